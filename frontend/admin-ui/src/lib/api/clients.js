@@ -8,4 +8,6 @@ export const clientsApi = {
   delete: (id) => request(`/clients/${id}`, { method: 'DELETE' }),
   regenerateToken: (id) => request(`/clients/${id}/regenerate-token`, { method: 'POST' }),
   listTypes: () => request('/clients/types'),
+  runs: (id, limit = 30) => request(`/clients/${id}/runs?limit=${limit}`),
+  run: (id) => request(`/clients/${id}/run`, { method: 'POST' }),
 }
@@ -1,17 +1,44 @@
 import { request } from './client.js'
+import { getAuthHeaders } from '../auth.js'
+
+function filterQuery(params) {
+  const query = new URLSearchParams()
+  if (params.agentId) query.set('agentId', params.agentId)
+  if (params.source) query.set('source', params.source)
+  if (params.clientId) query.set('clientId', params.clientId)
+  if (params.perspective) query.set('perspective', params.perspective)
+  if (params.q) query.set('q', params.q)
+  if (params.from) query.set('from', params.from)
+  if (params.to) query.set('to', params.to)
+  return query
+}
 
 export const conversationsApi = {
   list: (params = {}) => {
-    const query = new URLSearchParams()
-    if (params.agentId) query.set('agentId', params.agentId)
-    if (params.source) query.set('source', params.source)
-    if (params.clientId) query.set('clientId', params.clientId)
-    if (params.perspective) query.set('perspective', params.perspective)
+    const query = filterQuery(params)
     if (params.limit != null) query.set('limit', params.limit)
     if (params.offset != null) query.set('offset', params.offset)
     const qs = query.toString()
     return request(`/conversations${qs ? '?' + qs : ''}`)
   },
+  async export(format, params = {}) {
+    const query = filterQuery(params)
+    query.set('format', format)
+    const res = await fetch(`/api/v1/admin/conversations/export?${query}`, { headers: getAuthHeaders() })
+    if (!res.ok) {
+      const data = await res.json().catch(() => ({}))
+      throw new Error(data.error || `HTTP ${res.status}`)
+    }
+    const blob = await res.blob()
+    const cd = res.headers.get('content-disposition') || ''
+    const match = cd.match(/filename="?([^"]+)"?/)
+
+    const a = document.createElement('a')
+    a.href = URL.createObjectURL(blob)
+    a.download = match ? match[1] : 'magec-conversations'
+    a.click()
+    URL.revokeObjectURL(a.href)
+  },
   get: (id, params = {}) => {
     const query = new URLSearchParams()
     if (params.msgLimit != null) query.set('msgLimit', params.msgLimit)
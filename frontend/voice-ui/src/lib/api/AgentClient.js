@@ -11,6 +11,10 @@ export class AgentClient {
     this.appName = agentId
   }
 
+  setUser(userId) {
+    if (userId) this.userId = userId
+  }
+
   async createSession(sessionId) {
     try {
       const response = await fetch(`${this.baseUrl}/apps/${this.appName}/users/${this.userId}/sessions/${sessionId}`, {
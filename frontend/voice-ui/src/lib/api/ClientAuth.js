@@ -10,6 +10,7 @@ class ClientAuth {
   get token() { return this._token }
   get isPaired() { return !!this._clientInfo?.paired }
   get clientName() { return this._clientInfo?.name || '' }
+  get userId() { return this._clientInfo?.userId || '' }
   get defaultAgent() { return this._clientInfo?.defaultAgent || '' }
   get allowedAgents() { return this._clientInfo?.allowedAgents || [] }
 
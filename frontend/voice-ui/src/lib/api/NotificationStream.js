@@ -0,0 +1,80 @@
+const LAST_ID_KEY = 'magec_last_notification_id'
+
+// NotificationStream follows the server's notification stream for this
+// client (e.g. cron results delivered to the voice UI). It reconnects when
+// the stream ends and resumes after the last notification seen.
+export class NotificationStream {
+  constructor() {
+    this.onNotification = null
+
+    this.controller = null
+    this.stopped = false
+    this.reconnectDelay = 1000
+    this.maxReconnectDelay = 30000
+    this.lastId = Number(localStorage.getItem(LAST_ID_KEY)) || 0
+  }
+
+  start() {
+    this.stopped = false
+    this._connect()
+  }
+
+  stop() {
+    this.stopped = true
+    this.controller?.abort()
+  }
+
+  async _connect() {
+    if (this.stopped) return
+    this.controller = new AbortController()
+
+    try {
+      const res = await fetch(`/api/v1/client/notifications?after=${this.lastId}`, {
+        signal: this.controller.signal
+      })
+      if (!res.ok || !res.body) throw new Error(`status ${res.status}`)
+      this.reconnectDelay = 1000
+      await this._read(res.body)
+    } catch {
+      if (this.stopped) return
+      this.reconnectDelay = Math.min(this.reconnectDelay * 2, this.maxReconnectDelay)
+    }
+
+    if (!this.stopped) {
+      setTimeout(() => this._connect(), this.reconnectDelay)
+    }
+  }
+
+  async _read(body) {
+    const reader = body.getReader()
+    const decoder = new TextDecoder()
+    let buffer = ''
+
+    while (true) {
+      const { done, value } = await reader.read()
+      if (done) return
+      buffer += decoder.decode(value, { stream: true })
+
+      let end
+      while ((end = buffer.indexOf('\n\n')) !== -1) {
+        const block = buffer.slice(0, end)
+        buffer = buffer.slice(end + 2)
+        const data = block.split('\n')
+          .filter(line => line.startsWith('data: '))
+          .map(line => line.slice(6))
+          .join('\n')
+        if (data) this._handle(data)
+      }
+    }
+  }
+
+  _handle(data) {
+    try {
+      const notification = JSON.parse(data)
+      if (notification.id <= this.lastId) return
+      this.lastId = notification.id
+      localStorage.setItem(LAST_ID_KEY, String(notification.id))
+      this.onNotification?.(notification)
+    } catch {}
+  }
+}
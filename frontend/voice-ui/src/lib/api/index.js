@@ -1,2 +1,3 @@
 export { AgentClient } from './AgentClient.js'
 export { clientAuth } from './ClientAuth.js'
+export { NotificationStream } from './NotificationStream.js'
@@ -1,8 +1,15 @@
+import { getLanguage } from '../i18n/index.js'
+
+// WAV_HEADER_SIZE is the size of the header of the server's WAV streams.
+const WAV_HEADER_SIZE = 44
+
 export class OpenAITTS {
   constructor() {
-    this._audio = null
+    this._context = null
+    this._sources = []
     this._speaking = false
     this._abortController = null
+    this._resolvePlayback = null
     this._available = null
     this._agentId = 'default'
   }
@@ -15,6 +22,10 @@ export class OpenAITTS {
     return `/api/v1/voice/${this._agentId}/speech`
   }
 
+  _streamUrl() {
+    return `/api/v1/voice/${this._agentId}/speech/stream`
+  }
+
   async checkAvailable() {
     try {
       const response = await fetch(this._speechUrl(), {
@@ -44,6 +55,8 @@ export class OpenAITTS {
       .trim()
   }
 
+  // speak plays text through the speech stream, which synthesizes it
+  // sentence by sentence, so playback starts with the first sentence.
   async speak(text) {
     const cleanedText = this._cleanText(text)
     if (!cleanedText) return
@@ -52,10 +65,10 @@ export class OpenAITTS {
     this._abortController = new AbortController()
 
     try {
-      const response = await fetch(this._speechUrl(), {
+      const response = await fetch(this._streamUrl(), {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ input: cleanedText }),
+        body: JSON.stringify({ input: cleanedText, response_format: 'wav', language: getLanguage() }),
         signal: this._abortController.signal,
       })
 
@@ -64,12 +77,7 @@ export class OpenAITTS {
         throw new Error(`TTS request failed: ${response.status} ${error}`)
       }
 
-      const audioBlob = await response.blob()
-      const audioUrl = URL.createObjectURL(audioBlob)
-
-      await this._playAudio(audioUrl)
-
-      URL.revokeObjectURL(audioUrl)
+      await this._playStream(response.body.getReader())
     } catch (e) {
       if (e.name === 'AbortError') return
       this._speaking = false
@@ -77,29 +85,72 @@ export class OpenAITTS {
     }
   }
 
-  _playAudio(url) {
-    return new Promise((resolve, reject) => {
-      this._audio = new Audio(url)
-      this._speaking = true
-
-      this._audio.onended = () => {
-        this._speaking = false
-        this._audio = null
-        resolve()
+  // _playStream schedules 16-bit PCM from a WAV stream as it arrives and
+  // resolves when the last of it has been played.
+  async _playStream(reader) {
+    let header = null
+    let pending = new Uint8Array(0)
+    let nextTime = 0
+    this._speaking = true
+
+    const done = new Promise((resolve) => { this._resolvePlayback = resolve })
+
+    for (;;) {
+      const { value, done: ended } = await reader.read()
+      if (ended || !this._speaking) break
+
+      const merged = new Uint8Array(pending.length + value.length)
+      merged.set(pending)
+      merged.set(value, pending.length)
+      pending = merged
+
+      if (!header) {
+        if (pending.length < WAV_HEADER_SIZE) continue
+        const view = new DataView(pending.buffer)
+        header = { channels: view.getUint16(22, true), rate: view.getUint32(24, true) }
+        pending = pending.slice(WAV_HEADER_SIZE)
+        this._context = new AudioContext({ sampleRate: header.rate })
+        await this._context.resume()
+        if (!this._speaking) break
+        nextTime = this._context.currentTime
       }
 
-      this._audio.onerror = () => {
-        this._speaking = false
-        this._audio = null
-        reject(new Error('Audio playback failed'))
+      const frameSize = 2 * header.channels
+      const usable = pending.length - (pending.length % frameSize)
+      if (usable === 0) continue
+      const view = new DataView(pending.buffer, pending.byteOffset, usable)
+      const frames = usable / frameSize
+      const buffer = this._context.createBuffer(1, frames, header.rate)
+      const channel = buffer.getChannelData(0)
+      for (let i = 0; i < frames; i++) {
+        channel[i] = view.getInt16(i * frameSize, true) / 32768
       }
+      pending = pending.slice(usable)
+
+      const source = this._context.createBufferSource()
+      source.buffer = buffer
+      source.connect(this._context.destination)
+      nextTime = Math.max(nextTime, this._context.currentTime)
+      source.start(nextTime)
+      nextTime += buffer.duration
+      this._sources.push(source)
+    }
 
-      this._audio.play().catch((e) => {
-        this._speaking = false
-        this._audio = null
-        reject(e)
-      })
-    })
+    if (this._speaking && this._sources.length > 0) {
+      this._sources[this._sources.length - 1].onended = () => this._resolvePlayback?.()
+      await done
+    }
+    this._closeContext()
+    this._speaking = false
+  }
+
+  _closeContext() {
+    for (const source of this._sources) {
+      try { source.stop() } catch { /* not started yet */ }
+    }
+    this._sources = []
+    this._context?.close()
+    this._context = null
   }
 
   stop() {
@@ -108,12 +159,10 @@ export class OpenAITTS {
       this._abortController = null
     }
 
-    if (this._audio) {
-      this._audio.pause()
-      this._audio.currentTime = 0
-      this._audio = null
-    }
+    this._closeContext()
     this._speaking = false
+    this._resolvePlayback?.()
+    this._resolvePlayback = null
   }
 
   isSpeaking() {
@@ -8,12 +8,14 @@ export class VoiceEventsClient {
     this.onWakeword = null
     this.onSpeechStart = null
     this.onSpeechEnd = null
+    this.onInterrupt = null
     this.onCapabilities = null
     this.onError = null
 
     this.ws = null
     this.isConnected = false
     this.isLoaded = false
+    this.idleClosed = false
     this.reconnectAttempts = 0
     this.maxReconnectAttempts = 5
     this.reconnectDelay = 1000
@@ -39,15 +41,23 @@ export class VoiceEventsClient {
       }, 5000)
 
       try {
-        this.ws = new WebSocket(this.config.wsUrl)
+        // Browsers can't send headers with WebSockets: the token goes as a subprotocol
+        const protocols = this.config.token ? ['magec.voice', `bearer.${this.config.token}`] : undefined
+        this.ws = new WebSocket(this.config.wsUrl, protocols)
 
         this.ws.onopen = () => {
           this.isConnected = true
           this.reconnectAttempts = 0
+          if (this.sampleRate) this._sendConfig()
         }
 
         this.ws.onclose = (event) => {
           this.isConnected = false
+          // Closed while no audio was sent: reconnect when it comes again
+          if (event.reason === 'idle timeout') {
+            this.idleClosed = true
+            return
+          }
           if (this.isLoaded) {
             this._attemptReconnect()
           }
@@ -96,6 +106,9 @@ export class VoiceEventsClient {
         case 'speech_end':
           this.onSpeechEnd?.()
           break
+        case 'interrupt':
+          this.onInterrupt?.()
+          break
         case 'error':
           this.onError?.(msg.data)
           break
@@ -167,6 +180,15 @@ export class VoiceEventsClient {
     this.activeWakeword = modelId
   }
 
+  setPlaying(playing) {
+    if (!this.isConnected || this.ws?.readyState !== WebSocket.OPEN) return
+
+    this.ws.send(JSON.stringify({
+      type: 'playing',
+      data: { playing }
+    }))
+  }
+
   getActivePhrase() {
     const model = this.wakewordModels.find(m => m.id === this.activeWakeword)
     return model?.phrase || this.activeWakeword
@@ -181,6 +203,10 @@ export class VoiceEventsClient {
   }
 
   async processAudio(audioData, inputSampleRate) {
+    if (this.idleClosed && this.isLoaded) {
+      this.idleClosed = false
+      this.load().catch(() => {})
+    }
     if (!this.isConnected) return
 
     if (inputSampleRate !== this.sampleRate) {
@@ -12,6 +12,10 @@ export class SessionService {
     this.appName = agentId
   }
 
+  setUser(userId) {
+    if (userId) this.userId = userId
+  }
+
   async listSessions() {
     try {
       const response = await fetch(`${this.baseUrl}/apps/${this.appName}/users/${this.userId}/sessions`)
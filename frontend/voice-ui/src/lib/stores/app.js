@@ -1,7 +1,7 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { CONFIG } from '../config.js'
-import { clientAuth, AgentClient } from '../api/index.js'
+import { clientAuth, AgentClient, NotificationStream } from '../api/index.js'
 import { SessionManager, SessionService } from '../session/index.js'
 import { SettingsManager } from '../settings/SettingsManager.js'
 import { AudioCapture, AudioRecorder, VoiceEventsClient, FeedbackSound, OpenAITTS } from '../audio/index.js'
@@ -48,12 +48,14 @@ export const useAppStore = defineStore('app', () => {
   let audioCapture = null
   let audioRecorder = null
   let voiceEvents = null
+  let notificationStream = null
   let transcriber = null
   let feedbackSound = null
   let tts = null
   let wakeLock = null
   let prevWakeWordEnabled = true
   let recordingTimeout = null
+  let interrupted = false
 
   async function init() {
     initLanguage()
@@ -104,6 +106,8 @@ export const useAppStore = defineStore('app', () => {
     agentClient = new AgentClient()
     sessionManager = new SessionManager()
     sessionService = new SessionService()
+    agentClient.setUser(clientAuth.userId)
+    sessionService.setUser(clientAuth.userId)
 
     selectedAgent.value = clientAuth.defaultAgent || null
     allowedAgents.value = clientAuth.allowedAgents || []
@@ -122,6 +126,7 @@ export const useAppStore = defineStore('app', () => {
     wakeWordEnabled.value = settings.wakeWordEnabled
 
     await _checkTTSAvailability()
+    _initNotificationStream()
     await _initVoiceEvents()
     await _initSession()
     _setReady()
@@ -138,17 +143,28 @@ export const useAppStore = defineStore('app', () => {
     }
   }
 
+  function _initNotificationStream() {
+    notificationStream = new NotificationStream()
+    notificationStream.onNotification = (n) => addNotification('info', n.message, n.title)
+    notificationStream.start()
+  }
+
   async function _initVoiceEvents() {
     setStatus(t('status.loadingWakeWord'), 'loading')
     showLoadingNotification('wakeword', t('notifications.wakeWordLoading'))
 
     try {
-      const ve = new VoiceEventsClient()
+      const ve = new VoiceEventsClient({ token: clientAuth.token })
 
       ve.onWakeword = () => {
         if (wakeWordEnabled.value) startRecording()
       }
       ve.onSpeechStart = () => {}
+      ve.onInterrupt = () => {
+        interrupted = true
+        tts?.stop()
+        if (ve.isVADEnabled()) startRecording()
+      }
       ve.onSpeechEnd = () => {
         if (isRecording.value && ve.isVADEnabled()) {
           stopRecording()
@@ -376,14 +392,18 @@ export const useAppStore = defineStore('app', () => {
     setStatus(t('status.ready'), 'listening')
     refreshSessionList()
 
+    interrupted = false
     for (const response of responses) {
       messages.value.push({ role: 'ai', text: response })
-      if (ttsEnabled.value) {
+      if (ttsEnabled.value && !interrupted) {
+        voiceEvents?.setPlaying(true)
         try {
           await tts.speak(response)
         } catch {
           tts?.stop()
           addNotification('warning', t('errors.ttsUnavailable'))
+        } finally {
+          voiceEvents?.setPlaying(false)
         }
       }
     }
@@ -495,10 +515,11 @@ export const useAppStore = defineStore('app', () => {
     navigator.clipboard.writeText(text)
   }
 
-  function addNotification(type, message) {
+  function addNotification(type, message, title = '') {
     notifications.value.unshift({
       id: ++notificationId,
       type,
+      title,
       message,
       timestamp: new Date()
     })
@@ -14,7 +14,7 @@ import (
 
 // backupDownload streams a .tar.gz of the entire data/ directory.
 // @Summary      Download backup
-// @Description  Streams a .tar.gz archive containing the entire data directory (store.json, conversations.json, skills files).
+// @Description  Streams a .tar.gz archive containing the entire data directory (store.json, conversations.db, skills files). A SQLite conversation log is copied with VACUUM INTO, so the archive holds a consistent snapshot. A Postgres conversation log is not included; back it up with pg_dump.
 // @Tags         backup
 // @Produce      application/gzip
 // @Success      200  {file}    binary  "Backup archive"
@@ -28,6 +28,24 @@ func (h *Handler) backupDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The live SQLite file may be mid-transaction, so archive a snapshot of
+	// it instead, together with none of its journal files.
+	var dbFile, dbSnapshot string
+	if h.conversations != nil && h.conversations.File() != "" {
+		dbFile, _ = filepath.Abs(h.conversations.File())
+		tmpDir, err := os.MkdirTemp("", "magec-backup-")
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to create temp dir: "+err.Error())
+			return
+		}
+		defer os.RemoveAll(tmpDir)
+		dbSnapshot = filepath.Join(tmpDir, "conversations.db")
+		if err := h.conversations.Snapshot(dbSnapshot); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	ts := time.Now().UTC().Format("20060102-150405")
 	filename := fmt.Sprintf("magec-backup-%s.tar.gz", ts)
 
@@ -52,6 +70,18 @@ func (h *Handler) backupDownload(w http.ResponseWriter, r *http.Request) {
 			return nil
 		}
 
+		if dbFile != "" {
+			switch abs, _ := filepath.Abs(path); abs {
+			case dbFile + "-journal", dbFile + "-wal", dbFile + "-shm":
+				return nil
+			case dbFile:
+				if info, err = os.Stat(dbSnapshot); err != nil {
+					return err
+				}
+				path = dbSnapshot
+			}
+		}
+
 		header, err := tar.FileInfoHeader(info, "")
 		if err != nil {
 			return err
@@ -186,6 +216,10 @@ func (h *Handler) backupRestore(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusInternalServerError, "data restored but conversations reload failed: "+err.Error())
 			return
 		}
+		if _, err := h.conversations.ImportLegacyJSON(filepath.Join(dataDir, "conversations.json")); err != nil {
+			writeError(w, http.StatusInternalServerError, "data restored but legacy conversations import failed: "+err.Error())
+			return
+		}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "restored"})
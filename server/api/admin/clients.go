@@ -2,11 +2,14 @@ package admin
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/gorilla/mux"
 
 	"github.com/achetronic/magec/server/clients"
+	"github.com/achetronic/magec/server/clients/cron"
+	"github.com/achetronic/magec/server/clients/webhook"
 	"github.com/achetronic/magec/server/store"
 )
 
@@ -185,6 +188,22 @@ func (h *Handler) listClientTypes(w http.ResponseWriter, r *http.Request) {
 }
 
 func validateClientConfig(c store.ClientDefinition) error {
+	if err := c.Retention.Validate(); err != nil {
+		return err
+	}
+	if err := c.Voice.Validate(); err != nil {
+		return err
+	}
+	if c.Type == "cron" && c.Config.Cron != nil {
+		if _, err := cron.ParseClient(c.Config.Cron); err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+	}
+	if c.Type == "webhook" && c.Config.Webhook != nil {
+		if err := webhook.ValidateConfig(c.Config.Webhook); err != nil {
+			return err
+		}
+	}
 	raw, err := json.Marshal(c.Config)
 	if err != nil {
 		return nil
@@ -2,8 +2,13 @@ package admin
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"google.golang.org/adk/session"
@@ -13,16 +18,21 @@ import (
 
 // listConversations returns a paginated list of conversation audit logs.
 // @Summary      List conversations
-// @Description  Returns a paginated list of conversation audit logs, newest first. Filters by agent, source, or client.
+// @Description  Returns a paginated list of conversation audit logs, newest first. Filters by agent, source, client, perspective, start time range, or full-text search. Search results carry highlighted snippets of the matching messages.
 // @Tags         conversations
 // @Produce      json
 // @Param        agentId   query     string  false  "Filter by agent or flow ID"
 // @Param        source    query     string  false  "Filter by source (voice-ui, telegram, executor, direct, cron, webhook)"
 // @Param        clientId  query     string  false  "Filter by client ID"
 // @Param        perspective query  string  false  "Filter by perspective (admin, user)"
+// @Param        from      query     string  false  "Only conversations started at or after this time (RFC 3339)"
+// @Param        to        query     string  false  "Only conversations started before this time (RFC 3339)"
+// @Param        q         query     string  false  "Full-text search over message content, tool names and tool args. Words are ANDed; use double quotes for phrases"
 // @Param        limit     query     int     false  "Max items to return (default 30, 0 for all)"
 // @Param        offset    query     int     false  "Items to skip (default 0)"
 // @Success      200  {object}  store.PaginatedResult[store.Conversation]
+// @Failure      400  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
 // @Security     AdminAuth
 // @Router       /conversations [get]
 func (h *Handler) listConversations(w http.ResponseWriter, r *http.Request) {
@@ -34,17 +44,225 @@ func (h *Handler) listConversations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	agentID := r.URL.Query().Get("agentId")
-	source := r.URL.Query().Get("source")
-	clientID := r.URL.Query().Get("clientId")
-	perspective := r.URL.Query().Get("perspective")
+	filter, err := conversationFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	limit := queryInt(r, "limit", 30)
 	offset := queryInt(r, "offset", 0)
 
-	result := h.conversations.List(agentID, source, clientID, perspective, limit, offset)
+	result, err := h.conversations.ListFiltered(filter, limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	writeJSON(w, http.StatusOK, result)
 }
 
+// exportConversations streams the conversations matching the list filters.
+// @Summary      Export conversations
+// @Description  Streams every conversation matching the filters, oldest first. Formats: jsonl (one Conversation per line), markdown (readable transcripts) and openai (chat fine-tuning dataset, one {"messages": [...]} per line, tool calls included).
+// @Tags         conversations
+// @Produce      application/x-ndjson
+// @Produce      text/markdown
+// @Param        format      query  string  false  "jsonl (default), markdown or openai"
+// @Param        rawEvents   query  bool    false  "Include raw ADK events (jsonl only)"
+// @Param        agentId     query  string  false  "Filter by agent or flow ID"
+// @Param        source      query  string  false  "Filter by source"
+// @Param        clientId    query  string  false  "Filter by client ID"
+// @Param        perspective query  string  false  "Filter by perspective (admin, user)"
+// @Param        from        query  string  false  "Only conversations started at or after this time (RFC 3339)"
+// @Param        to          query  string  false  "Only conversations started before this time (RFC 3339)"
+// @Param        q           query  string  false  "Full-text search"
+// @Success      200  {file}    binary  "Export file"
+// @Failure      400  {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /conversations/export [get]
+func (h *Handler) exportConversations(w http.ResponseWriter, r *http.Request) {
+	if h.conversations == nil {
+		writeError(w, http.StatusNotFound, "conversation store not initialized")
+		return
+	}
+
+	filter, err := conversationFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	var write func(io.Writer, store.Conversation) error
+	var contentType, ext string
+	switch format {
+	case "jsonl":
+		write, contentType, ext = writeConversationJSONL, "application/x-ndjson", "jsonl"
+	case "markdown":
+		write, contentType, ext = writeConversationMarkdown, "text/markdown; charset=utf-8", "md"
+	case "openai":
+		write, contentType, ext = writeConversationOpenAI, "application/x-ndjson", "jsonl"
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q (use jsonl, markdown or openai)", format))
+		return
+	}
+	withEvents, _ := strconv.ParseBool(r.URL.Query().Get("rawEvents"))
+	withEvents = withEvents && format == "jsonl"
+
+	ts := time.Now().UTC().Format("20060102-150405")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="magec-conversations-%s.%s"`, ts, ext))
+
+	// Large exports outlive the admin server's write timeout.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	err = h.conversations.Each(filter, withEvents, func(c store.Conversation) error {
+		if err := write(w, c); err != nil {
+			return err
+		}
+		rc.Flush()
+		return r.Context().Err()
+	})
+	if err != nil && r.Context().Err() == nil {
+		slog.Warn("Conversation export aborted", "error", err)
+	}
+}
+
+func writeConversationJSONL(w io.Writer, c store.Conversation) error {
+	return json.NewEncoder(w).Encode(c)
+}
+
+func writeConversationMarkdown(w io.Writer, c store.Conversation) error {
+	var b strings.Builder
+	title := c.AgentName
+	if title == "" {
+		title = c.AgentID
+	}
+	fmt.Fprintf(&b, "# %s — %s\n\n", title, c.StartedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- **ID:** %s\n", c.ID)
+	fmt.Fprintf(&b, "- **Source:** %s\n", c.Source)
+	if c.ClientName != "" {
+		fmt.Fprintf(&b, "- **Client:** %s\n", c.ClientName)
+	}
+	if c.UserID != "" {
+		fmt.Fprintf(&b, "- **User:** %s\n", c.UserID)
+	}
+	if c.Perspective != "" {
+		fmt.Fprintf(&b, "- **Perspective:** %s\n", c.Perspective)
+	}
+	b.WriteString("\n")
+	if c.Summary != "" {
+		fmt.Fprintf(&b, "> %s\n\n", strings.ReplaceAll(c.Summary, "\n", "\n> "))
+	}
+
+	for _, m := range c.Messages {
+		role := m.Role
+		if m.Agent != "" && m.Role != "user" {
+			role += " (" + m.Agent + ")"
+		}
+		fmt.Fprintf(&b, "## %s\n\n", role)
+		if text := store.StripMagecComments(m.Content); text != "" {
+			b.WriteString(text + "\n\n")
+		}
+		for _, tc := range m.ToolCalls {
+			if tc.Result != nil {
+				fmt.Fprintf(&b, "**Tool result** `%s`\n\n```json\n%s\n```\n\n", tc.Name, markdownJSON(tc.Result))
+			} else {
+				fmt.Fprintf(&b, "**Tool call** `%s`\n\n```json\n%s\n```\n\n", tc.Name, markdownJSON(tc.Args))
+			}
+		}
+	}
+	b.WriteString("---\n\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownJSON(v interface{}) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// openAIMessage is a message in the OpenAI chat fine-tuning format.
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// writeConversationOpenAI writes one {"messages": [...]} line. Tool calls
+// become assistant tool_calls and their results "tool" messages linked by a
+// generated call ID, matched to the oldest pending call with the same name.
+// System messages are notes Magec added after the fact, such as cron
+// delivery outcomes; the model never saw them, so they are left out.
+func writeConversationOpenAI(w io.Writer, c store.Conversation) error {
+	var msgs []openAIMessage
+	pending := map[string][]string{}
+	next := 0
+
+	for _, m := range c.Messages {
+		if m.Role == "system" {
+			continue
+		}
+		text := store.StripMagecComments(m.Content)
+		role := "assistant"
+		if m.Role == "user" {
+			role = "user"
+		}
+
+		out := openAIMessage{Role: role, Content: text}
+		var results []openAIMessage
+		for _, tc := range m.ToolCalls {
+			if tc.Result != nil {
+				var id string
+				if ids := pending[tc.Name]; len(ids) > 0 {
+					id, pending[tc.Name] = ids[0], ids[1:]
+				} else {
+					id = fmt.Sprintf("call_%d", next)
+					next++
+				}
+				content, _ := json.Marshal(tc.Result)
+				results = append(results, openAIMessage{Role: "tool", Content: string(content), ToolCallID: id})
+				continue
+			}
+			call := openAIToolCall{ID: fmt.Sprintf("call_%d", next), Type: "function"}
+			next++
+			call.Function.Name = tc.Name
+			args, _ := json.Marshal(tc.Args)
+			if tc.Args == nil {
+				args = []byte("{}")
+			}
+			call.Function.Arguments = string(args)
+			out.ToolCalls = append(out.ToolCalls, call)
+			pending[tc.Name] = append(pending[tc.Name], call.ID)
+		}
+
+		if out.Content != "" || len(out.ToolCalls) > 0 {
+			msgs = append(msgs, out)
+		}
+		msgs = append(msgs, results...)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return json.NewEncoder(w).Encode(map[string]interface{}{"messages": msgs})
+}
+
 // getConversation returns a single conversation with paginated messages.
 // @Summary      Get conversation
 // @Description  Returns a conversation by ID with paginated messages (latest first). Includes totalMessages for client-side pagination.
@@ -128,6 +346,7 @@ func (h *Handler) clearConversations(w http.ResponseWriter, r *http.Request) {
 // @Tags         conversations
 // @Produce      json
 // @Success      200  {object}  map[string]interface{}  "total, bySources, byAgents"
+// @Failure      500  {object}  ErrorResponse
 // @Security     AdminAuth
 // @Router       /conversations/stats [get]
 func (h *Handler) conversationStats(w http.ResponseWriter, r *http.Request) {
@@ -136,24 +355,38 @@ func (h *Handler) conversationStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	all := h.conversations.List("", "", "", "", 0, 0)
+	stats, err := h.conversations.Stats()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
 
-	sourceCount := map[string]int{}
-	agentCount := map[string]int{}
-	for _, c := range all.Items {
-		sourceCount[c.Source]++
-		if c.AgentName != "" {
-			agentCount[c.AgentName]++
-		} else {
-			agentCount[c.AgentID]++
-		}
+// pruneConversations applies the retention policies now.
+// @Summary      Apply retention policies
+// @Description  Deletes conversations and raw events that fall outside the global and per-client retention policies. With dryRun=true nothing is deleted and the report shows what would be.
+// @Tags         conversations
+// @Produce      json
+// @Param        dryRun  query     bool  false  "Only report what would be deleted"
+// @Success      200     {object}  store.RetentionReport
+// @Failure      500     {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /conversations/prune [post]
+func (h *Handler) pruneConversations(w http.ResponseWriter, r *http.Request) {
+	if h.conversations == nil {
+		writeError(w, http.StatusNotFound, "conversation store not initialized")
+		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"total":     all.Total,
-		"bySources": sourceCount,
-		"byAgents":  agentCount,
-	})
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	global, clients := h.store.RetentionPolicies()
+	report, err := h.conversations.ApplyRetention(global, clients, time.Now(), dryRun)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
 }
 
 // updateConversationSummary sets or updates the summary for a conversation.
@@ -276,6 +509,39 @@ func (h *Handler) findPerspectivePair(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]interface{}{"pairId": pair.ID})
 }
 
+// conversationFilter reads the conversation filters shared by list and
+// export from the query string.
+func conversationFilter(r *http.Request) (store.ConversationFilter, error) {
+	filter := store.ConversationFilter{
+		AgentID:     r.URL.Query().Get("agentId"),
+		Source:      r.URL.Query().Get("source"),
+		ClientID:    r.URL.Query().Get("clientId"),
+		Perspective: r.URL.Query().Get("perspective"),
+		Query:       r.URL.Query().Get("q"),
+	}
+	var err error
+	if filter.From, err = queryTime(r, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = queryTime(r, "to"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// queryTime parses an optional RFC 3339 timestamp query parameter.
+func queryTime(r *http.Request, key string) (time.Time, error) {
+	s := r.URL.Query().Get(key)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected RFC 3339 timestamp", key)
+	}
+	return t, nil
+}
+
 func queryInt(r *http.Request, key string, defaultVal int) int {
 	s := r.URL.Query().Get(key)
 	if s == "" {
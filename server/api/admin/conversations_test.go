@@ -0,0 +1,203 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+func newExportHandler(t *testing.T) *Handler {
+	t.Helper()
+	s, err := store.New(filepath.Join(t.TempDir(), "store.json"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := store.NewConversationStore(store.ConversationBackendSQLite, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.Close() })
+
+	started := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	convos := []store.Conversation{
+		{
+			ID:          "weather",
+			AgentID:     "helper",
+			AgentName:   "Helper",
+			Source:      "telegram",
+			UserID:      "u1",
+			Perspective: "admin",
+			StartedAt:   started,
+			Messages: []store.ConversationMessage{
+				{Role: "user", Content: "<!--MAGEC_META:{\"source\":\"telegram\"}:MAGEC_META-->\nWeather in Madrid?"},
+				{Role: "assistant", Agent: "helper", ToolCalls: []store.ToolCallInfo{{Name: "get_forecast", Args: map[string]any{"city": "Madrid"}}}},
+				{Role: "assistant", Agent: "helper", ToolCalls: []store.ToolCallInfo{{Name: "get_forecast", Result: map[string]any{"temp": 21}}}},
+				{Role: "assistant", Agent: "helper", Content: "Sunny, 21°C."},
+				{Role: "system", Content: "Delivered to telegram"},
+			},
+			RawEvents: []interface{}{map[string]interface{}{"id": "e1"}},
+		},
+		{
+			ID:        "greeting",
+			AgentID:   "helper",
+			Source:    "cron",
+			StartedAt: started.Add(time.Hour),
+			Messages: []store.ConversationMessage{
+				{Role: "user", Content: "Say hi"},
+				{Role: "assistant", Content: "Hi!"},
+			},
+		},
+	}
+	for _, c := range convos {
+		if _, err := cs.Append(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := New(s)
+	h.SetConversationStore(cs)
+	return h
+}
+
+func export(t *testing.T, h *Handler, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/conversations/export?"+query, nil))
+	return rec
+}
+
+func jsonLines(t *testing.T, body string) []json.RawMessage {
+	t.Helper()
+	var lines []json.RawMessage
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		lines = append(lines, json.RawMessage(sc.Text()))
+	}
+	return lines
+}
+
+func TestExportJSONL(t *testing.T) {
+	h := newExportHandler(t)
+
+	rec := export(t, h, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasSuffix(cd, `.jsonl"`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	lines := jsonLines(t, rec.Body.String())
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var first store.Conversation
+	if err := json.Unmarshal(lines[0], &first); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != "weather" || len(first.Messages) != 5 || first.UserID != "u1" {
+		t.Errorf("first line = %s, %d messages, user %q", first.ID, len(first.Messages), first.UserID)
+	}
+	if first.RawEvents != nil {
+		t.Error("raw events exported without rawEvents=true")
+	}
+
+	lines = jsonLines(t, export(t, h, "rawEvents=true&source=telegram").Body.String())
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines for source=telegram, want 1", len(lines))
+	}
+	var withEvents store.Conversation
+	json.Unmarshal(lines[0], &withEvents)
+	if len(withEvents.RawEvents) != 1 {
+		t.Errorf("got %d raw events, want 1", len(withEvents.RawEvents))
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	h := newExportHandler(t)
+
+	rec := export(t, h, "format=markdown&source=telegram")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/markdown; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# Helper — 2026-03-01T09:00:00Z\n",
+		"- **ID:** weather\n",
+		"- **User:** u1\n",
+		"## user\n\nWeather in Madrid?\n\n",
+		"## assistant (helper)\n\n**Tool call** `get_forecast`\n\n```json\n{\n  \"city\": \"Madrid\"\n}\n```",
+		"**Tool result** `get_forecast`\n\n```json\n{\n  \"temp\": 21\n}\n```",
+		"## assistant (helper)\n\nSunny, 21°C.\n\n",
+		"## system\n\nDelivered to telegram\n\n",
+		"---\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "MAGEC_META") {
+		t.Error("markdown contains the metadata comment")
+	}
+}
+
+func TestExportOpenAI(t *testing.T) {
+	h := newExportHandler(t)
+
+	rec := export(t, h, "format=openai")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	lines := jsonLines(t, rec.Body.String())
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+
+	var got struct {
+		Messages []openAIMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(lines[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	call := openAIToolCall{ID: "call_0", Type: "function"}
+	call.Function.Name = "get_forecast"
+	call.Function.Arguments = `{"city":"Madrid"}`
+	want := []openAIMessage{
+		{Role: "user", Content: "Weather in Madrid?"},
+		{Role: "assistant", ToolCalls: []openAIToolCall{call}},
+		{Role: "tool", Content: `{"temp":21}`, ToolCallID: "call_0"},
+		{Role: "assistant", Content: "Sunny, 21°C."},
+	}
+	if !reflect.DeepEqual(got.Messages, want) {
+		t.Errorf("messages = %+v\nwant %+v", got.Messages, want)
+	}
+
+	json.Unmarshal(lines[1], &got)
+	if len(got.Messages) != 2 || got.Messages[0].Role != "user" || got.Messages[1].Role != "assistant" {
+		t.Errorf("second conversation = %+v", got.Messages)
+	}
+}
+
+func TestExportUnsupportedFormat(t *testing.T) {
+	h := newExportHandler(t)
+	if rec := export(t, h, "format=csv"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if rec := export(t, h, "from=yesterday"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d for a bad time, want 400", rec.Code)
+	}
+}
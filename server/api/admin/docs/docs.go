@@ -821,6 +821,110 @@ const docTemplate = `{
                 }
             }
         },
+        "/clients/{id}/run": {
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Runs a cron client's command outside its schedule. The run continues in the background; poll the run history for its outcome. Results are delivered like scheduled runs.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "clients"
+                ],
+                "summary": "Run client now",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/store.ClientRun"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/clients/{id}/runs": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Returns the run history of a cron client, newest first: trigger (schedule, catchup, manual), scheduled slot, start and end times, status (running, success, error, missed) and a response excerpt.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "clients"
+                ],
+                "summary": "List client runs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Max items to return (default 30, 0 for all)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Items to skip (default 0)",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.PaginatedResult-store_ClientRun"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/commands": {
             "get": {
                 "security": [
@@ -1033,7 +1137,7 @@ const docTemplate = `{
                         "AdminAuth": []
                     }
                 ],
-                "description": "Returns a paginated list of conversation audit logs, newest first. Filters by agent, source, or client.",
+                "description": "Returns a paginated list of conversation audit logs, newest first. Filters by agent, source, client, perspective, start time range, or full-text search. Search results carry highlighted snippets of the matching messages.",
                 "produces": [
                     "application/json"
                 ],
@@ -1066,6 +1170,24 @@ const docTemplate = `{
                         "name": "perspective",
                         "in": "query"
                     },
+                    {
+                        "type": "string",
+                        "description": "Only conversations started at or after this time (RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only conversations started before this time (RFC 3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Full-text search over message content, tool names and tool args. Words are ANDed; use double quotes for phrases",
+                        "name": "q",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
                         "description": "Max items to return (default 30, 0 for all)",
@@ -1085,6 +1207,18 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/store.PaginatedResult-store_Conversation"
                         }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
                     }
                 }
             }
@@ -1114,6 +1248,133 @@ const docTemplate = `{
                 }
             }
         },
+        "/conversations/export": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Streams every conversation matching the filters, oldest first. Formats: jsonl (one Conversation per line), markdown (readable transcripts) and openai (chat fine-tuning dataset, one {\"messages\": [...]} per line, tool calls included).",
+                "produces": [
+                    "application/x-ndjson",
+                    "text/markdown"
+                ],
+                "tags": [
+                    "conversations"
+                ],
+                "summary": "Export conversations",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "jsonl (default), markdown or openai",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include raw ADK events (jsonl only)",
+                        "name": "rawEvents",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by agent or flow ID",
+                        "name": "agentId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by source",
+                        "name": "source",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by client ID",
+                        "name": "clientId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by perspective (admin, user)",
+                        "name": "perspective",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only conversations started at or after this time (RFC 3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only conversations started before this time (RFC 3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Full-text search",
+                        "name": "q",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Export file",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/conversations/prune": {
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Deletes conversations and raw events that fall outside the global and per-client retention policies. With dryRun=true nothing is deleted and the report shows what would be.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "conversations"
+                ],
+                "summary": "Apply retention policies",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Only report what would be deleted",
+                        "name": "dryRun",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.RetentionReport"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/conversations/stats": {
             "get": {
                 "security": [
@@ -1136,6 +1397,12 @@ const docTemplate = `{
                             "type": "object",
                             "additionalProperties": true
                         }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
                     }
                 }
             }
@@ -2237,7 +2504,7 @@ const docTemplate = `{
                         "AdminAuth": []
                     }
                 ],
-                "description": "Returns the global settings (session provider, long-term memory provider).",
+                "description": "Returns the global settings (session provider, long-term memory provider, conversation retention).",
                 "produces": [
                     "application/json"
                 ],
@@ -2311,7 +2578,7 @@ const docTemplate = `{
                         "AdminAuth": []
                     }
                 ],
-                "description": "Streams a .tar.gz archive containing the entire data directory (store.json, conversations.json, skills files).",
+                "description": "Streams a .tar.gz archive containing the entire data directory (store.json, conversations.db, skills files). A SQLite conversation log is copied with VACUUM INTO, so the archive holds a consistent snapshot. A Postgres conversation log is not included; back it up with pg_dump.",
                 "produces": [
                     "application/gzip"
                 ],
@@ -2741,37 +3008,1037 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "admin.ClientTypeInfo": {
-            "type": "object",
-            "properties": {
-                "configSchema": {
-                    "$ref": "#/definitions/clients.Schema"
-                },
-                "displayName": {
-                    "type": "string",
-                    "example": "Telegram"
-                },
-                "type": {
-                    "type": "string",
-                    "example": "telegram"
-                }
-            }
-        },
-        "admin.ErrorResponse": {
-            "type": "object",
-            "properties": {
-                "error": {
-                    "type": "string",
-                    "example": "resource not found"
-                }
-            }
         },
-        "admin.MemoryTypeInfo": {
-            "type": "object",
-            "properties": {
+        "/users": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Returns all Magec users with their linked external identities",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "List users",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/store.User"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Creates a new user, optionally with an initial set of identities",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Create user",
+                "parameters": [
+                    {
+                        "description": "User definition",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.User"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/store.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Returns a user by its unique ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.User"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Updates a user's name. Identities are managed with the link, unlink and merge endpoints.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Update user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User definition",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.User"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Deletes a user. Its identities resolve to new users on their next message.",
+                "tags": [
+                    "users"
+                ],
+                "summary": "Delete user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/identities": {
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Links an external identity (telegram, slack, discord, matrix, mattermost, email or client) to a user. If the identity belongs to another user it is moved.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Link identity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Identity",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.Identity"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/identities/{provider}/{externalId}": {
+            "delete": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Detaches an external identity from a user. The next message from that identity creates a new user.",
+                "tags": [
+                    "users"
+                ],
+                "summary": "Unlink identity",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Identity provider",
+                        "name": "provider",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "External ID",
+                        "name": "externalId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/merge": {
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Moves every identity of the source user into the target user and deletes the source. The source's ADK sessions, long-term memories and logged conversations are moved to the target.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Merge users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Target user ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Source user",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.MergeUsersRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/voiceprint": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Returns whether a user has enrolled their voice for speaker identification, with which model and how many samples",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get voiceprint",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.VoiceprintResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Enrolls a user for speaker identification with a few WAV samples of their voice (16-bit PCM, a few seconds of speech each). Samples add to the existing voiceprint unless reset is true. Requires a speaker embedding model in the data directory.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Enroll voice",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "WAV sample (repeat the field for several samples)",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Replace the existing voiceprint instead of adding to it",
+                        "name": "reset",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.VoiceprintResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Removes the enrolled voice of a user, who is no longer recognized by speaker identification",
+                "tags": [
+                    "users"
+                ],
+                "summary": "Delete voiceprint",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/voice/connections": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Returns the open connections of the voice events WebSocket (total, with a voice session, per client ID and without a client token) and, since the server started, how many were accepted, refused for their origin or the per-client limit, and closed for idling. All zero when voice detection is not enabled.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "voice"
+                ],
+                "summary": "Voice connections",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/voice.ConnectionStats"
+                        }
+                    }
+                }
+            }
+        },
+        "/voices": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Returns the Piper voices used by local TTS backends",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "voices"
+                ],
+                "summary": "List voices",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/store.TTSVoice"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Uploads a Piper voice: the .onnx model and its .onnx.json config. Language, sample rate and speakers are read from the config",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "voices"
+                ],
+                "summary": "Upload voice",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Piper .onnx model",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "Piper .onnx.json config",
+                        "name": "config",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name agents use to pick the voice (defaults to the model file name)",
+                        "name": "name",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Speaker of a multi-speaker voice (defaults to the first)",
+                        "name": "speaker",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/store.TTSVoice"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/voices/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Returns a voice by its unique ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "voices"
+                ],
+                "summary": "Get voice",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Voice ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.TTSVoice"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Updates the name and speaker of a voice. The model and its config are kept",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "voices"
+                ],
+                "summary": "Update voice",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Voice ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Voice definition",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.TTSVoice"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.TTSVoice"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Deletes a voice, its model and its config",
+                "tags": [
+                    "voices"
+                ],
+                "summary": "Delete voice",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Voice ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/wakewords": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Returns the custom wake word models. Built-in models are not included",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "wakewords"
+                ],
+                "summary": "List wake words",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/store.WakeWord"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Uploads an openWakeWord ONNX model. The model is test-loaded first and rejected if ONNX Runtime cannot load it. It is loaded by the voice detectors without a restart",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "wakewords"
+                ],
+                "summary": "Upload wake word",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "openWakeWord .onnx model",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Display name",
+                        "name": "name",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Phrase to say (defaults to the name)",
+                        "name": "phrase",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Detection threshold (default 0.5)",
+                        "name": "threshold",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/store.WakeWord"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/wakewords/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Returns a custom wake word by its unique ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "wakewords"
+                ],
+                "summary": "Get wake word",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Wake word ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.WakeWord"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Updates the name, phrase and threshold of a custom wake word. The model is kept",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "wakewords"
+                ],
+                "summary": "Update wake word",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Wake word ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Wake word definition",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/store.WakeWord"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/store.WakeWord"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Deletes a custom wake word and its model file",
+                "tags": [
+                    "wakewords"
+                ],
+                "summary": "Delete wake word",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Wake word ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "admin.ClientTypeInfo": {
+            "type": "object",
+            "properties": {
+                "configSchema": {
+                    "$ref": "#/definitions/clients.Schema"
+                },
+                "displayName": {
+                    "type": "string",
+                    "example": "Telegram"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "telegram"
+                }
+            }
+        },
+        "admin.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "resource not found"
+                }
+            }
+        },
+        "admin.MemoryTypeInfo": {
+            "type": "object",
+            "properties": {
                 "categories": {
                     "type": "array",
                     "items": {
@@ -2794,6 +4061,15 @@ const docTemplate = `{
                 }
             }
         },
+        "admin.MergeUsersRequest": {
+            "type": "object",
+            "properties": {
+                "sourceId": {
+                    "type": "string",
+                    "example": "a1b2c3d4-e5f6-7a8b-9c0d-1e2f3a4b5c6d"
+                }
+            }
+        },
         "admin.SecretCreateRequest": {
             "type": "object",
             "properties": {
@@ -2857,6 +4133,23 @@ const docTemplate = `{
                 }
             }
         },
+        "admin.VoiceprintResponse": {
+            "type": "object",
+            "properties": {
+                "model": {
+                    "type": "string",
+                    "example": "3dspeaker_speech_campplus_sv_en_voxceleb_16k.onnx"
+                },
+                "samples": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "a1b2c3d4-e5f6-7a8b-9c0d-1e2f3a4b5c6d"
+                }
+            }
+        },
         "clients.Schema": {
             "type": "object",
             "additionalProperties": true
@@ -2943,6 +4236,12 @@ const docTemplate = `{
                 "apiKey": {
                     "type": "string"
                 },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "id": {
                     "type": "string"
                 },
@@ -2963,6 +4262,12 @@ const docTemplate = `{
                 "backend": {
                     "type": "string"
                 },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "model": {
                     "type": "string"
                 }
@@ -2977,6 +4282,18 @@ const docTemplate = `{
                 "discord": {
                     "$ref": "#/definitions/store.DiscordClientConfig"
                 },
+                "email": {
+                    "$ref": "#/definitions/store.EmailClientConfig"
+                },
+                "matrix": {
+                    "$ref": "#/definitions/store.MatrixClientConfig"
+                },
+                "mattermost": {
+                    "$ref": "#/definitions/store.MattermostClientConfig"
+                },
+                "mqtt": {
+                    "$ref": "#/definitions/store.MQTTClientConfig"
+                },
                 "slack": {
                     "$ref": "#/definitions/store.SlackClientConfig"
                 },
@@ -2985,6 +4302,9 @@ const docTemplate = `{
                 },
                 "webhook": {
                     "$ref": "#/definitions/store.WebhookClientConfig"
+                },
+                "wyoming": {
+                    "$ref": "#/definitions/store.WyomingClientConfig"
                 }
             }
         },
@@ -3009,11 +4329,53 @@ const docTemplate = `{
                 "name": {
                     "type": "string"
                 },
+                "retention": {
+                    "$ref": "#/definitions/store.RetentionPolicy"
+                },
                 "token": {
                     "type": "string"
                 },
                 "type": {
                     "type": "string"
+                },
+                "voice": {
+                    "$ref": "#/definitions/store.VoiceSettings"
+                }
+            }
+        },
+        "store.ClientRun": {
+            "type": "object",
+            "properties": {
+                "clientId": {
+                    "type": "string"
+                },
+                "endedAt": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "response": {
+                    "description": "Response is an excerpt of the agent response.",
+                    "type": "string"
+                },
+                "scheduledAt": {
+                    "description": "ScheduledAt is the slot the run belongs to. Manual runs have none.",
+                    "type": "string"
+                },
+                "startedAt": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status is \"running\", \"success\", \"error\" or \"missed\".",
+                    "type": "string"
+                },
+                "trigger": {
+                    "description": "Trigger is \"schedule\", \"catchup\" or \"manual\".",
+                    "type": "string"
                 }
             }
         },
@@ -3040,6 +4402,9 @@ const docTemplate = `{
                 "enabled": {
                     "type": "boolean"
                 },
+                "maxTokens": {
+                    "type": "integer"
+                },
                 "maxTurns": {
                     "type": "integer"
                 },
@@ -3097,6 +4462,13 @@ const docTemplate = `{
                 "sessionId": {
                     "type": "string"
                 },
+                "snippets": {
+                    "description": "set by ListFiltered when searching",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.SearchSnippet"
+                    }
+                },
                 "source": {
                     "type": "string"
                 },
@@ -3141,11 +4513,29 @@ const docTemplate = `{
         "store.CronClientConfig": {
             "type": "object",
             "properties": {
+                "catchUp": {
+                    "type": "string"
+                },
                 "commandId": {
                     "type": "string"
                 },
+                "deliveryClientId": {
+                    "type": "string"
+                },
+                "deliveryRetries": {
+                    "type": "integer"
+                },
+                "deliveryTarget": {
+                    "type": "string"
+                },
+                "deliveryUrl": {
+                    "type": "string"
+                },
                 "schedule": {
                     "type": "string"
+                },
+                "timezone": {
+                    "type": "string"
                 }
             }
         },
@@ -3167,7 +4557,63 @@ const docTemplate = `{
                 "botToken": {
                     "type": "string"
                 },
-                "guildId": {
+                "defaultAgent": {
+                    "type": "string"
+                },
+                "responseMode": {
+                    "type": "string"
+                },
+                "threadHistoryLimit": {
+                    "type": "integer"
+                }
+            }
+        },
+        "store.EmailClientConfig": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "allowedSenders": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "authServId": {
+                    "type": "string"
+                },
+                "defaultAgent": {
+                    "type": "string"
+                },
+                "imapHost": {
+                    "type": "string"
+                },
+                "imapPort": {
+                    "type": "integer"
+                },
+                "imapSecurity": {
+                    "type": "string"
+                },
+                "mailbox": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "pollInterval": {
+                    "type": "integer"
+                },
+                "smtpHost": {
+                    "type": "string"
+                },
+                "smtpPort": {
+                    "type": "integer"
+                },
+                "smtpSecurity": {
+                    "type": "string"
+                },
+                "username": {
                     "type": "string"
                 }
             }
@@ -3207,58 +4653,165 @@ const docTemplate = `{
                 "steps": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/store.FlowStep"
+                        "$ref": "#/definitions/store.FlowStep"
+                    }
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.Identity": {
+            "type": "object",
+            "properties": {
+                "externalId": {
+                    "type": "string"
+                },
+                "provider": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.MCPServer": {
+            "type": "object",
+            "properties": {
+                "args": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "command": {
+                    "type": "string"
+                },
+                "endpoint": {
+                    "type": "string"
+                },
+                "env": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "insecure": {
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "systemPrompt": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "workDir": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.MQTTClientConfig": {
+            "type": "object",
+            "properties": {
+                "brokerUrl": {
+                    "type": "string"
+                },
+                "clientId": {
+                    "type": "string"
+                },
+                "commandId": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "qos": {
+                    "type": "integer"
+                },
+                "replyTopic": {
+                    "type": "string"
+                },
+                "topics": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "username": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.MatrixClientConfig": {
+            "type": "object",
+            "properties": {
+                "accessToken": {
+                    "type": "string"
+                },
+                "allowedRooms": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "allowedUsers": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
                     }
                 },
-                "type": {
+                "defaultAgent": {
+                    "type": "string"
+                },
+                "homeserverUrl": {
+                    "type": "string"
+                },
+                "responseMode": {
                     "type": "string"
+                },
+                "threadHistoryLimit": {
+                    "type": "integer"
                 }
             }
         },
-        "store.MCPServer": {
+        "store.MattermostClientConfig": {
             "type": "object",
             "properties": {
-                "args": {
+                "allowedChannels": {
                     "type": "array",
                     "items": {
                         "type": "string"
                     }
                 },
-                "command": {
-                    "type": "string"
-                },
-                "endpoint": {
-                    "type": "string"
-                },
-                "env": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "string"
-                    }
-                },
-                "headers": {
-                    "type": "object",
-                    "additionalProperties": {
+                "allowedUsers": {
+                    "type": "array",
+                    "items": {
                         "type": "string"
                     }
                 },
-                "id": {
+                "botToken": {
                     "type": "string"
                 },
-                "insecure": {
-                    "type": "boolean"
-                },
-                "name": {
+                "defaultAgent": {
                     "type": "string"
                 },
-                "systemPrompt": {
+                "responseMode": {
                     "type": "string"
                 },
-                "type": {
+                "serverUrl": {
                     "type": "string"
                 },
-                "workDir": {
-                    "type": "string"
+                "threadHistoryLimit": {
+                    "type": "integer"
                 }
             }
         },
@@ -3286,6 +4839,20 @@ const docTemplate = `{
                 }
             }
         },
+        "store.PaginatedResult-store_ClientRun": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.ClientRun"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
         "store.PaginatedResult-store_Conversation": {
             "type": "object",
             "properties": {
@@ -3300,12 +4867,90 @@ const docTemplate = `{
                 }
             }
         },
+        "store.RetentionPolicy": {
+            "type": "object",
+            "properties": {
+                "days": {
+                    "description": "default for every source",
+                    "type": "integer"
+                },
+                "rawEventsHours": {
+                    "description": "drop RawEvents after this many hours",
+                    "type": "integer"
+                },
+                "sourceDays": {
+                    "description": "per-source override, e.g. {\"webhook\": 7}",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "store.RetentionReport": {
+            "type": "object",
+            "properties": {
+                "conversations": {
+                    "description": "conversations deleted (or that would be)",
+                    "type": "integer"
+                },
+                "dryRun": {
+                    "type": "boolean"
+                },
+                "rawEventsConversations": {
+                    "description": "conversations whose raw events were dropped",
+                    "type": "integer"
+                },
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.RetentionRuleReport"
+                    }
+                }
+            }
+        },
+        "store.RetentionRuleReport": {
+            "type": "object",
+            "properties": {
+                "clientId": {
+                    "description": "empty for the global policy",
+                    "type": "string"
+                },
+                "conversations": {
+                    "type": "integer"
+                },
+                "cutoff": {
+                    "type": "string"
+                },
+                "source": {
+                    "description": "empty when the rule covers every other source",
+                    "type": "string"
+                }
+            }
+        },
+        "store.SearchSnippet": {
+            "type": "object",
+            "properties": {
+                "role": {
+                    "type": "string"
+                },
+                "seq": {
+                    "type": "integer"
+                },
+                "text": {
+                    "type": "string"
+                }
+            }
+        },
         "store.Settings": {
             "type": "object",
             "properties": {
                 "longTermProvider": {
                     "type": "string"
                 },
+                "retention": {
+                    "$ref": "#/definitions/store.RetentionPolicy"
+                },
                 "sessionProvider": {
                     "type": "string"
                 }
@@ -3366,8 +5011,14 @@ const docTemplate = `{
                 "botToken": {
                     "type": "string"
                 },
+                "defaultAgent": {
+                    "type": "string"
+                },
                 "responseMode": {
                     "type": "string"
+                },
+                "threadHistoryLimit": {
+                    "type": "integer"
                 }
             }
         },
@@ -3388,6 +5039,38 @@ const docTemplate = `{
                 }
             }
         },
+        "store.TTSVoice": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "language": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "sampleRate": {
+                    "type": "integer"
+                },
+                "size": {
+                    "description": "bytes of the model file",
+                    "type": "integer"
+                },
+                "speaker": {
+                    "description": "speaker to use, the first when empty",
+                    "type": "string"
+                },
+                "speakers": {
+                    "description": "multi-speaker voices only",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
         "store.TelegramClientConfig": {
             "type": "object",
             "properties": {
@@ -3406,6 +5089,9 @@ const docTemplate = `{
                 "botToken": {
                     "type": "string"
                 },
+                "defaultAgent": {
+                    "type": "string"
+                },
                 "responseMode": {
                     "type": "string"
                 }
@@ -3421,14 +5107,178 @@ const docTemplate = `{
                 "result": {}
             }
         },
+        "store.User": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "identities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/store.Identity"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.VoiceSettings": {
+            "type": "object",
+            "properties": {
+                "minSpeech": {
+                    "description": "ms of speech before it starts",
+                    "type": "integer"
+                },
+                "silenceTimeout": {
+                    "description": "ms of silence that end speech",
+                    "type": "integer"
+                },
+                "speakerId": {
+                    "description": "SpeakerID identifies the enrolled user speaking each utterance, who\nthe turn then runs as. SpeakerThreshold is the similarity a voice\nmust reach to be recognized.",
+                    "type": "boolean"
+                },
+                "speakerThreshold": {
+                    "type": "number"
+                },
+                "vadThreshold": {
+                    "description": "speech probability",
+                    "type": "number"
+                },
+                "wakewordThreshold": {
+                    "description": "wake word score, overrides the model's",
+                    "type": "number"
+                },
+                "wakewords": {
+                    "description": "Wakewords restricts the client to these wake word IDs, the first one\nactive by default. Empty allows them all.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "store.WakeWord": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "phrase": {
+                    "type": "string"
+                },
+                "size": {
+                    "description": "bytes of the model file",
+                    "type": "integer"
+                },
+                "threshold": {
+                    "type": "number"
+                }
+            }
+        },
         "store.WebhookClientConfig": {
             "type": "object",
             "properties": {
+                "allowedCallbackUrls": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "async": {
+                    "type": "boolean"
+                },
+                "auth": {
+                    "type": "string"
+                },
+                "callbackUrl": {
+                    "type": "string"
+                },
                 "commandId": {
                     "type": "string"
                 },
+                "eventHeader": {
+                    "type": "string"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "filterPath": {
+                    "type": "string"
+                },
+                "filterValues": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "passthrough": {
                     "type": "boolean"
+                },
+                "promptTemplate": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "signatureHeader": {
+                    "type": "string"
+                }
+            }
+        },
+        "store.WyomingClientConfig": {
+            "type": "object",
+            "properties": {
+                "languages": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "listen": {
+                    "type": "string"
+                }
+            }
+        },
+        "voice.ConnectionStats": {
+            "type": "object",
+            "properties": {
+                "accepted": {
+                    "type": "integer"
+                },
+                "active": {
+                    "type": "integer"
+                },
+                "anonymous": {
+                    "description": "Anonymous counts the open connections without a client token",
+                    "type": "integer"
+                },
+                "clients": {
+                    "description": "Clients counts the open connections of each client, by ID",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "idleClosed": {
+                    "type": "integer"
+                },
+                "rejectedLimit": {
+                    "type": "integer"
+                },
+                "rejectedOrigin": {
+                    "type": "integer"
+                },
+                "sessions": {
+                    "description": "Sessions counts the open connections running a voice session",
+                    "type": "integer"
                 }
             }
         }
@@ -5,9 +5,11 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"google.golang.org/adk/memory"
 	"google.golang.org/adk/session"
 
 	"github.com/achetronic/magec/server/store"
+	"github.com/achetronic/magec/server/voice"
 )
 
 // ErrorResponse is returned for all error responses.
@@ -17,10 +19,15 @@ type ErrorResponse struct {
 
 // Handler provides the admin API router.
 type Handler struct {
-	store          *store.Store
-	conversations  *store.ConversationStore
-	sessionService session.Service
-	router         *mux.Router
+	store            *store.Store
+	conversations    *store.ConversationStore
+	sessionService   session.Service
+	memoryService    memory.Service
+	runner           ClientRunner
+	speakers         *voice.SpeakerID
+	voiceConnections VoiceConnections
+	onnxLibraryPath  string
+	router           *mux.Router
 }
 
 // New creates a new admin API handler.
@@ -46,6 +53,18 @@ func (h *Handler) SetSessionService(svc session.Service) {
 	h.sessionService = svc
 }
 
+// SetMemoryService injects the ADK memory service, used to move memories
+// when users are merged. It may be nil.
+func (h *Handler) SetMemoryService(svc memory.Service) {
+	h.memoryService = svc
+}
+
+// SetOnnxLibraryPath sets the ONNX Runtime library used to check uploaded
+// models.
+func (h *Handler) SetOnnxLibraryPath(path string) {
+	h.onnxLibraryPath = path
+}
+
 // ServeHTTP implements http.Handler.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.router.ServeHTTP(w, r)
@@ -97,6 +116,8 @@ func (h *Handler) buildRouter() *mux.Router {
 	r.HandleFunc("/clients/{id}", h.updateClient).Methods("PUT")
 	r.HandleFunc("/clients/{id}", h.deleteClient).Methods("DELETE")
 	r.HandleFunc("/clients/{id}/regenerate-token", h.regenerateClientToken).Methods("POST")
+	r.HandleFunc("/clients/{id}/runs", h.listClientRuns).Methods("GET")
+	r.HandleFunc("/clients/{id}/run", h.runClient).Methods("POST")
 
 	// Commands
 	r.HandleFunc("/commands", h.listCommands).Methods("GET")
@@ -133,10 +154,42 @@ func (h *Handler) buildRouter() *mux.Router {
 	r.HandleFunc("/secrets/{id}", h.updateSecret).Methods("PUT")
 	r.HandleFunc("/secrets/{id}", h.deleteSecret).Methods("DELETE")
 
+	// Users
+	r.HandleFunc("/users", h.listUsers).Methods("GET")
+	r.HandleFunc("/users", h.createUser).Methods("POST")
+	r.HandleFunc("/users/{id}", h.getUser).Methods("GET")
+	r.HandleFunc("/users/{id}", h.updateUser).Methods("PUT")
+	r.HandleFunc("/users/{id}", h.deleteUser).Methods("DELETE")
+	r.HandleFunc("/users/{id}/merge", h.mergeUsers).Methods("POST")
+	r.HandleFunc("/users/{id}/identities", h.linkUserIdentity).Methods("POST")
+	r.HandleFunc("/users/{id}/identities/{provider}/{externalId}", h.unlinkUserIdentity).Methods("DELETE")
+	r.HandleFunc("/users/{id}/voiceprint", h.getVoiceprint).Methods("GET")
+	r.HandleFunc("/users/{id}/voiceprint", h.enrollVoiceprint).Methods("POST")
+	r.HandleFunc("/users/{id}/voiceprint", h.deleteVoiceprint).Methods("DELETE")
+
+	// Wake words
+	r.HandleFunc("/wakewords", h.listWakeWords).Methods("GET")
+	r.HandleFunc("/wakewords", h.createWakeWord).Methods("POST")
+	r.HandleFunc("/wakewords/{id}", h.getWakeWord).Methods("GET")
+	r.HandleFunc("/wakewords/{id}", h.updateWakeWord).Methods("PUT")
+	r.HandleFunc("/wakewords/{id}", h.deleteWakeWord).Methods("DELETE")
+
+	// Voices (local TTS)
+	r.HandleFunc("/voices", h.listTTSVoices).Methods("GET")
+	r.HandleFunc("/voices", h.createTTSVoice).Methods("POST")
+	r.HandleFunc("/voices/{id}", h.getTTSVoice).Methods("GET")
+	r.HandleFunc("/voices/{id}", h.updateTTSVoice).Methods("PUT")
+	r.HandleFunc("/voices/{id}", h.deleteTTSVoice).Methods("DELETE")
+
+	// Voice connections
+	r.HandleFunc("/voice/connections", h.voiceConnectionStats).Methods("GET")
+
 	// Conversations (audit)
 	r.HandleFunc("/conversations", h.listConversations).Methods("GET")
 	r.HandleFunc("/conversations/stats", h.conversationStats).Methods("GET")
 	r.HandleFunc("/conversations/clear", h.clearConversations).Methods("DELETE")
+	r.HandleFunc("/conversations/prune", h.pruneConversations).Methods("POST")
+	r.HandleFunc("/conversations/export", h.exportConversations).Methods("GET")
 	r.HandleFunc("/conversations/{id}", h.getConversation).Methods("GET")
 	r.HandleFunc("/conversations/{id}", h.deleteConversation).Methods("DELETE")
 	r.HandleFunc("/conversations/{id}/pair", h.findPerspectivePair).Methods("GET")
@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+// ClientRunner starts runs of scheduled clients on demand.
+type ClientRunner interface {
+	RunNow(clientID string) (store.ClientRun, error)
+}
+
+// SetClientRunner injects the scheduler used by the run-now endpoint.
+func (h *Handler) SetClientRunner(r ClientRunner) {
+	h.runner = r
+}
+
+// listClientRuns returns the run history of a scheduled client.
+// @Summary      List client runs
+// @Description  Returns the run history of a cron client, newest first: trigger (schedule, catchup, manual), scheduled slot, start and end times, status (running, success, error, missed) and a response excerpt.
+// @Tags         clients
+// @Produce      json
+// @Param        id      path      string  true   "Client ID"
+// @Param        limit   query     int     false  "Max items to return (default 30, 0 for all)"
+// @Param        offset  query     int     false  "Items to skip (default 0)"
+// @Success      200     {object}  store.PaginatedResult[store.ClientRun]
+// @Failure      404     {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /clients/{id}/runs [get]
+func (h *Handler) listClientRuns(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, ok := h.store.GetClient(id); !ok {
+		writeError(w, http.StatusNotFound, "client not found")
+		return
+	}
+	if h.conversations == nil {
+		writeJSON(w, http.StatusOK, store.PaginatedResult[store.ClientRun]{Items: []store.ClientRun{}})
+		return
+	}
+	limit := queryInt(r, "limit", 30)
+	offset := queryInt(r, "offset", 0)
+	writeJSON(w, http.StatusOK, h.conversations.ListRuns(id, limit, offset))
+}
+
+// runClient starts a run of a cron client right away.
+// @Summary      Run client now
+// @Description  Runs a cron client's command outside its schedule. The run continues in the background; poll the run history for its outcome. Results are delivered like scheduled runs.
+// @Tags         clients
+// @Produce      json
+// @Param        id   path      string  true  "Client ID"
+// @Success      202  {object}  store.ClientRun
+// @Failure      400  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      503  {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /clients/{id}/run [post]
+func (h *Handler) runClient(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, ok := h.store.GetClient(id); !ok {
+		writeError(w, http.StatusNotFound, "client not found")
+		return
+	}
+	if h.runner == nil {
+		writeError(w, http.StatusServiceUnavailable, "scheduler is not available")
+		return
+	}
+	run, err := h.runner.RunNow(id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run)
+}
@@ -9,7 +9,7 @@ import (
 
 // getSettings returns the global runtime settings.
 // @Summary      Get settings
-// @Description  Returns the global settings (session provider, long-term memory provider).
+// @Description  Returns the global settings (session provider, long-term memory provider, conversation retention).
 // @Tags         settings
 // @Produce      json
 // @Success      200  {object}  store.Settings
@@ -37,6 +37,10 @@ func (h *Handler) updateSettings(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if err := settings.Retention.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	if err := h.store.UpdateSettings(settings); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
@@ -0,0 +1,210 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/achetronic/magec/server/store"
+	"github.com/achetronic/magec/server/voice"
+)
+
+const (
+	// maxTTSVoiceModelSize bounds uploaded voice models. Piper voices are
+	// 20-120 MB depending on their quality.
+	maxTTSVoiceModelSize = 200 << 20
+	// maxTTSVoiceConfigSize bounds the JSON config of a voice.
+	maxTTSVoiceConfigSize = 1 << 20
+)
+
+// listTTSVoices returns all uploaded voices.
+// @Summary      List voices
+// @Description  Returns the Piper voices used by local TTS backends
+// @Tags         voices
+// @Produce      json
+// @Success      200  {array}  store.TTSVoice
+// @Security     AdminAuth
+// @Router       /voices [get]
+func (h *Handler) listTTSVoices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.store.ListTTSVoices())
+}
+
+// getTTSVoice returns a single voice by ID.
+// @Summary      Get voice
+// @Description  Returns a voice by its unique ID
+// @Tags         voices
+// @Produce      json
+// @Param        id    path      string  true  "Voice ID"
+// @Success      200   {object}  store.TTSVoice
+// @Failure      404   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /voices/{id} [get]
+func (h *Handler) getTTSVoice(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	v, ok := h.store.GetTTSVoice(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "voice not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// createTTSVoice uploads a Piper voice.
+// @Summary      Upload voice
+// @Description  Uploads a Piper voice: the .onnx model and its .onnx.json config. Language, sample rate and speakers are read from the config
+// @Tags         voices
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file     formData  file    true   "Piper .onnx model"
+// @Param        config   formData  file    true   "Piper .onnx.json config"
+// @Param        name     formData  string  false  "Name agents use to pick the voice (defaults to the model file name)"
+// @Param        speaker  formData  string  false  "Speaker of a multi-speaker voice (defaults to the first)"
+// @Success      201   {object}  store.TTSVoice
+// @Failure      400   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /voices [post]
+func (h *Handler) createTTSVoice(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxTTSVoiceModelSize+maxTTSVoiceConfigSize+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid upload: "+err.Error())
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	defer file.Close()
+	if !strings.EqualFold(filepath.Ext(header.Filename), ".onnx") {
+		writeError(w, http.StatusBadRequest, "file must be an .onnx model")
+		return
+	}
+	configFile, _, err := r.FormFile("config")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "config is required")
+		return
+	}
+	defer configFile.Close()
+
+	configData, err := io.ReadAll(io.LimitReader(configFile, maxTTSVoiceConfigSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read config: "+err.Error())
+		return
+	}
+	if len(configData) > maxTTSVoiceConfigSize {
+		writeError(w, http.StatusBadRequest, "config is too large")
+		return
+	}
+	config, err := voice.ParsePiperConfig(configData)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := store.TTSVoice{
+		Name:       strings.TrimSpace(r.FormValue("name")),
+		Speaker:    strings.TrimSpace(r.FormValue("speaker")),
+		Language:   config.Language.Code,
+		SampleRate: config.Audio.SampleRate,
+		Speakers:   config.Speakers(),
+	}
+	if v.Name == "" {
+		v.Name = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+	if err := validateTTSVoice(v); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	model, err := io.ReadAll(io.LimitReader(file, maxTTSVoiceModelSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read file: "+err.Error())
+		return
+	}
+	if len(model) == 0 || len(model) > maxTTSVoiceModelSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("model must be between 1 byte and %d MB", maxTTSVoiceModelSize>>20))
+		return
+	}
+
+	created, err := h.store.CreateTTSVoice(v, model, configData)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// updateTTSVoice updates the name and speaker of a voice.
+// @Summary      Update voice
+// @Description  Updates the name and speaker of a voice. The model and its config are kept
+// @Tags         voices
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string          true  "Voice ID"
+// @Param        body  body      store.TTSVoice  true  "Voice definition"
+// @Success      200   {object}  store.TTSVoice
+// @Failure      400   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /voices/{id} [put]
+func (h *Handler) updateTTSVoice(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	existing, ok := h.store.GetTTSVoice(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "voice not found")
+		return
+	}
+	var v store.TTSVoice
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	existing.Name = strings.TrimSpace(v.Name)
+	existing.Speaker = strings.TrimSpace(v.Speaker)
+	if err := validateTTSVoice(existing); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.store.UpdateTTSVoice(id, existing); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	updated, _ := h.store.GetTTSVoice(id)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// deleteTTSVoice deletes a voice and its files.
+// @Summary      Delete voice
+// @Description  Deletes a voice, its model and its config
+// @Tags         voices
+// @Param        id  path  string  true  "Voice ID"
+// @Success      204
+// @Failure      404  {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /voices/{id} [delete]
+func (h *Handler) deleteTTSVoice(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := h.store.DeleteTTSVoice(id); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateTTSVoice requires a name and a speaker the voice has.
+func validateTTSVoice(v store.TTSVoice) error {
+	if v.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if v.Speaker != "" && !slices.Contains(v.Speakers, v.Speaker) {
+		return fmt.Errorf("speaker %q is not one of the voice's speakers", v.Speaker)
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/adk/session"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+// MergeUsersRequest is the body for merging two users.
+type MergeUsersRequest struct {
+	SourceID string `json:"sourceId" example:"a1b2c3d4-e5f6-7a8b-9c0d-1e2f3a4b5c6d"`
+}
+
+// listUsers returns all users.
+// @Summary      List users
+// @Description  Returns all Magec users with their linked external identities
+// @Tags         users
+// @Produce      json
+// @Success      200  {array}  store.User
+// @Security     AdminAuth
+// @Router       /users [get]
+func (h *Handler) listUsers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.store.ListUsers())
+}
+
+// getUser returns a single user by ID.
+// @Summary      Get user
+// @Description  Returns a user by its unique ID
+// @Tags         users
+// @Produce      json
+// @Param        id    path      string  true  "User ID"
+// @Success      200   {object}  store.User
+// @Failure      404   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users/{id} [get]
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	u, ok := h.store.GetUser(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// createUser creates a new user.
+// @Summary      Create user
+// @Description  Creates a new user, optionally with an initial set of identities
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        body  body      store.User  true  "User definition"
+// @Success      201   {object}  store.User
+// @Failure      400   {object}  ErrorResponse
+// @Failure      409   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users [post]
+func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
+	var u store.User
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if u.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	for _, ident := range u.Identities {
+		if ident.Provider == "" || ident.ExternalID == "" {
+			writeError(w, http.StatusBadRequest, "identities require provider and externalId")
+			return
+		}
+	}
+	created, err := h.store.CreateUser(u)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// updateUser renames a user.
+// @Summary      Update user
+// @Description  Updates a user's name. Identities are managed with the link, unlink and merge endpoints.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string      true  "User ID"
+// @Param        body  body      store.User  true  "User definition"
+// @Success      200   {object}  store.User
+// @Failure      400   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users/{id} [put]
+func (h *Handler) updateUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var u store.User
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if err := h.store.UpdateUser(id, u); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	updated, _ := h.store.GetUser(id)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// deleteUser deletes a user.
+// @Summary      Delete user
+// @Description  Deletes a user. Its identities resolve to new users on their next message.
+// @Tags         users
+// @Param        id  path  string  true  "User ID"
+// @Success      204
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users/{id} [delete]
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := h.store.DeleteUser(id); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mergeUsers merges another user into this one.
+// @Summary      Merge users
+// @Description  Moves every identity of the source user into the target user and deletes the source. The source's ADK sessions, long-term memories and logged conversations are moved to the target.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string             true  "Target user ID"
+// @Param        body  body      MergeUsersRequest  true  "Source user"
+// @Success      200   {object}  store.User
+// @Failure      400   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users/{id}/merge [post]
+func (h *Handler) mergeUsers(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req MergeUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if req.SourceID == "" {
+		writeError(w, http.StatusBadRequest, "sourceId is required")
+		return
+	}
+	if req.SourceID == id {
+		writeError(w, http.StatusBadRequest, "cannot merge a user into itself")
+		return
+	}
+	for _, userID := range []string{id, req.SourceID} {
+		if _, ok := h.store.GetUser(userID); !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("user %q not found", userID))
+			return
+		}
+	}
+	// Sessions and memories move first: if that fails both users are left
+	// in place and the merge can be retried.
+	if err := h.moveUserData(r.Context(), req.SourceID, id); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	merged, err := h.store.MergeUsers(id, req.SourceID)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	if h.conversations != nil {
+		if err := h.conversations.ReassignUser(req.SourceID, id); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, merged)
+}
+
+// linkUserIdentity links an external identity to a user.
+// @Summary      Link identity
+// @Description  Links an external identity (telegram, slack, discord, matrix, mattermost, email or client) to a user. If the identity belongs to another user it is moved.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string          true  "User ID"
+// @Param        body  body      store.Identity  true  "Identity"
+// @Success      200   {object}  store.User
+// @Failure      400   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Failure      500   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users/{id}/identities [post]
+func (h *Handler) linkUserIdentity(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var ident store.Identity
+	if err := json.NewDecoder(r.Body).Decode(&ident); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if ident.Provider == "" || ident.ExternalID == "" {
+		writeError(w, http.StatusBadRequest, "provider and externalId are required")
+		return
+	}
+	if err := h.store.LinkIdentity(id, ident); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	updated, _ := h.store.GetUser(id)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// unlinkUserIdentity removes an external identity from a user.
+// @Summary      Unlink identity
+// @Description  Detaches an external identity from a user. The next message from that identity creates a new user.
+// @Tags         users
+// @Param        id          path  string  true  "User ID"
+// @Param        provider    path  string  true  "Identity provider"
+// @Param        externalId  path  string  true  "External ID"
+// @Success      204
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users/{id}/identities/{provider}/{externalId} [delete]
+func (h *Handler) unlinkUserIdentity(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ident := store.Identity{Provider: vars["provider"], ExternalID: vars["externalId"]}
+	if err := h.store.UnlinkIdentity(vars["id"], ident); err != nil {
+		writeUserError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUserError maps a user directory error to its status code.
+func writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrMergeIntoItself):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrUserNotFound), errors.Is(err, store.ErrIdentityNotLinked):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrIdentityInUse):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// memoryDB is implemented by SQL-backed memory services, such as the
+// Postgres provider, whose entries can be re-keyed in place.
+type memoryDB interface {
+	DB() *sql.DB
+}
+
+// moveUserData hands the ADK sessions and long-term memories of sourceID to
+// targetID, across every agent and flow.
+func (h *Handler) moveUserData(ctx context.Context, sourceID, targetID string) error {
+	if h.sessionService != nil {
+		var apps []string
+		for _, a := range h.store.ListAgents() {
+			apps = append(apps, a.ID)
+		}
+		for _, f := range h.store.ListFlows() {
+			apps = append(apps, f.ID)
+		}
+		for _, app := range apps {
+			if err := moveSessions(ctx, h.sessionService, app, sourceID, targetID); err != nil {
+				return fmt.Errorf("failed to move sessions of %s: %w", app, err)
+			}
+		}
+	}
+	if h.memoryService != nil {
+		db, ok := h.memoryService.(memoryDB)
+		if !ok {
+			return errors.New("the memory provider cannot move memories between users")
+		}
+		if err := moveMemories(ctx, db.DB(), sourceID, targetID); err != nil {
+			return fmt.Errorf("failed to move memories: %w", err)
+		}
+	}
+	return nil
+}
+
+// moveMemories re-keys the memory entries of sourceID to targetID in one
+// transaction. Entries are unique per app, user, session and event, so a
+// source entry the target already holds is dropped instead of moved.
+func moveMemories(ctx context.Context, db *sql.DB, sourceID, targetID string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM memory_entries
+		WHERE user_id = $1 AND EXISTS (
+			SELECT 1 FROM memory_entries t
+			WHERE t.user_id = $2
+			  AND t.app_name = memory_entries.app_name
+			  AND t.session_id = memory_entries.session_id
+			  AND t.event_id = memory_entries.event_id)`, sourceID, targetID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE memory_entries SET user_id = $1 WHERE user_id = $2`, targetID, sourceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// moveSessions copies every session of sourceID in an app to targetID under
+// the same session ID, then deletes the original. Events are appended to a
+// target session that already exists.
+func moveSessions(ctx context.Context, svc session.Service, appName, sourceID, targetID string) error {
+	list, err := svc.List(ctx, &session.ListRequest{AppName: appName, UserID: sourceID})
+	if err != nil {
+		return err
+	}
+	for _, listed := range list.Sessions {
+		got, err := svc.Get(ctx, &session.GetRequest{AppName: appName, UserID: sourceID, SessionID: listed.ID()})
+		if err != nil {
+			return err
+		}
+		src := got.Session
+
+		var dst session.Session
+		if existing, err := svc.Get(ctx, &session.GetRequest{AppName: appName, UserID: targetID, SessionID: src.ID()}); err == nil {
+			dst = existing.Session
+		} else {
+			created, err := svc.Create(ctx, &session.CreateRequest{
+				AppName:   appName,
+				UserID:    targetID,
+				SessionID: src.ID(),
+				State:     maps.Collect(src.State().All()),
+			})
+			if err != nil {
+				return err
+			}
+			dst = created.Session
+		}
+
+		for evt := range src.Events().All() {
+			copied := *evt
+			// The state was copied whole, so deltas must not be applied again.
+			copied.Actions.StateDelta = nil
+			if err := svc.AppendEvent(ctx, dst, &copied); err != nil {
+				return err
+			}
+		}
+		if err := svc.Delete(ctx, &session.DeleteRequest{AppName: appName, UserID: sourceID, SessionID: src.ID()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
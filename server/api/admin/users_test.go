@@ -0,0 +1,116 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"google.golang.org/adk/model"
+	"google.golang.org/adk/session"
+	"google.golang.org/genai"
+
+	_ "modernc.org/sqlite"
+)
+
+func appendText(t *testing.T, svc session.Service, sess session.Session, author, text string) {
+	t.Helper()
+	evt := session.NewEvent("inv")
+	evt.Author = author
+	evt.LLMResponse = model.LLMResponse{Content: genai.NewContentFromText(text, genai.RoleUser)}
+	if err := svc.AppendEvent(context.Background(), sess, evt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMoveSessions(t *testing.T) {
+	ctx := context.Background()
+	svc := session.InMemoryService()
+
+	src, err := svc.Create(ctx, &session.CreateRequest{AppName: "agent", UserID: "old", SessionID: "s1", State: map[string]any{"topic": "plants"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendText(t, svc, src.Session, "user", "my fern is dying")
+	appendText(t, svc, src.Session, "agent", "water it less")
+
+	// A session with the same ID already exists under the target.
+	dst, _ := svc.Create(ctx, &session.CreateRequest{AppName: "agent", UserID: "new", SessionID: "s2"})
+	appendText(t, svc, dst.Session, "user", "hello")
+	shared, _ := svc.Create(ctx, &session.CreateRequest{AppName: "agent", UserID: "old", SessionID: "s2"})
+	appendText(t, svc, shared.Session, "user", "again")
+
+	if err := moveSessions(ctx, svc, "agent", "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	if left, _ := svc.List(ctx, &session.ListRequest{AppName: "agent", UserID: "old"}); len(left.Sessions) != 0 {
+		t.Errorf("expected no sessions left under the source, got %d", len(left.Sessions))
+	}
+	moved, err := svc.Get(ctx, &session.GetRequest{AppName: "agent", UserID: "new", SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := moved.Session.Events().Len(); n != 2 {
+		t.Errorf("moved session has %d events, want 2", n)
+	}
+	if topic, _ := moved.Session.State().Get("topic"); topic != "plants" {
+		t.Errorf("moved session state topic = %v, want plants", topic)
+	}
+	merged, _ := svc.Get(ctx, &session.GetRequest{AppName: "agent", UserID: "new", SessionID: "s2"})
+	if n := merged.Session.Events().Len(); n != 2 {
+		t.Errorf("existing target session has %d events, want 2", n)
+	}
+}
+
+func TestMoveMemoriesOverlapping(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// Same key as the adk-utils-go Postgres memory table.
+	if _, err := db.Exec(`CREATE TABLE memory_entries (
+		id INTEGER PRIMARY KEY,
+		app_name TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		content_text TEXT NOT NULL,
+		UNIQUE(app_name, user_id, session_id, event_id))`); err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{
+		{"agent", "old", "s1", "e1", "shared"},
+		{"agent", "new", "s1", "e1", "shared"},
+		{"agent", "old", "s1", "e2", "only old"},
+		{"other", "old", "s1", "e1", "other app"},
+		{"agent", "new", "s2", "e1", "only new"},
+	}
+	for _, r := range rows {
+		if _, err := db.Exec(`INSERT INTO memory_entries (app_name, user_id, session_id, event_id, content_text) VALUES (?, ?, ?, ?, ?)`, r[0], r[1], r[2], r[3], r[4]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := moveMemories(ctx, db, "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	var left, moved int
+	db.QueryRow(`SELECT COUNT(*) FROM memory_entries WHERE user_id = 'old'`).Scan(&left)
+	db.QueryRow(`SELECT COUNT(*) FROM memory_entries WHERE user_id = 'new'`).Scan(&moved)
+	if left != 0 {
+		t.Errorf("expected no memories left under the source, got %d", left)
+	}
+	if moved != 4 {
+		t.Errorf("target has %d memories, want 4", moved)
+	}
+
+	// Running it again is a no-op rather than a conflict.
+	if err := moveMemories(ctx, db, "old", "new"); err != nil {
+		t.Errorf("second move: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/achetronic/magec/server/voice"
+)
+
+// VoiceConnections reports the connections of the voice events WebSocket.
+type VoiceConnections interface {
+	Stats() voice.ConnectionStats
+}
+
+// SetVoiceConnections injects the voice events handler for connection metrics.
+func (h *Handler) SetVoiceConnections(v VoiceConnections) {
+	h.voiceConnections = v
+}
+
+// voiceConnectionStats returns the voice events connection metrics.
+// @Summary      Voice connections
+// @Description  Returns the open connections of the voice events WebSocket (total, with a voice session, per client ID and without a client token) and, since the server started, how many were accepted, refused for their origin or the per-client limit, and closed for idling. All zero when voice detection is not enabled.
+// @Tags         voice
+// @Produce      json
+// @Success      200  {object}  voice.ConnectionStats
+// @Security     AdminAuth
+// @Router       /voice/connections [get]
+func (h *Handler) voiceConnectionStats(w http.ResponseWriter, r *http.Request) {
+	if h.voiceConnections == nil {
+		writeJSON(w, http.StatusOK, voice.ConnectionStats{Clients: map[string]int{}})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.voiceConnections.Stats())
+}
@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/achetronic/magec/server/voice"
+)
+
+// maxVoiceprintSampleSize bounds each enrollment sample: about 30 seconds
+// of 16-bit mono audio at 48 kHz.
+const maxVoiceprintSampleSize = 3 << 20
+
+// VoiceprintResponse describes the enrolled voice of a user. The
+// embedding itself is not returned.
+type VoiceprintResponse struct {
+	UserID  string `json:"userId" example:"a1b2c3d4-e5f6-7a8b-9c0d-1e2f3a4b5c6d"`
+	Model   string `json:"model" example:"3dspeaker_speech_campplus_sv_en_voxceleb_16k.onnx"`
+	Samples int    `json:"samples" example:"3"`
+}
+
+// SetSpeakerID injects the speaker identifier used to enroll voiceprints.
+func (h *Handler) SetSpeakerID(sid *voice.SpeakerID) {
+	h.speakers = sid
+}
+
+// getVoiceprint returns the voiceprint of a user.
+// @Summary      Get voiceprint
+// @Description  Returns whether a user has enrolled their voice for speaker identification, with which model and how many samples
+// @Tags         users
+// @Produce      json
+// @Param        id    path      string  true  "User ID"
+// @Success      200   {object}  VoiceprintResponse
+// @Failure      404   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users/{id}/voiceprint [get]
+func (h *Handler) getVoiceprint(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	v, ok := h.store.GetVoiceprint(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "voiceprint not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, VoiceprintResponse{UserID: v.UserID, Model: v.Model, Samples: v.Samples})
+}
+
+// enrollVoiceprint adds voice samples to the voiceprint of a user.
+// @Summary      Enroll voice
+// @Description  Enrolls a user for speaker identification with a few WAV samples of their voice (16-bit PCM, a few seconds of speech each). Samples add to the existing voiceprint unless reset is true. Requires a speaker embedding model in the data directory.
+// @Tags         users
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id     path      string  true   "User ID"
+// @Param        file   formData  file    true   "WAV sample (repeat the field for several samples)"
+// @Param        reset  formData  bool    false  "Replace the existing voiceprint instead of adding to it"
+// @Success      200    {object}  VoiceprintResponse
+// @Failure      400    {object}  ErrorResponse
+// @Failure      404    {object}  ErrorResponse
+// @Failure      503    {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users/{id}/voiceprint [post]
+func (h *Handler) enrollVoiceprint(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, ok := h.store.GetUser(id); !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if h.speakers == nil {
+		writeError(w, http.StatusServiceUnavailable, "speaker identification is not available")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, voice.MaxEnrollmentSamples*maxVoiceprintSampleSize+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid upload: "+err.Error())
+		return
+	}
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		writeError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	if len(files) > voice.MaxEnrollmentSamples {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d samples can be enrolled at once", voice.MaxEnrollmentSamples))
+		return
+	}
+	reset, _ := strconv.ParseBool(r.FormValue("reset"))
+
+	wavs := make([][]byte, 0, len(files))
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read file: "+err.Error())
+			return
+		}
+		wav, err := io.ReadAll(io.LimitReader(file, maxVoiceprintSampleSize+1))
+		file.Close()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read file: "+err.Error())
+			return
+		}
+		if len(wav) > maxVoiceprintSampleSize {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s is too large", header.Filename))
+			return
+		}
+		wavs = append(wavs, wav)
+	}
+
+	v, err := h.speakers.Enroll(id, wavs, reset)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, voice.ErrNoSpeakerModel) {
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, VoiceprintResponse{UserID: v.UserID, Model: v.Model, Samples: v.Samples})
+}
+
+// deleteVoiceprint removes the voiceprint of a user.
+// @Summary      Delete voiceprint
+// @Description  Removes the enrolled voice of a user, who is no longer recognized by speaker identification
+// @Tags         users
+// @Param        id  path  string  true  "User ID"
+// @Success      204
+// @Failure      404  {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /users/{id}/voiceprint [delete]
+func (h *Handler) deleteVoiceprint(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := h.store.DeleteVoiceprint(id); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
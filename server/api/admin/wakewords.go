@@ -0,0 +1,199 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/achetronic/magec/server/store"
+	"github.com/achetronic/magec/server/voice"
+)
+
+const (
+	// maxWakeWordModelSize bounds uploaded wake word models. openWakeWord
+	// models are a few hundred kilobytes.
+	maxWakeWordModelSize = 10 << 20
+	// defaultWakeWordThreshold is used when an upload sets no threshold.
+	defaultWakeWordThreshold = 0.5
+)
+
+// listWakeWords returns all uploaded wake words.
+// @Summary      List wake words
+// @Description  Returns the custom wake word models. Built-in models are not included
+// @Tags         wakewords
+// @Produce      json
+// @Success      200  {array}  store.WakeWord
+// @Security     AdminAuth
+// @Router       /wakewords [get]
+func (h *Handler) listWakeWords(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.store.ListWakeWords())
+}
+
+// getWakeWord returns a single wake word by ID.
+// @Summary      Get wake word
+// @Description  Returns a custom wake word by its unique ID
+// @Tags         wakewords
+// @Produce      json
+// @Param        id    path      string  true  "Wake word ID"
+// @Success      200   {object}  store.WakeWord
+// @Failure      404   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /wakewords/{id} [get]
+func (h *Handler) getWakeWord(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	ww, ok := h.store.GetWakeWord(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "wake word not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, ww)
+}
+
+// createWakeWord uploads an openWakeWord model.
+// @Summary      Upload wake word
+// @Description  Uploads an openWakeWord ONNX model. The model is test-loaded first and rejected if ONNX Runtime cannot load it. It is loaded by the voice detectors without a restart
+// @Tags         wakewords
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file       formData  file    true   "openWakeWord .onnx model"
+// @Param        name       formData  string  true   "Display name"
+// @Param        phrase     formData  string  false  "Phrase to say (defaults to the name)"
+// @Param        threshold  formData  number  false  "Detection threshold (default 0.5)"
+// @Success      201   {object}  store.WakeWord
+// @Failure      400   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /wakewords [post]
+func (h *Handler) createWakeWord(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxWakeWordModelSize+1<<20)
+	if err := r.ParseMultipartForm(maxWakeWordModelSize); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid upload: "+err.Error())
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "file is required")
+		return
+	}
+	defer file.Close()
+	if !strings.EqualFold(filepath.Ext(header.Filename), ".onnx") {
+		writeError(w, http.StatusBadRequest, "file must be an .onnx model")
+		return
+	}
+
+	ww := store.WakeWord{
+		Name:   strings.TrimSpace(r.FormValue("name")),
+		Phrase: strings.TrimSpace(r.FormValue("phrase")),
+	}
+	if v := r.FormValue("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "threshold must be a number")
+			return
+		}
+		ww.Threshold = float32(t)
+	}
+	if err := validateWakeWord(&ww); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	model, err := io.ReadAll(io.LimitReader(file, maxWakeWordModelSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read file: "+err.Error())
+		return
+	}
+	if len(model) == 0 || len(model) > maxWakeWordModelSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("model must be between 1 byte and %d MB", maxWakeWordModelSize>>20))
+		return
+	}
+
+	if err := voice.InitONNX(h.onnxLibraryPath); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := voice.ValidateWakeWordModel(model); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid wake word model: "+err.Error())
+		return
+	}
+
+	created, err := h.store.CreateWakeWord(ww, model)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// updateWakeWord updates the name, phrase and threshold of a wake word.
+// @Summary      Update wake word
+// @Description  Updates the name, phrase and threshold of a custom wake word. The model is kept
+// @Tags         wakewords
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string          true  "Wake word ID"
+// @Param        body  body      store.WakeWord  true  "Wake word definition"
+// @Success      200   {object}  store.WakeWord
+// @Failure      400   {object}  ErrorResponse
+// @Failure      404   {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /wakewords/{id} [put]
+func (h *Handler) updateWakeWord(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var ww store.WakeWord
+	if err := json.NewDecoder(r.Body).Decode(&ww); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if err := validateWakeWord(&ww); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.store.UpdateWakeWord(id, ww); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	updated, _ := h.store.GetWakeWord(id)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// deleteWakeWord deletes a wake word and its model.
+// @Summary      Delete wake word
+// @Description  Deletes a custom wake word and its model file
+// @Tags         wakewords
+// @Param        id  path  string  true  "Wake word ID"
+// @Success      204
+// @Failure      404  {object}  ErrorResponse
+// @Security     AdminAuth
+// @Router       /wakewords/{id} [delete]
+func (h *Handler) deleteWakeWord(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := h.store.DeleteWakeWord(id); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateWakeWord requires a name and fills in the phrase and threshold
+// defaults.
+func validateWakeWord(ww *store.WakeWord) error {
+	if ww.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if ww.Phrase == "" {
+		ww.Phrase = ww.Name
+	}
+	if ww.Threshold == 0 {
+		ww.Threshold = defaultWakeWordThreshold
+	}
+	if ww.Threshold < store.MinWakewordThreshold || ww.Threshold > store.MaxWakewordThreshold {
+		return fmt.Errorf("threshold must be between %.2f and %.2f", store.MinWakewordThreshold, store.MaxWakewordThreshold)
+	}
+	return nil
+}
@@ -889,7 +889,7 @@ const docTemplateuserapi = `{
                         "BearerAuth": []
                     }
                 ],
-                "description": "Returns client pairing status, name, default agent, and allowed agents. Requires Bearer token via Authorization header.",
+                "description": "Returns client pairing status, name, linked Magec user, default agent, and allowed agents. Requires Bearer token via Authorization header.",
                 "produces": [
                     "application/json"
                 ],
@@ -919,6 +919,45 @@ const docTemplateuserapi = `{
                 }
             }
         },
+        "/client/notifications": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Server-Sent Events stream of notifications for the authenticated client (e.g. cron results delivered to the voice UI). Each event carries a Notification. Pass the last ID seen as ` + "`" + `after` + "`" + ` to receive notifications published while disconnected. The stream closes after a few minutes; reconnect to continue.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "client"
+                ],
+                "summary": "Notification stream",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Only replay notifications with a greater ID",
+                        "name": "after",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stream of notification events",
+                        "schema": {
+                            "$ref": "#/definitions/user.Notification"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/user.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/health": {
             "get": {
                 "description": "Returns 200 if the server is healthy",
@@ -941,17 +980,54 @@ const docTemplateuserapi = `{
         },
         "/voice/events": {
             "get": {
-                "description": "WebSocket endpoint for real-time voice events including wake word detection and voice activity detection (VAD).",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "WebSocket endpoint for real-time voice events including wake word detection and voice activity detection (VAD). Browsers, which can't set the Authorization header, send the client token as a \"bearer.\u003ctoken\u003e\" subprotocol along with \"magec.voice\", which is required with it, or in the token query parameter. Browser origins other than the server's own must be allowed in the configuration. Connections per client are limited, and idle connections are closed.",
                 "tags": [
                     "voice"
                 ],
                 "summary": "Voice events WebSocket",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client token, when it can't go in a header or subprotocol",
+                        "name": "token",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "101": {
                         "description": "Switching Protocols",
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/user.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/user.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Origin not allowed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/user.ErrorResponse"
+                        }
                     }
                 }
             }
@@ -1026,6 +1102,78 @@ const docTemplateuserapi = `{
                 }
             }
         },
+        "/voice/{agentId}/speech/stream": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Cuts text into sentences, synthesizes each one with the agent's TTS backend as soon as it is complete and streams the audio back in a chunked response. The text comes from a text/event-stream body (the SSE stream of /agent/run_sse), from \"input\", or from the reply of the agent to \"message\" in \"sessionId\", spoken while it is generated.",
+                "consumes": [
+                    "application/json",
+                    "text/event-stream"
+                ],
+                "produces": [
+                    "audio/mpeg",
+                    "audio/wav",
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "voice"
+                ],
+                "summary": "Streaming Text-to-Speech",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Agent ID",
+                        "name": "agentId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "mp3 (default), wav or pcm",
+                        "name": "response_format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Language of the sentence rules, e.g. en or es-ES",
+                        "name": "language",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Text or message to speak (JSON bodies)",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/user.SpeechStreamRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Audio stream",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/user.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/user.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/voice/{agentId}/transcription": {
             "post": {
                 "security": [
@@ -1352,6 +1500,10 @@ const docTemplateuserapi = `{
                 "paired": {
                     "type": "boolean",
                     "example": true
+                },
+                "userId": {
+                    "type": "string",
+                    "example": "b3f1c2d4-5e6f-4a7b-8c9d-0e1f2a3b4c5d"
                 }
             }
         },
@@ -1364,6 +1516,26 @@ const docTemplateuserapi = `{
                 }
             }
         },
+        "user.Notification": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer",
+                    "example": 1760781600000
+                },
+                "message": {
+                    "type": "string",
+                    "example": "Good morning! You have two meetings today."
+                },
+                "timestamp": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Morning briefing"
+                }
+            }
+        },
         "user.SpeechRequest": {
             "type": "object",
             "properties": {
@@ -1373,6 +1545,34 @@ const docTemplateuserapi = `{
                 }
             }
         },
+        "user.SpeechStreamRequest": {
+            "type": "object",
+            "properties": {
+                "input": {
+                    "type": "string",
+                    "example": "Hello world. How are you today?"
+                },
+                "language": {
+                    "type": "string",
+                    "example": "en"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "Tell me a short story"
+                },
+                "response_format": {
+                    "type": "string",
+                    "example": "mp3"
+                },
+                "sessionId": {
+                    "type": "string",
+                    "example": "story-1"
+                },
+                "userId": {
+                    "type": "string"
+                }
+            }
+        },
         "user.WebhookRequest": {
             "type": "object",
             "properties": {
@@ -2,6 +2,7 @@ package user
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
 
 	"github.com/achetronic/magec/server/store"
@@ -11,6 +12,7 @@ import (
 type ClientInfoResponse struct {
 	Paired        bool              `json:"paired" example:"true"`
 	Name          string            `json:"name,omitempty" example:"my-tablet"`
+	UserID        string            `json:"userId,omitempty" example:"b3f1c2d4-5e6f-4a7b-8c9d-0e1f2a3b4c5d"`
 	DefaultAgent  string            `json:"defaultAgent,omitempty" example:"magec"`
 	AllowedAgents []AgentSummary    `json:"allowedAgents,omitempty"`
 }
@@ -39,6 +41,17 @@ type SpeechRequest struct {
 	Input string `json:"input" example:"Hello world"`
 }
 
+// SpeechStreamRequest is the JSON body of the speech stream. It carries
+// either the text to speak or a message to run the agent with.
+type SpeechStreamRequest struct {
+	Input          string `json:"input,omitempty" example:"Hello world. How are you today?"`
+	Message        string `json:"message,omitempty" example:"Tell me a short story"`
+	UserID         string `json:"userId,omitempty"`
+	SessionID      string `json:"sessionId,omitempty" example:"story-1"`
+	ResponseFormat string `json:"response_format,omitempty" example:"mp3"`
+	Language       string `json:"language,omitempty" example:"en"`
+}
+
 // ErrorResponse is returned for all error responses.
 type ErrorResponse struct {
 	Error string `json:"error" example:"resource not found"`
@@ -68,7 +81,7 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 
 // ClientInfo returns pairing and agent info for the authenticated client.
 // @Summary      Client info
-// @Description  Returns client pairing status, name, default agent, and allowed agents. Requires Bearer token via Authorization header.
+// @Description  Returns client pairing status, name, linked Magec user, default agent, and allowed agents. Requires Bearer token via Authorization header.
 // @Tags         client
 // @Produce      json
 // @Success      200  {object}  ClientInfoResponse          "Authenticated client info"
@@ -124,10 +137,15 @@ func (h *Handler) ClientInfo(w http.ResponseWriter, r *http.Request) {
 	if len(cl.AllowedAgents) > 0 {
 		defaultAgent = cl.AllowedAgents[0]
 	}
+	userID, err := h.store.ResolveUser(store.IdentityClient, cl.ID, cl.Name)
+	if err != nil {
+		slog.Warn("Failed to resolve user identity", "client", cl.Name, "error", err)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ClientInfoResponse{
 		Paired:        true,
 		Name:          cl.Name,
+		UserID:        userID,
 		DefaultAgent:  defaultAgent,
 		AllowedAgents: allowedDetails,
 	})
@@ -150,6 +168,26 @@ func (h *Handler) ClientInfo(w http.ResponseWriter, r *http.Request) {
 // @Router       /voice/{agentId}/speech [post]
 func (h *Handler) Speech(w http.ResponseWriter, r *http.Request) {}
 
+// SpeechStream speaks text sentence by sentence as it arrives.
+// @Summary      Streaming Text-to-Speech
+// @Description  Cuts text into sentences, synthesizes each one with the agent's TTS backend as soon as it is complete and streams the audio back in a chunked response. The text comes from a text/event-stream body (the SSE stream of /agent/run_sse), from "input", or from the reply of the agent to "message" in "sessionId", spoken while it is generated.
+// @Tags         voice
+// @Accept       json
+// @Accept       text/event-stream
+// @Produce      audio/mpeg
+// @Produce      audio/wav
+// @Produce      application/octet-stream
+// @Param        agentId          path      string               true   "Agent ID"
+// @Param        response_format  query     string               false  "mp3 (default), wav or pcm"
+// @Param        language         query     string               false  "Language of the sentence rules, e.g. en or es-ES"
+// @Param        body             body      SpeechStreamRequest  false  "Text or message to speak (JSON bodies)"
+// @Success      200              {file}    binary               "Audio stream"
+// @Failure      400              {object}  ErrorResponse
+// @Failure      502              {object}  ErrorResponse
+// @Security     BearerAuth
+// @Router       /voice/{agentId}/speech/stream [post]
+func (h *Handler) SpeechStream(w http.ResponseWriter, r *http.Request) {}
+
 // Transcription proxies an STT request to the agent's configured backend.
 // @Summary      Speech-to-Text
 // @Description  Proxies a transcription request to the STT backend configured for the given agent. Accepts multipart audio.
@@ -169,9 +207,15 @@ func (h *Handler) Transcription(w http.ResponseWriter, r *http.Request) {}
 
 // VoiceEvents serves the WebSocket connection for real-time voice events (wake word detection, VAD).
 // @Summary      Voice events WebSocket
-// @Description  WebSocket endpoint for real-time voice events including wake word detection and voice activity detection (VAD).
+// @Description  WebSocket endpoint for real-time voice events including wake word detection and voice activity detection (VAD). Browsers, which can't set the Authorization header, send the client token as a "bearer.<token>" subprotocol along with "magec.voice", which is required with it, or in the token query parameter. Browser origins other than the server's own must be allowed in the configuration. Connections per client are limited, and idle connections are closed.
 // @Tags         voice
-// @Success      101  {string}  string  "Switching Protocols"
+// @Param        token  query     string  false  "Client token, when it can't go in a header or subprotocol"
+// @Success      101    {string}  string  "Switching Protocols"
+// @Failure      400    {object}  ErrorResponse
+// @Failure      401    {object}  ErrorResponse
+// @Failure      403    {string}  string  "Origin not allowed"
+// @Failure      429    {object}  ErrorResponse
+// @Security     BearerAuth
 // @Router       /voice/events [get]
 func (h *Handler) VoiceEvents(w http.ResponseWriter, r *http.Request) {}
 
@@ -0,0 +1,182 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// notificationBacklog is how many recent notifications are kept per
+	// client for voice UIs that were offline when they were published.
+	notificationBacklog = 20
+
+	// notificationStreamLifetime closes streams before the server's write
+	// timeout. Clients reconnect with the last ID they saw.
+	notificationStreamLifetime = 10 * time.Minute
+
+	notificationHeartbeat = 30 * time.Second
+)
+
+// Notification is a message pushed to the voice UI of a client, e.g. the
+// result of a cron job.
+type Notification struct {
+	ID        int64     `json:"id" example:"1760781600000"`
+	Title     string    `json:"title,omitempty" example:"Morning briefing"`
+	Message   string    `json:"message" example:"Good morning! You have two meetings today."`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Notifier keeps recent notifications per client and streams new ones to
+// connected voice UIs.
+type Notifier struct {
+	mu          sync.Mutex
+	nextID      int64
+	backlog     map[string][]Notification
+	subscribers map[string]map[chan Notification]struct{}
+}
+
+// NewNotifier creates an empty notifier. IDs start at the current time in
+// milliseconds so they keep increasing across restarts.
+func NewNotifier() *Notifier {
+	return &Notifier{
+		nextID:      time.Now().UnixMilli(),
+		backlog:     make(map[string][]Notification),
+		subscribers: make(map[string]map[chan Notification]struct{}),
+	}
+}
+
+// Publish sends a notification to every voice UI connected with the
+// client's token and keeps it for those that connect later.
+func (n *Notifier) Publish(clientID, title, message string) Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.nextID++
+	notif := Notification{ID: n.nextID, Title: title, Message: message, Timestamp: time.Now()}
+
+	backlog := append(n.backlog[clientID], notif)
+	if len(backlog) > notificationBacklog {
+		backlog = backlog[len(backlog)-notificationBacklog:]
+	}
+	n.backlog[clientID] = backlog
+
+	for ch := range n.subscribers[clientID] {
+		select {
+		case ch <- notif:
+		default:
+			// Slow reader: it catches up from the backlog on reconnect.
+		}
+	}
+	return notif
+}
+
+func (n *Notifier) subscribe(clientID string, after int64) (chan Notification, []Notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var missed []Notification
+	for _, notif := range n.backlog[clientID] {
+		if notif.ID > after {
+			missed = append(missed, notif)
+		}
+	}
+
+	ch := make(chan Notification, notificationBacklog)
+	if n.subscribers[clientID] == nil {
+		n.subscribers[clientID] = make(map[chan Notification]struct{})
+	}
+	n.subscribers[clientID][ch] = struct{}{}
+	return ch, missed
+}
+
+func (n *Notifier) unsubscribe(clientID string, ch chan Notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.subscribers[clientID], ch)
+	if len(n.subscribers[clientID]) == 0 {
+		delete(n.subscribers, clientID)
+	}
+}
+
+// ServeHTTP streams notifications for the authenticated client.
+// @Summary      Notification stream
+// @Description  Server-Sent Events stream of notifications for the authenticated client (e.g. cron results delivered to the voice UI). Each event carries a Notification. Pass the last ID seen as `after` to receive notifications published while disconnected. The stream closes after a few minutes; reconnect to continue.
+// @Tags         client
+// @Produce      text/event-stream
+// @Param        after  query     int           false  "Only replay notifications with a greater ID"
+// @Success      200    {object}  Notification  "Stream of notification events"
+// @Failure      401    {object}  ErrorResponse
+// @Security     BearerAuth
+// @Router       /client/notifications [get]
+func (n *Notifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	clientID := r.Header.Get("X-Client-ID")
+	if clientID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "client token required"})
+		return
+	}
+	after, _ := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64)
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ch, missed := n.subscribe(clientID, after)
+	defer n.unsubscribe(clientID, ch)
+
+	write := func(notif Notification) bool {
+		data, _ := json.Marshal(notif)
+		if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", notif.ID, data); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	for _, notif := range missed {
+		if !write(notif) {
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(notificationHeartbeat)
+	defer heartbeat.Stop()
+	lifetime := time.NewTimer(notificationStreamLifetime)
+	defer lifetime.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-lifetime.C:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case notif := <-ch:
+			if !write(notif) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,383 @@
+// Copyright 2025 Alby Hernández
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/achetronic/magec/server/clients/msgutil"
+)
+
+// agentAPI talks to the magec agent API (ADK sessions and /run_sse) and to
+// the voice proxies next to it. baseURL ends in /agent.
+type agentAPI struct {
+	baseURL string
+	token   string
+}
+
+// run sends a user message to an agent via the /run_sse endpoint and calls
+// handler for each event as it arrives from the SSE stream.
+func (a *agentAPI) run(agentID, userID, sessionID, message string, files []File, handler func(msgutil.SSEEvent)) error {
+	parts := []map[string]interface{}{
+		{"text": message},
+	}
+	for _, f := range files {
+		parts = append(parts, map[string]interface{}{
+			"inlineData": map[string]interface{}{
+				"mimeType":    f.MIMEType,
+				"data":        base64.StdEncoding.EncodeToString(f.Data),
+				"displayName": f.Name,
+			},
+		})
+	}
+	reqBody := map[string]interface{}{
+		"appName":   agentID,
+		"userId":    userID,
+		"sessionId": sessionID,
+		"newMessage": map[string]interface{}{
+			"role":  "user",
+			"parts": parts,
+		},
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/run_sse", bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	a.setAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("agent returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return msgutil.ParseSSEStream(resp.Body, handler)
+}
+
+// ensureSession creates the ADK session for the given agent, user and
+// session ID. If the session already exists (409) it silently succeeds.
+func (a *agentAPI) ensureSession(agentID, userID, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.sessionURL(agentID, userID, sessionID), bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	a.setAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// 200 = created, 409 = already exists, both are fine
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		return fmt.Errorf("failed to create session: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sessionExists reports whether the ADK session exists. The agent API
+// answers a missing session with an error status, so anything but 200
+// counts as missing.
+func (a *agentAPI) sessionExists(agentID, userID, sessionID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", a.sessionURL(agentID, userID, sessionID), nil)
+	if err != nil {
+		return false, err
+	}
+	a.setAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// deleteSession removes an ADK session. A missing session is not an error.
+func (a *agentAPI) deleteSession(agentID, userID, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", a.sessionURL(agentID, userID, sessionID), nil)
+	if err != nil {
+		return err
+	}
+	a.setAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete session: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// transcribe sends WAV audio to the magec transcription proxy, which routes
+// it to the backend configured for the agent.
+func (a *agentAPI) transcribe(wavData []byte, agentID string) (string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(wavData); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.voiceURL(agentID, "transcription"), &buf)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	a.setAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("transcription failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// speech calls the magec TTS proxy for the agent and returns Opus audio.
+func (a *agentAPI) speech(text, agentID string) ([]byte, error) {
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"input":           text,
+		"response_format": "opus",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.voiceURL(agentID, "speech"), bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	a.setAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("TTS failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// listArtifacts returns the artifact names stored in a session.
+func (a *agentAPI) listArtifacts(agentID, userID, sessionID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", a.sessionURL(agentID, userID, sessionID)+"/artifacts", nil)
+	if err != nil {
+		return nil, err
+	}
+	a.setAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("artifact list returned status %d", resp.StatusCode)
+	}
+
+	var result []string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode artifact list: %w", err)
+	}
+	return result, nil
+}
+
+// downloadArtifact fetches an artifact and returns its bytes and MIME type.
+func (a *agentAPI) downloadArtifact(agentID, userID, sessionID, name string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", a.sessionURL(agentID, userID, sessionID)+"/artifacts/"+name, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	a.setAuthHeader(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("artifact download returned status %d", resp.StatusCode)
+	}
+
+	var artifact struct {
+		Text       string `json:"text,omitempty"`
+		InlineData *struct {
+			MIMEType string `json:"mimeType"`
+			Data     string `json:"data"`
+		} `json:"inlineData,omitempty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&artifact); err != nil {
+		return nil, "", fmt.Errorf("failed to decode artifact: %w", err)
+	}
+
+	if artifact.InlineData != nil {
+		data, err := base64.StdEncoding.DecodeString(artifact.InlineData.Data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode artifact binary data: %w", err)
+		}
+		return data, artifact.InlineData.MIMEType, nil
+	}
+
+	return []byte(artifact.Text), "text/plain", nil
+}
+
+func (a *agentAPI) sessionURL(agentID, userID, sessionID string) string {
+	return fmt.Sprintf("%s/apps/%s/users/%s/sessions/%s", a.baseURL, agentID, userID, sessionID)
+}
+
+func (a *agentAPI) voiceURL(agentID, endpoint string) string {
+	return strings.TrimSuffix(a.baseURL, "/agent") + "/voice/" + agentID + "/" + endpoint
+}
+
+// setAuthHeader adds the client token to requests sent to the magec API.
+func (a *agentAPI) setAuthHeader(req *http.Request) {
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+}
+
+// convertToWav shells out to ffmpeg to turn any voice note (OGG/Opus, M4A,
+// WebM...) into 16 kHz mono WAV, the format expected by transcription
+// backends. The input goes through a temp file because some containers need
+// a seekable input.
+func convertToWav(audio []byte) ([]byte, error) {
+	tmpIn, err := os.CreateTemp("", "magec-audio-in-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp input file: %w", err)
+	}
+	defer os.Remove(tmpIn.Name())
+
+	if _, err := tmpIn.Write(audio); err != nil {
+		tmpIn.Close()
+		return nil, fmt.Errorf("failed to write temp input file: %w", err)
+	}
+	tmpIn.Close()
+
+	cmd := exec.Command("ffmpeg", "-i", tmpIn.Name(), "-ar", "16000", "-ac", "1", "-f", "wav", "pipe:1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg conversion failed: %w, stderr: %s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// Download fetches a URL with an optional bearer token. Adapters use it to
+// load voice notes from their platform's file API.
+func Download(ctx context.Context, url, bearer string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
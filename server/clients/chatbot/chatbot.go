@@ -0,0 +1,749 @@
+// Copyright 2025 Alby Hernández
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chatbot is the platform-agnostic runtime shared by the
+// conversational clients (Telegram, Slack, Discord, ...). It owns everything
+// that talks to the magec agent API — sessions, streaming, transcription,
+// TTS, artifacts — plus the bot commands and per-chat state. A platform only
+// has to receive messages and implement the small Adapter interface to
+// deliver replies.
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/achetronic/magec/server/clients/msgutil"
+	"github.com/achetronic/magec/server/store"
+)
+
+// Response modes control how the bot replies to messages.
+// "text" sends only text, "voice" sends only audio, "mirror" matches the input
+// format (voice reply to voice, text reply to text), and "both" sends both.
+const (
+	ResponseModeText   = "text"
+	ResponseModeVoice  = "voice"
+	ResponseModeMirror = "mirror"
+	ResponseModeBoth   = "both"
+)
+
+// ResponseModes lists the valid response modes in display order.
+var ResponseModes = []string{ResponseModeText, ResponseModeVoice, ResponseModeMirror, ResponseModeBoth}
+
+// defaultUserID is used when the sender cannot be mapped to a Magec user.
+const defaultUserID = "default_user"
+
+// maxSessionOwners caps how many session owners a runtime remembers. A
+// forgotten session is just looked up again on its next message.
+const maxSessionOwners = 10000
+
+// AgentInfo is a lightweight reference to an agent that a bot is allowed to
+// talk to. It only carries display information; all runtime config (TTS,
+// transcription, LLM) is resolved server-side by the proxies.
+type AgentInfo struct {
+	ID   string
+	Name string
+}
+
+// Store is the subset of the store used by the runtime.
+type Store interface {
+	UpdateClient(id string, c store.ClientDefinition) error
+	ResolveUser(provider, externalID, name string) (string, error)
+}
+
+// Chat identifies where a conversation happens and where replies go.
+type Chat struct {
+	// ID is the chat or channel. Agent selection is tracked per ID.
+	ID string
+	// ThreadID scopes the session to a thread inside the chat, if any.
+	ThreadID string
+	// Group marks a chat shared by several people, such as a channel or a
+	// group room. Its session belongs to the chat rather than the sender.
+	Group bool
+	// Ref carries adapter-specific data needed to deliver replies.
+	Ref any
+}
+
+// Message is an incoming message, already filtered and authorised by the
+// adapter.
+type Message struct {
+	// ID is the platform message ID, used for reactions and to skip the
+	// message itself when reading thread history.
+	ID   string
+	Chat Chat
+	// UserID and UserName identify the sender on the platform. They are
+	// mapped to a Magec user through the user directory.
+	UserID   string
+	UserName string
+	Text     string
+	// Audio, when set, loads a voice message that is transcribed and used
+	// as the message text.
+	Audio func(ctx context.Context) ([]byte, error)
+	// Files are attachments handed to the agent alongside the text.
+	Files []File
+	// Meta is sent to the agent as a MAGEC_META comment. The runtime adds
+	// "source" when missing.
+	Meta map[string]any
+	// Ref carries adapter-specific data about the message.
+	Ref any
+}
+
+// File is an attachment sent to a chat or received from one.
+type File struct {
+	Name     string
+	Data     []byte
+	MIMEType string
+	// Voice marks a spoken reply; Caption then holds its transcript.
+	Voice   bool
+	Caption string
+}
+
+// HistoryEntry is a prior message in a thread.
+type HistoryEntry struct {
+	Author string
+	Text   string
+}
+
+// Reaction is a processing state shown on the user's message. Adapters map
+// each one to a platform emoji.
+type Reaction int
+
+const (
+	ReactionSeen Reaction = iota
+	ReactionThinking
+	ReactionDone
+	ReactionFailed
+)
+
+// TextKind tells the adapter how a text should be rendered.
+type TextKind int
+
+const (
+	// TextReply is agent output, sent verbatim.
+	TextReply TextKind = iota
+	// TextNotice is a plain runtime message: errors, the tool counter.
+	TextNotice
+	// TextMarkup is a command reply using Config.Bold and `code` spans.
+	TextMarkup
+	// TextTool is a tool call or result rendered by Config.FormatToolCall
+	// or Config.FormatToolResult.
+	TextTool
+)
+
+// Adapter delivers the runtime's output to a chat platform.
+type Adapter interface {
+	// SendText posts one message (already split to Config.MaxMessageLength)
+	// and returns its ID.
+	SendText(ctx context.Context, chat Chat, text string, kind TextKind) (string, error)
+	// EditText replaces the text of a message sent with SendText.
+	EditText(ctx context.Context, chat Chat, messageID, text string) error
+	SendFile(ctx context.Context, chat Chat, file File) error
+	React(ctx context.Context, msg Message, reaction Reaction) error
+	// FetchHistory returns the earlier messages of the thread msg belongs
+	// to, oldest first, excluding msg. Platforms without history return nil.
+	FetchHistory(ctx context.Context, msg Message) ([]HistoryEntry, error)
+}
+
+// Typer is implemented by adapters that can show a typing indicator. It is
+// refreshed every Config.TypingInterval while the agent is working.
+type Typer interface {
+	Typing(ctx context.Context, chat Chat)
+}
+
+// Config describes the platform to the runtime.
+type Config struct {
+	// Platform names the platform. It prefixes session IDs, is the identity
+	// provider for the user directory and the default "source" metadata.
+	Platform string
+	// CommandPrefix starts a bot command, e.g. "/" or "!".
+	CommandPrefix    string
+	MaxMessageLength int
+	Bold             func(string) string
+	FormatToolCall   func(msgutil.SSEEvent) string
+	FormatToolResult func(msgutil.SSEEvent) string
+	TypingInterval   time.Duration
+
+	// ResponseMode and DefaultAgent are the configured defaults.
+	ResponseMode string
+	DefaultAgent string
+	// SetDefaultAgent stores agentID as the default agent in the platform
+	// section of the client definition, so a switch survives restarts.
+	SetDefaultAgent func(def *store.ClientDefinition, agentID string)
+	// LegacySessions is set by platforms that predate the user directory,
+	// when every session belonged to default_user. A chat whose session only
+	// exists under default_user keeps using it, and the long-term memory
+	// stored with it, until the session is reset.
+	LegacySessions bool
+}
+
+// Runtime runs conversations between chat users and magec agents on behalf
+// of an Adapter.
+type Runtime struct {
+	// Config: injected at creation, read-only after New().
+	cfg     Config
+	adapter Adapter
+	api     *agentAPI
+	agents  []AgentInfo
+	store   Store
+	logger  *slog.Logger
+
+	// Mutable state: client definition (default agent), per-chat agent
+	// selection and runtime overrides.
+	mu                   sync.RWMutex
+	clientDef            store.ClientDefinition
+	activeAgent          map[string]string // chat ID -> agent ID
+	legacySession        map[string]bool   // session ID -> owned by default_user
+	responseModeOverride string
+	showTools            bool
+}
+
+// New creates a runtime that replies through adapter.
+func New(adapter Adapter, cfg Config, clientDef store.ClientDefinition, agentURL string, agents []AgentInfo, s Store, logger *slog.Logger) *Runtime {
+	if cfg.Bold == nil {
+		cfg.Bold = func(s string) string { return s }
+	}
+	return &Runtime{
+		cfg:           cfg,
+		adapter:       adapter,
+		api:           &agentAPI{baseURL: agentURL, token: clientDef.Token},
+		agents:        agents,
+		store:         s,
+		logger:        logger,
+		clientDef:     clientDef,
+		activeAgent:   make(map[string]string),
+		legacySession: make(map[string]bool),
+	}
+}
+
+// Handle runs a bot command or, if msg is not one, forwards it to the agent.
+func (r *Runtime) Handle(ctx context.Context, msg Message) {
+	if r.HandleCommand(ctx, msg) {
+		return
+	}
+	r.Process(ctx, msg)
+}
+
+// Process forwards a message to the chat's active agent and streams the
+// response back: text, tool activity, a voice reply according to the
+// response mode and any artifacts the agent created.
+func (r *Runtime) Process(ctx context.Context, msg Message) {
+	r.react(ctx, msg, ReactionSeen)
+
+	text := msg.Text
+	inputWasVoice := msg.Audio != nil
+	agentID := r.ActiveAgentID(msg.Chat.ID)
+
+	if inputWasVoice {
+		transcript, ok := r.transcribe(ctx, msg, agentID)
+		if !ok {
+			return
+		}
+		text = transcript
+	}
+
+	r.logger.Info("Message received", "platform", r.cfg.Platform, "chat", msg.Chat.ID, "user", msg.UserID, "voice", inputWasVoice, "text", text)
+	r.react(ctx, msg, ReactionThinking)
+	typingDone := r.startTyping(ctx, msg.Chat)
+
+	input, truncated := msgutil.ValidateInputLength(text, msgutil.DefaultMaxInputLength)
+	if truncated {
+		r.logger.Warn("Inbound message truncated", "chat", msg.Chat.ID, "original_len", len([]rune(text)))
+	}
+
+	sessionID := r.SessionID(msg.Chat, agentID)
+	userID := r.sessionOwner(msg, agentID, sessionID)
+	artifactsBefore := r.listArtifacts(agentID, userID, sessionID)
+
+	if err := r.api.ensureSession(agentID, userID, sessionID); err != nil {
+		r.logger.Warn("Failed to ensure session, continuing anyway", "error", err)
+	}
+	fullMessage := r.metaBlock(msg) + r.historyBlock(ctx, msg) + input
+
+	mode := r.ResponseMode()
+	suppressText := mode == ResponseModeVoice || (mode == ResponseModeMirror && inputWasVoice)
+	wantVoice := mode == ResponseModeVoice || mode == ResponseModeBoth || (mode == ResponseModeMirror && inputWasVoice)
+
+	var lastText, lastFinishReason, lastErrorMessage string
+	var lastUsage *msgutil.UsageMetadata
+	hasText, hasToolActivity := false, false
+	eventCount, toolCount := 0, 0
+	var toolCounterID string
+
+	err := r.api.run(agentID, userID, sessionID, fullMessage, msg.Files, func(evt msgutil.SSEEvent) {
+		eventCount++
+		if evt.FinishReason != "" {
+			lastFinishReason = evt.FinishReason
+		}
+		if evt.ErrorMessage != "" {
+			lastErrorMessage = evt.ErrorMessage
+		}
+		if evt.UsageMetadata != nil {
+			lastUsage = evt.UsageMetadata
+		}
+		switch evt.Type {
+		case msgutil.SSEEventText:
+			hasText = true
+			lastText = evt.Text
+			toolCount = 0
+			toolCounterID = ""
+			if !suppressText {
+				r.sendText(ctx, msg.Chat, evt.Text, TextReply)
+			}
+		case msgutil.SSEEventToolCall:
+			hasToolActivity = true
+			toolCounterID = r.sendToolCounter(ctx, msg.Chat, toolCounterID, &toolCount, evt)
+		case msgutil.SSEEventToolResult:
+			hasToolActivity = true
+			if r.ShowTools() {
+				r.sendText(ctx, msg.Chat, r.cfg.FormatToolResult(evt), TextTool)
+			}
+		case msgutil.SSEEventError:
+			r.logger.Error("Agent stream error",
+				"chat", msg.Chat.ID,
+				"error_code", evt.ErrorCode,
+				"error_message", evt.ErrorMessage,
+			)
+		}
+	})
+	close(typingDone)
+
+	if err != nil {
+		r.logger.Error("Failed to call agent", "error", err)
+		r.react(ctx, msg, ReactionFailed)
+		r.sendText(ctx, msg.Chat, fmt.Sprintf("Failed to process your request: %s", SanitizeError(err)), TextNotice)
+		return
+	}
+
+	if !hasText && !hasToolActivity {
+		logFields := []any{
+			"chat", msg.Chat.ID,
+			"agent", agentID,
+			"session", sessionID,
+			"events_received", eventCount,
+			"finish_reason", lastFinishReason,
+		}
+		if lastUsage != nil {
+			logFields = append(logFields, "prompt_tokens", lastUsage.PromptTokens, "total_tokens", lastUsage.TotalTokens)
+		}
+		r.logger.Warn("No text in agent response", logFields...)
+		r.sendText(ctx, msg.Chat, msgutil.ExplainNoResponse(lastFinishReason, lastErrorMessage), TextNotice)
+	}
+
+	if wantVoice && lastText != "" {
+		r.sendVoice(ctx, msg.Chat, lastText, agentID, suppressText)
+	}
+
+	r.react(ctx, msg, ReactionDone)
+	r.sendNewArtifacts(ctx, msg.Chat, agentID, userID, sessionID, artifactsBefore)
+}
+
+// transcribe loads, converts and transcribes a voice message. On failure it
+// tells the user and returns false.
+func (r *Runtime) transcribe(ctx context.Context, msg Message, agentID string) (string, bool) {
+	fail := func(text string, err error) (string, bool) {
+		r.logger.Error(text, "chat", msg.Chat.ID, "error", err)
+		r.react(ctx, msg, ReactionFailed)
+		return "", false
+	}
+
+	audio, err := msg.Audio(ctx)
+	if err != nil {
+		r.sendText(ctx, msg.Chat, "Failed to download your voice message. Please try again.", TextNotice)
+		return fail("Failed to download voice message", err)
+	}
+	wav, err := convertToWav(audio)
+	if err != nil {
+		r.sendText(ctx, msg.Chat, "Failed to process your voice message. Please try again.", TextNotice)
+		return fail("Failed to convert voice message", err)
+	}
+	text, err := r.api.transcribe(wav, agentID)
+	if err != nil {
+		r.sendText(ctx, msg.Chat, "Sorry, I couldn't transcribe your voice message.", TextNotice)
+		return fail("Failed to transcribe voice message", err)
+	}
+	r.logger.Info("Transcribed voice", "chat", msg.Chat.ID, "text", text)
+	return text, true
+}
+
+// sendText splits text to the platform limit and posts each chunk. It
+// returns the ID of the last chunk sent.
+func (r *Runtime) sendText(ctx context.Context, chat Chat, text string, kind TextKind) string {
+	var id string
+	for _, chunk := range msgutil.SplitMessage(text, r.cfg.MaxMessageLength) {
+		sent, err := r.adapter.SendText(ctx, chat, chunk, kind)
+		if err != nil {
+			r.logger.Error("Failed to send message", "platform", r.cfg.Platform, "chat", chat.ID, "error", err)
+			break
+		}
+		id = sent
+	}
+	return id
+}
+
+// Deliver posts text to chat outside of a conversation, e.g. a scheduled
+// result from a cron client. Unlike replies, failures are returned so the
+// caller can retry.
+func (r *Runtime) Deliver(ctx context.Context, chat Chat, text string) error {
+	for _, chunk := range msgutil.SplitMessage(text, r.cfg.MaxMessageLength) {
+		if _, err := r.adapter.SendText(ctx, chat, chunk, TextReply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendToolCounter posts or edits a compact tool activity counter. When
+// showTools is enabled it posts the full tool call instead. Returns the
+// counter message ID for subsequent edits.
+func (r *Runtime) sendToolCounter(ctx context.Context, chat Chat, counterID string, toolCount *int, evt msgutil.SSEEvent) string {
+	if r.ShowTools() {
+		r.sendText(ctx, chat, r.cfg.FormatToolCall(evt), TextTool)
+		return counterID
+	}
+
+	*toolCount++
+	counterText := fmt.Sprintf("⚙️ x%d", *toolCount)
+
+	if counterID == "" {
+		return r.sendText(ctx, chat, counterText, TextNotice)
+	}
+	if err := r.adapter.EditText(ctx, chat, counterID, counterText); err != nil {
+		r.logger.Debug("Failed to update tool counter", "error", err)
+	}
+	return counterID
+}
+
+// sendVoice synthesises text with the agent's TTS and posts it as a voice
+// message. If that fails and the text reply was suppressed, the text is sent
+// instead so the answer is not lost.
+func (r *Runtime) sendVoice(ctx context.Context, chat Chat, text, agentID string, textSuppressed bool) {
+	audio, err := r.api.speech(text, agentID)
+	if err == nil {
+		err = r.adapter.SendFile(ctx, chat, File{
+			Name:     "voice.ogg",
+			Data:     audio,
+			MIMEType: "audio/ogg",
+			Voice:    true,
+			Caption:  text,
+		})
+	}
+	if err != nil {
+		r.logger.Error("Failed to send voice response", "chat", chat.ID, "error", err)
+		if textSuppressed {
+			r.sendText(ctx, chat, text, TextReply)
+		}
+	}
+}
+
+// listArtifacts returns the artifact names of a session, or nil on error.
+func (r *Runtime) listArtifacts(agentID, userID, sessionID string) []string {
+	names, err := r.api.listArtifacts(agentID, userID, sessionID)
+	if err != nil {
+		r.logger.Debug("Failed to list artifacts", "error", err)
+	}
+	return names
+}
+
+// sendNewArtifacts posts the artifacts created during the current run as
+// file attachments.
+func (r *Runtime) sendNewArtifacts(ctx context.Context, chat Chat, agentID, userID, sessionID string, before []string) {
+	for _, name := range r.listArtifacts(agentID, userID, sessionID) {
+		if slices.Contains(before, name) {
+			continue
+		}
+		data, mimeType, err := r.api.downloadArtifact(agentID, userID, sessionID, name)
+		if err != nil {
+			r.logger.Error("Failed to download artifact", "name", name, "error", err)
+			continue
+		}
+		if err := r.adapter.SendFile(ctx, chat, File{Name: name, Data: data, MIMEType: mimeType}); err != nil {
+			r.logger.Error("Failed to send artifact", "name", name, "error", err)
+		}
+	}
+}
+
+// react sets a processing reaction; failures are only logged.
+func (r *Runtime) react(ctx context.Context, msg Message, reaction Reaction) {
+	if err := r.adapter.React(ctx, msg, reaction); err != nil {
+		r.logger.Debug("Failed to set reaction", "reaction", reaction, "error", err)
+	}
+}
+
+// startTyping refreshes the typing indicator until the returned channel is
+// closed. It is a no-op for adapters that do not implement Typer.
+func (r *Runtime) startTyping(ctx context.Context, chat Chat) chan struct{} {
+	done := make(chan struct{})
+	typer, ok := r.adapter.(Typer)
+	if !ok || r.cfg.TypingInterval <= 0 {
+		return done
+	}
+	typer.Typing(ctx, chat)
+	go func() {
+		ticker := time.NewTicker(r.cfg.TypingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				typer.Typing(ctx, chat)
+			}
+		}
+	}()
+	return done
+}
+
+// metaBlock renders msg.Meta as the invisible metadata comment prepended to
+// the user's message so the LLM knows who is writing and from where.
+func (r *Runtime) metaBlock(msg Message) string {
+	meta := make(map[string]any, len(msg.Meta)+1)
+	for k, v := range msg.Meta {
+		meta[k] = v
+	}
+	if _, ok := meta["source"]; !ok {
+		meta["source"] = r.cfg.Platform
+	}
+	if msg.Chat.Group && msg.UserID != "" {
+		meta["magec_user_id"] = r.ResolveUser(msg.UserID, msg.UserName)
+	}
+	jsonBytes, err := json.Marshal(meta)
+	if err != nil {
+		r.logger.Warn("Failed to marshal message context metadata", "error", err)
+		return ""
+	}
+	return fmt.Sprintf("<!--MAGEC_META:%s:MAGEC_META-->\n", string(jsonBytes))
+}
+
+// historyBlock renders the thread history as context for the agent.
+func (r *Runtime) historyBlock(ctx context.Context, msg Message) string {
+	entries, err := r.adapter.FetchHistory(ctx, msg)
+	if err != nil {
+		r.logger.Debug("Failed to fetch thread context", "error", err)
+		return ""
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("<!--MAGEC_THREAD_HISTORY:\n")
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "[%s]: %s\n", e.Author, e.Text)
+	}
+	sb.WriteString(":MAGEC_THREAD_HISTORY-->\n")
+	return sb.String()
+}
+
+// SessionID builds a stable session ID scoped to a chat (and thread, when
+// set) and agent: <platform>_<chat>[_<thread>]_<agent>.
+func (r *Runtime) SessionID(chat Chat, agentID string) string {
+	if chat.ThreadID != "" {
+		return fmt.Sprintf("%s_%s_%s_%s", r.cfg.Platform, chat.ID, chat.ThreadID, agentID)
+	}
+	return fmt.Sprintf("%s_%s_%s", r.cfg.Platform, chat.ID, agentID)
+}
+
+// SessionUserID returns the ADK user that owns msg's session. A group chat
+// is one conversation shared by its members, so it gets a user of its own and
+// the sender only appears as magec_user_id in the metadata. Direct chats use
+// the sender's Magec user, so sessions and memories follow the person across
+// clients.
+func (r *Runtime) SessionUserID(msg Message) string {
+	if msg.Chat.Group {
+		return fmt.Sprintf("%s_%s", r.cfg.Platform, msg.Chat.ID)
+	}
+	return r.ResolveUser(msg.UserID, msg.UserName)
+}
+
+// sessionOwner returns the ADK user whose session msg continues: the
+// SessionUserID, or default_user for a session created before the user
+// directory (see Config.LegacySessions). The lookup is done once per session.
+func (r *Runtime) sessionOwner(msg Message, agentID, sessionID string) string {
+	userID := r.SessionUserID(msg)
+	if !r.cfg.LegacySessions || userID == defaultUserID {
+		return userID
+	}
+
+	r.mu.RLock()
+	legacy, checked := r.legacySession[sessionID]
+	r.mu.RUnlock()
+	if !checked {
+		var err error
+		legacy, err = r.isLegacySession(agentID, userID, sessionID)
+		if err != nil {
+			r.logger.Warn("Failed to look up legacy session", "session", sessionID, "error", err)
+			return userID
+		}
+		r.mu.Lock()
+		r.rememberSessionOwner(sessionID, legacy)
+		r.mu.Unlock()
+		if legacy {
+			r.logger.Info("Continuing legacy session", "platform", r.cfg.Platform, "session", sessionID, "user", defaultUserID)
+		}
+	}
+	if legacy {
+		return defaultUserID
+	}
+	return userID
+}
+
+// rememberSessionOwner caches the result of a legacy session lookup. When
+// the cache is full, sessions known not to be legacy are dropped first:
+// they are the bulk of it and cost a single lookup to find again. Callers
+// must hold r.mu.
+func (r *Runtime) rememberSessionOwner(sessionID string, legacy bool) {
+	if len(r.legacySession) >= maxSessionOwners {
+		for id, l := range r.legacySession {
+			if !l {
+				delete(r.legacySession, id)
+			}
+		}
+		if len(r.legacySession) >= maxSessionOwners {
+			clear(r.legacySession)
+		}
+	}
+	r.legacySession[sessionID] = legacy
+}
+
+// isLegacySession reports whether sessionID exists under default_user but
+// not under userID.
+func (r *Runtime) isLegacySession(agentID, userID, sessionID string) (bool, error) {
+	exists, err := r.api.sessionExists(agentID, userID, sessionID)
+	if err != nil || exists {
+		return false, err
+	}
+	return r.api.sessionExists(agentID, defaultUserID, sessionID)
+}
+
+// ResolveUser maps a platform user to its Magec user so sessions and
+// long-term memory are shared with the person's other linked clients.
+func (r *Runtime) ResolveUser(platformUserID, name string) string {
+	if platformUserID == "" {
+		return defaultUserID
+	}
+	userID, err := r.store.ResolveUser(r.cfg.Platform, platformUserID, name)
+	if err != nil {
+		r.logger.Warn("Failed to resolve user identity", "user", platformUserID, "error", err)
+	}
+	if userID == "" {
+		return defaultUserID
+	}
+	return userID
+}
+
+// ActiveAgentID returns the agent selected for a chat, falling back to the
+// configured default and then to the first allowed agent.
+func (r *Runtime) ActiveAgentID(chatID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id, ok := r.activeAgent[chatID]; ok {
+		return id
+	}
+	if r.cfg.DefaultAgent != "" {
+		return r.cfg.DefaultAgent
+	}
+	if len(r.clientDef.AllowedAgents) > 0 {
+		return r.clientDef.AllowedAgents[0]
+	}
+	if len(r.agents) > 0 {
+		return r.agents[0].ID
+	}
+	return ""
+}
+
+// SetActiveAgentID switches a chat to another agent and persists it as the
+// client's default agent.
+func (r *Runtime) SetActiveAgentID(chatID, agentID string) {
+	r.mu.Lock()
+	r.activeAgent[chatID] = agentID
+	r.cfg.DefaultAgent = agentID
+	def := r.clientDef
+	if r.cfg.SetDefaultAgent != nil {
+		r.cfg.SetDefaultAgent(&def, agentID)
+	}
+	r.clientDef = def
+	r.mu.Unlock()
+
+	if r.cfg.SetDefaultAgent == nil {
+		return
+	}
+	if err := r.store.UpdateClient(def.ID, def); err != nil {
+		r.logger.Warn("Failed to persist default agent", "error", err)
+	}
+}
+
+// AgentInfo looks up an allowed agent by ID. Returns nil if the agent is
+// not in the list.
+func (r *Runtime) AgentInfo(agentID string) *AgentInfo {
+	i := slices.IndexFunc(r.agents, func(a AgentInfo) bool { return a.ID == agentID })
+	if i < 0 {
+		return nil
+	}
+	return &r.agents[i]
+}
+
+// AgentLabel returns the display name of an agent, falling back to its ID.
+func (r *Runtime) AgentLabel(agentID string) string {
+	if a := r.AgentInfo(agentID); a != nil && a.Name != "" {
+		return a.Name
+	}
+	return agentID
+}
+
+// ResponseMode returns the current response mode. A runtime override set
+// with the responsemode command takes precedence over the config default.
+func (r *Runtime) ResponseMode() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.responseModeOverride != "" {
+		return r.responseModeOverride
+	}
+	return r.configResponseMode()
+}
+
+// configResponseMode returns the configured response mode, defaulting to text.
+func (r *Runtime) configResponseMode() string {
+	if r.cfg.ResponseMode != "" {
+		return r.cfg.ResponseMode
+	}
+	return ResponseModeText
+}
+
+// ShowTools reports whether tool calls are posted in full.
+func (r *Runtime) ShowTools() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.showTools
+}
+
+// SanitizeError returns an error message safe to show in a chat: truncated,
+// and replaced entirely when it may contain a credential.
+func SanitizeError(err error) string {
+	msg := err.Error()
+	if len(msg) > 200 {
+		msg = msg[:200] + "..."
+	}
+	lower := strings.ToLower(msg)
+	for _, secret := range []string{"bearer ", "xoxb-", "xapp-", "bot", "token"} {
+		if strings.Contains(lower, secret) {
+			return "an internal error occurred"
+		}
+	}
+	return msg
+}
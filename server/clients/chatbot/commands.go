@@ -0,0 +1,184 @@
+// Copyright 2025 Alby Hernández
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// HandleCommand runs msg as a bot command (help, agent, reset, responsemode,
+// showtools, start) and reports whether it was one. Unknown commands are
+// not handled so they reach the agent as plain text.
+func (r *Runtime) HandleCommand(ctx context.Context, msg Message) bool {
+	text := strings.TrimSpace(msg.Text)
+	if r.cfg.CommandPrefix == "" || !strings.HasPrefix(text, r.cfg.CommandPrefix) {
+		return false
+	}
+	name, args, _ := strings.Cut(strings.TrimPrefix(text, r.cfg.CommandPrefix), " ")
+	// Telegram appends the bot username in groups: /agent@magec_bot.
+	name, _, _ = strings.Cut(strings.ToLower(name), "@")
+	args = strings.TrimSpace(args)
+
+	var reply string
+	switch name {
+	case "start":
+		reply = r.startCommand(msg)
+	case "help":
+		reply = r.helpCommand()
+	case "agent":
+		reply = r.agentCommand(msg, args)
+	case "reset":
+		reply = r.resetCommand(msg)
+	case "responsemode":
+		reply = r.responseModeCommand(args)
+	case "showtools":
+		reply = r.showToolsCommand()
+	default:
+		return false
+	}
+	r.sendText(ctx, msg.Chat, reply, TextMarkup)
+	return true
+}
+
+func (r *Runtime) startCommand(msg Message) string {
+	return fmt.Sprintf("👋 %s You are now talking to %s.\n\nType %s to see available commands.",
+		r.cfg.Bold("Welcome!"), r.cfg.Bold(r.AgentLabel(r.ActiveAgentID(msg.Chat.ID))), r.command("help"))
+}
+
+func (r *Runtime) helpCommand() string {
+	return r.cfg.Bold("Available commands:") + "\n" +
+		"• " + r.command("help") + " — Show this help message\n" +
+		"• " + r.command("agent") + " — Show or switch the active agent\n" +
+		"• " + r.command("agent <id>") + " — Switch to a specific agent\n" +
+		"• " + r.command("reset") + " — Reset the conversation session\n" +
+		"• " + r.command("responsemode") + " — Show or change the response mode\n" +
+		"• " + r.command("responsemode <mode>") + " — Set response mode (" + r.modeOptions() + ")\n" +
+		"• " + r.command("showtools") + " — Toggle tool call visibility\n" +
+		"• " + r.command("start") + " — Show the welcome message"
+}
+
+// agentCommand shows the active agent and lists the available ones, or
+// switches the chat to the agent given in args.
+func (r *Runtime) agentCommand(msg Message, args string) string {
+	if args == "" {
+		currentID := r.ActiveAgentID(msg.Chat.ID)
+		currentLabel := currentID
+		if a := r.AgentInfo(currentID); a != nil && a.Name != "" {
+			currentLabel = fmt.Sprintf("%s (`%s`)", a.Name, currentID)
+		}
+
+		var agentList strings.Builder
+		for _, a := range r.agents {
+			marker := "  "
+			if a.ID == currentID {
+				marker = "▸ "
+			}
+			label := a.ID
+			if a.Name != "" {
+				label = fmt.Sprintf("%s (`%s`)", a.Name, a.ID)
+			}
+			fmt.Fprintf(&agentList, "%s%s\n", marker, label)
+		}
+		return fmt.Sprintf("%s %s\n\n%s\n%s\nUsage: %s",
+			r.cfg.Bold("Active agent:"), currentLabel, r.cfg.Bold("Available agents:"), agentList.String(), r.command("agent <id>"))
+	}
+
+	if r.AgentInfo(args) == nil {
+		ids := make([]string, 0, len(r.agents))
+		for _, a := range r.agents {
+			ids = append(ids, "`"+a.ID+"`")
+		}
+		return fmt.Sprintf("Unknown agent `%s`. Available: %s", args, strings.Join(ids, ", "))
+	}
+
+	r.SetActiveAgentID(msg.Chat.ID, args)
+	r.logger.Info("Agent switched", "platform", r.cfg.Platform, "chat", msg.Chat.ID, "user", msg.UserID, "agent", args)
+	return fmt.Sprintf("Switched to agent %s (`%s`)", r.cfg.Bold(r.AgentLabel(args)), args)
+}
+
+// resetCommand deletes the ADK session for the current chat and thread.
+func (r *Runtime) resetCommand(msg Message) string {
+	agentID := r.ActiveAgentID(msg.Chat.ID)
+	sessionID := r.SessionID(msg.Chat, agentID)
+	if err := r.api.deleteSession(agentID, r.sessionOwner(msg, agentID, sessionID), sessionID); err != nil {
+		r.logger.Error("Failed to delete session", "error", err)
+		return "Failed to reset session."
+	}
+	// The legacy session is gone, so the next lookup finds the session
+	// belongs to the chat's own user.
+	r.mu.Lock()
+	delete(r.legacySession, sessionID)
+	r.mu.Unlock()
+	r.logger.Info("Session reset", "platform", r.cfg.Platform, "chat", msg.Chat.ID, "agent", agentID, "session", sessionID)
+	return fmt.Sprintf("Session reset for %s. Next message starts a fresh conversation.", r.cfg.Bold(r.AgentLabel(agentID)))
+}
+
+// responseModeCommand shows the current mode, overrides it until restart,
+// or with "reset" goes back to the config default.
+func (r *Runtime) responseModeCommand(args string) string {
+	switch {
+	case args == "":
+		r.mu.RLock()
+		overridden := r.responseModeOverride != ""
+		r.mu.RUnlock()
+
+		status := fmt.Sprintf("%s `%s`", r.cfg.Bold("Response mode:"), r.ResponseMode())
+		if overridden {
+			status += fmt.Sprintf(" (override, config: `%s`)", r.configResponseMode())
+		}
+		return status + fmt.Sprintf("\n%s %s", r.cfg.Bold("Options:"), r.modeOptions())
+
+	case args == "reset":
+		r.mu.Lock()
+		r.responseModeOverride = ""
+		r.mu.Unlock()
+		r.logger.Info("Response mode override cleared", "config_mode", r.configResponseMode())
+		return fmt.Sprintf("Response mode reset to config default: `%s`", r.configResponseMode())
+
+	case !slices.Contains(ResponseModes, args):
+		return fmt.Sprintf("Invalid mode `%s`. Valid options: %s", args, r.modeOptions())
+	}
+
+	r.mu.Lock()
+	r.responseModeOverride = args
+	r.mu.Unlock()
+	r.logger.Info("Response mode overridden", "new_mode", args)
+	return fmt.Sprintf("Response mode set to `%s` (until restart)", args)
+}
+
+func (r *Runtime) showToolsCommand() string {
+	r.mu.Lock()
+	r.showTools = !r.showTools
+	state := r.showTools
+	r.mu.Unlock()
+
+	label := "OFF"
+	if state {
+		label = "ON"
+	}
+	return fmt.Sprintf("🔧 Tool call visibility: %s", r.cfg.Bold(label))
+}
+
+// command renders a command name with the platform prefix as a code span.
+func (r *Runtime) command(name string) string {
+	return "`" + r.cfg.CommandPrefix + name + "`"
+}
+
+func (r *Runtime) modeOptions() string {
+	return "`" + strings.Join(ResponseModes, "`, `") + "`, `reset`"
+}
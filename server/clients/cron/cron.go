@@ -7,13 +7,21 @@ import (
 	"time"
 )
 
-// Schedule represents a parsed standard cron expression (min hour dom month dow).
+// Schedule represents a parsed cron expression: the standard five fields
+// (min hour dom month dow), optionally preceded by a seconds field. It is
+// evaluated in its location's wall-clock time.
 type Schedule struct {
+	seconds  [60]bool
 	minutes  [60]bool
 	hours    [24]bool
 	days     [31]bool
 	months   [12]bool
 	weekdays [7]bool
+
+	// every is set for "@every <duration>" schedules, which fire at a fixed
+	// interval instead of matching fields.
+	every    time.Duration
+	location *time.Location
 }
 
 var shorthands = map[string]string{
@@ -26,19 +34,43 @@ var shorthands = map[string]string{
 	"@hourly":   "0 * * * *",
 }
 
-// Parse parses a standard 5-field cron expression or a shorthand like @daily, @hourly.
-func Parse(expr string) (*Schedule, error) {
+// Parse parses a cron expression evaluated in loc (the server's local time
+// when nil). It accepts 5 fields, 6 fields with leading seconds, shorthands
+// like @daily or @hourly, and "@every <duration>" (e.g. "@every 90s").
+func Parse(expr string, loc *time.Location) (*Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	s := &Schedule{location: loc}
+
 	trimmed := strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(strings.ToLower(trimmed), "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid @every duration: %w", err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("@every duration must be at least 1s")
+		}
+		s.every = d
+		return s, nil
+	}
 	if expanded, ok := shorthands[strings.ToLower(trimmed)]; ok {
 		trimmed = expanded
 	}
 	fields := strings.Fields(trimmed)
-	if len(fields) != 5 {
-		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	switch len(fields) {
+	case 5:
+		s.seconds[0] = true
+	case 6:
+		if err := parseField(fields[0], s.seconds[:], 0, 59); err != nil {
+			return nil, fmt.Errorf("second: %w", err)
+		}
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf("expected 5 or 6 fields, got %d", len(fields))
 	}
 
-	s := &Schedule{}
-
 	if err := parseField(fields[0], s.minutes[:], 0, 59); err != nil {
 		return nil, fmt.Errorf("minute: %w", err)
 	}
@@ -103,24 +135,60 @@ func parseField(field string, bits []bool, min, max int) error {
 	return nil
 }
 
-// Next returns the next time after t that matches the schedule.
+// Next returns the next time after t that matches the schedule. Days that
+// don't match are skipped whole, so sparse schedules stay cheap.
 func (s *Schedule) Next(t time.Time) time.Time {
-	t = t.Add(time.Minute).Truncate(time.Minute)
+	if s.every > 0 {
+		return t.Add(s.every).Truncate(time.Second)
+	}
 
-	for i := 0; i < 366*24*60; i++ {
-		if s.matches(t) {
-			return t
+	t = t.In(s.location).Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !s.matchesDay(t) {
+			y, m, d := t.Date()
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.hours[t.Hour()] || !s.minutes[t.Minute()] {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if s.repeatedWallClock(t) {
+			// Second pass through an hour repeated when clocks go back: a
+			// job pinned to specific hours already ran in the first one.
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		for sec := t.Second(); sec < 60; sec++ {
+			if s.seconds[sec] {
+				return t.Add(time.Duration(sec-t.Second()) * time.Second)
+			}
 		}
-		t = t.Add(time.Minute)
+		t = t.Truncate(time.Minute).Add(time.Minute)
 	}
 
-	return t
+	return limit
+}
+
+// repeatedWallClock reports whether t's wall-clock minute already happened
+// an hour earlier, which only occurs when clocks go back. Schedules that run
+// every hour are not affected.
+func (s *Schedule) repeatedWallClock(t time.Time) bool {
+	allHours := true
+	for _, h := range s.hours {
+		allHours = allHours && h
+	}
+	if allHours {
+		return false
+	}
+	prev := t.Add(-time.Hour)
+	return prev.Hour() == t.Hour() && prev.Minute() == t.Minute()
 }
 
-func (s *Schedule) matches(t time.Time) bool {
-	return s.minutes[t.Minute()] &&
-		s.hours[t.Hour()] &&
-		s.days[t.Day()-1] &&
+func (s *Schedule) matchesDay(t time.Time) bool {
+	return s.days[t.Day()-1] &&
 		s.months[t.Month()-1] &&
 		s.weekdays[t.Weekday()]
 }
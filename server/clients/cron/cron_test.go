@@ -0,0 +1,263 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"empty", ""},
+		{"too few fields", "* * * *"},
+		{"too many fields", "0 * * * * * *"},
+		{"minute out of range", "60 * * * *"},
+		{"hour out of range", "* 24 * * *"},
+		{"day zero", "0 0 0 * *"},
+		{"month out of range", "* * * 13 *"},
+		{"weekday out of range", "* * * * 7"},
+		{"second out of range", "60 * * * * *"},
+		{"zero step", "*/0 * * * *"},
+		{"bad step", "*/x * * * *"},
+		{"reversed range", "5-1 * * * *"},
+		{"bad range end", "1-x * * * *"},
+		{"not a number", "a * * * *"},
+		{"unknown shorthand", "@fortnightly"},
+		{"every too short", "@every 500ms"},
+		{"every invalid", "@every soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.expr, time.UTC); err == nil {
+				t.Errorf("Parse(%q) expected an error", tt.expr)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2026-01-03 is a Saturday.
+	from := time.Date(2026, 1, 3, 10, 0, 5, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", from, time.Date(2026, 1, 3, 10, 1, 0, 0, time.UTC)},
+		{"list", "15,45 * * * *", from, time.Date(2026, 1, 3, 10, 15, 0, 0, time.UTC)},
+		{"range with step", "0 8-18/4 * * *", from, time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC)},
+		{"weekdays skip the weekend", "0 9 * * 1-5", from, time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)},
+		{"month and day", "0 0 1 3 *", from, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"seconds field", "*/20 * * * * *", from, time.Date(2026, 1, 3, 10, 0, 20, 0, time.UTC)},
+		{"seconds field in later minute", "30 5 * * * *", from, time.Date(2026, 1, 3, 10, 5, 30, 0, time.UTC)},
+		{"strictly after", "0 10 * * *", time.Date(2026, 1, 3, 10, 0, 0, 0, time.UTC), time.Date(2026, 1, 4, 10, 0, 0, 0, time.UTC)},
+		{"daily shorthand", "@daily", from, time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"shorthand case insensitive", "@HOURLY", from, time.Date(2026, 1, 3, 11, 0, 0, 0, time.UTC)},
+		{"weekly shorthand", "@weekly", from, time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"every", "@every 90s", from, time.Date(2026, 1, 3, 10, 1, 35, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched, err := Parse(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := sched.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNext_Timezone(t *testing.T) {
+	ny := mustLocation(t, "America/New_York")
+	sched, err := Parse("0 9 * * *", ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC) // 07:00 in New York
+	want := time.Date(2026, 1, 3, 14, 0, 0, 0, time.UTC)
+	if got := sched.Next(from); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got.UTC(), want)
+	}
+}
+
+// In Europe/Madrid clocks go forward from 02:00 to 03:00 on 2026-03-29 and
+// back from 03:00 to 02:00 on 2026-10-25.
+func TestNext_DaylightSaving(t *testing.T) {
+	madrid := mustLocation(t, "Europe/Madrid")
+	cest := time.FixedZone("CEST", 2*3600)
+	cet := time.FixedZone("CET", 3600)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			name: "spring forward skips a missing time",
+			expr: "30 2 * * *",
+			from: time.Date(2026, 3, 28, 3, 0, 0, 0, cet),
+			want: []time.Time{time.Date(2026, 3, 30, 2, 30, 0, 0, cest)},
+		},
+		{
+			name: "spring forward keeps hourly runs",
+			expr: "0 * * * *",
+			from: time.Date(2026, 3, 29, 1, 30, 0, 0, cet),
+			want: []time.Time{
+				time.Date(2026, 3, 29, 3, 0, 0, 0, cest),
+				time.Date(2026, 3, 29, 4, 0, 0, 0, cest),
+			},
+		},
+		{
+			name: "fall back runs a repeated time once",
+			expr: "30 2 * * *",
+			from: time.Date(2026, 10, 25, 0, 0, 0, 0, cest),
+			want: []time.Time{
+				time.Date(2026, 10, 25, 2, 30, 0, 0, cest),
+				time.Date(2026, 10, 26, 2, 30, 0, 0, cet),
+			},
+		},
+		{
+			name: "fall back skips the whole repeated hour",
+			expr: "*/20 2 * * *",
+			from: time.Date(2026, 10, 25, 2, 30, 0, 0, cest),
+			want: []time.Time{
+				time.Date(2026, 10, 25, 2, 40, 0, 0, cest),
+				time.Date(2026, 10, 26, 2, 0, 0, 0, cet),
+			},
+		},
+		{
+			name: "fall back keeps hourly runs in both passes",
+			expr: "0 * * * *",
+			from: time.Date(2026, 10, 25, 1, 30, 0, 0, cest),
+			want: []time.Time{
+				time.Date(2026, 10, 25, 2, 0, 0, 0, cest),
+				time.Date(2026, 10, 25, 2, 0, 0, 0, cet),
+				time.Date(2026, 10, 25, 3, 0, 0, 0, cet),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched, err := Parse(tt.expr, madrid)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			cur := tt.from
+			for i, want := range tt.want {
+				cur = sched.Next(cur)
+				if !cur.Equal(want) {
+					t.Fatalf("run %d = %v, want %v", i+1, cur, want.In(madrid))
+				}
+			}
+		})
+	}
+}
+
+func TestMissedSlots(t *testing.T) {
+	sched, err := Parse("0 * * * *", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := time.Date(2026, 1, 3, 10, 0, 0, 0, time.UTC)
+
+	missed, total := missedSlots(sched, last, last.Add(30*time.Minute))
+	if total != 0 || len(missed) != 0 {
+		t.Errorf("expected no missed slots, got %d (%v)", total, missed)
+	}
+
+	missed, total = missedSlots(sched, last, time.Date(2026, 1, 3, 13, 0, 0, 0, time.UTC))
+	want := []time.Time{
+		time.Date(2026, 1, 3, 11, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 3, 13, 0, 0, 0, time.UTC),
+	}
+	if total != len(want) || len(missed) != len(want) {
+		t.Fatalf("missed %d slots (%v), want %d", total, missed, len(want))
+	}
+	for i := range want {
+		if !missed[i].Equal(want[i]) {
+			t.Errorf("slot %d = %v, want %v", i, missed[i], want[i])
+		}
+	}
+
+	// Only the latest maxCatchUpRuns are kept, oldest first.
+	missed, total = missedSlots(sched, last, last.Add(48*time.Hour))
+	if total != 48 || len(missed) != maxCatchUpRuns {
+		t.Fatalf("got %d slots of %d missed, want %d of 48", len(missed), total, maxCatchUpRuns)
+	}
+	if !missed[len(missed)-1].Equal(last.Add(48 * time.Hour)) {
+		t.Errorf("latest slot = %v, want %v", missed[len(missed)-1], last.Add(48*time.Hour))
+	}
+	if !missed[0].Before(missed[1]) {
+		t.Error("expected slots oldest first")
+	}
+}
+
+func TestCatchUpRuns(t *testing.T) {
+	base := time.Date(2026, 1, 3, 10, 0, 0, 0, time.UTC)
+	missed := []time.Time{base, base.Add(time.Hour), base.Add(2 * time.Hour)}
+
+	tests := []struct {
+		policy string
+		want   []time.Time
+	}{
+		{"", nil},
+		{CatchUpSkip, nil},
+		{CatchUpOnce, missed[2:]},
+		{CatchUpAll, missed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			got := catchUpRuns(tt.policy, missed)
+			if len(got) != len(tt.want) {
+				t.Fatalf("catchUpRuns(%q) = %v, want %v", tt.policy, got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("catchUpRuns(%q)[%d] = %v, want %v", tt.policy, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if got := catchUpRuns(CatchUpAll, nil); got != nil {
+		t.Errorf("expected nothing to run without missed slots, got %v", got)
+	}
+}
+
+func TestRetry_Disabled(t *testing.T) {
+	s := &Scheduler{logger: slog.New(slog.DiscardHandler)}
+	for _, n := range []int{0, -1} {
+		cl := store.ClientDefinition{Config: store.ClientConfig{Cron: &store.CronClientConfig{DeliveryRetries: &n}}}
+		calls := 0
+		out := s.retry(context.Background(), cl, func(context.Context) error {
+			calls++
+			return errors.New("unreachable")
+		})
+		if calls != 1 || out.attempts != 1 || out.err == nil {
+			t.Errorf("deliveryRetries %d: %d calls, outcome %+v, want a single failed attempt", n, calls, out)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/achetronic/magec/server/clients"
+	"github.com/achetronic/magec/server/store"
+)
+
+const (
+	defaultDeliveryRetries = 3
+	maxDeliveryBackoff     = time.Minute
+	deliveryTimeout        = 30 * time.Second
+)
+
+// deliveryPayload is the JSON body POSTed to a cron client's delivery URL.
+type deliveryPayload struct {
+	ClientID   string    `json:"clientId"`
+	ClientName string    `json:"clientName"`
+	CommandID  string    `json:"commandId"`
+	Response   string    `json:"response"`
+	FiredAt    time.Time `json:"firedAt"`
+}
+
+// deliver sends the result of a run to the client's delivery targets and
+// records each outcome in the run's conversations.
+func (s *Scheduler) deliver(ctx context.Context, cl store.ClientDefinition, firedAt time.Time, res clients.RunResult) {
+	cfg := cl.Config.Cron
+
+	if cfg.DeliveryClientID != "" {
+		label := cfg.DeliveryClientID
+		if target, ok := s.store.GetClient(cfg.DeliveryClientID); ok {
+			label = target.Name
+		}
+		if cfg.DeliveryTarget != "" {
+			label += " (" + cfg.DeliveryTarget + ")"
+		}
+		s.record(ctx, cl, res, "client", label, s.retry(ctx, cl, func(ctx context.Context) error {
+			if s.deliverer == nil {
+				return fmt.Errorf("client delivery is not available")
+			}
+			return s.deliverer.Deliver(ctx, cfg.DeliveryClientID, cfg.DeliveryTarget, cl.Name, res.Text)
+		}))
+	}
+
+	if cfg.DeliveryURL != "" {
+		payload := deliveryPayload{
+			ClientID:   cl.ID,
+			ClientName: cl.Name,
+			CommandID:  cfg.CommandID,
+			Response:   res.Text,
+			FiredAt:    firedAt,
+		}
+		s.record(ctx, cl, res, "url", cfg.DeliveryURL, s.retry(ctx, cl, func(ctx context.Context) error {
+			return postResult(ctx, cfg.DeliveryURL, payload)
+		}))
+	}
+}
+
+// retry calls send until it succeeds or the client's retries are used up,
+// backing off exponentially between attempts. It returns the number of
+// attempts made and the last error.
+func (s *Scheduler) retry(ctx context.Context, cl store.ClientDefinition, send func(context.Context) error) deliveryOutcome {
+	retries := defaultDeliveryRetries
+	if n := cl.Config.Cron.DeliveryRetries; n != nil {
+		retries = max(*n, 0)
+	}
+
+	backoff := 2 * time.Second
+	var out deliveryOutcome
+	for {
+		out.attempts++
+		sendCtx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+		out.err = send(sendCtx)
+		cancel()
+		if out.err == nil || out.attempts > retries {
+			return out
+		}
+		s.logger.Warn("Cron delivery failed, retrying", "client", cl.Name, "attempt", out.attempts, "error", out.err)
+		select {
+		case <-ctx.Done():
+			return out
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxDeliveryBackoff)
+	}
+}
+
+type deliveryOutcome struct {
+	attempts int
+	err      error
+}
+
+// record logs a delivery outcome and appends it to every conversation of
+// the run.
+func (s *Scheduler) record(ctx context.Context, cl store.ClientDefinition, res clients.RunResult, kind, target string, out deliveryOutcome) {
+	metadata := map[string]interface{}{
+		"delivery": kind,
+		"target":   target,
+		"attempts": out.attempts,
+		"success":  out.err == nil,
+	}
+	var note string
+	if out.err == nil {
+		s.logger.Info("Cron result delivered", "client", cl.Name, "to", target, "attempts", out.attempts)
+		note = "Delivered to " + target
+	} else {
+		s.logger.Error("Cron delivery failed", "client", cl.Name, "to", target, "attempts", out.attempts, "error", out.err)
+		note = fmt.Sprintf("Delivery to %s failed after %d attempts: %v", target, out.attempts, out.err)
+		metadata["error"] = out.err.Error()
+	}
+	for _, sess := range res.Sessions {
+		s.executor.RecordNote(ctx, sess, note, metadata)
+	}
+}
+
+// postResult POSTs the run result as JSON. Any 2xx status is a success.
+func postResult(ctx context.Context, url string, payload deliveryPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "magec-cron")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
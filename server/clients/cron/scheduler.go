@@ -2,34 +2,59 @@ package cron
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
+	_ "time/tzdata" // IANA timezones on hosts without a zoneinfo database
 
 	"github.com/achetronic/magec/server/clients"
 	"github.com/achetronic/magec/server/store"
 )
 
+// Catch-up policies for runs missed while the server was down.
+const (
+	CatchUpSkip = "skip"
+	CatchUpOnce = "once"
+	CatchUpAll  = "all"
+)
+
+const (
+	// maxCatchUpRuns caps how many missed runs the "all" policy replays.
+	maxCatchUpRuns = 10
+	// maxMissedScan bounds the search for missed slots, for frequent
+	// schedules after a long downtime.
+	maxMissedScan = 100000
+	// maxResponseExcerpt is how much of a response is kept in run history.
+	maxResponseExcerpt = 500
+)
+
 // Scheduler runs cron clients on their configured schedules.
 // It polls the store periodically for client changes rather than
 // depending on a cron library, keeping dependencies minimal.
 type Scheduler struct {
-	executor *clients.Executor
-	store    *store.Store
-	logger   *slog.Logger
+	executor  *clients.Executor
+	deliverer clients.Deliverer
+	runs      *store.ConversationStore
+	store     *store.Store
+	logger    *slog.Logger
 
 	mu      sync.Mutex
 	cancel  context.CancelFunc
+	ctx     context.Context
 	entries map[string]*cronEntry
 }
 
 type cronEntry struct {
 	client   store.ClientDefinition
 	schedule *Schedule
-	next     time.Time
+	// spec is the schedule and timezone the entry was built from, so edits
+	// to either recompute the next run.
+	spec string
+	next time.Time
 }
 
-// NewScheduler creates a cron scheduler that checks clients every 30 seconds.
+// NewScheduler creates a cron scheduler that checks clients every second.
 func NewScheduler(executor *clients.Executor, s *store.Store, logger *slog.Logger) *Scheduler {
 	return &Scheduler{
 		executor: executor,
@@ -39,15 +64,38 @@ func NewScheduler(executor *clients.Executor, s *store.Store, logger *slog.Logge
 	}
 }
 
+// SetDeliverer enables delivering results through other clients. Without
+// it, only URL delivery is available.
+func (s *Scheduler) SetDeliverer(d clients.Deliverer) {
+	s.deliverer = d
+}
+
+// SetRunStore enables run history and catch-up of runs missed while the
+// server was down.
+func (s *Scheduler) SetRunStore(cs *store.ConversationStore) {
+	s.runs = cs
+}
+
 // Start begins the scheduler loop. It reloads cron clients from the store
-// whenever they change and fires matching entries every 30 seconds.
+// whenever they change and fires due entries every second. On start, runs
+// missed while the server was down are handled per client catch-up policy.
 func (s *Scheduler) Start(ctx context.Context) {
-	ctx, s.cancel = context.WithCancel(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.ctx, s.cancel = ctx, cancel
+	s.mu.Unlock()
+
+	if s.runs != nil {
+		if err := s.runs.InterruptRuns(); err != nil {
+			s.logger.Warn("Failed to mark interrupted cron runs", "error", err)
+		}
+	}
 
 	s.reload()
+	s.catchUp(ctx)
 
 	changeCh := s.store.OnChange()
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 
 	for {
@@ -64,11 +112,36 @@ func (s *Scheduler) Start(ctx context.Context) {
 
 // Stop halts the scheduler.
 func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.cancel != nil {
 		s.cancel()
 	}
 }
 
+// RunNow starts a run of a cron client outside its schedule and returns the
+// run as recorded when it started. The run continues in the background.
+func (s *Scheduler) RunNow(clientID string) (store.ClientRun, error) {
+	cl, ok := s.store.GetClient(clientID)
+	if !ok {
+		return store.ClientRun{}, fmt.Errorf("client %q not found", clientID)
+	}
+	if cl.Type != "cron" || cl.Config.Cron == nil {
+		return store.ClientRun{}, fmt.Errorf("client %q is not a cron client", cl.Name)
+	}
+	if !cl.Enabled {
+		return store.ClientRun{}, fmt.Errorf("client %q is disabled", cl.Name)
+	}
+
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+	if ctx == nil {
+		return store.ClientRun{}, fmt.Errorf("scheduler is not running")
+	}
+	return s.start(ctx, cl, store.RunTriggerManual, nil), nil
+}
+
 func (s *Scheduler) reload() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -81,13 +154,14 @@ func (s *Scheduler) reload() {
 			continue
 		}
 
-		sched, err := Parse(cl.Config.Cron.Schedule)
+		sched, err := ParseClient(cl.Config.Cron)
 		if err != nil {
-			s.logger.Warn("Invalid cron schedule, skipping", "client", cl.Name, "schedule", cl.Config.Cron.Schedule, "error", err)
+			s.logger.Warn("Invalid cron schedule, skipping", "client", cl.Name, "schedule", cl.Config.Cron.Schedule, "timezone", cl.Config.Cron.Timezone, "error", err)
 			continue
 		}
+		spec := cl.Config.Cron.Schedule + "|" + cl.Config.Cron.Timezone
 
-		if existing, ok := s.entries[cl.ID]; ok {
+		if existing, ok := s.entries[cl.ID]; ok && existing.spec == spec {
 			existing.client = cl
 			existing.schedule = sched
 			newEntries[cl.ID] = existing
@@ -95,6 +169,7 @@ func (s *Scheduler) reload() {
 			newEntries[cl.ID] = &cronEntry{
 				client:   cl,
 				schedule: sched,
+				spec:     spec,
 				next:     sched.Next(time.Now()),
 			}
 		}
@@ -104,27 +179,196 @@ func (s *Scheduler) reload() {
 	s.logger.Debug("Scheduler reloaded", "cronClients", len(newEntries))
 }
 
+// ParseClient parses a cron client's schedule in its timezone.
+func ParseClient(cfg *store.CronClientConfig) (*Schedule, error) {
+	loc := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q", cfg.Timezone)
+		}
+	}
+	return Parse(cfg.Schedule, loc)
+}
+
 func (s *Scheduler) tick(ctx context.Context) {
+	type due struct {
+		client store.ClientDefinition
+		slot   time.Time
+	}
+
 	s.mu.Lock()
 	now := time.Now()
-	var toRun []cronEntry
+	var toRun []due
 	for _, entry := range s.entries {
 		if !now.Before(entry.next) {
-			toRun = append(toRun, *entry)
+			toRun = append(toRun, due{client: entry.client, slot: entry.next})
 			entry.next = entry.schedule.Next(now)
 		}
 	}
 	s.mu.Unlock()
 
-	for _, entry := range toRun {
-		go func(cl store.ClientDefinition) {
-			s.logger.Info("Cron client firing", "client", cl.Name, "id", cl.ID)
-			result, err := s.executor.RunClient(ctx, cl, "")
+	for _, d := range toRun {
+		slot := d.slot
+		s.start(ctx, d.client, store.RunTriggerSchedule, &slot)
+	}
+}
+
+// catchUp looks for scheduled slots between each client's last recorded
+// slot and now, and runs or records them according to its policy.
+func (s *Scheduler) catchUp(ctx context.Context) {
+	if s.runs == nil {
+		return
+	}
+
+	s.mu.Lock()
+	entries := make([]cronEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, *entry)
+	}
+	s.mu.Unlock()
+
+	now := time.Now()
+	for _, entry := range entries {
+		last, ok := s.runs.LastScheduledRun(entry.client.ID)
+		if !ok {
+			continue
+		}
+		missed, total := missedSlots(entry.schedule, last, now)
+		if total == 0 {
+			continue
+		}
+
+		cl := entry.client
+		runs := catchUpRuns(cl.Config.Cron.CatchUp, missed)
+		if len(runs) == 0 {
+			s.logger.Warn("Cron runs missed while the server was down", "client", cl.Name, "missed", total, "catchUp", CatchUpSkip)
+			slot := missed[len(missed)-1]
+			_, err := s.runs.AddRun(store.ClientRun{
+				ClientID:    cl.ID,
+				Trigger:     store.RunTriggerSchedule,
+				ScheduledAt: &slot,
+				StartedAt:   now,
+				EndedAt:     &now,
+				Status:      store.RunStatusMissed,
+				Error:       fmt.Sprintf("%d scheduled run(s) missed while the server was down", total),
+			})
 			if err != nil {
-				s.logger.Error("Cron client failed", "client", cl.Name, "error", err)
-				return
+				s.logger.Warn("Failed to record missed cron runs", "client", cl.Name, "error", err)
+			}
+			continue
+		}
+
+		if cl.Config.Cron.CatchUp == CatchUpAll && total > len(runs) {
+			s.logger.Warn("Too many missed cron runs, catching up the latest only", "client", cl.Name, "missed", total, "limit", maxCatchUpRuns)
+		}
+		s.logger.Info("Catching up missed cron runs", "client", cl.Name, "missed", total, "runs", len(runs))
+		go func() {
+			// One at a time, oldest first, so the runs keep their order.
+			for _, slot := range runs {
+				if ctx.Err() != nil {
+					return
+				}
+				s.execute(ctx, cl, store.RunTriggerCatchUp, &slot)
 			}
-			s.logger.Info("Cron client completed", "client", cl.Name, "responseLen", len(result))
-		}(entry.client)
+		}()
+	}
+}
+
+// catchUpRuns returns which missed slots a catch-up policy runs: the
+// latest for "once", all of them for "all" and none for "skip", in which
+// case they are only recorded as missed.
+func catchUpRuns(policy string, missed []time.Time) []time.Time {
+	if len(missed) == 0 {
+		return nil
+	}
+	switch policy {
+	case CatchUpOnce:
+		return missed[len(missed)-1:]
+	case CatchUpAll:
+		return missed
+	default:
+		return nil
+	}
+}
+
+// missedSlots returns up to maxCatchUpRuns of the latest slots after last
+// and up to now, oldest first, along with the total number missed.
+func missedSlots(sched *Schedule, last, now time.Time) ([]time.Time, int) {
+	var slots []time.Time
+	total := 0
+	for t := sched.Next(last); !t.After(now); t = sched.Next(t) {
+		total++
+		slots = append(slots, t)
+		if len(slots) > maxCatchUpRuns {
+			slots = slots[1:]
+		}
+		if total >= maxMissedScan {
+			break
+		}
+	}
+	return slots, total
+}
+
+// start runs a client in the background and returns its run record.
+func (s *Scheduler) start(ctx context.Context, cl store.ClientDefinition, trigger string, slot *time.Time) store.ClientRun {
+	run := s.begin(cl, trigger, slot)
+	go s.finish(ctx, cl, run)
+	return run
+}
+
+// execute runs a client and waits for it to finish.
+func (s *Scheduler) execute(ctx context.Context, cl store.ClientDefinition, trigger string, slot *time.Time) {
+	s.finish(ctx, cl, s.begin(cl, trigger, slot))
+}
+
+// begin records the start of a run.
+func (s *Scheduler) begin(cl store.ClientDefinition, trigger string, slot *time.Time) store.ClientRun {
+	run := store.ClientRun{
+		ClientID:    cl.ID,
+		Trigger:     trigger,
+		ScheduledAt: slot,
+		StartedAt:   time.Now(),
+		Status:      store.RunStatusRunning,
+	}
+	if s.runs != nil {
+		var err error
+		if run, err = s.runs.AddRun(run); err != nil {
+			s.logger.Warn("Failed to record cron run", "client", cl.Name, "error", err)
+		}
+	}
+	return run
+}
+
+// finish executes the run, records its outcome and delivers the result.
+func (s *Scheduler) finish(ctx context.Context, cl store.ClientDefinition, run store.ClientRun) {
+	s.logger.Info("Cron client firing", "client", cl.Name, "id", cl.ID, "trigger", run.Trigger)
+	res, err := s.executor.Run(ctx, cl, "")
+	if err != nil {
+		s.logger.Error("Cron client failed", "client", cl.Name, "error", err)
+		s.finishRun(cl, run, store.RunStatusError, "", err.Error())
+		return
+	}
+	s.logger.Info("Cron client completed", "client", cl.Name, "responseLen", len(res.Text))
+	s.finishRun(cl, run, store.RunStatusSuccess, excerpt(res.Text), "")
+	s.deliver(ctx, cl, run.StartedAt, res)
+}
+
+// finishRun records the outcome of a run in the run history.
+func (s *Scheduler) finishRun(cl store.ClientDefinition, run store.ClientRun, status, response, errMsg string) {
+	if s.runs == nil || run.ID == "" {
+		return
+	}
+	if err := s.runs.FinishRun(run.ID, status, response, errMsg); err != nil {
+		s.logger.Warn("Failed to record cron run", "client", cl.Name, "error", err)
+	}
+}
+
+func excerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxResponseExcerpt {
+		return text
 	}
+	return string(runes[:maxResponseExcerpt]) + "…"
 }
@@ -22,7 +22,20 @@ func (p *Provider) ConfigSchema() clients.Schema {
 				"title":         "Schedule",
 				"minLength":     1,
 				"x-placeholder": "0 9 * * *",
-				"description":   "Standard cron expression (min hour day month weekday)",
+				"description":   "Cron expression (min hour day month weekday), with optional leading seconds, or @daily, @hourly, @every 15m…",
+			},
+			"timezone": clients.Schema{
+				"type":          "string",
+				"title":         "Timezone",
+				"x-placeholder": "Europe/Madrid",
+				"description":   "IANA timezone the schedule is evaluated in (server local time when empty)",
+			},
+			"catchUp": clients.Schema{
+				"type":        "string",
+				"title":       "Catch-up",
+				"enum":        []string{CatchUpSkip, CatchUpOnce, CatchUpAll},
+				"default":     CatchUpSkip,
+				"description": "Runs missed while the server was down: skip them, run once, or run each (up to 10)",
 			},
 			"commandId": clients.Schema{
 				"type":      "string",
@@ -30,6 +43,33 @@ func (p *Provider) ConfigSchema() clients.Schema {
 				"minLength": 1,
 				"x-entity":  "commands",
 			},
+			"deliveryClientId": clients.Schema{
+				"type":           "string",
+				"title":          "Deliver To",
+				"x-entity":       "clients",
+				"x-entity-types": []string{"direct", "telegram", "slack", "discord", "matrix", "mattermost", "email"},
+				"description":    "Post the result through this client. A Direct client shows it as a voice UI notification.",
+			},
+			"deliveryTarget": clients.Schema{
+				"type":          "string",
+				"title":         "Delivery Target",
+				"x-placeholder": "Chat, channel or room ID, or email address",
+				"description":   "Where the delivery client posts the result. Not needed for Direct clients.",
+			},
+			"deliveryUrl": clients.Schema{
+				"type":          "string",
+				"title":         "Delivery URL",
+				"x-placeholder": "https://example.com/hooks/briefing",
+				"description":   "POST the result as JSON to this URL",
+			},
+			"deliveryRetries": clients.Schema{
+				"type":        "integer",
+				"title":       "Delivery Retries",
+				"minimum":     0,
+				"maximum":     10,
+				"default":     3,
+				"description": "How many times a failed delivery is retried, with exponential backoff. 0 disables retries",
+			},
 		},
 		"required": []string{"schedule", "commandId"},
 	}
@@ -0,0 +1,11 @@
+package clients
+
+import "context"
+
+// Deliverer sends a message out through another client, e.g. a chat bot
+// posting a cron result to a channel. target is the platform-specific
+// destination (chat, channel, room or address); title is used where the
+// platform has one, such as an email subject.
+type Deliverer interface {
+	Deliver(ctx context.Context, clientID, target, title, text string) error
+}
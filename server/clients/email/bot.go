@@ -0,0 +1,486 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	imapclient "github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message/mail"
+
+	"github.com/achetronic/magec/server/clients/chatbot"
+	"github.com/achetronic/magec/server/clients/msgutil"
+	"github.com/achetronic/magec/server/store"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	dialTimeout         = 30 * time.Second
+
+	// maxRepliesPerHour bounds replies to a single sender. It is the last
+	// line of defence against loops with responders that don't mark their
+	// mail as automatic.
+	maxRepliesPerHour = 20
+)
+
+// Client is an email bot: it polls an IMAP mailbox for unread mail and
+// answers each message over SMTP. It is the chat-bot runtime's adapter for
+// email. Every email thread is its own agent session.
+type Client struct {
+	clientDef store.ClientDefinition
+	logger    *slog.Logger
+	runtime   *chatbot.Runtime
+
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	replies map[string][]time.Time // sender -> recent reply times
+}
+
+// reply collects everything the runtime sends for one incoming email so it
+// goes out as a single mail. It travels in chatbot.Chat.Ref.
+type reply struct {
+	mu    sync.Mutex
+	parts []string
+	files []chatbot.File
+}
+
+func New(clientDef store.ClientDefinition, agentURL string, agents []chatbot.AgentInfo, s chatbot.Store, logger *slog.Logger) (*Client, error) {
+	if clientDef.Config.Email == nil {
+		return nil, fmt.Errorf("email config is required")
+	}
+	cfg := clientDef.Config.Email
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("email address is required")
+	}
+	if cfg.IMAPHost == "" {
+		return nil, fmt.Errorf("email IMAP host is required")
+	}
+	if cfg.SMTPHost == "" {
+		return nil, fmt.Errorf("email SMTP host is required")
+	}
+
+	c := &Client{
+		clientDef: clientDef,
+		logger:    logger,
+		replies:   make(map[string][]time.Time),
+	}
+	c.runtime = chatbot.New(c, chatbot.Config{
+		Platform:         store.IdentityEmail,
+		CommandPrefix:    "!",
+		MaxMessageLength: msgutil.EmailMaxMessageLength,
+		Bold:             func(s string) string { return "*" + s + "*" },
+		FormatToolCall:   msgutil.FormatToolCallEmail,
+		FormatToolResult: msgutil.FormatToolResultEmail,
+		DefaultAgent:     cfg.DefaultAgent,
+		SetDefaultAgent: func(def *store.ClientDefinition, agentID string) {
+			ec := *def.Config.Email
+			ec.DefaultAgent = agentID
+			def.Config.Email = &ec
+		},
+	}, clientDef, agentURL, agents, s, logger)
+	return c, nil
+}
+
+// Start checks the mailbox right away and then every poll interval until
+// the context is cancelled or Stop is called. A failure on the first check
+// (e.g. wrong credentials) is returned; later ones are logged and retried.
+func (c *Client) Start(ctx context.Context) error {
+	pollCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+
+	cfg := c.clientDef.Config.Email
+	interval := time.Duration(cfg.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	if err := c.poll(pollCtx); err != nil {
+		return fmt.Errorf("failed to check mailbox: %w", err)
+	}
+	c.logger.Info("Email client started", "address", cfg.Address, "imap", cfg.IMAPHost, "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pollCtx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.poll(pollCtx); err != nil {
+				c.logger.Error("Failed to check mailbox", "error", err)
+			}
+		}
+	}
+}
+
+func (c *Client) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.logger.Info("Email client stopped")
+}
+
+// poll fetches all unread mail, marks it as read and answers each message
+// in turn.
+func (c *Client) poll(ctx context.Context) error {
+	raw, err := c.fetchUnseen()
+	if err != nil {
+		return err
+	}
+	for _, data := range raw {
+		if ctx.Err() != nil {
+			return nil
+		}
+		c.handleMail(ctx, data)
+	}
+	return nil
+}
+
+// fetchUnseen returns the raw bodies of all unread messages and flags them
+// as seen so they are handled once.
+func (c *Client) fetchUnseen() ([][]byte, error) {
+	cfg := c.clientDef.Config.Email
+	addr := net.JoinHostPort(cfg.IMAPHost, strconv.Itoa(portOr(cfg.IMAPPort, 993)))
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	tlsConfig := &tls.Config{ServerName: cfg.IMAPHost}
+
+	var conn *imapclient.Client
+	var err error
+	switch cfg.IMAPSecurity {
+	case "none", "starttls":
+		conn, err = imapclient.DialWithDialer(dialer, addr)
+		if err == nil && cfg.IMAPSecurity == "starttls" {
+			err = conn.StartTLS(tlsConfig)
+		}
+	default:
+		conn, err = imapclient.DialWithDialerTLS(dialer, addr, tlsConfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("imap connect: %w", err)
+	}
+	defer conn.Logout()
+	conn.Timeout = 2 * time.Minute
+
+	if err := conn.Login(c.username(), cfg.Password); err != nil {
+		return nil, fmt.Errorf("imap login: %w", err)
+	}
+	mailbox := cfg.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+	if _, err := conn.Select(mailbox, false); err != nil {
+		return nil, fmt.Errorf("imap select %s: %w", mailbox, err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := conn.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("imap search: %w", err)
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	var raw [][]byte
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(body); err != nil {
+			continue
+		}
+		raw = append(raw, buf.Bytes())
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("imap fetch: %w", err)
+	}
+
+	flags := []interface{}{imap.SeenFlag}
+	if err := conn.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+		return nil, fmt.Errorf("imap store: %w", err)
+	}
+	return raw, nil
+}
+
+// handleMail filters one email and runs it through the agent, then sends
+// everything the runtime produced as a single reply.
+func (c *Client) handleMail(ctx context.Context, data []byte) {
+	in, err := parseMessage(bytes.NewReader(data))
+	if err != nil {
+		c.logger.Warn("Failed to parse email", "error", err)
+		return
+	}
+	cfg := c.clientDef.Config.Email
+	switch {
+	case in.Automated:
+		c.logger.Info("Ignoring automated email", "from", in.From, "subject", in.Subject)
+		return
+	case strings.EqualFold(in.From, cfg.Address):
+		return
+	case !c.isAllowed(in.From):
+		c.logger.Debug("Unauthorized email sender", "from", in.From)
+		return
+	case len(cfg.AllowedSenders) > 0 && !senderAuthenticated(in.AuthResults, in.From, cfg.AuthServID):
+		c.logger.Warn("Ignoring email whose sender could not be authenticated", "from", in.From)
+		return
+	case !c.allowReply(in.From):
+		c.logger.Warn("Email reply rate limit reached, ignoring message", "from", in.From, "limit_per_hour", maxRepliesPerHour)
+		return
+	}
+
+	text := in.Text
+	if text == "" {
+		text = in.Subject
+	}
+	if text == "" && len(in.Files) == 0 {
+		return
+	}
+	if len(in.Skipped) > 0 {
+		c.logger.Warn("Email attachments too large, skipped", "from", in.From, "files", in.Skipped)
+	}
+
+	meta := map[string]any{
+		"email_from":    in.From,
+		"email_subject": in.Subject,
+	}
+	if in.FromName != "" {
+		meta["email_name"] = in.FromName
+	}
+	if in.MessageID != "" {
+		meta["email_message_id"] = in.MessageID
+	}
+	if len(in.Files) > 0 {
+		names := make([]string, len(in.Files))
+		for i, f := range in.Files {
+			names[i] = f.Name
+		}
+		meta["email_attachments"] = names
+	}
+
+	out := &reply{}
+	name := in.FromName
+	if name == "" {
+		name = in.From
+	}
+	msg := chatbot.Message{
+		ID:       in.MessageID,
+		Chat:     chatbot.Chat{ID: in.From, ThreadID: in.threadID(), Ref: out},
+		UserID:   in.From,
+		UserName: name,
+		Text:     text,
+		Files:    in.Files,
+		Meta:     meta,
+	}
+	c.runtime.Handle(ctx, msg)
+
+	out.mu.Lock()
+	body := strings.Join(out.parts, "\n\n")
+	files := out.files
+	out.mu.Unlock()
+	if body == "" && len(files) == 0 {
+		return
+	}
+	to := &mail.Address{Name: in.FromName, Address: in.From}
+	if err := c.send(outgoing{To: to, Reply: in, Text: body, Files: files}); err != nil {
+		c.logger.Error("Failed to send email reply", "to", in.From, "error", err)
+	}
+}
+
+// Deliver emails text to the target address as a new message with title as
+// its subject, outside of any conversation.
+func (c *Client) Deliver(_ context.Context, target, title, text string) error {
+	to, err := mail.ParseAddress(target)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", target, err)
+	}
+	if title == "" {
+		title = c.clientDef.Name
+	}
+	return c.send(outgoing{To: to, Subject: title, Text: text})
+}
+
+// send delivers a message over SMTP from the configured address.
+func (c *Client) send(o outgoing) error {
+	cfg := c.clientDef.Config.Email
+	o.From = cfg.Address
+	data, err := compose(o)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(portOr(cfg.SMTPPort, 587)))
+	tlsConfig := &tls.Config{ServerName: cfg.SMTPHost}
+	var conn net.Conn
+	if cfg.SMTPSecurity == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp connect: %w", err)
+	}
+	sc, err := smtp.NewClient(conn, cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer sc.Close()
+
+	if cfg.SMTPSecurity == "" || cfg.SMTPSecurity == "starttls" {
+		if err := sc.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if ok, _ := sc.Extension("AUTH"); ok && cfg.Password != "" {
+		if err := sc.Auth(smtp.PlainAuth("", c.username(), cfg.Password, cfg.SMTPHost)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := sc.Mail(cfg.Address); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	if err := sc.Rcpt(o.To.Address); err != nil {
+		return fmt.Errorf("smtp rcpt to: %w", err)
+	}
+	w, err := sc.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	return sc.Quit()
+}
+
+// SendText implements chatbot.Adapter by adding a part to the pending reply.
+// The returned ID is the part's index so the tool counter can be edited.
+func (c *Client) SendText(_ context.Context, chat chatbot.Chat, text string, _ chatbot.TextKind) (string, error) {
+	out, ok := chat.Ref.(*reply)
+	if !ok {
+		return "", fmt.Errorf("email reply context missing")
+	}
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.parts = append(out.parts, text)
+	return strconv.Itoa(len(out.parts) - 1), nil
+}
+
+// EditText implements chatbot.Adapter by replacing a pending part.
+func (c *Client) EditText(_ context.Context, chat chatbot.Chat, messageID, text string) error {
+	out, ok := chat.Ref.(*reply)
+	if !ok {
+		return fmt.Errorf("email reply context missing")
+	}
+	i, err := strconv.Atoi(messageID)
+	if err != nil {
+		return err
+	}
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if i < 0 || i >= len(out.parts) {
+		return fmt.Errorf("unknown message %q", messageID)
+	}
+	out.parts[i] = text
+	return nil
+}
+
+// SendFile implements chatbot.Adapter by attaching the file to the pending
+// reply.
+func (c *Client) SendFile(_ context.Context, chat chatbot.Chat, file chatbot.File) error {
+	out, ok := chat.Ref.(*reply)
+	if !ok {
+		return fmt.Errorf("email reply context missing")
+	}
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.files = append(out.files, file)
+	return nil
+}
+
+// React implements chatbot.Adapter. Email has no reactions.
+func (c *Client) React(context.Context, chatbot.Message, chatbot.Reaction) error {
+	return nil
+}
+
+// FetchHistory implements chatbot.Adapter. Earlier messages of a thread are
+// already in the agent session, so no history is injected.
+func (c *Client) FetchHistory(context.Context, chatbot.Message) ([]chatbot.HistoryEntry, error) {
+	return nil, nil
+}
+
+// isAllowed checks a sender against the allowlist. Entries are full
+// addresses or "@domain". If no allowlist is configured, everyone is allowed.
+// The From header can be forged, so handleMail also requires the receiving
+// server to have authenticated it when an allowlist is set.
+func (c *Client) isAllowed(from string) bool {
+	allowed := c.clientDef.Config.Email.AllowedSenders
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a == from || (strings.HasPrefix(a, "@") && strings.HasSuffix(from, a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowReply records a reply to sender and reports whether it stays within
+// maxRepliesPerHour.
+func (c *Client) allowReply(sender string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cutoff := time.Now().Add(-time.Hour)
+	recent := c.replies[sender][:0]
+	for _, t := range c.replies[sender] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= maxRepliesPerHour {
+		c.replies[sender] = recent
+		return false
+	}
+	c.replies[sender] = append(recent, time.Now())
+	return true
+}
+
+func (c *Client) username() string {
+	if u := c.clientDef.Config.Email.Username; u != "" {
+		return u
+	}
+	return c.clientDef.Config.Email.Address
+}
+
+func portOr(port, def int) int {
+	if port > 0 {
+		return port
+	}
+	return def
+}
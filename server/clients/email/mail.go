@@ -0,0 +1,422 @@
+package email
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+
+	"github.com/achetronic/magec/server/clients/chatbot"
+)
+
+// maxAttachmentBytes caps the total size of attachments handed to the agent
+// from a single email.
+const maxAttachmentBytes = 20 << 20
+
+// incoming is a parsed email.
+type incoming struct {
+	From       string // lowercased address
+	FromName   string
+	Subject    string
+	MessageID  string
+	References []string
+	Date       time.Time
+	Text       string
+	Files      []chatbot.File
+	// Automated is set when the mail looks like an auto-reply, bounce or
+	// list traffic. Replying to those risks mail loops.
+	Automated bool
+	// Skipped lists attachments dropped for exceeding maxAttachmentBytes.
+	Skipped []string
+	// AuthResults holds the Authentication-Results headers, topmost (added
+	// by the receiving server) first.
+	AuthResults []string
+}
+
+// threadID returns a short stable ID for the thread the email belongs to,
+// derived from the first message of the thread.
+func (m *incoming) threadID() string {
+	root := m.MessageID
+	if len(m.References) > 0 {
+		root = m.References[0]
+	}
+	sum := sha256.Sum256([]byte(root))
+	return hex.EncodeToString(sum[:6])
+}
+
+// parseMessage reads an RFC 5322 message.
+func parseMessage(r io.Reader) (*incoming, error) {
+	mr, err := mail.CreateReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer mr.Close()
+
+	h := mr.Header
+	from, err := h.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return nil, fmt.Errorf("missing or invalid From header")
+	}
+	m := &incoming{
+		From:      strings.ToLower(from[0].Address),
+		FromName:  from[0].Name,
+		Automated: isAutomated(h, from[0].Address),
+	}
+	m.AuthResults = h.Values("Authentication-Results")
+	m.Subject, _ = h.Subject()
+	m.MessageID, _ = h.MessageID()
+	m.Date, _ = h.Date()
+	m.References, _ = h.MsgIDList("References")
+	if len(m.References) == 0 {
+		m.References, _ = h.MsgIDList("In-Reply-To")
+	}
+
+	var plain, htmlText string
+	var attachmentBytes int
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var name, mimeType string
+		switch ph := p.Header.(type) {
+		case *mail.InlineHeader:
+			mimeType, _, _ = ph.ContentType()
+			if mimeType == "text/plain" || mimeType == "text/html" || mimeType == "" {
+				body, err := io.ReadAll(p.Body)
+				if err != nil {
+					return nil, err
+				}
+				if mimeType == "text/html" {
+					if htmlText == "" {
+						htmlText = string(body)
+					}
+				} else if plain == "" {
+					plain = string(body)
+				}
+				continue
+			}
+			// Inline images and other non-text parts are passed on as files.
+			_, params, _ := ph.ContentType()
+			name = params["name"]
+		case *mail.AttachmentHeader:
+			mimeType, _, _ = ph.ContentType()
+			name, _ = ph.Filename()
+		}
+
+		data, err := io.ReadAll(p.Body)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = "attachment"
+			if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+				name += exts[0]
+			}
+		}
+		if attachmentBytes+len(data) > maxAttachmentBytes {
+			m.Skipped = append(m.Skipped, name)
+			continue
+		}
+		attachmentBytes += len(data)
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		m.Files = append(m.Files, chatbot.File{Name: name, Data: data, MIMEType: mimeType})
+	}
+
+	if plain == "" && htmlText != "" {
+		plain = htmlToText(htmlText)
+	}
+	m.Text = stripQuoted(plain)
+	return m, nil
+}
+
+// noReplyLocalParts are senders that never expect an answer.
+var noReplyLocalParts = []string{"mailer-daemon", "postmaster", "noreply", "no-reply", "donotreply", "do-not-reply"}
+
+// isAutomated applies the usual auto-reply heuristics (RFC 3834 and common
+// vendor headers) so the client never answers machines.
+func isAutomated(h mail.Header, from string) bool {
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "bulk", "junk", "list", "auto_reply":
+		return true
+	}
+	for _, key := range []string{"List-Id", "List-Unsubscribe", "X-Autoreply", "X-Autorespond", "X-Auto-Response-Suppress"} {
+		if h.Get(key) != "" {
+			return true
+		}
+	}
+	if strings.TrimSpace(h.Get("Return-Path")) == "<>" {
+		return true
+	}
+	local, _, _ := strings.Cut(strings.ToLower(from), "@")
+	for _, p := range noReplyLocalParts {
+		if local == p {
+			return true
+		}
+	}
+	return false
+}
+
+// senderAuthenticated reports whether the receiving server vouched for the
+// From address in an Authentication-Results header (RFC 8601): DMARC passed,
+// or SPF or DKIM passed for the From domain. Only the topmost header is
+// read, since anything below it may have been written by the sender. With
+// authServID set, the header must come from that server instead, which also
+// covers servers that do not strip forged copies.
+func senderAuthenticated(results []string, from, authServID string) bool {
+	_, domain, ok := strings.Cut(from, "@")
+	if !ok || domain == "" {
+		return false
+	}
+	for i, header := range results {
+		id, methods := parseAuthResults(header)
+		if authServID != "" && !strings.EqualFold(id, authServID) {
+			continue
+		}
+		if authServID == "" && i > 0 {
+			break
+		}
+		for _, m := range methods {
+			if m.result != "pass" {
+				continue
+			}
+			switch m.method {
+			case "dmarc":
+				if from := m.props["header.from"]; from == "" || from == domain {
+					return true
+				}
+			case "spf":
+				if alignedDomain(domain, m.props["smtp.mailfrom"]) {
+					return true
+				}
+			case "dkim":
+				if alignedDomain(domain, m.props["header.d"]) || alignedDomain(domain, m.props["header.i"]) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
+type authResult struct {
+	method string
+	result string
+	props  map[string]string
+}
+
+var commentPattern = regexp.MustCompile(`\([^()]*\)`)
+
+// parseAuthResults splits an Authentication-Results value into the
+// authserv-id and its "method=result prop=value ..." entries.
+func parseAuthResults(header string) (string, []authResult) {
+	header = commentPattern.ReplaceAllString(header, " ")
+	parts := strings.Split(header, ";")
+	fields := strings.Fields(parts[0])
+	if len(fields) == 0 {
+		return "", nil
+	}
+	var results []authResult
+	for _, part := range parts[1:] {
+		tokens := strings.Fields(part)
+		if len(tokens) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(tokens[0], "=")
+		if !ok {
+			continue
+		}
+		r := authResult{
+			method: strings.ToLower(method),
+			result: strings.ToLower(result),
+			props:  map[string]string{},
+		}
+		for _, t := range tokens[1:] {
+			if k, v, ok := strings.Cut(t, "="); ok {
+				r.props[strings.ToLower(k)] = strings.ToLower(strings.Trim(v, `"`))
+			}
+		}
+		results = append(results, r)
+	}
+	return fields[0], results
+}
+
+// alignedDomain reports whether value (a domain, or an address whose domain
+// is used) is the From domain or a parent of it.
+func alignedDomain(fromDomain, value string) bool {
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		value = value[i+1:]
+	}
+	if value == "" {
+		return false
+	}
+	return fromDomain == value || strings.HasSuffix(fromDomain, "."+value)
+}
+
+var (
+	attributionPattern = regexp.MustCompile(`(?i)^on .+wrote:\s*$`)
+	tagPattern         = regexp.MustCompile(`(?s)<[^>]*>`)
+	blockPattern       = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6])\s*/?>`)
+	stylePattern       = regexp.MustCompile(`(?is)<(style|script)[^>]*>.*?</(style|script)>`)
+)
+
+// stripQuoted removes quoted replies so the agent only sees the new text.
+// Earlier messages of the thread are already in the agent session.
+func stripQuoted(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") || attributionPattern.MatchString(trimmed) {
+			continue
+		}
+		out = append(out, strings.TrimRight(line, " \t"))
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// htmlToText builds a plain-text version of an HTML body.
+func htmlToText(s string) string {
+	s = stylePattern.ReplaceAllString(s, "")
+	s = blockPattern.ReplaceAllString(s, "\n")
+	s = tagPattern.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+// outgoing is a reply to an incoming email, or a new message when Reply is
+// nil.
+type outgoing struct {
+	From  string
+	To    *mail.Address
+	Reply *incoming
+	// Subject is used for new messages; replies reuse the original one.
+	Subject string
+	Text    string
+	Files   []chatbot.File
+}
+
+// compose renders a reply that stays in the sender's thread and is marked as
+// an automatic response so well-behaved auto-responders don't answer it.
+// New messages are marked as automatically generated instead.
+func compose(o outgoing) ([]byte, error) {
+	var h mail.Header
+	h.SetDate(time.Now())
+	h.SetAddressList("From", []*mail.Address{{Address: o.From}})
+	h.SetAddressList("To", []*mail.Address{o.To})
+	if err := h.GenerateMessageIDWithHostname(domainOf(o.From)); err != nil {
+		return nil, err
+	}
+	text := o.Text
+	if o.Reply != nil {
+		h.SetSubject(replySubject(o.Reply.Subject))
+		if o.Reply.MessageID != "" {
+			h.SetMsgIDList("In-Reply-To", []string{o.Reply.MessageID})
+			h.SetMsgIDList("References", append(append([]string{}, o.Reply.References...), o.Reply.MessageID))
+		}
+		h.Set("Auto-Submitted", "auto-replied")
+		text += quote(o.Reply)
+	} else {
+		h.SetSubject(o.Subject)
+		h.Set("Auto-Submitted", "auto-generated")
+	}
+	h.Set("X-Auto-Response-Suppress", "All")
+
+	var buf bytes.Buffer
+	mw, err := mail.CreateWriter(&buf, h)
+	if err != nil {
+		return nil, err
+	}
+
+	var th mail.InlineHeader
+	th.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+	tw, err := mw.CreateSingleInline(th)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(tw, text); err != nil {
+		return nil, err
+	}
+	tw.Close()
+
+	for _, f := range o.Files {
+		var ah mail.AttachmentHeader
+		mimeType := f.MIMEType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		ah.SetContentType(mimeType, nil)
+		ah.SetFilename(f.Name)
+		aw, err := mw.CreateAttachment(ah)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := aw.Write(f.Data); err != nil {
+			return nil, err
+		}
+		aw.Close()
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// quote renders the original message below the reply, the way mail clients
+// do.
+func quote(m *incoming) string {
+	if m.Text == "" {
+		return ""
+	}
+	sender := m.From
+	if m.FromName != "" {
+		sender = fmt.Sprintf("%s <%s>", m.FromName, m.From)
+	}
+	var b strings.Builder
+	b.WriteString("\n\n")
+	if !m.Date.IsZero() {
+		b.WriteString(fmt.Sprintf("On %s, %s wrote:\n", m.Date.Format("Mon, 2 Jan 2006 15:04"), sender))
+	} else {
+		b.WriteString(sender + " wrote:\n")
+	}
+	for _, line := range strings.Split(m.Text, "\n") {
+		b.WriteString("> " + line + "\n")
+	}
+	return b.String()
+}
+
+func replySubject(subject string) string {
+	if subject == "" {
+		return "Re: (no subject)"
+	}
+	if strings.HasPrefix(strings.ToLower(subject), "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
+
+func domainOf(address string) string {
+	if _, domain, ok := strings.Cut(address, "@"); ok && domain != "" {
+		return domain
+	}
+	return "localhost"
+}
@@ -0,0 +1,72 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSenderAuthenticated(t *testing.T) {
+	const gmail = "mx.google.com;\r\n       dkim=pass header.i=@example.com header.s=s1 header.b=abc;\r\n       spf=pass (google.com: domain of alice@example.com designates 1.2.3.4 as permitted sender) smtp.mailfrom=alice@example.com;\r\n       dmarc=pass (p=REJECT sp=REJECT dis=NONE) header.from=example.com"
+
+	tests := []struct {
+		name       string
+		results    []string
+		from       string
+		authServID string
+		want       bool
+	}{
+		{"no header", nil, "alice@example.com", "", false},
+		{"dmarc pass", []string{gmail}, "alice@example.com", "", true},
+		{"dmarc for another domain", []string{"mx.example.net; dmarc=pass header.from=evil.com"}, "alice@example.com", "", false},
+		{"spf aligned", []string{"mx.example.net; spf=pass smtp.mailfrom=bounce@example.com"}, "alice@example.com", "", true},
+		{"spf for another domain", []string{"mx.example.net; spf=pass smtp.mailfrom=attacker@evil.com"}, "alice@example.com", "", false},
+		{"dkim parent domain", []string{"mx.example.net; dkim=pass header.d=example.com"}, "alice@mail.example.com", "", true},
+		{"dkim lookalike domain", []string{"mx.example.net; dkim=pass header.d=ample.com"}, "alice@example.com", "", false},
+		{"all failed", []string{"mx.example.net; spf=fail smtp.mailfrom=example.com; dkim=none; dmarc=fail header.from=example.com"}, "alice@example.com", "", false},
+		{"no result", []string{"mx.example.net; none"}, "alice@example.com", "", false},
+		{
+			"forged header below the server's",
+			[]string{"mx.example.net; spf=softfail smtp.mailfrom=evil.com", "mx.example.net; dmarc=pass header.from=example.com"},
+			"alice@example.com", "", false,
+		},
+		{
+			"trusted server picked by ID",
+			[]string{"forged.example.org; dmarc=pass header.from=example.com", "mx.example.net; dmarc=fail header.from=example.com"},
+			"alice@example.com", "mx.example.net", false,
+		},
+		{
+			"trusted server below a relay",
+			[]string{"relay.internal; none", "MX.example.net; dkim=pass header.d=example.com"},
+			"alice@example.com", "mx.example.net", true,
+		},
+		{"trusted server missing", []string{gmail}, "alice@example.com", "mx.example.net", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := senderAuthenticated(tt.results, tt.from, tt.authServID); got != tt.want {
+				t.Errorf("senderAuthenticated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMessageAuthResults(t *testing.T) {
+	raw := "Authentication-Results: mx.example.net;\r\n" +
+		"\tdmarc=pass header.from=example.com\r\n" +
+		"Authentication-Results: forged.example.org; dmarc=pass header.from=example.com\r\n" +
+		"From: Alice <Alice@Example.com>\r\n" +
+		"Subject: hi\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"hello\r\n"
+	m, err := parseMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.AuthResults) != 2 || !strings.HasPrefix(m.AuthResults[0], "mx.example.net") {
+		t.Fatalf("AuthResults = %q, want the receiving server's header first", m.AuthResults)
+	}
+	if !senderAuthenticated(m.AuthResults, m.From, "") {
+		t.Errorf("expected %s to be authenticated", m.From)
+	}
+}
@@ -0,0 +1,103 @@
+package email
+
+import (
+	"github.com/achetronic/magec/server/clients"
+)
+
+type Provider struct{}
+
+func init() {
+	clients.Register(&Provider{})
+}
+
+func (p *Provider) Type() string        { return "email" }
+func (p *Provider) DisplayName() string { return "Email" }
+
+func (p *Provider) ConfigSchema() clients.Schema {
+	security := func(title, def string) clients.Schema {
+		return clients.Schema{
+			"type":    "string",
+			"title":   title,
+			"default": def,
+			"enum":    []string{"tls", "starttls", "none"},
+		}
+	}
+	return clients.Schema{
+		"type": "object",
+		"properties": clients.Schema{
+			"address": clients.Schema{
+				"type":          "string",
+				"title":         "Email Address",
+				"minLength":     1,
+				"x-placeholder": "agent@example.com",
+				"description":   "Address the agent receives mail at. Replies are sent from it.",
+			},
+			"username": clients.Schema{
+				"type":          "string",
+				"title":         "Username",
+				"x-placeholder": "Defaults to the email address",
+			},
+			"password": clients.Schema{
+				"type":     "string",
+				"title":    "Password",
+				"x-format": "password",
+			},
+			"imapHost": clients.Schema{
+				"type":          "string",
+				"title":         "IMAP Host",
+				"minLength":     1,
+				"x-placeholder": "imap.example.com",
+			},
+			"imapPort": clients.Schema{
+				"type":    "integer",
+				"title":   "IMAP Port",
+				"default": 993,
+				"minimum": 1,
+				"maximum": 65535,
+			},
+			"imapSecurity": security("IMAP Security", "tls"),
+			"mailbox": clients.Schema{
+				"type":    "string",
+				"title":   "Mailbox",
+				"default": "INBOX",
+			},
+			"pollInterval": clients.Schema{
+				"type":        "integer",
+				"title":       "Poll Interval (seconds)",
+				"default":     30,
+				"minimum":     5,
+				"maximum":     3600,
+				"description": "How often the mailbox is checked for unread mail.",
+			},
+			"smtpHost": clients.Schema{
+				"type":          "string",
+				"title":         "SMTP Host",
+				"minLength":     1,
+				"x-placeholder": "smtp.example.com",
+			},
+			"smtpPort": clients.Schema{
+				"type":    "integer",
+				"title":   "SMTP Port",
+				"default": 587,
+				"minimum": 1,
+				"maximum": 65535,
+			},
+			"smtpSecurity": security("SMTP Security", "starttls"),
+			"allowedSenders": clients.Schema{
+				"type":          "array",
+				"items":         clients.Schema{"type": "string"},
+				"title":         "Allowed Senders",
+				"x-placeholder": "Comma-separated addresses or domains (e.g. alice@example.com, @example.com)",
+				"description":   "The From header can be forged, so when this is set mail is only answered if your mail server's Authentication-Results header shows DMARC, or SPF or DKIM for the sender's domain, passed. Servers that add no such header cannot be used with an allowlist.",
+			},
+			"authServId": clients.Schema{
+				"type":          "string",
+				"title":         "Trusted Authentication Server",
+				"x-placeholder": "mx.example.com",
+				"description":   "Authentication server ID (the first word of Authentication-Results) of your mail server. When empty, the topmost Authentication-Results header is trusted.",
+			},
+			"defaultAgent": clients.DefaultAgentSchema(),
+		},
+		"required": []string{"address", "imapHost", "smtpHost"},
+	}
+}
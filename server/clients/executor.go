@@ -38,76 +38,116 @@ func (e *Executor) SetConversationStore(cs *store.ConversationStore) {
 	e.conversations = cs
 }
 
+// RunResult is the outcome of running a client against its agents.
+type RunResult struct {
+	// Text joins the responses of every agent that answered.
+	Text string
+	// Sessions lists the agent sessions that answered, so follow-up events
+	// can be recorded in their conversations.
+	Sessions []RunSession
+}
+
+// RunSession identifies the agent session of one run.
+type RunSession struct {
+	AgentID   string
+	UserID    string
+	SessionID string
+}
+
 // RunClient resolves the client's command and agents, then calls the agent API
-// for each allowed agent. For passthrough webhooks, prompt is provided directly.
+// for each allowed agent. For passthrough webhooks and MQTT messages, prompt is
+// provided directly.
 func (e *Executor) RunClient(ctx context.Context, cl store.ClientDefinition, passthroughPrompt string) (string, error) {
+	res, err := e.Run(ctx, cl, passthroughPrompt)
+	if err != nil {
+		return "", err
+	}
+	return res.Text, nil
+}
+
+// Run works like RunClient but also returns the sessions used.
+func (e *Executor) Run(ctx context.Context, cl store.ClientDefinition, passthroughPrompt string) (RunResult, error) {
 	var prompt string
 	var commandID string
 
 	switch cl.Type {
 	case "cron":
 		if cl.Config.Cron == nil {
-			return "", fmt.Errorf("client %q: missing cron config", cl.Name)
+			return RunResult{}, fmt.Errorf("client %q: missing cron config", cl.Name)
 		}
 		commandID = cl.Config.Cron.CommandID
 	case "webhook":
 		if cl.Config.Webhook == nil {
-			return "", fmt.Errorf("client %q: missing webhook config", cl.Name)
+			return RunResult{}, fmt.Errorf("client %q: missing webhook config", cl.Name)
 		}
 		if cl.Config.Webhook.Passthrough {
 			prompt = passthroughPrompt
 			if prompt == "" {
-				return "", fmt.Errorf("passthrough webhook requires a prompt in the request body")
+				return RunResult{}, fmt.Errorf("passthrough webhook requires a prompt in the request body")
 			}
 		} else {
 			commandID = cl.Config.Webhook.CommandID
 		}
+	case "mqtt":
+		// The MQTT bridge renders the command template with the message.
+		prompt = passthroughPrompt
+		if prompt == "" {
+			return RunResult{}, fmt.Errorf("mqtt message produced an empty prompt")
+		}
 	default:
-		return "", fmt.Errorf("client %q: unsupported type %q for execution", cl.Name, cl.Type)
+		return RunResult{}, fmt.Errorf("client %q: unsupported type %q for execution", cl.Name, cl.Type)
 	}
 
 	if commandID != "" {
 		cmd, ok := e.store.GetCommand(commandID)
 		if !ok {
-			return "", fmt.Errorf("command %q not found", commandID)
+			return RunResult{}, fmt.Errorf("command %q not found", commandID)
 		}
 		prompt = cmd.Prompt
 	}
 
 	if len(cl.AllowedAgents) == 0 {
-		return "", fmt.Errorf("client %q: no allowed agents configured", cl.Name)
+		return RunResult{}, fmt.Errorf("client %q: no allowed agents configured", cl.Name)
 	}
 
-	var allResults string
+	userID, err := e.store.ResolveUser(store.IdentityClient, cl.ID, cl.Name)
+	if err != nil {
+		e.logger.Warn("Failed to resolve user identity", "client", cl.Name, "error", err)
+	}
+	if userID == "" {
+		userID = "trigger"
+	}
+
+	var res RunResult
 	for _, agentID := range cl.AllowedAgents {
 		var responseFilter []string
 		if flow, ok := e.store.GetFlow(agentID); ok {
 			responseFilter = flow.ResponseAgentIDs()
 		}
-		result, err := e.callAgent(ctx, agentID, prompt, cl.Token, responseFilter)
+		sessionID := uuid.New().String()
+		result, err := e.callAgent(ctx, agentID, userID, sessionID, prompt, cl.Token, responseFilter)
 		if err != nil {
 			e.logger.Error("Failed to run agent", "client", cl.Name, "agent", agentID, "error", err)
 			continue
 		}
-		if allResults != "" {
-			allResults += "\n---\n"
+		if res.Text != "" {
+			res.Text += "\n---\n"
 		}
-		allResults += result
+		res.Text += result
+		res.Sessions = append(res.Sessions, RunSession{AgentID: agentID, UserID: userID, SessionID: sessionID})
 	}
 
-	if allResults == "" {
-		return "", fmt.Errorf("all agents failed for client %q", cl.Name)
+	if res.Text == "" {
+		return RunResult{}, fmt.Errorf("all agents failed for client %q", cl.Name)
 	}
-	return allResults, nil
+	return res, nil
 }
 
-// callAgent sends a prompt to the agent API and returns the response text.
-// responseFilter optionally limits which agent authors are included in the
-// extracted response. When empty, all events are considered.
-func (e *Executor) callAgent(ctx context.Context, agentID, prompt, token string, responseFilter []string) (string, error) {
-	userID := "trigger"
-	sessionID := uuid.New().String()
-
+// callAgent sends a prompt to the agent API on behalf of userID in a new
+// session and returns the response text. responseFilter optionally limits
+// which agent authors are included in the extracted response. When empty, all
+// events are considered.
+func (e *Executor) callAgent(ctx context.Context, agentID, userID, sessionID, prompt, token string, responseFilter []string) (string, error) {
 	if err := e.ensureSession(ctx, agentID, userID, sessionID, token); err != nil {
 		e.logger.Warn("Failed to ensure session, continuing anyway", "error", err)
 	}
@@ -334,3 +374,39 @@ func (e *Executor) LogExternalConversation(agentID, userID, sessionID, source, c
 		e.logger.Error("Failed to log conversation", "error", err)
 	}
 }
+
+// RecordNote appends a system message to the conversations of a run, e.g.
+// the outcome of delivering a cron result. Conversations are written
+// asynchronously by the recorder middleware, so it waits briefly for them
+// to appear.
+func (e *Executor) RecordNote(ctx context.Context, sess RunSession, text string, metadata map[string]interface{}) {
+	if e.conversations == nil {
+		return
+	}
+
+	msg := store.ConversationMessage{
+		Role:      "system",
+		Content:   text,
+		Timestamp: time.Now(),
+		Metadata:  metadata,
+	}
+	for _, perspective := range []string{"user", "admin"} {
+		for attempt := 0; ; attempt++ {
+			if convo, ok := e.conversations.FindBySession(sess.SessionID, sess.AgentID, perspective); ok {
+				if err := e.conversations.AppendMessage(convo.ID, msg); err != nil {
+					e.logger.Error("Failed to record note", "session", sess.SessionID, "error", err)
+				}
+				break
+			}
+			if attempt == 4 {
+				e.logger.Debug("Conversation not found for note", "session", sess.SessionID, "perspective", perspective)
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// api is a minimal Matrix client-server API client covering what the bot
+// needs: sync, sending events, media and thread relations.
+type api struct {
+	baseURL string
+	token   string
+	http    *http.Client
+	txn     atomic.Int64
+}
+
+func newAPI(homeserverURL, token string) *api {
+	return &api{
+		baseURL: strings.TrimSuffix(homeserverURL, "/"),
+		token:   token,
+		// Long enough for a 30s /sync long-poll.
+		http: &http.Client{Timeout: 90 * time.Second},
+	}
+}
+
+// event is a Matrix room event. Content is decoded lazily per event type.
+type event struct {
+	Type     string          `json:"type"`
+	Sender   string          `json:"sender"`
+	EventID  string          `json:"event_id"`
+	StateKey *string         `json:"state_key,omitempty"`
+	Content  json.RawMessage `json:"content"`
+}
+
+// messageContent is the content of an m.room.message event.
+type messageContent struct {
+	MsgType   string          `json:"msgtype"`
+	Body      string          `json:"body"`
+	URL       string          `json:"url,omitempty"`
+	File      json.RawMessage `json:"file,omitempty"`
+	Info      *mediaInfo      `json:"info,omitempty"`
+	RelatesTo *relatesTo      `json:"m.relates_to,omitempty"`
+	Mentions  *struct {
+		UserIDs []string `json:"user_ids,omitempty"`
+	} `json:"m.mentions,omitempty"`
+}
+
+type mediaInfo struct {
+	MIMEType string `json:"mimetype,omitempty"`
+	Size     int    `json:"size,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+}
+
+type relatesTo struct {
+	RelType       string `json:"rel_type,omitempty"`
+	EventID       string `json:"event_id,omitempty"`
+	Key           string `json:"key,omitempty"`
+	IsFallingBack bool   `json:"is_falling_back,omitempty"`
+	InReplyTo     *struct {
+		EventID string `json:"event_id"`
+	} `json:"m.in_reply_to,omitempty"`
+}
+
+// syncResponse holds the parts of a /sync response the bot uses.
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Summary struct {
+				JoinedMemberCount *int `json:"m.joined_member_count,omitempty"`
+			} `json:"summary"`
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct {
+			InviteState struct {
+				Events []event `json:"events"`
+			} `json:"invite_state"`
+		} `json:"invite"`
+	} `json:"rooms"`
+}
+
+// syncFilter keeps /sync responses to room messages and memberships.
+const syncFilter = `{"presence":{"types":[]},"account_data":{"types":[]},"room":{"ephemeral":{"types":[]},"state":{"lazy_load_members":true},"timeline":{"types":["m.room.message","m.room.encrypted","m.room.member"]}}}`
+
+func (a *api) whoami(ctx context.Context) (string, error) {
+	var resp struct {
+		UserID string `json:"user_id"`
+	}
+	if err := a.do(ctx, "GET", "/_matrix/client/v3/account/whoami", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.UserID, nil
+}
+
+func (a *api) displayName(ctx context.Context, userID string) (string, error) {
+	var resp struct {
+		DisplayName string `json:"displayname"`
+	}
+	if err := a.do(ctx, "GET", "/_matrix/client/v3/profile/"+url.PathEscape(userID)+"/displayname", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.DisplayName, nil
+}
+
+// sync long-polls for new events since the given batch token.
+func (a *api) sync(ctx context.Context, since string, timeout time.Duration) (*syncResponse, error) {
+	q := url.Values{}
+	q.Set("timeout", fmt.Sprint(timeout.Milliseconds()))
+	q.Set("filter", syncFilter)
+	if since != "" {
+		q.Set("since", since)
+	}
+	var resp syncResponse
+	if err := a.do(ctx, "GET", "/_matrix/client/v3/sync?"+q.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (a *api) joinRoom(ctx context.Context, roomID string) error {
+	return a.do(ctx, "POST", "/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/join", map[string]any{}, nil)
+}
+
+func (a *api) joinedMemberCount(ctx context.Context, roomID string) (int, error) {
+	var resp struct {
+		Joined map[string]json.RawMessage `json:"joined"`
+	}
+	if err := a.do(ctx, "GET", "/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/joined_members", nil, &resp); err != nil {
+		return 0, err
+	}
+	return len(resp.Joined), nil
+}
+
+// sendEvent sends a room event and returns its event ID.
+func (a *api) sendEvent(ctx context.Context, roomID, eventType string, content any) (string, error) {
+	txnID := fmt.Sprintf("magec-%d-%d", time.Now().UnixNano(), a.txn.Add(1))
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/%s/%s", url.PathEscape(roomID), url.PathEscape(eventType), txnID)
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	if err := a.do(ctx, "PUT", path, content, &resp); err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+func (a *api) typing(ctx context.Context, roomID, userID string, timeout time.Duration) error {
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/typing/%s", url.PathEscape(roomID), url.PathEscape(userID))
+	return a.do(ctx, "PUT", path, map[string]any{"typing": true, "timeout": timeout.Milliseconds()}, nil)
+}
+
+func (a *api) getEvent(ctx context.Context, roomID, eventID string) (*event, error) {
+	var ev event
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/event/%s", url.PathEscape(roomID), url.PathEscape(eventID))
+	if err := a.do(ctx, "GET", path, nil, &ev); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// threadEvents returns up to limit replies of a thread, newest first.
+func (a *api) threadEvents(ctx context.Context, roomID, rootID string, limit int) ([]event, error) {
+	var resp struct {
+		Chunk []event `json:"chunk"`
+	}
+	path := fmt.Sprintf("/_matrix/client/v1/rooms/%s/relations/%s/m.thread?dir=b&limit=%d", url.PathEscape(roomID), url.PathEscape(rootID), limit)
+	if err := a.do(ctx, "GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Chunk, nil
+}
+
+// upload stores media on the homeserver and returns its mxc:// URI.
+func (a *api) upload(ctx context.Context, name, mimeType string, data []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/_matrix/media/v3/upload?filename="+url.QueryEscape(name), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", mimeType)
+	var resp struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := a.send(req, &resp); err != nil {
+		return "", err
+	}
+	return resp.ContentURI, nil
+}
+
+// download fetches mxc:// media. It uses the authenticated media endpoint
+// and falls back to the legacy one for homeservers that predate it.
+func (a *api) download(ctx context.Context, mxc string) ([]byte, error) {
+	serverAndID, ok := strings.CutPrefix(mxc, "mxc://")
+	if !ok {
+		return nil, fmt.Errorf("invalid media URI %q", mxc)
+	}
+	var lastErr error
+	for _, prefix := range []string{"/_matrix/client/v1/media/download/", "/_matrix/media/v3/download/"} {
+		req, err := http.NewRequestWithContext(ctx, "GET", a.baseURL+prefix+serverAndID, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+a.token)
+		resp, err := a.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return data, nil
+		}
+		lastErr = fmt.Errorf("media download returned status %d", resp.StatusCode)
+	}
+	return nil, lastErr
+}
+
+// do sends a JSON request to the homeserver and decodes the JSON response
+// into out (when non-nil).
+func (a *api) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return a.send(req, out)
+}
+
+func (a *api) send(req *http.Request, out any) error {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var merr struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &merr) == nil && merr.ErrCode != "" {
+			return fmt.Errorf("matrix %s %s: %s (%s)", req.Method, req.URL.Path, merr.ErrCode, merr.Error)
+		}
+		return fmt.Errorf("matrix %s %s: status %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
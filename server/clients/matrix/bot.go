@@ -0,0 +1,531 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/achetronic/magec/server/clients/chatbot"
+	"github.com/achetronic/magec/server/clients/msgutil"
+	"github.com/achetronic/magec/server/store"
+)
+
+var reactions = map[chatbot.Reaction]string{
+	chatbot.ReactionSeen:     "👀",
+	chatbot.ReactionThinking: "🧠",
+	chatbot.ReactionDone:     "✅",
+	chatbot.ReactionFailed:   "❌",
+}
+
+const (
+	syncTimeout  = 30 * time.Second
+	retryBackoff = 5 * time.Second
+)
+
+// Client is a Matrix bot that follows the homeserver with /sync
+// long-polling. It is the chat-bot runtime's adapter for Matrix.
+type Client struct {
+	clientDef store.ClientDefinition
+	logger    *slog.Logger
+	runtime   *chatbot.Runtime
+	api       *api
+
+	cancel context.CancelFunc
+
+	userID      string
+	displayName string
+
+	mu        sync.Mutex
+	members   map[string]int    // room ID -> joined member count
+	names     map[string]string // user ID -> display name
+	encWarned map[string]bool   // rooms already warned about encryption
+}
+
+// replyTarget is carried in chatbot.Chat.Ref so replies land in the thread
+// of the message that triggered them.
+type replyTarget struct {
+	inReplyTo string
+}
+
+func New(clientDef store.ClientDefinition, agentURL string, agents []chatbot.AgentInfo, s chatbot.Store, logger *slog.Logger) (*Client, error) {
+	if clientDef.Config.Matrix == nil {
+		return nil, fmt.Errorf("matrix config is required")
+	}
+	cfg := clientDef.Config.Matrix
+	if cfg.HomeserverURL == "" {
+		return nil, fmt.Errorf("matrix homeserver URL is required")
+	}
+	if cfg.AccessToken == "" {
+		return nil, fmt.Errorf("matrix access token is required")
+	}
+
+	c := &Client{
+		clientDef: clientDef,
+		logger:    logger,
+		api:       newAPI(cfg.HomeserverURL, cfg.AccessToken),
+		members:   make(map[string]int),
+		names:     make(map[string]string),
+		encWarned: make(map[string]bool),
+	}
+	c.runtime = chatbot.New(c, chatbot.Config{
+		Platform:         store.IdentityMatrix,
+		CommandPrefix:    "!",
+		MaxMessageLength: msgutil.MatrixMaxMessageLength,
+		Bold:             func(s string) string { return "**" + s + "**" },
+		FormatToolCall:   msgutil.FormatToolCallMatrix,
+		FormatToolResult: msgutil.FormatToolResultMatrix,
+		TypingInterval:   8 * time.Second,
+		ResponseMode:     cfg.ResponseMode,
+		DefaultAgent:     cfg.DefaultAgent,
+		SetDefaultAgent: func(def *store.ClientDefinition, agentID string) {
+			mc := *def.Config.Matrix
+			mc.DefaultAgent = agentID
+			def.Config.Matrix = &mc
+		},
+	}, clientDef, agentURL, agents, s, logger)
+	return c, nil
+}
+
+// Start authenticates against the homeserver and blocks running the sync
+// loop until the context is cancelled or Stop is called. Messages sent
+// before the bot started are skipped.
+func (c *Client) Start(ctx context.Context) error {
+	syncCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+
+	userID, err := c.api.whoami(syncCtx)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate matrix bot: %w", err)
+	}
+	c.userID = userID
+	if name, err := c.api.displayName(syncCtx, userID); err == nil {
+		c.displayName = name
+	}
+	c.logger.Info("Matrix bot started", "user_id", c.userID, "homeserver", c.clientDef.Config.Matrix.HomeserverURL)
+
+	initial, err := c.api.sync(syncCtx, "", 0)
+	if err != nil {
+		if syncCtx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("initial matrix sync failed: %w", err)
+	}
+	c.handleInvites(syncCtx, initial)
+	since := initial.NextBatch
+
+	for syncCtx.Err() == nil {
+		resp, err := c.api.sync(syncCtx, since, syncTimeout)
+		if err != nil {
+			if syncCtx.Err() != nil {
+				return nil
+			}
+			c.logger.Error("Matrix sync failed", "error", err)
+			select {
+			case <-syncCtx.Done():
+			case <-time.After(retryBackoff):
+			}
+			continue
+		}
+		since = resp.NextBatch
+		c.handleInvites(syncCtx, resp)
+		c.handleTimeline(syncCtx, resp)
+	}
+	return nil
+}
+
+func (c *Client) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.logger.Info("Matrix bot stopped")
+}
+
+// Deliver posts text to a room the bot has joined, outside of any
+// conversation. title is unused.
+func (c *Client) Deliver(ctx context.Context, target, _, text string) error {
+	return c.runtime.Deliver(ctx, chatbot.Chat{ID: target}, text)
+}
+
+// handleInvites joins rooms the bot is invited to when the inviter or the
+// room is allowed.
+func (c *Client) handleInvites(ctx context.Context, resp *syncResponse) {
+	for roomID, room := range resp.Rooms.Invite {
+		inviter := ""
+		for _, ev := range room.InviteState.Events {
+			if ev.Type == "m.room.member" && ev.StateKey != nil && *ev.StateKey == c.userID {
+				inviter = ev.Sender
+			}
+		}
+		if !c.isAllowed(inviter, roomID) {
+			c.logger.Debug("Ignoring Matrix invite", "room", roomID, "inviter", inviter)
+			continue
+		}
+		if err := c.api.joinRoom(ctx, roomID); err != nil {
+			c.logger.Warn("Failed to join Matrix room", "room", roomID, "error", err)
+			continue
+		}
+		c.logger.Info("Joined Matrix room", "room", roomID, "inviter", inviter)
+	}
+}
+
+func (c *Client) handleTimeline(ctx context.Context, resp *syncResponse) {
+	for roomID, room := range resp.Rooms.Join {
+		if n := room.Summary.JoinedMemberCount; n != nil {
+			c.mu.Lock()
+			c.members[roomID] = *n
+			c.mu.Unlock()
+		}
+		for _, ev := range room.Timeline.Events {
+			switch ev.Type {
+			case "m.room.member":
+				// Membership changed: recount on the next message.
+				c.mu.Lock()
+				delete(c.members, roomID)
+				c.mu.Unlock()
+			case "m.room.encrypted":
+				c.warnEncrypted(roomID)
+			case "m.room.message":
+				go c.handleMessage(ctx, roomID, ev)
+			}
+		}
+	}
+}
+
+func (c *Client) handleMessage(ctx context.Context, roomID string, ev event) {
+	if ev.Sender == c.userID {
+		return
+	}
+	var content messageContent
+	if err := json.Unmarshal(ev.Content, &content); err != nil {
+		return
+	}
+	// Skip bot notices and edits of earlier messages.
+	if content.MsgType == "m.notice" || (content.RelatesTo != nil && content.RelatesTo.RelType == "m.replace") {
+		return
+	}
+	if !c.isAllowed(ev.Sender, roomID) {
+		c.logger.Debug("Unauthorized Matrix message", "user", ev.Sender, "room", roomID)
+		return
+	}
+
+	threadID := ""
+	if content.RelatesTo != nil && content.RelatesTo.RelType == "m.thread" {
+		threadID = content.RelatesTo.EventID
+	}
+
+	isDM := c.isDirect(ctx, roomID)
+	text := strings.TrimSpace(content.Body)
+	isAudio := content.MsgType == "m.audio" && content.URL != ""
+	if !isDM {
+		if !c.isMentioned(content) {
+			return
+		}
+		text = c.stripBotMention(text)
+		// A mention in the room timeline starts a thread on that message.
+		if threadID == "" {
+			threadID = ev.EventID
+		}
+	}
+	if content.MsgType != "m.text" && !isAudio {
+		return
+	}
+
+	roomType := "group"
+	if isDM {
+		roomType = "direct"
+	}
+	name := c.userName(ctx, ev.Sender)
+	meta := map[string]any{
+		"matrix_user_id":   ev.Sender,
+		"matrix_room_id":   roomID,
+		"matrix_room_type": roomType,
+	}
+	if name != ev.Sender {
+		meta["matrix_name"] = name
+	}
+	if threadID != "" {
+		meta["matrix_thread_id"] = threadID
+	}
+
+	msg := chatbot.Message{
+		ID: ev.EventID,
+		Chat: chatbot.Chat{
+			ID:       roomID,
+			ThreadID: threadID,
+			Group:    !isDM,
+			Ref:      replyTarget{inReplyTo: ev.EventID},
+		},
+		UserID:   ev.Sender,
+		UserName: name,
+		Text:     text,
+		Meta:     meta,
+	}
+
+	if isAudio {
+		mxc := content.URL
+		c.logger.Info("Matrix audio message received", "user", ev.Sender, "room", roomID)
+		msg.Text = ""
+		msg.Audio = func(ctx context.Context) ([]byte, error) {
+			return c.api.download(ctx, mxc)
+		}
+		c.runtime.Process(ctx, msg)
+		return
+	}
+
+	if msg.Text == "" {
+		return
+	}
+	c.runtime.Handle(ctx, msg)
+}
+
+// SendText implements chatbot.Adapter. Command replies and tool activity are
+// sent as HTML, runtime notices as m.notice so other bots ignore them.
+func (c *Client) SendText(ctx context.Context, chat chatbot.Chat, text string, kind chatbot.TextKind) (string, error) {
+	content := map[string]any{"msgtype": "m.text", "body": text}
+	switch kind {
+	case chatbot.TextNotice:
+		content["msgtype"] = "m.notice"
+	case chatbot.TextMarkup:
+		content["body"] = strings.ReplaceAll(text, "**", "")
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = markupToHTML(text)
+	case chatbot.TextTool:
+		content["msgtype"] = "m.notice"
+		content["body"] = htmlToText(text)
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = text
+	}
+	c.addRelation(content, chat)
+	return c.api.sendEvent(ctx, chat.ID, "m.room.message", content)
+}
+
+// EditText implements chatbot.Adapter using an m.replace relation.
+func (c *Client) EditText(ctx context.Context, chat chatbot.Chat, messageID, text string) error {
+	content := map[string]any{
+		"msgtype":       "m.notice",
+		"body":          "* " + text,
+		"m.new_content": map[string]any{"msgtype": "m.notice", "body": text},
+		"m.relates_to":  map[string]any{"rel_type": "m.replace", "event_id": messageID},
+	}
+	_, err := c.api.sendEvent(ctx, chat.ID, "m.room.message", content)
+	return err
+}
+
+// SendFile implements chatbot.Adapter. The file is uploaded to the media
+// repository first; voice replies are flagged as voice messages.
+func (c *Client) SendFile(ctx context.Context, chat chatbot.Chat, file chatbot.File) error {
+	uri, err := c.api.upload(ctx, file.Name, file.MIMEType, file.Data)
+	if err != nil {
+		return err
+	}
+	content := map[string]any{
+		"msgtype": "m.file",
+		"body":    file.Name,
+		"url":     uri,
+		"info":    mediaInfo{MIMEType: file.MIMEType, Size: len(file.Data)},
+	}
+	switch {
+	case file.Voice:
+		content["msgtype"] = "m.audio"
+		content["org.matrix.msc3245.voice"] = map[string]any{}
+		content["org.matrix.msc1767.audio"] = map[string]any{}
+	case strings.HasPrefix(file.MIMEType, "image/"):
+		content["msgtype"] = "m.image"
+	case strings.HasPrefix(file.MIMEType, "audio/"):
+		content["msgtype"] = "m.audio"
+	}
+	c.addRelation(content, chat)
+	_, err = c.api.sendEvent(ctx, chat.ID, "m.room.message", content)
+	return err
+}
+
+// React implements chatbot.Adapter with m.annotation reactions.
+func (c *Client) React(ctx context.Context, msg chatbot.Message, reaction chatbot.Reaction) error {
+	_, err := c.api.sendEvent(ctx, msg.Chat.ID, "m.reaction", map[string]any{
+		"m.relates_to": relatesTo{RelType: "m.annotation", EventID: msg.ID, Key: reactions[reaction]},
+	})
+	return err
+}
+
+// FetchHistory implements chatbot.Adapter. It returns the thread root and
+// its earlier replies; messages outside a thread have no history.
+func (c *Client) FetchHistory(ctx context.Context, msg chatbot.Message) ([]chatbot.HistoryEntry, error) {
+	if msg.Chat.ThreadID == "" || msg.Chat.ThreadID == msg.ID {
+		return nil, nil
+	}
+
+	limit := c.clientDef.Config.Matrix.ThreadHistoryLimit
+	if limit <= 0 {
+		limit = 50
+	}
+	replies, err := c.api.threadEvents(ctx, msg.Chat.ID, msg.Chat.ThreadID, limit)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]event, 0, len(replies)+1)
+	if root, err := c.api.getEvent(ctx, msg.Chat.ID, msg.Chat.ThreadID); err == nil {
+		events = append(events, *root)
+	}
+	// Relations come newest first.
+	for i := len(replies) - 1; i >= 0; i-- {
+		events = append(events, replies[i])
+	}
+
+	var history []chatbot.HistoryEntry
+	for _, ev := range events {
+		if ev.EventID == msg.ID || ev.Type != "m.room.message" {
+			continue
+		}
+		var content messageContent
+		if err := json.Unmarshal(ev.Content, &content); err != nil {
+			continue
+		}
+		text := strings.TrimSpace(content.Body)
+		if text == "" || (content.MsgType != "m.text" && content.MsgType != "m.notice") {
+			continue
+		}
+		history = append(history, chatbot.HistoryEntry{Author: c.userName(ctx, ev.Sender), Text: text})
+	}
+	return history, nil
+}
+
+// Typing implements chatbot.Typer.
+func (c *Client) Typing(ctx context.Context, chat chatbot.Chat) {
+	_ = c.api.typing(ctx, chat.ID, c.userID, 10*time.Second)
+}
+
+// addRelation places a reply in the chat's thread. Clients without thread
+// support fall back to showing it as a reply to the triggering message.
+func (c *Client) addRelation(content map[string]any, chat chatbot.Chat) {
+	if chat.ThreadID == "" {
+		return
+	}
+	rel := relatesTo{RelType: "m.thread", EventID: chat.ThreadID, IsFallingBack: true}
+	if target, ok := chat.Ref.(replyTarget); ok && target.inReplyTo != "" {
+		rel.InReplyTo = &struct {
+			EventID string `json:"event_id"`
+		}{EventID: target.inReplyTo}
+	}
+	content["m.relates_to"] = rel
+}
+
+// isAllowed checks whether a Matrix user or room is permitted to interact
+// with this bot. If no allowlists are configured, all users are allowed.
+func (c *Client) isAllowed(userID, roomID string) bool {
+	cfg := c.clientDef.Config.Matrix
+	if len(cfg.AllowedUsers) == 0 && len(cfg.AllowedRooms) == 0 {
+		return true
+	}
+	if len(cfg.AllowedUsers) > 0 && slices.Contains(cfg.AllowedUsers, userID) {
+		return true
+	}
+	if len(cfg.AllowedRooms) > 0 && slices.Contains(cfg.AllowedRooms, roomID) {
+		return true
+	}
+	return false
+}
+
+// isDirect reports whether a room only holds the bot and one other user.
+func (c *Client) isDirect(ctx context.Context, roomID string) bool {
+	c.mu.Lock()
+	n, ok := c.members[roomID]
+	c.mu.Unlock()
+	if !ok {
+		count, err := c.api.joinedMemberCount(ctx, roomID)
+		if err != nil {
+			c.logger.Warn("Failed to count Matrix room members", "room", roomID, "error", err)
+			return false
+		}
+		n = count
+		c.mu.Lock()
+		c.members[roomID] = n
+		c.mu.Unlock()
+	}
+	return n <= 2
+}
+
+// isMentioned reports whether a message addresses the bot, either through
+// intentional mentions or by its user ID or display name in the body.
+func (c *Client) isMentioned(content messageContent) bool {
+	if content.Mentions != nil && slices.Contains(content.Mentions.UserIDs, c.userID) {
+		return true
+	}
+	body := strings.ToLower(content.Body)
+	if strings.Contains(body, strings.ToLower(c.userID)) {
+		return true
+	}
+	return c.displayName != "" && strings.Contains(body, strings.ToLower(c.displayName))
+}
+
+// stripBotMention removes the bot's user ID or display name from the start
+// of a message, including the ":" that clients add after a pill.
+func (c *Client) stripBotMention(text string) string {
+	for _, name := range []string{c.userID, c.displayName} {
+		if name == "" {
+			continue
+		}
+		if len(text) >= len(name) && strings.EqualFold(text[:len(name)], name) {
+			text = strings.TrimPrefix(text[len(name):], ":")
+			break
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// userName returns a user's display name, cached for the bot's lifetime.
+func (c *Client) userName(ctx context.Context, userID string) string {
+	c.mu.Lock()
+	name, ok := c.names[userID]
+	c.mu.Unlock()
+	if ok {
+		return name
+	}
+	name, err := c.api.displayName(ctx, userID)
+	if err != nil || name == "" {
+		name = userID
+	}
+	c.mu.Lock()
+	c.names[userID] = name
+	c.mu.Unlock()
+	return name
+}
+
+// warnEncrypted logs once per room that end-to-end encrypted messages
+// cannot be read.
+func (c *Client) warnEncrypted(roomID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.encWarned[roomID] {
+		return
+	}
+	c.encWarned[roomID] = true
+	c.logger.Warn("Matrix room is end-to-end encrypted, messages are ignored", "room", roomID)
+}
+
+var (
+	boldPattern = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	codePattern = regexp.MustCompile("`([^`]+)`")
+	tagPattern  = regexp.MustCompile(`<[^>]*>`)
+)
+
+// markupToHTML renders the runtime's command markup (**bold** and `code`)
+// as Matrix HTML.
+func markupToHTML(text string) string {
+	s := html.EscapeString(text)
+	s = boldPattern.ReplaceAllString(s, "<b>$1</b>")
+	s = codePattern.ReplaceAllString(s, "<code>$1</code>")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// htmlToText builds the plain-text fallback body of an HTML message.
+func htmlToText(s string) string {
+	s = strings.NewReplacer("<br>", "\n", "</blockquote>", "\n", "<pre>", "\n").Replace(s)
+	return strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(s, "")))
+}
@@ -0,0 +1,56 @@
+package matrix
+
+import (
+	"github.com/achetronic/magec/server/clients"
+)
+
+type Provider struct{}
+
+func init() {
+	clients.Register(&Provider{})
+}
+
+func (p *Provider) Type() string        { return "matrix" }
+func (p *Provider) DisplayName() string { return "Matrix" }
+
+func (p *Provider) ConfigSchema() clients.Schema {
+	return clients.Schema{
+		"type": "object",
+		"properties": clients.Schema{
+			"homeserverUrl": clients.Schema{
+				"type":          "string",
+				"title":         "Homeserver URL",
+				"minLength":     1,
+				"x-placeholder": "https://matrix.example.com",
+			},
+			"accessToken": clients.Schema{
+				"type":          "string",
+				"title":         "Access Token",
+				"minLength":     1,
+				"x-format":      "password",
+				"x-placeholder": "syt_...",
+			},
+			"allowedUsers": clients.Schema{
+				"type":          "array",
+				"items":         clients.Schema{"type": "string"},
+				"title":         "Allowed Users",
+				"x-placeholder": "Comma-separated Matrix user IDs (e.g. @alice:example.com)",
+			},
+			"allowedRooms": clients.Schema{
+				"type":          "array",
+				"items":         clients.Schema{"type": "string"},
+				"title":         "Allowed Rooms",
+				"x-placeholder": "Comma-separated Matrix room IDs (e.g. !abc123:example.com)",
+			},
+			"responseMode": clients.Schema{
+				"type":    "string",
+				"title":   "Response Mode",
+				"default": "text",
+				"enum":    []string{"text", "voice", "mirror", "both"},
+			},
+			"defaultAgent":       clients.DefaultAgentSchema(),
+			"threadHistoryLimit": clients.ThreadHistoryLimitSchema(100),
+		},
+		"required": []string{"homeserverUrl", "accessToken"},
+	}
+}
@@ -0,0 +1,267 @@
+package mattermost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// api is a minimal Mattermost REST v4 client covering what the bot needs.
+type api struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newAPI(serverURL, token string) *api {
+	return &api{
+		baseURL: strings.TrimSuffix(serverURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type user struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Nickname  string `json:"nickname"`
+	Email     string `json:"email"`
+}
+
+// fullName returns the user's real name, falling back to the nickname and
+// then the username.
+func (u *user) fullName() string {
+	if name := strings.TrimSpace(u.FirstName + " " + u.LastName); name != "" {
+		return name
+	}
+	if u.Nickname != "" {
+		return u.Nickname
+	}
+	return u.Username
+}
+
+type post struct {
+	ID        string         `json:"id,omitempty"`
+	CreateAt  int64          `json:"create_at,omitempty"`
+	UserID    string         `json:"user_id,omitempty"`
+	ChannelID string         `json:"channel_id"`
+	RootID    string         `json:"root_id,omitempty"`
+	Message   string         `json:"message"`
+	Type      string         `json:"type,omitempty"`
+	FileIDs   []string       `json:"file_ids,omitempty"`
+	Props     map[string]any `json:"props,omitempty"`
+}
+
+type fileInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+// wsEvent is a WebSocket event. For "posted", Data holds the post as a JSON
+// string plus channel and mention details.
+type wsEvent struct {
+	Event string `json:"event"`
+	Data  struct {
+		Post        string `json:"post"`
+		ChannelType string `json:"channel_type"`
+		TeamID      string `json:"team_id"`
+		Mentions    string `json:"mentions"`
+	} `json:"data"`
+}
+
+func (a *api) me(ctx context.Context) (*user, error) {
+	return a.user(ctx, "me")
+}
+
+func (a *api) user(ctx context.Context, id string) (*user, error) {
+	var u user
+	if err := a.do(ctx, "GET", "/api/v4/users/"+url.PathEscape(id), nil, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (a *api) createPost(ctx context.Context, p post) (*post, error) {
+	var created post
+	if err := a.do(ctx, "POST", "/api/v4/posts", p, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (a *api) patchPost(ctx context.Context, id, message string) error {
+	return a.do(ctx, "PUT", "/api/v4/posts/"+url.PathEscape(id)+"/patch", map[string]string{"message": message}, nil)
+}
+
+func (a *api) addReaction(ctx context.Context, userID, postID, emoji string) error {
+	return a.do(ctx, "POST", "/api/v4/reactions", map[string]string{
+		"user_id":    userID,
+		"post_id":    postID,
+		"emoji_name": emoji,
+	}, nil)
+}
+
+func (a *api) typing(ctx context.Context, channelID, parentID string) error {
+	return a.do(ctx, "POST", "/api/v4/users/me/typing", map[string]string{
+		"channel_id": channelID,
+		"parent_id":  parentID,
+	}, nil)
+}
+
+// thread returns all posts of the thread rooted at rootID, oldest first.
+func (a *api) thread(ctx context.Context, rootID string) ([]post, error) {
+	var resp struct {
+		Posts map[string]post `json:"posts"`
+	}
+	if err := a.do(ctx, "GET", "/api/v4/posts/"+url.PathEscape(rootID)+"/thread", nil, &resp); err != nil {
+		return nil, err
+	}
+	posts := make([]post, 0, len(resp.Posts))
+	for _, p := range resp.Posts {
+		posts = append(posts, p)
+	}
+	sortByCreateAt(posts)
+	return posts, nil
+}
+
+func (a *api) fileInfo(ctx context.Context, id string) (*fileInfo, error) {
+	var info fileInfo
+	if err := a.do(ctx, "GET", "/api/v4/files/"+url.PathEscape(id)+"/info", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (a *api) downloadFile(ctx context.Context, id string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", a.baseURL+"/api/v4/files/"+url.PathEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("file download returned status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// uploadFile stores a file in a channel and returns its ID for attaching to
+// a post.
+func (a *api) uploadFile(ctx context.Context, channelID, name string, data []byte) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("channel_id", channelID); err != nil {
+		return "", err
+	}
+	part, err := w.CreateFormFile("files", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/api/v4/files", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	var resp struct {
+		FileInfos []fileInfo `json:"file_infos"`
+	}
+	if err := a.send(req, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.FileInfos) == 0 {
+		return "", fmt.Errorf("upload returned no file")
+	}
+	return resp.FileInfos[0].ID, nil
+}
+
+// dialWebSocket opens the event stream, authenticated with the bot token.
+func (a *api) dialWebSocket(ctx context.Context) (*websocket.Conn, error) {
+	wsURL := a.baseURL + "/api/v4/websocket"
+	switch {
+	case strings.HasPrefix(wsURL, "https://"):
+		wsURL = "wss://" + strings.TrimPrefix(wsURL, "https://")
+	case strings.HasPrefix(wsURL, "http://"):
+		wsURL = "ws://" + strings.TrimPrefix(wsURL, "http://")
+	}
+	header := http.Header{"Authorization": []string{"Bearer " + a.token}}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	return conn, err
+}
+
+// do sends a JSON request and decodes the JSON response into out (when
+// non-nil).
+func (a *api) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return a.send(req, out)
+}
+
+func (a *api) send(req *http.Request, out any) error {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			ID      string `json:"id"`
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("mattermost %s %s: %s (%s)", req.Method, req.URL.Path, apiErr.Message, apiErr.ID)
+		}
+		return fmt.Errorf("mattermost %s %s: status %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func sortByCreateAt(posts []post) {
+	for i := 1; i < len(posts); i++ {
+		for j := i; j > 0 && posts[j].CreateAt < posts[j-1].CreateAt; j-- {
+			posts[j], posts[j-1] = posts[j-1], posts[j]
+		}
+	}
+}
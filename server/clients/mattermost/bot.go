@@ -0,0 +1,390 @@
+package mattermost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/achetronic/magec/server/clients/chatbot"
+	"github.com/achetronic/magec/server/clients/msgutil"
+	"github.com/achetronic/magec/server/store"
+)
+
+var reactions = map[chatbot.Reaction]string{
+	chatbot.ReactionSeen:     "eyes",
+	chatbot.ReactionThinking: "brain",
+	chatbot.ReactionDone:     "white_check_mark",
+	chatbot.ReactionFailed:   "x",
+}
+
+const retryBackoff = 5 * time.Second
+
+// Client is a Mattermost bot that receives posts over the WebSocket API and
+// replies through the REST API. It is the chat-bot runtime's adapter for
+// Mattermost.
+type Client struct {
+	clientDef store.ClientDefinition
+	logger    *slog.Logger
+	runtime   *chatbot.Runtime
+	api       *api
+
+	cancel context.CancelFunc
+
+	botUserID   string
+	botUsername string
+
+	mu    sync.Mutex
+	users map[string]*user // user ID -> profile
+}
+
+func New(clientDef store.ClientDefinition, agentURL string, agents []chatbot.AgentInfo, s chatbot.Store, logger *slog.Logger) (*Client, error) {
+	if clientDef.Config.Mattermost == nil {
+		return nil, fmt.Errorf("mattermost config is required")
+	}
+	cfg := clientDef.Config.Mattermost
+	if cfg.ServerURL == "" {
+		return nil, fmt.Errorf("mattermost server URL is required")
+	}
+	if cfg.BotToken == "" {
+		return nil, fmt.Errorf("mattermost bot token is required")
+	}
+
+	c := &Client{
+		clientDef: clientDef,
+		logger:    logger,
+		api:       newAPI(cfg.ServerURL, cfg.BotToken),
+		users:     make(map[string]*user),
+	}
+	c.runtime = chatbot.New(c, chatbot.Config{
+		Platform:         store.IdentityMattermost,
+		CommandPrefix:    "!",
+		MaxMessageLength: msgutil.MattermostMaxMessageLength,
+		Bold:             func(s string) string { return "**" + s + "**" },
+		FormatToolCall:   msgutil.FormatToolCallDiscord,
+		FormatToolResult: msgutil.FormatToolResultDiscord,
+		TypingInterval:   5 * time.Second,
+		ResponseMode:     cfg.ResponseMode,
+		DefaultAgent:     cfg.DefaultAgent,
+		SetDefaultAgent: func(def *store.ClientDefinition, agentID string) {
+			mc := *def.Config.Mattermost
+			mc.DefaultAgent = agentID
+			def.Config.Mattermost = &mc
+		},
+	}, clientDef, agentURL, agents, s, logger)
+	return c, nil
+}
+
+// Start authenticates the bot and blocks reading the WebSocket event stream
+// until the context is cancelled or Stop is called. Dropped connections are
+// reopened after a short backoff.
+func (c *Client) Start(ctx context.Context) error {
+	wsCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+
+	me, err := c.api.me(wsCtx)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate mattermost bot: %w", err)
+	}
+	c.botUserID = me.ID
+	c.botUsername = me.Username
+	c.logger.Info("Mattermost bot started", "username", c.botUsername, "server", c.clientDef.Config.Mattermost.ServerURL)
+
+	for wsCtx.Err() == nil {
+		if err := c.listen(wsCtx); err != nil && wsCtx.Err() == nil {
+			c.logger.Error("Mattermost WebSocket failed", "error", err)
+		}
+		select {
+		case <-wsCtx.Done():
+		case <-time.After(retryBackoff):
+		}
+	}
+	return nil
+}
+
+func (c *Client) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.logger.Info("Mattermost bot stopped")
+}
+
+// Deliver posts text to a channel, outside of any conversation. title is
+// unused.
+func (c *Client) Deliver(ctx context.Context, target, _, text string) error {
+	return c.runtime.Deliver(ctx, chatbot.Chat{ID: target}, text)
+}
+
+// listen reads events from one WebSocket connection until it fails or the
+// context is cancelled.
+func (c *Client) listen(ctx context.Context) error {
+	conn, err := c.api.dialWebSocket(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c.logger.Debug("Mattermost WebSocket connected")
+	for {
+		var ev wsEvent
+		if err := conn.ReadJSON(&ev); err != nil {
+			return err
+		}
+		if ev.Event == "posted" {
+			go c.handlePosted(ctx, ev)
+		}
+	}
+}
+
+func (c *Client) handlePosted(ctx context.Context, ev wsEvent) {
+	var p post
+	if err := json.Unmarshal([]byte(ev.Data.Post), &p); err != nil {
+		return
+	}
+	// Skip our own posts, system messages and posts made by other bots or
+	// integrations.
+	if p.UserID == c.botUserID || p.Type != "" || p.Props["from_bot"] == "true" || p.Props["from_webhook"] == "true" {
+		return
+	}
+	if !c.isAllowed(p.UserID, p.ChannelID) {
+		c.logger.Debug("Unauthorized Mattermost message", "user", p.UserID, "channel", p.ChannelID)
+		return
+	}
+
+	isDM := ev.Data.ChannelType == "D"
+	text := strings.TrimSpace(p.Message)
+	threadID := p.RootID
+	if !isDM {
+		if !c.isMentioned(ev.Data.Mentions, text) {
+			return
+		}
+		text = c.stripBotMention(text)
+		// A mention in the channel root starts a thread on that post.
+		if threadID == "" {
+			threadID = p.ID
+		}
+	}
+
+	channelType := "channel"
+	if isDM {
+		channelType = "direct"
+	}
+	meta := map[string]any{
+		"mattermost_user_id":      p.UserID,
+		"mattermost_channel_id":   p.ChannelID,
+		"mattermost_channel_type": channelType,
+	}
+	if ev.Data.TeamID != "" {
+		meta["mattermost_team_id"] = ev.Data.TeamID
+	}
+	if threadID != "" {
+		meta["mattermost_thread_id"] = threadID
+	}
+	var name string
+	if u := c.user(ctx, p.UserID); u != nil {
+		name = u.fullName()
+		meta["mattermost_username"] = u.Username
+		if name != u.Username {
+			meta["mattermost_name"] = name
+		}
+		if u.Email != "" {
+			meta["mattermost_email"] = u.Email
+		}
+	}
+
+	msg := chatbot.Message{
+		ID:       p.ID,
+		Chat:     chatbot.Chat{ID: p.ChannelID, ThreadID: threadID, Group: !isDM},
+		UserID:   p.UserID,
+		UserName: name,
+		Text:     text,
+		Meta:     meta,
+	}
+
+	// Voice clips are only transcribed in direct messages, like Slack.
+	if isDM {
+		if info := c.audioFile(ctx, p.FileIDs); info != nil {
+			c.logger.Info("Mattermost audio clip received",
+				"user", p.UserID,
+				"channel", p.ChannelID,
+				"mimetype", info.MIMEType,
+				"size", info.Size,
+				"fileID", info.ID,
+			)
+			fileID := info.ID
+			msg.Audio = func(ctx context.Context) ([]byte, error) {
+				return c.api.downloadFile(ctx, fileID)
+			}
+			c.runtime.Process(ctx, msg)
+			return
+		}
+	}
+
+	if msg.Text == "" {
+		return
+	}
+	c.runtime.Handle(ctx, msg)
+}
+
+// SendText implements chatbot.Adapter. Mattermost renders Markdown, so every
+// kind of text is posted as-is.
+func (c *Client) SendText(ctx context.Context, chat chatbot.Chat, text string, _ chatbot.TextKind) (string, error) {
+	created, err := c.api.createPost(ctx, post{ChannelID: chat.ID, RootID: chat.ThreadID, Message: text})
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// EditText implements chatbot.Adapter.
+func (c *Client) EditText(ctx context.Context, _ chatbot.Chat, messageID, text string) error {
+	return c.api.patchPost(ctx, messageID, text)
+}
+
+// SendFile implements chatbot.Adapter. The file is uploaded to the channel
+// first and then attached to a post; voice replies carry their transcript
+// as the message.
+func (c *Client) SendFile(ctx context.Context, chat chatbot.Chat, file chatbot.File) error {
+	fileID, err := c.api.uploadFile(ctx, chat.ID, file.Name, file.Data)
+	if err != nil {
+		return err
+	}
+	_, err = c.api.createPost(ctx, post{
+		ChannelID: chat.ID,
+		RootID:    chat.ThreadID,
+		Message:   file.Caption,
+		FileIDs:   []string{fileID},
+	})
+	return err
+}
+
+// React implements chatbot.Adapter.
+func (c *Client) React(ctx context.Context, msg chatbot.Message, reaction chatbot.Reaction) error {
+	return c.api.addReaction(ctx, c.botUserID, msg.ID, reactions[reaction])
+}
+
+// FetchHistory implements chatbot.Adapter. It returns the thread root and
+// its earlier replies; posts outside a thread have no history.
+func (c *Client) FetchHistory(ctx context.Context, msg chatbot.Message) ([]chatbot.HistoryEntry, error) {
+	if msg.Chat.ThreadID == "" || msg.Chat.ThreadID == msg.ID {
+		return nil, nil
+	}
+
+	limit := c.clientDef.Config.Mattermost.ThreadHistoryLimit
+	if limit <= 0 {
+		limit = 50
+	}
+	posts, err := c.api.thread(ctx, msg.Chat.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+	posts = slices.DeleteFunc(posts, func(p post) bool {
+		return p.ID == msg.ID || p.Type != "" || strings.TrimSpace(p.Message) == ""
+	})
+	if len(posts) > limit {
+		posts = posts[len(posts)-limit:]
+	}
+
+	history := make([]chatbot.HistoryEntry, 0, len(posts))
+	for _, p := range posts {
+		author := p.UserID
+		if p.UserID == c.botUserID {
+			author = "assistant"
+		} else if u := c.user(ctx, p.UserID); u != nil {
+			author = u.fullName()
+		}
+		history = append(history, chatbot.HistoryEntry{Author: author, Text: strings.TrimSpace(p.Message)})
+	}
+	return history, nil
+}
+
+// Typing implements chatbot.Typer.
+func (c *Client) Typing(ctx context.Context, chat chatbot.Chat) {
+	_ = c.api.typing(ctx, chat.ID, chat.ThreadID)
+}
+
+// audioFile returns the first audio attachment among a post's files, if any.
+func (c *Client) audioFile(ctx context.Context, fileIDs []string) *fileInfo {
+	for _, id := range fileIDs {
+		info, err := c.api.fileInfo(ctx, id)
+		if err != nil {
+			c.logger.Warn("Failed to read Mattermost file info", "fileID", id, "error", err)
+			continue
+		}
+		if strings.HasPrefix(info.MIMEType, "audio/") {
+			return info
+		}
+	}
+	return nil
+}
+
+// isAllowed checks whether a Mattermost user or channel is permitted to
+// interact with this bot. If no allowlists are configured, all users are
+// allowed.
+func (c *Client) isAllowed(userID, channelID string) bool {
+	cfg := c.clientDef.Config.Mattermost
+	if len(cfg.AllowedUsers) == 0 && len(cfg.AllowedChannels) == 0 {
+		return true
+	}
+	if len(cfg.AllowedUsers) > 0 && slices.Contains(cfg.AllowedUsers, userID) {
+		return true
+	}
+	if len(cfg.AllowedChannels) > 0 && slices.Contains(cfg.AllowedChannels, channelID) {
+		return true
+	}
+	return false
+}
+
+// isMentioned reports whether a post addresses the bot, either through the
+// server-computed mentions or by @username in the text.
+func (c *Client) isMentioned(mentions, text string) bool {
+	var ids []string
+	if mentions != "" && json.Unmarshal([]byte(mentions), &ids) == nil && slices.Contains(ids, c.botUserID) {
+		return true
+	}
+	return c.mentionPattern().MatchString(text)
+}
+
+// stripBotMention removes every @username mention of the bot from a post.
+func (c *Client) stripBotMention(text string) string {
+	return strings.TrimSpace(c.mentionPattern().ReplaceAllString(text, ""))
+}
+
+func (c *Client) mentionPattern() *regexp.Regexp {
+	return regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(c.botUsername) + `\b:?`)
+}
+
+// user returns a user's profile, cached for the bot's lifetime. It returns
+// nil when the profile cannot be read.
+func (c *Client) user(ctx context.Context, userID string) *user {
+	c.mu.Lock()
+	u, ok := c.users[userID]
+	c.mu.Unlock()
+	if ok {
+		return u
+	}
+	u, err := c.api.user(ctx, userID)
+	if err != nil {
+		c.logger.Warn("Failed to read Mattermost user", "user", userID, "error", err)
+		return nil
+	}
+	c.mu.Lock()
+	c.users[userID] = u
+	c.mu.Unlock()
+	return u
+}
@@ -0,0 +1,55 @@
+package mattermost
+
+import (
+	"github.com/achetronic/magec/server/clients"
+)
+
+type Provider struct{}
+
+func init() {
+	clients.Register(&Provider{})
+}
+
+func (p *Provider) Type() string        { return "mattermost" }
+func (p *Provider) DisplayName() string { return "Mattermost" }
+
+func (p *Provider) ConfigSchema() clients.Schema {
+	return clients.Schema{
+		"type": "object",
+		"properties": clients.Schema{
+			"serverUrl": clients.Schema{
+				"type":          "string",
+				"title":         "Server URL",
+				"minLength":     1,
+				"x-placeholder": "https://mattermost.example.com",
+			},
+			"botToken": clients.Schema{
+				"type":      "string",
+				"title":     "Bot Token",
+				"minLength": 1,
+				"x-format":  "password",
+			},
+			"allowedUsers": clients.Schema{
+				"type":          "array",
+				"items":         clients.Schema{"type": "string"},
+				"title":         "Allowed Users",
+				"x-placeholder": "Comma-separated Mattermost user IDs",
+			},
+			"allowedChannels": clients.Schema{
+				"type":          "array",
+				"items":         clients.Schema{"type": "string"},
+				"title":         "Allowed Channels",
+				"x-placeholder": "Comma-separated Mattermost channel IDs",
+			},
+			"responseMode": clients.Schema{
+				"type":    "string",
+				"title":   "Response Mode",
+				"default": "text",
+				"enum":    []string{"text", "voice", "mirror", "both"},
+			},
+			"defaultAgent":       clients.DefaultAgentSchema(),
+			"threadHistoryLimit": clients.ThreadHistoryLimitSchema(1000),
+		},
+		"required": []string{"serverUrl", "botToken"},
+	}
+}
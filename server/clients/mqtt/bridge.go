@@ -0,0 +1,273 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/achetronic/magec/server/clients"
+	"github.com/achetronic/magec/server/clients/msgutil"
+	"github.com/achetronic/magec/server/store"
+)
+
+// maxConcurrentRuns bounds agent runs in flight per MQTT client so a burst
+// of sensor events can't flood the agent.
+const maxConcurrentRuns = 4
+
+// Bridge keeps one broker connection per enabled MQTT client and runs the
+// client for every message received on its topics. It reloads clients when
+// the store changes, like the cron scheduler.
+type Bridge struct {
+	executor *clients.Executor
+	store    *store.Store
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	entries map[string]*bridgeEntry
+}
+
+type bridgeEntry struct {
+	hash   string
+	conn   paho.Client
+	cancel context.CancelFunc
+}
+
+// NewBridge creates an MQTT bridge.
+func NewBridge(executor *clients.Executor, s *store.Store, logger *slog.Logger) *Bridge {
+	return &Bridge{
+		executor: executor,
+		store:    s,
+		logger:   logger,
+		entries:  make(map[string]*bridgeEntry),
+	}
+}
+
+// Start connects all MQTT clients and keeps them in sync with the store
+// until the context is cancelled or Stop is called.
+func (b *Bridge) Start(ctx context.Context) {
+	ctx, b.cancel = context.WithCancel(ctx)
+
+	b.reload(ctx)
+
+	changeCh := b.store.OnChange()
+	for {
+		select {
+		case <-ctx.Done():
+			b.disconnectAll()
+			return
+		case <-changeCh:
+			b.reload(ctx)
+		}
+	}
+}
+
+// Stop disconnects all clients.
+func (b *Bridge) Stop() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+func (b *Bridge) reload(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	desired := make(map[string]store.ClientDefinition)
+	for _, cl := range b.store.ListClients() {
+		if cl.Type == "mqtt" && cl.Enabled && cl.Config.MQTT != nil && len(cl.AllowedAgents) > 0 {
+			desired[cl.ID] = cl
+		}
+	}
+
+	for id, entry := range b.entries {
+		cl, ok := desired[id]
+		if ok && b.hash(cl) == entry.hash {
+			continue
+		}
+		entry.stop()
+		delete(b.entries, id)
+	}
+
+	for id, cl := range desired {
+		if _, ok := b.entries[id]; ok {
+			continue
+		}
+		entry, err := b.connect(ctx, cl)
+		if err != nil {
+			b.logger.Error("Failed to start MQTT client", "client", cl.Name, "error", err)
+			continue
+		}
+		b.entries[id] = entry
+	}
+	b.logger.Debug("MQTT bridge reloaded", "mqttClients", len(b.entries))
+}
+
+func (b *Bridge) disconnectAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, entry := range b.entries {
+		entry.stop()
+		delete(b.entries, id)
+	}
+}
+
+func (e *bridgeEntry) stop() {
+	e.cancel()
+	e.conn.Disconnect(250)
+}
+
+// connect opens the broker connection for a client. Subscriptions are made
+// in the OnConnect handler so they are restored after reconnects.
+func (b *Bridge) connect(ctx context.Context, cl store.ClientDefinition) (*bridgeEntry, error) {
+	cfg := cl.Config.MQTT
+	if cfg.BrokerURL == "" {
+		return nil, fmt.Errorf("broker URL is required")
+	}
+	if len(cfg.Topics) == 0 {
+		return nil, fmt.Errorf("at least one topic is required")
+	}
+	var tmpl *template.Template
+	if cfg.CommandID != "" {
+		cmd, ok := b.store.GetCommand(cfg.CommandID)
+		if !ok {
+			return nil, fmt.Errorf("command %q not found", cfg.CommandID)
+		}
+		text := cmd.Prompt
+		if !strings.Contains(text, "{{") {
+			// Plain prompts get the payload appended so the event isn't lost.
+			text += "\n\n{{.Payload}}"
+		}
+		var err error
+		tmpl, err = msgutil.ParseTemplate(cmd.ID, text, nil)
+		if err != nil {
+			return nil, fmt.Errorf("command %q: invalid template: %w", cfg.CommandID, err)
+		}
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "magec-" + cl.ID
+	}
+	qos := byte(cfg.QoS)
+	runCtx, cancel := context.WithCancel(ctx)
+	slots := make(chan struct{}, maxConcurrentRuns)
+	logger := b.logger.With("client", cl.Name)
+
+	onMessage := func(_ paho.Client, msg paho.Message) {
+		// Retained messages are old state replayed on subscribe, and our
+		// own replies must never trigger another run.
+		if msg.Retained() || (cfg.ReplyTopic != "" && msg.Topic() == cfg.ReplyTopic) {
+			return
+		}
+		prompt, err := renderPrompt(tmpl, msg.Topic(), msg.Payload())
+		if err != nil {
+			logger.Warn("Failed to render MQTT prompt", "topic", msg.Topic(), "error", err)
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+		default:
+			logger.Warn("MQTT client busy, dropping message", "topic", msg.Topic())
+			return
+		}
+		go func() {
+			defer func() { <-slots }()
+			b.run(runCtx, cl, msg.Topic(), prompt)
+		}()
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.BrokerURL).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetOrderMatters(false).
+		SetOnConnectHandler(func(c paho.Client) {
+			filters := make(map[string]byte, len(cfg.Topics))
+			for _, t := range cfg.Topics {
+				filters[t] = qos
+			}
+			token := c.SubscribeMultiple(filters, onMessage)
+			if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+				logger.Error("MQTT subscribe failed", "topics", cfg.Topics, "error", token.Error())
+				return
+			}
+			logger.Info("MQTT client connected", "broker", cfg.BrokerURL, "topics", cfg.Topics)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.Warn("MQTT connection lost", "error", err)
+		})
+
+	conn := paho.NewClient(opts)
+	// With ConnectRetry the token only completes once connected; failures
+	// are retried in the background.
+	conn.Connect()
+
+	return &bridgeEntry{hash: b.hash(cl), conn: conn, cancel: cancel}, nil
+}
+
+// run executes the client for one message and publishes the response.
+func (b *Bridge) run(ctx context.Context, cl store.ClientDefinition, topic, prompt string) {
+	b.logger.Info("MQTT client firing", "client", cl.Name, "topic", topic)
+	result, err := b.executor.RunClient(ctx, cl, prompt)
+	if err != nil {
+		b.logger.Error("MQTT client failed", "client", cl.Name, "topic", topic, "error", err)
+		return
+	}
+	b.logger.Info("MQTT client completed", "client", cl.Name, "responseLen", len(result))
+
+	cfg := cl.Config.MQTT
+	if cfg.ReplyTopic == "" {
+		return
+	}
+	b.mu.Lock()
+	entry, ok := b.entries[cl.ID]
+	b.mu.Unlock()
+	if !ok || ctx.Err() != nil {
+		return
+	}
+	token := entry.conn.Publish(cfg.ReplyTopic, byte(cfg.QoS), false, result)
+	if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+		b.logger.Error("MQTT publish failed", "client", cl.Name, "topic", cfg.ReplyTopic, "error", token.Error())
+	}
+}
+
+// renderPrompt builds the prompt for a message. Without a command template
+// the payload itself is the prompt.
+func renderPrompt(tmpl *template.Template, topic string, payload []byte) (string, error) {
+	if tmpl == nil {
+		return strings.TrimSpace(string(payload)), nil
+	}
+	// JSON is the decoded payload, or nil when it is not JSON.
+	var decoded any
+	_ = json.Unmarshal(payload, &decoded)
+	data := map[string]any{"Topic": topic, "Payload": string(payload), "JSON": decoded}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// hash identifies a client's effective configuration, including its command
+// prompt, so edits to either reconnect the client.
+func (b *Bridge) hash(cl store.ClientDefinition) string {
+	data, _ := json.Marshal(cl)
+	if cmd, ok := b.store.GetCommand(cl.Config.MQTT.CommandID); ok {
+		data = append(data, cmd.Prompt...)
+	}
+	return string(data)
+}
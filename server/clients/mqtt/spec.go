@@ -0,0 +1,69 @@
+package mqtt
+
+import (
+	"github.com/achetronic/magec/server/clients"
+)
+
+type Provider struct{}
+
+func init() {
+	clients.Register(&Provider{})
+}
+
+func (p *Provider) Type() string        { return "mqtt" }
+func (p *Provider) DisplayName() string { return "MQTT" }
+
+func (p *Provider) ConfigSchema() clients.Schema {
+	return clients.Schema{
+		"type": "object",
+		"properties": clients.Schema{
+			"brokerUrl": clients.Schema{
+				"type":          "string",
+				"title":         "Broker URL",
+				"minLength":     1,
+				"x-placeholder": "tcp://mosquitto:1883",
+				"description":   "tcp://, ssl://, ws:// or wss:// URL of the MQTT broker.",
+			},
+			"clientId": clients.Schema{
+				"type":          "string",
+				"title":         "MQTT Client ID",
+				"x-placeholder": "Defaults to magec-<client id>",
+			},
+			"username": clients.Schema{
+				"type":  "string",
+				"title": "Username",
+			},
+			"password": clients.Schema{
+				"type":     "string",
+				"title":    "Password",
+				"x-format": "password",
+			},
+			"topics": clients.Schema{
+				"type":          "array",
+				"items":         clients.Schema{"type": "string"},
+				"title":         "Topics",
+				"minItems":      1,
+				"x-placeholder": "Comma-separated topic filters (e.g. zigbee2mqtt/door/#, homeassistant/events)",
+			},
+			"qos": clients.Schema{
+				"type":    "integer",
+				"title":   "QoS",
+				"default": 0,
+				"enum":    []int{0, 1, 2},
+			},
+			"commandId": clients.Schema{
+				"type":        "string",
+				"title":       "Command",
+				"x-entity":    "commands",
+				"description": "Optional. The command prompt is a template with {{.Payload}}, {{.Topic}} and {{.JSON}}. Without a command, the payload is the prompt.",
+			},
+			"replyTopic": clients.Schema{
+				"type":          "string",
+				"title":         "Reply Topic",
+				"x-placeholder": "magec/replies",
+				"description":   "Topic the agent response is published to. Leave empty to discard responses.",
+			},
+		},
+		"required": []string{"brokerUrl", "topics"},
+	}
+}
@@ -9,6 +9,13 @@ const (
 	TelegramMaxMessageLength = 4096
 	DiscordMaxMessageLength  = 2000
 	SlackMaxMessageLength    = 39000
+	// Matrix caps whole events at 65536 bytes; this leaves room for
+	// multi-byte text and the HTML body.
+	MatrixMaxMessageLength = 16000
+	// Mattermost's default post size limit.
+	MattermostMaxMessageLength = 16383
+	// Email has no practical limit; replies are collected into one mail.
+	EmailMaxMessageLength = 100000
 
 	DefaultMaxInputLength = 16000
 )
@@ -347,6 +347,46 @@ func FormatToolResultSlack(evt SSEEvent) string {
 	return fmt.Sprintf("📎 *%s*\n```\n%s\n```", evt.ToolName, result)
 }
 
+// FormatToolCallMatrix formats a single tool call as Matrix HTML
+// (org.matrix.custom.html).
+func FormatToolCallMatrix(evt SSEEvent) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("<blockquote>🔧 <b>%s</b>", escapeHTML(evt.ToolName)))
+	for _, l := range humanArgLines(evt.ToolArgs) {
+		b.WriteString(fmt.Sprintf("<br><b>%s</b>: %s", escapeHTML(l.Key), escapeHTML(l.Value)))
+	}
+	b.WriteString("</blockquote>")
+	return b.String()
+}
+
+// FormatToolResultMatrix formats a tool result as Matrix HTML.
+func FormatToolResultMatrix(evt SSEEvent) string {
+	result := prettyResult(evt.ToolResult)
+	if result == "" {
+		return fmt.Sprintf("<blockquote>📎 <b>%s</b> → (empty)</blockquote>", escapeHTML(evt.ToolName))
+	}
+	return fmt.Sprintf("📎 <b>%s</b><pre><code>%s</code></pre>", escapeHTML(evt.ToolName), escapeHTML(result))
+}
+
+// FormatToolCallEmail formats a single tool call as plain text.
+func FormatToolCallEmail(evt SSEEvent) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("[tool] %s", evt.ToolName))
+	for _, l := range humanArgLines(evt.ToolArgs) {
+		b.WriteString(fmt.Sprintf("\n  %s: %s", l.Key, l.Value))
+	}
+	return b.String()
+}
+
+// FormatToolResultEmail formats a tool result as plain text.
+func FormatToolResultEmail(evt SSEEvent) string {
+	result := prettyResult(evt.ToolResult)
+	if result == "" {
+		return fmt.Sprintf("[result] %s -> (empty)", evt.ToolName)
+	}
+	return fmt.Sprintf("[result] %s\n%s", evt.ToolName, result)
+}
+
 // argLine holds a key-value pair from tool arguments.
 type argLine struct {
 	Key   string
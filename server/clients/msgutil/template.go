@@ -0,0 +1,165 @@
+package msgutil
+
+import (
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Functions that field accesses are rewritten into.
+const (
+	fieldFunc      = "_field"
+	rangeFieldFunc = "_rangeField"
+)
+
+// ParseTemplate parses a prompt template rendered against decoded JSON.
+// text/template fails on a field of a missing parent and prints
+// "<no value>" for a missing key, even with missingkey=zero, so every field
+// access — .a.b, $.a.b, $x.a and (pipeline).a — is rewritten into a lookup
+// that yields empty text when any part of the path is missing or null.
+// Fields resolve on maps and lists only, not on struct fields or methods.
+//
+// funcs are added to the template; they can be replaced with Funcs before
+// executing it.
+func ParseTemplate(name, text string, funcs template.FuncMap) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		fieldFunc:      lookupField,
+		rangeFieldFunc: lookupRangeField,
+	}).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			rewriteFields(t.Tree.Root)
+		}
+	}
+	return tmpl, nil
+}
+
+// LookupPath resolves a dotted path like "pull_request.base.ref" or
+// "alerts.0.status" in a decoded JSON value.
+func LookupPath(data interface{}, path string) (interface{}, bool) {
+	cur := data
+	for _, part := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			next, ok := v[part]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// lookupField resolves a field path against a value, yielding "" when any
+// part of it is missing or null, so {{.a.b}} prints nothing without an a.
+func lookupField(v interface{}, path string) interface{} {
+	if found, ok := LookupPath(v, path); ok && found != nil {
+		return found
+	}
+	return ""
+}
+
+// lookupRangeField is lookupField for range pipelines, which cannot
+// iterate over "" but skip nil.
+func lookupRangeField(v interface{}, path string) interface{} {
+	found, _ := LookupPath(v, path)
+	return found
+}
+
+func rewriteFields(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			rewriteFields(child)
+		}
+	case *parse.ActionNode:
+		rewritePipe(n.Pipe, fieldFunc)
+	case *parse.IfNode:
+		rewriteBranch(&n.BranchNode, fieldFunc)
+	case *parse.WithNode:
+		rewriteBranch(&n.BranchNode, fieldFunc)
+	case *parse.RangeNode:
+		rewriteBranch(&n.BranchNode, rangeFieldFunc)
+	case *parse.TemplateNode:
+		rewritePipe(n.Pipe, fieldFunc)
+	}
+}
+
+func rewriteBranch(n *parse.BranchNode, fn string) {
+	rewritePipe(n.Pipe, fn)
+	rewriteFields(n.List)
+	rewriteFields(n.ElseList)
+}
+
+// rewritePipe rewrites the field accesses of a pipeline. fn is used for a
+// field that is the whole pipeline; nested ones always use lookupField.
+func rewritePipe(pipe *parse.PipeNode, fn string) {
+	if pipe == nil {
+		return
+	}
+	for _, cmd := range pipe.Cmds {
+		name := fieldFunc
+		if len(pipe.Cmds) == 1 && len(cmd.Args) == 1 {
+			name = fn
+		}
+		// A field followed by arguments is a method call and is left alone.
+		call := len(cmd.Args) > 1
+		for i, arg := range cmd.Args {
+			switch a := arg.(type) {
+			case *parse.FieldNode:
+				if i > 0 || !call {
+					cmd.Args[i] = fieldCall(&parse.DotNode{NodeType: parse.NodeDot, Pos: a.Pos}, a.Ident, name, a.Pos)
+				}
+			case *parse.VariableNode:
+				if len(a.Ident) > 1 && (i > 0 || !call) {
+					v := &parse.VariableNode{NodeType: parse.NodeVariable, Pos: a.Pos, Ident: a.Ident[:1]}
+					cmd.Args[i] = fieldCall(v, a.Ident[1:], name, a.Pos)
+				}
+			case *parse.ChainNode:
+				if p, ok := a.Node.(*parse.PipeNode); ok {
+					rewritePipe(p, fieldFunc)
+				}
+				if i > 0 || !call {
+					cmd.Args[i] = fieldCall(a.Node, a.Field, name, a.Pos)
+				}
+			case *parse.PipeNode:
+				rewritePipe(a, fieldFunc)
+			}
+		}
+	}
+}
+
+// fieldCall builds the pipeline (fn receiver "a.b") for the field path a.b
+// of receiver.
+func fieldCall(receiver parse.Node, ident []string, fn string, pos parse.Pos) *parse.PipeNode {
+	path := strings.Join(ident, ".")
+	return &parse.PipeNode{
+		NodeType: parse.NodePipe,
+		Pos:      pos,
+		Cmds: []*parse.CommandNode{{
+			NodeType: parse.NodeCommand,
+			Pos:      pos,
+			Args: []parse.Node{
+				parse.NewIdentifier(fn).SetPos(pos),
+				receiver,
+				&parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(path), Text: path},
+			},
+		}},
+	}
+}
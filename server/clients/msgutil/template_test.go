@@ -0,0 +1,110 @@
+package msgutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestLookupPath(t *testing.T) {
+	data := decode(t, `{"pull_request":{"base":{"ref":"main"}},"alerts":[{"status":"firing"}],"id":12345678901234567890}`)
+
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{"pull_request.base.ref", "main", true},
+		{"alerts.0.status", "firing", true},
+		{"id", "12345678901234567890", true},
+		{"alerts.1.status", "", false},
+		{"alerts.x", "", false},
+		{"pull_request.head.ref", "", false},
+		{"pull_request.base.ref.more", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := LookupPath(data, tt.path)
+		if ok != tt.wantOK {
+			t.Errorf("LookupPath(%q) ok = %v, want %v", tt.path, ok, tt.wantOK)
+			continue
+		}
+		if ok && got != nil && toString(got) != tt.want {
+			t.Errorf("LookupPath(%q) = %v, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	if n, ok := v.(interface{ String() string }); ok {
+		return n.String()
+	}
+	return ""
+}
+
+func TestParseTemplate(t *testing.T) {
+	data := decode(t, `{"repo":{"name":"magec"},"alerts":[{"status":"firing","labels":{"severity":"page"}},{"status":"resolved"}],"note":"<no value>","empty":null}`)
+
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{"field", "{{.repo.name}}", "magec"},
+		{"missing parent", "[{{.issue.title}}]", "[]"},
+		{"null", "[{{.empty}}{{.empty.x}}]", "[]"},
+		{"literal no value kept", "{{.note}}", "<no value>"},
+		{"root variable", "{{$.repo.name}}[{{$.issue.title}}]", "magec[]"},
+		{"root variable in range", "{{range .alerts}}{{.status}}@{{$.repo.name}} {{end}}", "firing@magec resolved@magec "},
+		{"range variables", "{{range $i, $a := .alerts}}{{$i}}={{$a.labels.severity}};{{end}}", "0=page;1=;"},
+		{"variable in with", "{{with $r := .repo}}{{$r.name}}{{$r.owner.login}}{{end}}", "magec"},
+		{"range over missing variable field", "{{$p := .pull_request}}{{range $p.labels}}#{{.}}{{end}}x", "x"},
+		{"chain", "{{(index .alerts 0).labels.severity}}[{{(index .alerts 1).labels.severity}}]", "page[]"},
+		{"nested pipeline", `{{printf "%s-%s" (.repo.name) $.issue.title}}`, "magec-"},
+		{"if on missing variable field", "{{if $.issue.merged}}yes{{else}}no{{end}}", "no"},
+		{"defined template", `{{define "t"}}{{.name}}{{.missing.x}}{{end}}{{template "t" .repo}}`, "magec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseTemplate("test", tt.tmpl, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, data); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	tmpl, err := ParseTemplate("funcs", `{{shout .repo.name}}`, template.FuncMap{"shout": strings.ToUpper})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil || buf.String() != "MAGEC" {
+		t.Errorf("custom function = %q, %v", buf.String(), err)
+	}
+
+	if _, err := ParseTemplate("bad", "{{.a", nil); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+// errBlockedAddress is returned when a callback resolves to an address
+// the server refuses to call.
+var errBlockedAddress = errors.New("callback address is not allowed")
+
+// callbackClient posts job results to callbacks the client configuration
+// does not cover. Those URLs came from the request body of a possibly
+// unauthenticated webhook, so it only dials public addresses and never
+// follows redirects.
+var callbackClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: refusePrivate,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: callbackTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// configuredCallbackClient posts job results to callbacks set by the
+// admin, which may well live on the LAN or on localhost.
+var configuredCallbackClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: callbackTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// clientForCallback returns the client that may post to rawURL: the
+// unrestricted one when the URL is the client's CallbackURL or falls under
+// one of its AllowedCallbackURLs, the private-address guard otherwise.
+// It is checked on delivery, so narrowing the allowlist also applies to
+// jobs already queued.
+func clientForCallback(cfg *store.WebhookClientConfig, rawURL string) *http.Client {
+	if cfg == nil {
+		return callbackClient
+	}
+	if cfg.CallbackURL != "" && rawURL == cfg.CallbackURL {
+		return configuredCallbackClient
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return callbackClient
+	}
+	for _, allowed := range cfg.AllowedCallbackURLs {
+		if matchesPrefix(u, allowed) {
+			return configuredCallbackClient
+		}
+	}
+	return callbackClient
+}
+
+// refusePrivate runs after DNS resolution, so a public hostname pointing
+// at an internal address is refused too.
+func refusePrivate(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || blockedIP(ip) {
+		return fmt.Errorf("%w: %s", errBlockedAddress, host)
+	}
+	return nil
+}
+
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// callbackURLFor picks the callback of a job: the request's own URL when
+// the client allows it, or the client's configured one.
+func callbackURLFor(cfg *store.WebhookClientConfig, requested string) (string, error) {
+	if cfg == nil {
+		cfg = &store.WebhookClientConfig{}
+	}
+	if requested == "" {
+		return cfg.CallbackURL, nil
+	}
+	u, err := url.Parse(requested)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "", errors.New("invalid callbackUrl")
+	}
+	if requested == cfg.CallbackURL {
+		return requested, nil
+	}
+	for _, allowed := range cfg.AllowedCallbackURLs {
+		if matchesPrefix(u, allowed) {
+			return requested, nil
+		}
+	}
+	return "", errors.New("callbackUrl is not allowed for this webhook")
+}
+
+// matchesPrefix reports whether u has the scheme and host of prefix and a
+// path under it. Hosts are compared whole, so "https://example.com" does
+// not match "https://example.com.attacker.net", and paths with dot
+// segments never match, so "/jobs/../admin" does not escape "/jobs/".
+func matchesPrefix(u *url.URL, prefix string) bool {
+	p, err := url.Parse(prefix)
+	if err != nil || p.Host == "" {
+		return false
+	}
+	if hasDotSegment(u.Path) {
+		return false
+	}
+	if !strings.EqualFold(u.Scheme, p.Scheme) || !strings.EqualFold(u.Host, p.Host) {
+		return false
+	}
+	if p.Path == "" || p.Path == "/" {
+		return true
+	}
+	if u.Path == p.Path {
+		return true
+	}
+	return strings.HasPrefix(u.Path, strings.TrimSuffix(p.Path, "/")+"/")
+}
+
+// hasDotSegment reports whether a decoded URL path has a "." or ".."
+// segment. url.Parse decodes "%2e%2e" and "%2f" into u.Path, so those
+// are caught as well.
+func hasDotSegment(p string) bool {
+	for seg := range strings.SplitSeq(p, "/") {
+		if seg == "." || seg == ".." {
+			return true
+		}
+	}
+	return false
+}
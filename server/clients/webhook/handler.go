@@ -1,7 +1,10 @@
 package webhook
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 
@@ -14,23 +17,38 @@ import (
 // Handler serves webhook client endpoints.
 // Each webhook client has a unique URL: /api/v1/webhooks/{clientID}
 // Authentication uses the client's token via Authorization: Bearer header.
+// Asynchronous requests are queued as jobs, polled at
+// /api/v1/webhooks/{clientID}/jobs/{jobID}.
 type Handler struct {
 	executor *clients.Executor
 	store    *store.Store
+	jobs     *JobQueue
 	logger   *slog.Logger
 	router   *mux.Router
 }
 
 type webhookRequest struct {
 	Prompt string `json:"prompt,omitempty"`
+	// Async overrides the client's default mode for this request.
+	Async       *bool  `json:"async,omitempty"`
+	CallbackURL string `json:"callbackUrl,omitempty"`
 }
 
 type webhookResponse struct {
 	OK       bool   `json:"ok"`
 	Response string `json:"response,omitempty"`
 	Error    string `json:"error,omitempty"`
+	JobID    string `json:"jobId,omitempty"`
+	Status   string `json:"status,omitempty"`
+	// StatusURL is where the job can be polled.
+	StatusURL string `json:"statusUrl,omitempty"`
+	// Skipped explains why a request was filtered out without running.
+	Skipped string `json:"skipped,omitempty"`
 }
 
+// maxBodySize caps webhook request bodies.
+const maxBodySize = 5 << 20
+
 // NewHandler creates the webhook HTTP handler.
 func NewHandler(executor *clients.Executor, s *store.Store, logger *slog.Logger) *Handler {
 	h := &Handler{
@@ -40,48 +58,93 @@ func NewHandler(executor *clients.Executor, s *store.Store, logger *slog.Logger)
 	}
 	h.router = mux.NewRouter()
 	h.router.HandleFunc("/{id}", h.handle).Methods("POST")
+	h.router.HandleFunc("/{id}/jobs/{jobId}", h.getJob).Methods("GET")
 	return h
 }
 
+// SetJobQueue enables asynchronous requests.
+func (h *Handler) SetJobQueue(q *JobQueue) {
+	h.jobs = q
+}
+
 // ServeHTTP implements http.Handler.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.router.ServeHTTP(w, r)
 }
 
 func (h *Handler) handle(w http.ResponseWriter, r *http.Request) {
-	clientID := mux.Vars(r)["id"]
-
-	cl, ok := h.store.GetClient(clientID)
-	if !ok || cl.Type != "webhook" {
-		writeError(w, http.StatusNotFound, "webhook not found")
+	cl, ok := h.lookup(w, r)
+	if !ok {
 		return
 	}
+	cfg := cl.Config.Webhook
+	if cfg == nil {
+		cfg = &store.WebhookClientConfig{}
+	}
 
-	if !cl.Enabled {
-		writeError(w, http.StatusForbidden, "webhook client is disabled")
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if len(body) > maxBodySize {
+		writeError(w, http.StatusRequestEntityTooLarge, "body too large")
 		return
 	}
 
-	token := r.Header.Get("Authorization")
-	if len(token) > 7 && token[:7] == "Bearer " {
-		token = token[7:]
-	} else {
-		token = ""
+	switch cfg.Auth {
+	case AuthGitHub, AuthHMAC:
+		if err := verifySignature(cfg, r, body); err != nil {
+			h.logger.Warn("Webhook signature rejected", "client", cl.Name, "error", err)
+			writeError(w, http.StatusUnauthorized, "invalid signature")
+			return
+		}
+	default:
+		if !checkToken(r, cl) {
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
 	}
 
-	if token == "" || token != cl.Token {
-		writeError(w, http.StatusUnauthorized, "invalid or missing token")
+	var data interface{}
+	if cfg.PromptTemplate != "" || cfg.FilterPath != "" {
+		if data, err = decodePayload(body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+	}
+	if reason := filterReason(cfg, r, data); reason != "" {
+		h.logger.Debug("Webhook request filtered", "client", cl.Name, "reason", reason)
+		writeJSON(w, http.StatusOK, webhookResponse{OK: true, Skipped: reason})
 		return
 	}
 
 	var req webhookRequest
-	if r.ContentLength > 0 {
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if cfg.Passthrough && cfg.PromptTemplate != "" {
+		// Third-party payload: the whole body is template data, so only the
+		// query string can pick the mode.
+		if req.Prompt, err = renderPrompt(cfg.PromptTemplate, data, r.Header); err != nil {
+			writeError(w, http.StatusBadRequest, "failed to render prompt: "+err.Error())
+			return
+		}
+	} else if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
 			writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 			return
 		}
 	}
 
+	async := cfg.Async
+	if req.Async != nil {
+		async = *req.Async
+	} else if v := r.URL.Query().Get("async"); v != "" {
+		async = v == "true" || v == "1"
+	}
+	if async {
+		h.enqueue(w, cl, req)
+		return
+	}
+
 	h.logger.Info("Webhook client firing", "client", cl.Name, "id", cl.ID)
 
 	result, err := h.executor.RunClient(r.Context(), cl, req.Prompt)
@@ -95,6 +158,90 @@ func (h *Handler) handle(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, webhookResponse{OK: true, Response: result})
 }
 
+// enqueue queues the request as a job and answers 202 with its ID.
+func (h *Handler) enqueue(w http.ResponseWriter, cl store.ClientDefinition, req webhookRequest) {
+	if h.jobs == nil {
+		writeError(w, http.StatusServiceUnavailable, "asynchronous requests are not available")
+		return
+	}
+
+	callbackURL, err := callbackURLFor(cl.Config.Webhook, req.CallbackURL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := h.jobs.Enqueue(cl, req.Prompt, callbackURL)
+	if errors.Is(err, ErrQueueFull) {
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to queue webhook job", "client", cl.Name, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to queue job")
+		return
+	}
+
+	h.logger.Info("Webhook job queued", "client", cl.Name, "job", job.ID)
+	statusURL := "/api/v1/webhooks/" + cl.ID + "/jobs/" + job.ID
+	w.Header().Set("Location", statusURL)
+	writeJSON(w, http.StatusAccepted, webhookResponse{OK: true, JobID: job.ID, Status: job.Status, StatusURL: statusURL})
+}
+
+// getJob reports the status and result of a job. Jobs are always polled
+// with the client token, whatever scheme authenticates the webhook itself.
+func (h *Handler) getJob(w http.ResponseWriter, r *http.Request) {
+	cl, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+	if !checkToken(r, cl) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+	if h.jobs == nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	job, ok := h.jobs.Get(cl.ID, mux.Vars(r)["jobId"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// lookup resolves the enabled webhook client of the request, writing the
+// error response when there is none.
+func (h *Handler) lookup(w http.ResponseWriter, r *http.Request) (store.ClientDefinition, bool) {
+	clientID := mux.Vars(r)["id"]
+
+	cl, ok := h.store.GetClient(clientID)
+	if !ok || cl.Type != "webhook" {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return cl, false
+	}
+
+	if !cl.Enabled {
+		writeError(w, http.StatusForbidden, "webhook client is disabled")
+		return cl, false
+	}
+	return cl, true
+}
+
+// checkToken reports whether the request carries the client token as a
+// bearer token.
+func checkToken(r *http.Request, cl store.ClientDefinition) bool {
+	token := r.Header.Get("Authorization")
+	if len(token) > 7 && token[:7] == "Bearer " {
+		token = token[7:]
+	} else {
+		token = ""
+	}
+	return token != "" && token == cl.Token
+}
+
 func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, webhookResponse{OK: false, Error: message})
 }
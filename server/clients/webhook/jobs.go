@@ -0,0 +1,244 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/achetronic/magec/server/clients"
+	"github.com/achetronic/magec/server/store"
+)
+
+const (
+	callbackRetries    = 3
+	callbackTimeout    = 30 * time.Second
+	maxCallbackBackoff = time.Minute
+)
+
+// ErrQueueFull is returned when no more jobs can be queued.
+var ErrQueueFull = errors.New("job queue is full")
+
+// JobQueue runs asynchronous webhook requests on a fixed pool of workers.
+// Jobs are persisted in the conversation store, so queued jobs survive a
+// restart and finished ones can be polled by ID.
+type JobQueue struct {
+	executor *clients.Executor
+	store    *store.Store
+	jobs     *store.ConversationStore
+	logger   *slog.Logger
+	workers  int
+	queue    chan store.WebhookJob
+}
+
+// NewJobQueue creates a job queue with the given number of workers and
+// room for size jobs waiting to run.
+func NewJobQueue(executor *clients.Executor, s *store.Store, jobs *store.ConversationStore, workers, size int, logger *slog.Logger) *JobQueue {
+	return &JobQueue{
+		executor: executor,
+		store:    s,
+		jobs:     jobs,
+		logger:   logger,
+		workers:  max(workers, 1),
+		queue:    make(chan store.WebhookJob, max(size, 1)),
+	}
+}
+
+// Start runs the workers until ctx is cancelled. Jobs left running by a
+// previous process are marked as failed and queued ones are resumed.
+func (q *JobQueue) Start(ctx context.Context) {
+	if err := q.jobs.InterruptJobs(); err != nil {
+		q.logger.Warn("Failed to mark interrupted webhook jobs", "error", err)
+	}
+
+	for range q.workers {
+		go q.work(ctx)
+	}
+
+	pending, err := q.jobs.QueuedJobs()
+	if err != nil {
+		q.logger.Warn("Failed to load queued webhook jobs", "error", err)
+		return
+	}
+	if len(pending) > 0 {
+		q.logger.Info("Resuming queued webhook jobs", "jobs", len(pending))
+	}
+	for _, job := range pending {
+		select {
+		case q.queue <- job:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Enqueue persists a new job for a client and queues it.
+func (q *JobQueue) Enqueue(cl store.ClientDefinition, prompt, callbackURL string) (store.WebhookJob, error) {
+	if len(q.queue) == cap(q.queue) {
+		return store.WebhookJob{}, ErrQueueFull
+	}
+	job, err := q.jobs.AddJob(store.WebhookJob{
+		ClientID:    cl.ID,
+		Prompt:      prompt,
+		CallbackURL: callbackURL,
+	})
+	if err != nil {
+		return job, err
+	}
+	select {
+	case q.queue <- job:
+		return job, nil
+	default:
+		q.fail(job, ErrQueueFull.Error())
+		return job, ErrQueueFull
+	}
+}
+
+// Get returns a job of a client.
+func (q *JobQueue) Get(clientID, jobID string) (store.WebhookJob, bool) {
+	return q.jobs.GetJob(clientID, jobID)
+}
+
+func (q *JobQueue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-q.queue:
+			q.run(ctx, job)
+		}
+	}
+}
+
+// run executes a job, saves its result and sends the callback.
+func (q *JobQueue) run(ctx context.Context, job store.WebhookJob) {
+	now := time.Now()
+	claimed, err := q.jobs.ClaimJob(job.ID, now)
+	if err != nil {
+		q.logger.Warn("Failed to start webhook job", "job", job.ID, "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	job.Status = store.JobStatusRunning
+	job.StartedAt = &now
+
+	cl, ok := q.store.GetClient(job.ClientID)
+	if !ok || !cl.Enabled {
+		q.fail(job, "webhook client was removed or disabled")
+		return
+	}
+
+	q.logger.Info("Webhook job running", "client", cl.Name, "job", job.ID)
+	result, err := q.executor.RunClient(ctx, cl, job.Prompt)
+	if ctx.Err() != nil {
+		// Shutting down: left as running, marked interrupted on next start.
+		return
+	}
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if err != nil {
+		q.logger.Error("Webhook job failed", "client", cl.Name, "job", job.ID, "error", err)
+		job.Status = store.JobStatusError
+		job.Error = err.Error()
+	} else {
+		q.logger.Info("Webhook job completed", "client", cl.Name, "job", job.ID, "responseLen", len(result))
+		job.Status = store.JobStatusSuccess
+		job.Response = result
+	}
+	q.save(job)
+
+	if job.CallbackURL != "" {
+		q.callback(ctx, cl, &job)
+		q.save(job)
+	}
+}
+
+// callback POSTs the finished job to its callback URL, retrying with
+// exponential backoff.
+func (q *JobQueue) callback(ctx context.Context, cl store.ClientDefinition, job *store.WebhookJob) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		job.CallbackStatus, job.CallbackError = store.CallbackFailed, err.Error()
+		return
+	}
+
+	client := clientForCallback(cl.Config.Webhook, job.CallbackURL)
+	backoff := 2 * time.Second
+	for attempt := 1; ; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, callbackTimeout)
+		err = postCallback(sendCtx, client, job.CallbackURL, cl.Token, job.ID, body)
+		cancel()
+		if err == nil {
+			q.logger.Info("Webhook callback delivered", "client", cl.Name, "job", job.ID, "attempts", attempt)
+			job.CallbackStatus, job.CallbackError = store.CallbackDelivered, ""
+			return
+		}
+		if attempt > callbackRetries {
+			break
+		}
+		q.logger.Warn("Webhook callback failed, retrying", "client", cl.Name, "job", job.ID, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxCallbackBackoff)
+	}
+	q.logger.Error("Webhook callback failed", "client", cl.Name, "job", job.ID, "error", err)
+	job.CallbackStatus, job.CallbackError = store.CallbackFailed, err.Error()
+}
+
+func (q *JobQueue) fail(job store.WebhookJob, msg string) {
+	now := time.Now()
+	job.Status = store.JobStatusError
+	job.Error = msg
+	job.FinishedAt = &now
+	q.save(job)
+}
+
+func (q *JobQueue) save(job store.WebhookJob) {
+	if err := q.jobs.UpdateJob(job); err != nil {
+		q.logger.Warn("Failed to save webhook job", "job", job.ID, "error", err)
+	}
+}
+
+// postCallback sends a job result signed with the client token:
+// X-Magec-Signature-256 is "sha256=" plus the hex HMAC-SHA256 of the body.
+// Redirects are not followed, so a 3xx answer counts as a failure.
+func postCallback(ctx context.Context, client *http.Client, url, secret, jobID string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "magec-webhook")
+	req.Header.Set("X-Magec-Job-ID", jobID)
+	req.Header.Set("X-Magec-Signature-256", "sha256="+sign(secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/achetronic/magec/server/clients/msgutil"
+	"github.com/achetronic/magec/server/store"
+)
+
+// Authentication schemes for incoming requests.
+const (
+	AuthToken  = "token"
+	AuthGitHub = "github"
+	AuthHMAC   = "hmac"
+)
+
+// DefaultSignatureHeader carries the signature for the generic HMAC scheme.
+const DefaultSignatureHeader = "X-Signature-256"
+
+// ValidateConfig checks the parts of a webhook config the JSON schema
+// cannot: the prompt template syntax and that signature schemes have a
+// secret.
+func ValidateConfig(cfg *store.WebhookClientConfig) error {
+	if cfg.PromptTemplate != "" {
+		if _, err := ParseTemplate(cfg.PromptTemplate); err != nil {
+			return fmt.Errorf("invalid prompt template: %w", err)
+		}
+	}
+	if (cfg.Auth == AuthGitHub || cfg.Auth == AuthHMAC) && cfg.Secret == "" {
+		return fmt.Errorf("%s authentication requires a secret", cfg.Auth)
+	}
+	return nil
+}
+
+// verifySignature checks the body signature of a request for the GitHub and
+// generic HMAC schemes. Signatures are the hex HMAC-SHA256 of the raw body
+// keyed with the client secret, with an optional "sha256=" prefix.
+func verifySignature(cfg *store.WebhookClientConfig, r *http.Request, body []byte) error {
+	header := "X-Hub-Signature-256"
+	if cfg.Auth == AuthHMAC {
+		header = cfg.SignatureHeader
+		if header == "" {
+			header = DefaultSignatureHeader
+		}
+	}
+	if cfg.Secret == "" {
+		return fmt.Errorf("webhook secret is not configured")
+	}
+
+	got := strings.TrimPrefix(strings.TrimSpace(r.Header.Get(header)), "sha256=")
+	if got == "" {
+		return fmt.Errorf("missing %s header", header)
+	}
+	if !hmac.Equal([]byte(strings.ToLower(got)), []byte(sign(cfg.Secret, body))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// decodePayload parses a JSON body keeping numbers as written, so IDs are
+// not rendered in exponent form.
+func decodePayload(body []byte) (interface{}, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// filterReason returns why a request is filtered out by the client's event
+// filters, or "" when it should run.
+func filterReason(cfg *store.WebhookClientConfig, r *http.Request, data interface{}) string {
+	if cfg.EventHeader != "" && len(cfg.Events) > 0 {
+		event := r.Header.Get(cfg.EventHeader)
+		if !slices.Contains(cfg.Events, event) {
+			return fmt.Sprintf("event %q is not handled", event)
+		}
+	}
+	if cfg.FilterPath != "" && len(cfg.FilterValues) > 0 {
+		value, ok := msgutil.LookupPath(data, cfg.FilterPath)
+		if !ok || !slices.Contains(cfg.FilterValues, fmt.Sprint(value)) {
+			return fmt.Sprintf("%s does not match", cfg.FilterPath)
+		}
+	}
+	return ""
+}
+
+// ParseTemplate parses a prompt template. Besides the standard template
+// functions, "json" renders a value as JSON and "header" returns a request
+// header.
+func ParseTemplate(text string) (*template.Template, error) {
+	return msgutil.ParseTemplate("prompt", text, template.FuncMap{
+		"json":   func(interface{}) (string, error) { return "", nil },
+		"header": func(string) string { return "" },
+	})
+}
+
+// renderPrompt renders the prompt template against the decoded body.
+// Missing fields render as empty text.
+func renderPrompt(text string, data interface{}, header http.Header) (string, error) {
+	tmpl, err := ParseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"header": header.Get,
+	})
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+func signedRequest(header, value string) *http.Request {
+	r, _ := http.NewRequest("POST", "/", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	return r
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	good := sign("s3cret", body)
+
+	tests := []struct {
+		name    string
+		cfg     store.WebhookClientConfig
+		header  string
+		value   string
+		wantErr bool
+	}{
+		{"github good", store.WebhookClientConfig{Auth: AuthGitHub, Secret: "s3cret"}, "X-Hub-Signature-256", "sha256=" + good, false},
+		{"github uppercase hex", store.WebhookClientConfig{Auth: AuthGitHub, Secret: "s3cret"}, "X-Hub-Signature-256", "sha256=" + strings.ToUpper(good), false},
+		{"github wrong secret", store.WebhookClientConfig{Auth: AuthGitHub, Secret: "other"}, "X-Hub-Signature-256", "sha256=" + good, true},
+		{"github tampered", store.WebhookClientConfig{Auth: AuthGitHub, Secret: "s3cret"}, "X-Hub-Signature-256", "sha256=" + sign("s3cret", []byte("{}")), true},
+		{"github missing header", store.WebhookClientConfig{Auth: AuthGitHub, Secret: "s3cret"}, "", "", true},
+		{"github header ignored for hmac", store.WebhookClientConfig{Auth: AuthHMAC, Secret: "s3cret"}, "X-Hub-Signature-256", good, true},
+		{"hmac default header", store.WebhookClientConfig{Auth: AuthHMAC, Secret: "s3cret"}, DefaultSignatureHeader, good, false},
+		{"hmac custom header", store.WebhookClientConfig{Auth: AuthHMAC, Secret: "s3cret", SignatureHeader: "X-Sig"}, "X-Sig", "sha256=" + good, false},
+		{"hmac bad signature", store.WebhookClientConfig{Auth: AuthHMAC, Secret: "s3cret"}, DefaultSignatureHeader, "deadbeef", true},
+		{"no secret", store.WebhookClientConfig{Auth: AuthHMAC}, DefaultSignatureHeader, sign("", body), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySignature(&tt.cfg, signedRequest(tt.header, tt.value), body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifySignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterReason(t *testing.T) {
+	data, _ := decodePayload([]byte(`{"action":"opened"}`))
+
+	tests := []struct {
+		name  string
+		cfg   store.WebhookClientConfig
+		event string
+		skip  bool
+	}{
+		{"no filters", store.WebhookClientConfig{}, "", false},
+		{"event allowed", store.WebhookClientConfig{EventHeader: "X-GitHub-Event", Events: []string{"issues"}}, "issues", false},
+		{"event not handled", store.WebhookClientConfig{EventHeader: "X-GitHub-Event", Events: []string{"issues"}}, "push", true},
+		{"event header without events", store.WebhookClientConfig{EventHeader: "X-GitHub-Event"}, "push", false},
+		{"value matches", store.WebhookClientConfig{FilterPath: "action", FilterValues: []string{"opened", "reopened"}}, "", false},
+		{"value does not match", store.WebhookClientConfig{FilterPath: "action", FilterValues: []string{"closed"}}, "", true},
+		{"path missing", store.WebhookClientConfig{FilterPath: "issue.state", FilterValues: []string{"open"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := signedRequest("X-GitHub-Event", tt.event)
+			if got := filterReason(&tt.cfg, r, data); (got != "") != tt.skip {
+				t.Errorf("filterReason() = %q, want skip %v", got, tt.skip)
+			}
+		})
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	data, _ := decodePayload([]byte(`{"issue":{"title":"Crash on start","labels":["bug"]},"sender":{"login":"octocat"},"note":"<no value>","empty":null}`))
+	header := http.Header{"X-Github-Event": []string{"issues"}}
+
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{"fields", "New issue {{.issue.title}} by {{.sender.login}}", "New issue Crash on start by octocat"},
+		{"missing leaf", "[{{.issue.body}}]", "[]"},
+		{"missing parent", "[{{.pull_request.title}}]", "[]"},
+		{"null value", "[{{.empty}}]", "[]"},
+		{"literal no value kept", "{{.note}}", "<no value>"},
+		{"if on missing", "{{if .pull_request.merged}}merged{{else}}open{{end}}", "open"},
+		{"with", "{{with .issue}}{{.title}}{{.missing.x}}{{end}}", "Crash on start"},
+		{"range", "{{range .issue.labels}}#{{.}}{{end}}", "#bug"},
+		{"range over missing", "{{range .pull_request.labels}}#{{.}}{{end}}x", "x"},
+		{"pipeline", `{{.issue.title | printf "%q"}}`, `"Crash on start"`},
+		{"function argument", `{{printf "%s/%s" .sender.login .repo.name}}`, "octocat/"},
+		{"compare missing", `{{if eq .action "opened"}}yes{{else}}no{{end}}`, "no"},
+		{"json", "{{json .issue.labels}}", `["bug"]`},
+		{"header", `{{header "X-GitHub-Event"}}`, "issues"},
+		{"root variable", "{{with .issue}}{{.title}} by {{$.sender.login}}{{$.repo.name}}{{end}}", "Crash on start by octocat"},
+		{"range variable", "{{range $l := .issue.labels}}{{$l}}{{$l.name}}{{end}}", "bug"},
+		{"declared variable", "{{$i := .issue}}{{$i.title}}{{$i.missing.x}}", "Crash on start"},
+		{"chain", "{{(index .issue.labels 0)}}:{{(.sender).login}}{{(.pull_request).title.x}}", "bug:octocat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderPrompt(tt.tmpl, data, header)
+			if err != nil {
+				t.Fatalf("renderPrompt() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("renderPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	if err := ValidateConfig(&store.WebhookClientConfig{PromptTemplate: "{{.a"}); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+	if err := ValidateConfig(&store.WebhookClientConfig{Auth: AuthGitHub}); err == nil {
+		t.Error("expected an error for github auth without a secret")
+	}
+	if err := ValidateConfig(&store.WebhookClientConfig{Auth: AuthHMAC, Secret: "s", PromptTemplate: "{{.a.b}}"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -29,6 +29,77 @@ func (p *Provider) ConfigSchema() clients.Schema {
 				"minLength": 1,
 				"x-entity":  "commands",
 			},
+			"async": clients.Schema{
+				"type":        "boolean",
+				"title":       "Async",
+				"default":     false,
+				"description": "Answer right away with a job ID and run the request in the background. Requests can override it with \"async\".",
+			},
+			"callbackUrl": clients.Schema{
+				"type":          "string",
+				"title":         "Callback URL",
+				"x-placeholder": "https://example.com/hooks/magec",
+				"description":   "POST the result of async jobs to this URL, signed with the client token",
+			},
+			"allowedCallbackUrls": clients.Schema{
+				"type":          "array",
+				"title":         "Allowed Callback URLs",
+				"items":         clients.Schema{"type": "string"},
+				"x-placeholder": "https://example.com/hooks/",
+				"description":   "URL prefixes a request may pass as its own callbackUrl. Other request callbacks are rejected.",
+			},
+			"promptTemplate": clients.Schema{
+				"type":          "string",
+				"title":         "Prompt Template",
+				"x-format":      "textarea",
+				"x-placeholder": "New issue {{.issue.title}} by {{.sender.login}}",
+				"description":   "Passthrough only. Renders the prompt from any JSON body, so services like GitHub or Alertmanager can call the webhook directly.",
+			},
+			"auth": clients.Schema{
+				"type":        "string",
+				"title":       "Authentication",
+				"enum":        []string{"token", "github", "hmac"},
+				"default":     "token",
+				"description": "token: bearer client token. github: X-Hub-Signature-256. hmac: HMAC-SHA256 of the body in the signature header. Signatures use the secret.",
+			},
+			"secret": clients.Schema{
+				"type":        "string",
+				"title":       "Signing Secret",
+				"x-format":    "password",
+				"description": "Shared secret for github and hmac authentication",
+			},
+			"signatureHeader": clients.Schema{
+				"type":          "string",
+				"title":         "Signature Header",
+				"x-placeholder": "X-Signature-256",
+				"description":   "Header holding the signature for hmac authentication",
+			},
+			"eventHeader": clients.Schema{
+				"type":          "string",
+				"title":         "Event Header",
+				"x-placeholder": "X-GitHub-Event",
+				"description":   "Header naming the event type, checked against Events",
+			},
+			"events": clients.Schema{
+				"type":          "array",
+				"title":         "Events",
+				"items":         clients.Schema{"type": "string"},
+				"x-placeholder": "issues, pull_request",
+				"description":   "Only these events run the agent. Others are acknowledged and ignored.",
+			},
+			"filterPath": clients.Schema{
+				"type":          "string",
+				"title":         "Filter Path",
+				"x-placeholder": "action",
+				"description":   "Dotted path into the JSON body, checked against Filter Values",
+			},
+			"filterValues": clients.Schema{
+				"type":          "array",
+				"title":         "Filter Values",
+				"items":         clients.Schema{"type": "string"},
+				"x-placeholder": "opened, reopened",
+				"description":   "Only requests whose filter path has one of these values run the agent",
+			},
 		},
 		"oneOf": []clients.Schema{
 			{
@@ -0,0 +1,465 @@
+package wyoming
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/achetronic/magec/server/store"
+	"github.com/achetronic/magec/server/voice"
+)
+
+const (
+	// maxTranscribeDuration bounds the audio buffered for one transcription.
+	maxTranscribeDuration = 2 * time.Minute
+	// samplesPerChunk is the size of the audio chunks sent for speech.
+	samplesPerChunk = 1024
+)
+
+// Stream modes, chosen by the event that precedes the audio.
+const (
+	modeTranscribe = "transcribe"
+	modeDetect     = "detect"
+)
+
+var attribution = map[string]any{"name": "Magec", "url": "https://github.com/achetronic/magec"}
+
+// conn is one Wyoming connection. Events are handled in order; only the
+// detector and VAD callbacks write from other goroutines.
+type conn struct {
+	ctx     context.Context
+	srv     *Server
+	client  store.ClientDefinition
+	agentID string
+	userID  string
+	nc      net.Conn
+	r       *bufio.Reader
+	logger  *slog.Logger
+	wmu     sync.Mutex
+
+	// Current audio stream.
+	mode      string
+	rate      int
+	samples   []float32 // mono, at the stream rate
+	resampler *voice.Resampler
+	started   time.Time
+	wakeNames []string
+
+	detector *voice.Detector
+	vad      *voice.VAD
+	detected bool
+	detectMu sync.Mutex
+}
+
+func newConn(ctx context.Context, srv *Server, cl store.ClientDefinition, userID string, nc net.Conn, logger *slog.Logger) *conn {
+	return &conn{
+		ctx:     ctx,
+		srv:     srv,
+		client:  cl,
+		agentID: cl.AllowedAgents[0],
+		userID:  userID,
+		nc:      nc,
+		r:       bufio.NewReader(nc),
+		logger:  logger,
+	}
+}
+
+func (c *conn) serve() {
+	stop := context.AfterFunc(c.ctx, func() { c.nc.Close() })
+	defer func() {
+		stop()
+		c.nc.Close()
+		if c.detector != nil {
+			c.detector.Close()
+		}
+		if c.vad != nil {
+			c.vad.Close()
+		}
+	}()
+	c.logger.Debug("Wyoming connection opened")
+
+	for {
+		evt, err := readEvent(c.r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && c.ctx.Err() == nil {
+				c.logger.Warn("Wyoming read failed", "error", err)
+			}
+			return
+		}
+		if err := c.handle(evt); err != nil {
+			c.logger.Warn("Wyoming event failed", "event", evt.Type, "error", err)
+			if err := c.write(Event{Type: "error", Data: map[string]any{"text": err.Error()}}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *conn) handle(evt Event) error {
+	switch evt.Type {
+	case "describe":
+		return c.write(Event{Type: "info", Data: c.info()})
+	case "ping":
+		return c.write(Event{Type: "pong", Data: map[string]any{"text": str(evt.Data, "text")}})
+	case "detect":
+		c.mode = modeDetect
+		c.wakeNames = nil
+		if names, ok := evt.Data["names"].([]any); ok {
+			for _, n := range names {
+				if s, ok := n.(string); ok {
+					c.wakeNames = append(c.wakeNames, s)
+				}
+			}
+		}
+		return nil
+	case "transcribe":
+		c.mode = modeTranscribe
+		return nil
+	case "audio-start":
+		return c.audioStart(evt)
+	case "audio-chunk":
+		return c.audioChunk(evt)
+	case "audio-stop":
+		return c.audioStop()
+	case "synthesize":
+		return c.synthesize(str(evt.Data, "text"))
+	case "transcript":
+		return c.converse(evt)
+	default:
+		c.logger.Debug("Ignoring Wyoming event", "event", evt.Type)
+		return nil
+	}
+}
+
+// info describes the services of this connection's agent: wake (when
+// wake word models are loaded), ASR and TTS (when the agent has the
+// backends configured) and handle.
+func (c *conn) info() map[string]any {
+	languages := c.client.Config.Wyoming.Languages
+	if len(languages) == 0 {
+		languages = []string{"en"}
+	}
+	artifact := func(name, description string, languages []string) map[string]any {
+		return map[string]any{
+			"name":        name,
+			"attribution": attribution,
+			"installed":   true,
+			"description": description,
+			"version":     nil,
+			"languages":   languages,
+		}
+	}
+	program := func(name, description, listKey string, items []map[string]any, extra map[string]any) []map[string]any {
+		p := artifact(name, description, nil)
+		delete(p, "languages")
+		p[listKey] = items
+		for k, v := range extra {
+			p[k] = v
+		}
+		return []map[string]any{p}
+	}
+
+	info := map[string]any{
+		"asr":    []any{},
+		"tts":    []any{},
+		"wake":   []any{},
+		"handle": []any{},
+		"intent": []any{},
+	}
+	name, def, ok := c.srv.agent(c.agentID)
+	if !ok {
+		return info
+	}
+
+	if def.Transcription.Backend != "" {
+		info["asr"] = program("magec-asr", "Magec speech-to-text", "models",
+			[]map[string]any{artifact(c.agentID, name, languages)},
+			map[string]any{"supports_transcript_streaming": false})
+	}
+	if def.TTS.Backend != "" {
+		voiceName := def.TTS.Voice
+		if voiceName == "" {
+			voiceName = "default"
+		}
+		v := artifact(voiceName, name, languages)
+		v["speakers"] = nil
+		info["tts"] = program("magec-tts", "Magec text-to-speech", "voices",
+			[]map[string]any{v},
+			map[string]any{"supports_synthesize_streaming": false})
+	}
+	if c.srv.detector != nil {
+		var models []map[string]any
+		allowed := c.voiceSettings().Wakewords
+		for _, m := range c.srv.detector.GetModels() {
+			if len(allowed) > 0 && !slices.Contains(allowed, m.ID) {
+				continue
+			}
+			a := artifact(m.ID, m.Name, []string{})
+			a["phrase"] = m.Phrase
+			models = append(models, a)
+		}
+		if len(models) > 0 {
+			info["wake"] = program("magec-wake", "Magec wake word detection", "models", models, nil)
+		}
+	}
+	info["handle"] = program("magec", "Magec agent", "models",
+		[]map[string]any{artifact(c.agentID, name, languages)},
+		map[string]any{"supports_handled_streaming": false})
+	return info
+}
+
+func (c *conn) audioStart(evt Event) error {
+	if num(evt.Data, "width") != 0 && num(evt.Data, "width") != 2 {
+		return fmt.Errorf("only 16-bit audio is supported")
+	}
+	c.rate = num(evt.Data, "rate")
+	c.samples = c.samples[:0]
+	c.resampler = nil
+	c.started = time.Now()
+	c.setDetected(false)
+
+	if c.mode == modeDetect {
+		return c.loadDetector()
+	}
+	c.loadVAD()
+	if c.vad != nil {
+		c.vad.Reset()
+	}
+	return nil
+}
+
+func (c *conn) audioChunk(evt Event) error {
+	rate, width, channels := num(evt.Data, "rate"), num(evt.Data, "width"), num(evt.Data, "channels")
+	if width != 2 {
+		return fmt.Errorf("only 16-bit audio is supported")
+	}
+	if channels < 1 {
+		channels = 1
+	}
+	if rate <= 0 {
+		return fmt.Errorf("audio chunk has no sample rate")
+	}
+	if c.rate == 0 {
+		// Audio without audio-start: start the stream now.
+		if err := c.audioStart(evt); err != nil {
+			return err
+		}
+	}
+	c.rate = rate
+	if c.mode == modeDetect && c.detector == nil {
+		// The detector failed to load; that was reported at audio-start.
+		return nil
+	}
+	samples := pcmToFloat(evt.Payload, channels)
+
+	if c.mode != modeDetect {
+		if len(c.samples)+len(samples) > rate*int(maxTranscribeDuration/time.Second) {
+			return fmt.Errorf("audio is longer than %s", maxTranscribeDuration)
+		}
+		c.samples = append(c.samples, samples...)
+		if c.vad == nil {
+			return nil
+		}
+	}
+
+	// Wake word detection and VAD work on 16 kHz frames.
+	frames := [][]float32{samples}
+	if rate != voice.TargetSampleRate {
+		if c.resampler == nil {
+			c.resampler = voice.NewResampler(rate, voice.TargetSampleRate, 1280)
+		}
+		frames = c.resampler.Process(samples)
+	}
+	for _, frame := range frames {
+		if c.mode == modeDetect {
+			if err := c.detector.ProcessAudioFloat32(frame); err != nil {
+				return fmt.Errorf("wake word detection failed: %w", err)
+			}
+		} else if err := c.vad.ProcessAudio(frame); err != nil {
+			c.logger.Debug("VAD processing error", "error", err)
+		}
+	}
+	return nil
+}
+
+func (c *conn) audioStop() error {
+	mode, rate := c.mode, c.rate
+	c.mode = ""
+	c.rate = 0
+
+	if mode == modeDetect {
+		if !c.isDetected() {
+			return c.write(Event{Type: "not-detected"})
+		}
+		return nil
+	}
+
+	text := ""
+	speaker := ""
+	if len(c.samples) > 0 && rate > 0 {
+		wav := voice.EncodeWAV(c.samples, rate)
+		var err error
+		text, err = c.srv.pipeline.Transcribe(c.ctx, c.client.Token, c.agentID, wav)
+		if err != nil {
+			return fmt.Errorf("transcription failed: %w", err)
+		}
+		if settings := c.voiceSettings(); settings.SpeakerIDEnabled() {
+			if samples, err := voice.WAVSamples(wav); err == nil {
+				speaker = c.srv.pipeline.IdentifySpeaker(samples, settings)
+			}
+		}
+	}
+	c.srv.rememberSpeaker(c.client.ID, speaker)
+	c.logger.Info("Wyoming transcript", "text", text)
+	return c.write(Event{Type: "transcript", Data: map[string]any{"text": text}})
+}
+
+// synthesize speaks text with the agent's TTS and streams it as PCM.
+func (c *conn) synthesize(text string) error {
+	if text == "" {
+		return fmt.Errorf("nothing to synthesize")
+	}
+	audio, err := c.srv.pipeline.Speak(c.ctx, c.client.Token, c.agentID, text, "wav")
+	if err != nil {
+		return fmt.Errorf("speech synthesis failed: %w", err)
+	}
+	pcm, format, err := voice.DecodeWAV(audio)
+	if err != nil {
+		return fmt.Errorf("speech synthesis failed: %w", err)
+	}
+
+	data := map[string]any{"rate": format.Rate, "width": format.Width, "channels": format.Channels}
+	if err := c.write(Event{Type: "audio-start", Data: data}); err != nil {
+		return err
+	}
+	for chunk := range slices.Chunk(pcm, samplesPerChunk*format.Width*format.Channels) {
+		if err := c.write(Event{Type: "audio-chunk", Data: data, Payload: chunk}); err != nil {
+			return err
+		}
+	}
+	return c.write(Event{Type: "audio-stop"})
+}
+
+// converse runs the agent with a transcript (the "handle" service). The
+// conversation continues the Home Assistant conversation when one is given,
+// or the client's own session otherwise.
+func (c *conn) converse(evt Event) error {
+	text := str(evt.Data, "text")
+	convCtx, _ := evt.Data["context"].(map[string]any)
+	sessionID := "wyoming-" + c.client.ID
+	if id := str(convCtx, "conversation_id"); id != "" {
+		sessionID = "wyoming-" + id
+	}
+
+	// The speaker recognized in the transcription of this text, if any
+	userID := c.userID
+	if speaker := c.srv.takeSpeaker(c.client.ID); speaker != "" {
+		userID = speaker
+	}
+	reply, err := c.srv.pipeline.Ask(c.ctx, c.client.Token, c.agentID, userID, sessionID, text)
+	data := map[string]any{"text": reply}
+	if convCtx != nil {
+		data["context"] = convCtx
+	}
+	if err != nil {
+		c.logger.Warn("Wyoming agent run failed", "error", err)
+		data["text"] = err.Error()
+		return c.write(Event{Type: "not-handled", Data: data})
+	}
+	return c.write(Event{Type: "handled", Data: data})
+}
+
+// loadDetector creates the connection's wake word detector, activating the
+// first requested wake word that exists.
+func (c *conn) loadDetector() error {
+	if c.srv.detector == nil {
+		return fmt.Errorf("wake word detection is not available")
+	}
+	if c.detector == nil {
+		d := voice.NewDetector(c.srv.detector.Config(), c.logger)
+		if err := d.Load(); err != nil {
+			return fmt.Errorf("failed to load wake word detector: %w", err)
+		}
+		d.Tune(c.voiceSettings())
+		d.SetOnDetected(func(modelID string) {
+			c.setDetected(true)
+			c.write(Event{Type: "detection", Data: map[string]any{
+				"name":      modelID,
+				"timestamp": time.Since(c.started).Milliseconds(),
+			}})
+		})
+		c.detector = d
+	}
+	for _, name := range c.wakeNames {
+		for _, m := range c.detector.GetModels() {
+			if name == m.ID || name == m.Name {
+				return c.detector.SetActiveModel(m.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// loadVAD creates the connection's VAD, which reports voice-started and
+// voice-stopped while audio is transcribed. Without VAD models it does
+// nothing.
+func (c *conn) loadVAD() {
+	if c.vad != nil || c.srv.detector == nil || len(c.srv.detector.Config().VADModelData) == 0 {
+		return
+	}
+	v := voice.NewVAD(voice.VADConfig{ModelData: c.srv.detector.Config().VADModelData}, c.logger)
+	if err := v.Load(); err != nil {
+		c.logger.Warn("Failed to load VAD model, continuing without VAD", "error", err)
+		return
+	}
+	v.Tune(c.voiceSettings())
+	v.SetOnSpeechStart(func() {
+		c.write(Event{Type: "voice-started", Data: map[string]any{"timestamp": time.Since(c.started).Milliseconds()}})
+	})
+	v.SetOnSpeechEnd(func() {
+		c.write(Event{Type: "voice-stopped", Data: map[string]any{"timestamp": time.Since(c.started).Milliseconds()}})
+	})
+	c.vad = v
+}
+
+// voiceSettings returns the wake word and VAD settings of the client.
+func (c *conn) voiceSettings() store.VoiceSettings {
+	return store.VoiceSettings{}.Merge(c.client.Voice)
+}
+
+func (c *conn) setDetected(v bool) {
+	c.detectMu.Lock()
+	c.detected = v
+	c.detectMu.Unlock()
+}
+
+func (c *conn) isDetected() bool {
+	c.detectMu.Lock()
+	defer c.detectMu.Unlock()
+	return c.detected
+}
+
+func (c *conn) write(evt Event) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return writeEvent(c.nc, evt)
+}
+
+// pcmToFloat converts 16-bit little-endian PCM to mono float32, keeping
+// the first channel.
+func pcmToFloat(pcm []byte, channels int) []float32 {
+	frame := 2 * channels
+	samples := make([]float32, len(pcm)/frame)
+	for i := range samples {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(pcm[i*frame:]))) / 32768
+	}
+	return samples
+}
@@ -0,0 +1,110 @@
+package wyoming
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// protocolVersion is the Wyoming version sent in event headers.
+const protocolVersion = "1.5.4"
+
+// maxEventSize bounds the data and payload of an incoming event.
+const maxEventSize = 8 << 20
+
+// Event is a Wyoming protocol message: a type, JSON data and an optional
+// binary payload (PCM audio for audio-chunk).
+type Event struct {
+	Type    string
+	Data    map[string]any
+	Payload []byte
+}
+
+type header struct {
+	Type          string         `json:"type"`
+	Version       string         `json:"version,omitempty"`
+	Data          map[string]any `json:"data,omitempty"`
+	DataLength    int            `json:"data_length,omitempty"`
+	PayloadLength int            `json:"payload_length,omitempty"`
+}
+
+// readEvent reads one event: a JSON header line, followed by data_length
+// bytes of JSON merged into the header data and payload_length bytes of
+// payload.
+func readEvent(r *bufio.Reader) (Event, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return Event{}, err
+	}
+	var h header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return Event{}, fmt.Errorf("invalid event header: %w", err)
+	}
+	if h.DataLength < 0 || h.PayloadLength < 0 || h.DataLength+h.PayloadLength > maxEventSize {
+		return Event{}, fmt.Errorf("event %q is too large", h.Type)
+	}
+
+	evt := Event{Type: h.Type, Data: h.Data}
+	if evt.Data == nil {
+		evt.Data = map[string]any{}
+	}
+	if h.DataLength > 0 {
+		buf := make([]byte, h.DataLength)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return Event{}, err
+		}
+		var extra map[string]any
+		if err := json.Unmarshal(buf, &extra); err != nil {
+			return Event{}, fmt.Errorf("invalid event data: %w", err)
+		}
+		for k, v := range extra {
+			evt.Data[k] = v
+		}
+	}
+	if h.PayloadLength > 0 {
+		evt.Payload = make([]byte, h.PayloadLength)
+		if _, err := io.ReadFull(r, evt.Payload); err != nil {
+			return Event{}, err
+		}
+	}
+	return evt, nil
+}
+
+// writeEvent writes an event with its data after the header line, as the
+// reference implementation does.
+func writeEvent(w io.Writer, evt Event) error {
+	h := header{Type: evt.Type, Version: protocolVersion, PayloadLength: len(evt.Payload)}
+	var data []byte
+	if len(evt.Data) > 0 {
+		var err error
+		if data, err = json.Marshal(evt.Data); err != nil {
+			return err
+		}
+		h.DataLength = len(data)
+	}
+	line, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 0, len(line)+1+len(data)+len(evt.Payload))
+	buf = append(buf, line...)
+	buf = append(buf, '\n')
+	buf = append(buf, data...)
+	buf = append(buf, evt.Payload...)
+	_, err = w.Write(buf)
+	return err
+}
+
+// str returns a string field of event data.
+func str(data map[string]any, key string) string {
+	s, _ := data[key].(string)
+	return s
+}
+
+// num returns a numeric field of event data.
+func num(data map[string]any, key string) int {
+	f, _ := data[key].(float64)
+	return int(f)
+}
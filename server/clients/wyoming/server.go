@@ -0,0 +1,244 @@
+// Package wyoming serves the Wyoming protocol used by Home Assistant voice
+// satellites, backed by Magec's wake word detection, VAD, STT and TTS
+// proxies and agents.
+package wyoming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/achetronic/magec/server/store"
+	"github.com/achetronic/magec/server/voice"
+)
+
+// Server keeps one TCP listener per enabled Wyoming client. Each listener
+// talks to the client's first allowed agent with the client's token, so
+// runs are recorded and authorized like any other client call. It reloads
+// clients when the store changes, like the MQTT bridge.
+type Server struct {
+	store    *store.Store
+	pipeline *voice.Pipeline
+	detector *voice.Detector
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	entries map[string]*listener
+
+	// speakers holds the user recognized in each client's last
+	// transcription. Home Assistant transcribes and then asks for the
+	// conversation on separate connections.
+	speakerMu sync.Mutex
+	speakers  map[string]recognizedSpeaker
+}
+
+type recognizedSpeaker struct {
+	userID string
+	at     time.Time
+}
+
+// speakerTTL is how long a recognized speaker waits for the conversation
+// turn that follows the transcription.
+const speakerTTL = 30 * time.Second
+
+type listener struct {
+	hash   string
+	ln     net.Listener
+	cancel context.CancelFunc
+}
+
+// NewServer creates a Wyoming server. detector provides the wake word and
+// VAD models; without it the wake service is not offered.
+func NewServer(s *store.Store, pipeline *voice.Pipeline, detector *voice.Detector, logger *slog.Logger) *Server {
+	return &Server{
+		store:    s,
+		pipeline: pipeline,
+		detector: detector,
+		logger:   logger,
+		entries:  make(map[string]*listener),
+		speakers: make(map[string]recognizedSpeaker),
+	}
+}
+
+// rememberSpeaker keeps the speaker of a client's last transcription; an
+// empty userID forgets it.
+func (s *Server) rememberSpeaker(clientID, userID string) {
+	s.speakerMu.Lock()
+	defer s.speakerMu.Unlock()
+	if userID == "" {
+		delete(s.speakers, clientID)
+		return
+	}
+	s.speakers[clientID] = recognizedSpeaker{userID: userID, at: time.Now()}
+}
+
+// takeSpeaker returns and forgets the speaker of a client's last
+// transcription, if it is recent enough.
+func (s *Server) takeSpeaker(clientID string) string {
+	s.speakerMu.Lock()
+	defer s.speakerMu.Unlock()
+	sp, ok := s.speakers[clientID]
+	delete(s.speakers, clientID)
+	if !ok || time.Since(sp.at) > speakerTTL {
+		return ""
+	}
+	return sp.userID
+}
+
+// Start opens the listeners of all Wyoming clients and keeps them in sync
+// with the store until the context is cancelled or Stop is called.
+func (s *Server) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	s.reload(ctx)
+
+	changeCh := s.store.OnChange()
+	for {
+		select {
+		case <-ctx.Done():
+			s.closeAll()
+			return
+		case <-changeCh:
+			s.reload(ctx)
+		}
+	}
+}
+
+// Stop closes all listeners and connections.
+func (s *Server) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+func (s *Server) reload(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	desired := make(map[string]store.ClientDefinition)
+	for _, cl := range s.store.ListClients() {
+		if cl.Type == "wyoming" && cl.Enabled && cl.Config.Wyoming != nil && len(cl.AllowedAgents) > 0 {
+			desired[cl.ID] = cl
+		}
+	}
+
+	for id, l := range s.entries {
+		cl, ok := desired[id]
+		if ok && hash(cl) == l.hash {
+			continue
+		}
+		l.stop()
+		delete(s.entries, id)
+	}
+
+	for id, cl := range desired {
+		if _, ok := s.entries[id]; ok {
+			continue
+		}
+		l, err := s.listen(ctx, cl)
+		if err != nil {
+			s.logger.Error("Failed to start Wyoming client", "client", cl.Name, "error", err)
+			continue
+		}
+		s.entries[id] = l
+	}
+	s.logger.Debug("Wyoming server reloaded", "wyomingClients", len(s.entries))
+}
+
+func (s *Server) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, l := range s.entries {
+		l.stop()
+		delete(s.entries, id)
+	}
+}
+
+func (l *listener) stop() {
+	l.cancel()
+	l.ln.Close()
+}
+
+// listen opens the TCP listener of a client and serves its connections.
+func (s *Server) listen(ctx context.Context, cl store.ClientDefinition) (*listener, error) {
+	addr, err := listenAddress(cl.Config.Wyoming.Listen)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := s.store.ResolveUser(store.IdentityClient, cl.ID, cl.Name)
+	if err != nil {
+		s.logger.Warn("Failed to resolve user identity", "client", cl.Name, "error", err)
+	}
+	if userID == "" {
+		userID = "wyoming"
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	logger := s.logger.With("client", cl.Name)
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+					logger.Error("Wyoming accept failed", "error", err)
+				}
+				return
+			}
+			c := newConn(ctx, s, cl, userID, nc, logger.With("remote", nc.RemoteAddr().String()))
+			go c.serve()
+		}
+	}()
+
+	logger.Info("Wyoming server listening", "address", ln.Addr().String(), "agent", cl.AllowedAgents[0])
+	if h, _, _ := net.SplitHostPort(addr); h != "localhost" && !net.ParseIP(h).IsLoopback() {
+		logger.Warn("Wyoming server is reachable from the network; the protocol has no authentication, so anyone who can reach it can talk to the agent", "address", ln.Addr().String())
+	}
+	return &listener{hash: hash(cl), ln: ln, cancel: cancel}, nil
+}
+
+// listenAddress resolves the address of a client. Wyoming has no
+// authentication, so an address without a host (":10700") binds to
+// loopback; exposing the port needs an explicit host like "0.0.0.0:10700".
+func listenAddress(listen string) (string, error) {
+	if listen == "" {
+		return "", fmt.Errorf("listen address is required")
+	}
+	h, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %q: %w", listen, err)
+	}
+	if h == "" {
+		h = "127.0.0.1"
+	}
+	return net.JoinHostPort(h, port), nil
+}
+
+// agent returns the definition that configures STT and TTS for an agent or
+// flow. Flows use their first agent, like the voice proxies.
+func (s *Server) agent(id string) (name string, def store.AgentDefinition, ok bool) {
+	if a, ok := s.store.GetAgent(id); ok {
+		return a.Name, a, true
+	}
+	f, ok := s.store.GetFlow(id)
+	if !ok {
+		return "", store.AgentDefinition{}, false
+	}
+	a, ok := s.store.GetAgent(f.FirstAgentID())
+	return f.Name, a, ok
+}
+
+func hash(cl store.ClientDefinition) string {
+	data, _ := json.Marshal(cl)
+	return string(data)
+}
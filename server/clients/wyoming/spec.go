@@ -0,0 +1,36 @@
+package wyoming
+
+import (
+	"github.com/achetronic/magec/server/clients"
+)
+
+type Provider struct{}
+
+func init() {
+	clients.Register(&Provider{})
+}
+
+func (p *Provider) Type() string        { return "wyoming" }
+func (p *Provider) DisplayName() string { return "Wyoming" }
+
+func (p *Provider) ConfigSchema() clients.Schema {
+	return clients.Schema{
+		"type": "object",
+		"properties": clients.Schema{
+			"listen": clients.Schema{
+				"type":          "string",
+				"title":         "Listen Address",
+				"minLength":     1,
+				"x-placeholder": "0.0.0.0:10700",
+				"description":   "TCP address the Wyoming server listens on. Without a host (\":10700\") it only listens on loopback. Wyoming has no authentication: only expose it on a trusted network.",
+			},
+			"languages": clients.Schema{
+				"type":          "array",
+				"items":         clients.Schema{"type": "string"},
+				"title":         "Languages",
+				"x-placeholder": "Comma-separated language codes (e.g. en, es). Defaults to en",
+			},
+		},
+		"required": []string{"listen"},
+	}
+}
@@ -26,6 +26,8 @@ const (
 	BackendTypeOpenAI    = "openai"
 	BackendTypeAnthropic = "anthropic"
 	BackendTypeGemini    = "gemini"
+	// BackendTypeLocal runs speech models in-process instead of calling a URL
+	BackendTypeLocal = "local"
 
 	DefaultOpenAIURL = "https://api.openai.com/v1"
 )
@@ -34,9 +36,11 @@ const (
 // Only server infrastructure settings live here.
 // All resources (agents, backends, MCPs, memory, etc.) are managed via the admin API and persisted in the store.
 type Config struct {
-	Server Server `yaml:"server"`
-	Voice  Voice  `yaml:"voice"`
-	Log    Log    `yaml:"log"`
+	Server        Server        `yaml:"server"`
+	Conversations Conversations `yaml:"conversations"`
+	Webhooks      Webhooks      `yaml:"webhooks"`
+	Voice         Voice         `yaml:"voice"`
+	Log           Log           `yaml:"log"`
 }
 
 // Server holds network and runtime settings for the HTTP servers.
@@ -49,10 +53,23 @@ type Server struct {
 	PublicURL     string `yaml:"publicURL"`
 }
 
+// Conversations selects where the conversation audit log is stored.
+type Conversations struct {
+	Backend string `yaml:"backend"` // sqlite, postgres (default: sqlite)
+	DSN     string `yaml:"dsn"`     // SQLite file path or Postgres connection string (default: data/conversations.db)
+}
+
+// Webhooks sizes the worker pool that runs asynchronous webhook jobs.
+type Webhooks struct {
+	Workers   int `yaml:"workers"`   // concurrent jobs (default: 4)
+	QueueSize int `yaml:"queueSize"` // jobs waiting to run before requests are rejected (default: 100)
+}
+
 // Voice holds voice-related configuration (UI, ONNX runtime, etc.).
 type Voice struct {
-	UI              VoiceUI `yaml:"ui"`
-	OnnxLibraryPath string  `yaml:"onnxLibraryPath"`
+	UI              VoiceUI     `yaml:"ui"`
+	OnnxLibraryPath string      `yaml:"onnxLibraryPath"`
+	Events          VoiceEvents `yaml:"events"`
 }
 
 // VoiceUI controls whether the Voice UI frontend and voice routes are enabled.
@@ -60,6 +77,14 @@ type VoiceUI struct {
 	Enabled *bool `yaml:"enabled"`
 }
 
+// VoiceEvents guards the voice events WebSocket, where every connection
+// runs its own wake word and VAD models.
+type VoiceEvents struct {
+	AllowedOrigins          []string `yaml:"allowedOrigins"`          // browser origins allowed besides the server's own and publicURL; "*" allows any
+	MaxConnectionsPerClient int      `yaml:"maxConnectionsPerClient"` // open connections per client token, or per address without one (default: 4, -1 for no limit)
+	IdleTimeout             int      `yaml:"idleTimeout"`             // seconds without a message before a connection is closed (default: 120, -1 to never close)
+}
+
 // Log configures the application logger
 type Log struct {
 	Level  string `yaml:"level"`  // debug, info, warn, error (default: info)
@@ -121,6 +146,18 @@ func (c *Config) applyDefaults() {
 	if c.Server.AdminPort == 0 {
 		c.Server.AdminPort = 8081
 	}
+	if c.Conversations.Backend == "" {
+		c.Conversations.Backend = "sqlite"
+	}
+	if c.Conversations.DSN == "" && c.Conversations.Backend == "sqlite" {
+		c.Conversations.DSN = "data/conversations.db"
+	}
+	if c.Webhooks.Workers <= 0 {
+		c.Webhooks.Workers = 4
+	}
+	if c.Webhooks.QueueSize <= 0 {
+		c.Webhooks.QueueSize = 100
+	}
 	if c.Log.Level == "" {
 		c.Log.Level = "info"
 	}
@@ -131,4 +168,10 @@ func (c *Config) applyDefaults() {
 		enabled := true
 		c.Voice.UI.Enabled = &enabled
 	}
+	if c.Voice.Events.MaxConnectionsPerClient == 0 {
+		c.Voice.Events.MaxConnectionsPerClient = 4
+	}
+	if c.Voice.Events.IdleTimeout == 0 {
+		c.Voice.Events.IdleTimeout = 120
+	}
 }
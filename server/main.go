@@ -27,6 +27,8 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"syscall"
@@ -38,16 +40,23 @@ import (
 	"github.com/achetronic/magec/server/api/admin"
 	user "github.com/achetronic/magec/server/api/user"
 	"github.com/achetronic/magec/server/clients"
+	"github.com/achetronic/magec/server/clients/chatbot"
 	"github.com/achetronic/magec/server/clients/cron"
 	discordclient "github.com/achetronic/magec/server/clients/discord"
+	emailclient "github.com/achetronic/magec/server/clients/email"
+	matrixclient "github.com/achetronic/magec/server/clients/matrix"
+	mattermostclient "github.com/achetronic/magec/server/clients/mattermost"
+	"github.com/achetronic/magec/server/clients/mqtt"
 	slackclient "github.com/achetronic/magec/server/clients/slack"
 	"github.com/achetronic/magec/server/clients/telegram"
 	"github.com/achetronic/magec/server/clients/webhook"
+	"github.com/achetronic/magec/server/clients/wyoming"
 	"github.com/achetronic/magec/server/config"
 	"github.com/achetronic/magec/server/frontend"
 	"github.com/achetronic/magec/server/logging"
 	"github.com/achetronic/magec/server/middleware"
 	"github.com/achetronic/magec/server/models"
+	"github.com/achetronic/magec/server/openai"
 	"github.com/achetronic/magec/server/store"
 	"github.com/achetronic/magec/server/voice"
 
@@ -99,10 +108,15 @@ func main() {
 	}
 
 	// Initialize conversation store for audit logging
-	convoStore, err := store.NewConversationStore("data/conversations.json")
+	convoStore, err := store.NewConversationStore(cfg.Conversations.Backend, cfg.Conversations.DSN)
 	if err != nil {
-		slog.Warn("Failed to initialize conversation store", "error", err)
-		convoStore, _ = store.NewConversationStore("")
+		slog.Error("Failed to initialize conversation store", "backend", cfg.Conversations.Backend, "error", err)
+		os.Exit(1)
+	}
+	if n, err := convoStore.ImportLegacyJSON("data/conversations.json"); err != nil {
+		slog.Warn("Failed to import legacy conversations", "error", err)
+	} else if n > 0 {
+		slog.Info("Imported legacy conversations", "count", n)
 	}
 	slog.Info("Conversation store initialized", "conversations", convoStore.Count())
 
@@ -148,12 +162,16 @@ func main() {
 	}
 	a2aHandler := mageca2a.NewHandler(a2aPublicURL)
 
+	agentURL := fmt.Sprintf("http://127.0.0.1:%d/api/v1/agent", cfg.Server.Port)
+
+	// Server-side voice turns for voice sessions and Wyoming satellites
+	voicePipeline := voice.NewPipeline(dataStore, agentURL, slog.Default())
+
 	// Swappable handler for agent-related routes (hot-reloaded on store changes)
-	agentRouter := &agentRouterHandler{adminHandler: adminHandler, a2aHandler: a2aHandler, cwRegistry: cwRegistry}
+	agentRouter := &agentRouterHandler{adminHandler: adminHandler, a2aHandler: a2aHandler, voicePipeline: voicePipeline, cwRegistry: cwRegistry}
 	agentRouter.rebuild(ctx, dataStore)
 
 	// Executor for running commands against agents (cron, webhooks, etc.)
-	agentURL := fmt.Sprintf("http://127.0.0.1:%d/api/v1/agent", cfg.Server.Port)
 	executor := clients.NewExecutor(dataStore, agentURL, slog.Default())
 	executor.SetConversationStore(convoStore)
 
@@ -171,7 +189,22 @@ func main() {
 		executor, dataStore, "user",
 	)
 	httpMux.Handle("/api/v1/agent/", userRecorded)
-	httpMux.Handle("/api/v1/voice/", newVoiceHandler(dataStore, agentRouter))
+	const defaultOnnxLibraryPath = "/usr/lib/libonnxruntime.so"
+	onnxLibraryPath := defaultOnnxLibraryPath
+	if cfg.Voice.OnnxLibraryPath != "" {
+		onnxLibraryPath = cfg.Voice.OnnxLibraryPath
+	}
+
+	// In-process speech-to-text and text-to-speech for backends of type "local"
+	localSTT := voice.NewLocalSTT(filepath.Join(dataStore.DataDir(), "stt"), onnxLibraryPath, slog.Default())
+	localTTS := voice.NewLocalTTS(dataStore, onnxLibraryPath, slog.Default())
+
+	// Speaker identification, with the embedding model in data/speaker
+	speakerID := voice.NewSpeakerID(dataStore, filepath.Join(dataStore.DataDir(), "speaker"), onnxLibraryPath, slog.Default())
+	voicePipeline.SetSpeakerID(speakerID)
+	adminHandler.SetSpeakerID(speakerID)
+	adminHandler.SetOnnxLibraryPath(onnxLibraryPath)
+	httpMux.Handle("/api/v1/voice/", newVoiceHandler(dataStore, agentRouter, localSTT, localTTS))
 
 	// A2A protocol endpoints (global discovery + per-agent card + JSON-RPC invoke)
 	httpMux.HandleFunc("/api/v1/a2a/", a2aHandler.ServeA2A)
@@ -179,6 +212,8 @@ func main() {
 	userAPI := user.New(dataStore)
 	httpMux.HandleFunc("/api/v1/health", userAPI.Health)
 	httpMux.HandleFunc("/api/v1/client/info", userAPI.ClientInfo)
+	notifier := user.NewNotifier()
+	httpMux.Handle("/api/v1/client/notifications", notifier)
 
 	httpMux.Handle("/swagger/", httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"),
@@ -188,12 +223,6 @@ func main() {
 	// Voice events WebSocket handler (wake word + VAD)
 	var voiceDetector *voice.Detector
 	if *cfg.Voice.UI.Enabled {
-		const defaultOnnxLibraryPath = "/usr/lib/libonnxruntime.so"
-		onnxLibraryPath := defaultOnnxLibraryPath
-		if cfg.Voice.OnnxLibraryPath != "" {
-			onnxLibraryPath = cfg.Voice.OnnxLibraryPath
-		}
-
 		wakewordYAML, err := models.WakewordConfig()
 		if err != nil {
 			slog.Warn("Wake word config not available", "error", err)
@@ -220,6 +249,10 @@ func main() {
 					})
 				}
 
+				// Wake words uploaded through the Admin API come after the built-in ones
+				builtinModels := voiceModels
+				voiceModels = append(builtinModels[:len(builtinModels):len(builtinModels)], voice.CustomModels(dataStore, slog.Default())...)
+
 				melData, err1 := models.ReadAuxiliaryModel("mel-spectrogram.onnx")
 				embData, err2 := models.ReadAuxiliaryModel("speech-embedding.onnx")
 				vadData, err3 := models.ReadAuxiliaryModel("silero-vad.onnx")
@@ -237,8 +270,12 @@ func main() {
 					if err := voiceDetector.Load(); err != nil {
 						slog.Warn("Failed to load voice detection models", "error", err)
 					} else {
-						voiceHandler := voice.NewHandler(voiceDetector, slog.Default())
+						voiceHandler := voice.NewHandler(voiceDetector, dataStore, slog.Default())
+						voiceHandler.SetPipeline(voicePipeline)
+						voiceHandler.SetPolicy(voiceEventsPolicy(cfg))
+						adminHandler.SetVoiceConnections(voiceHandler)
 						httpMux.Handle("/api/v1/voice/events", voiceHandler)
+						go voice.WatchWakeWords(ctx, dataStore, builtinModels, voiceDetector, voiceHandler, slog.Default())
 						slog.Info("Voice detection enabled", "wakeWordModels", len(voiceModels), "vadEnabled", true)
 					}
 				}
@@ -258,8 +295,15 @@ func main() {
 		}
 	}()
 
+	// OpenAI-compatible Chat Completions API in front of agents and flows
+	openaiHandler := openai.NewHandler(dataStore, agentURL, slog.Default())
+	httpMux.Handle("/v1/", openaiHandler)
+
 	// Webhook handler for trigger endpoints
 	webhookHandler := webhook.NewHandler(executor, dataStore, slog.Default())
+	webhookJobs := webhook.NewJobQueue(executor, dataStore, convoStore, cfg.Webhooks.Workers, cfg.Webhooks.QueueSize, slog.Default())
+	webhookHandler.SetJobQueue(webhookJobs)
+	go webhookJobs.Start(ctx)
 	httpMux.Handle("/api/v1/webhooks/", http.StripPrefix("/api/v1/webhooks", webhookHandler))
 
 	// Static files
@@ -281,12 +325,28 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Chat bot clients, started below; cron results can be delivered through them
+	cm := newClientManager(dataStore, cfg.Server.Port, slog.Default())
+
 	// Start cron scheduler
 	cronScheduler := cron.NewScheduler(executor, dataStore, slog.Default())
+	cronScheduler.SetDeliverer(&deliveryRouter{store: dataStore, bots: cm, notifier: notifier})
+	cronScheduler.SetRunStore(convoStore)
+	adminHandler.SetClientRunner(cronScheduler)
 	go cronScheduler.Start(ctx)
 
-	// Start Telegram, Slack, and Discord clients (hot-reloaded on store changes)
-	cm := newClientManager(dataStore, cfg.Server.Port, slog.Default())
+	// Start MQTT bridge
+	mqttBridge := mqtt.NewBridge(executor, dataStore, slog.Default())
+	go mqttBridge.Start(ctx)
+
+	// Start Wyoming server for Home Assistant voice satellites
+	wyomingServer := wyoming.NewServer(dataStore, voicePipeline, voiceDetector, slog.Default())
+	go wyomingServer.Start(ctx)
+
+	// Prune conversation logs according to retention policies
+	go runRetention(ctx, dataStore, convoStore)
+
+	// Start chat bot clients (hot-reloaded on store changes)
 	cm.start(ctx)
 
 	// Graceful shutdown
@@ -297,10 +357,15 @@ func main() {
 
 		slog.Info("Shutting down...")
 		cronScheduler.Stop()
+		mqttBridge.Stop()
+		wyomingServer.Stop()
 		cm.stop()
 		if voiceDetector != nil {
 			voiceDetector.Close()
 		}
+		if err := dataStore.Flush(); err != nil {
+			slog.Error("Failed to save store", "error", err)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		adminServer.Shutdown(ctx)
@@ -314,11 +379,50 @@ func main() {
 	}
 }
 
+// runRetention applies the conversation retention policies once at startup
+// and then every hour until ctx is cancelled.
+func runRetention(ctx context.Context, dataStore *store.Store, convoStore *store.ConversationStore) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		global, clients := dataStore.RetentionPolicies()
+		if global != nil || len(clients) > 0 {
+			report, err := convoStore.ApplyRetention(global, clients, time.Now(), false)
+			if err != nil {
+				slog.Error("Retention pass failed", "error", err)
+			} else if report.Conversations > 0 || report.RawEventsConversations > 0 {
+				slog.Info("Retention pass completed", "conversations", report.Conversations, "rawEvents", report.RawEventsConversations)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// voiceEventsPolicy returns the origins, limits and timeouts of the voice
+// events WebSocket. The origin of the public URL is always allowed.
+func voiceEventsPolicy(cfg *config.Config) voice.EventsPolicy {
+	events := cfg.Voice.Events
+	policy := voice.EventsPolicy{
+		AllowedOrigins:          events.AllowedOrigins,
+		MaxConnectionsPerClient: max(events.MaxConnectionsPerClient, 0),
+		IdleTimeout:             time.Duration(max(events.IdleTimeout, 0)) * time.Second,
+	}
+	if u, err := url.Parse(cfg.Server.PublicURL); err == nil && u.Host != "" {
+		policy.AllowedOrigins = append(slices.Clone(policy.AllowedOrigins), u.Scheme+"://"+u.Host)
+	}
+	return policy
+}
+
 // newVoiceHandler creates a router for /api/v1/voice/{agentId}/{action} routes.
 // It extracts the agent ID and action from the URL path, resolves the agent
-// from the store, and dispatches to the speech (TTS) or transcription (STT) proxy.
+// from the store, and dispatches to the speech (TTS) or transcription (STT) proxy,
+// or to the speech stream, which speaks text sentence by sentence as it arrives.
 // The /api/v1/voice/events WebSocket endpoint is handled separately.
-func newVoiceHandler(dataStore *store.Store, agentRouter *agentRouterHandler) http.Handler {
+func newVoiceHandler(dataStore *store.Store, agentRouter *agentRouterHandler, localSTT *voice.LocalSTT, localTTS *voice.LocalTTS) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Strip prefix: /api/v1/voice/  →  {agentId}/speech or {agentId}/transcription
 		path := strings.TrimPrefix(r.URL.Path, "/api/v1/voice/")
@@ -353,9 +457,17 @@ func newVoiceHandler(dataStore *store.Store, agentRouter *agentRouterHandler) ht
 
 		switch action {
 		case "speech":
-			serveSpeechProxy(w, r, agentDef, dataStore)
+			serveSpeechProxy(w, r, agentDef, dataStore, localTTS)
 		case "transcription":
-			serveTranscriptionProxy(w, r, agentDef, dataStore)
+			serveTranscriptionProxy(w, r, agentDef, dataStore, localSTT)
+		case "speech/stream":
+			// Sentences are spoken through the speech proxy above, so the
+			// pipeline is given the agent or flow ID of the request
+			if r.Method != http.MethodPost {
+				http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+				return
+			}
+			agentRouter.voicePipeline.ServeSpeechStream(w, r, agentID)
 		default:
 			http.Error(w, `{"error":"unknown voice action"}`, http.StatusBadRequest)
 		}
@@ -365,14 +477,19 @@ func newVoiceHandler(dataStore *store.Store, agentRouter *agentRouterHandler) ht
 // serveSpeechProxy forwards a TTS request to the backend configured for the agent.
 // It reads only "input" and "response_format" from the client body, injects
 // model/voice/speed from the agent's store config, and proxies the request
-// to the backend's /v1/audio/speech endpoint.
-func serveSpeechProxy(w http.ResponseWriter, r *http.Request, agentDef store.AgentDefinition, dataStore *store.Store) {
+// to the backend's /v1/audio/speech endpoint. Local backends are served
+// in-process.
+func serveSpeechProxy(w http.ResponseWriter, r *http.Request, agentDef store.AgentDefinition, dataStore *store.Store, localTTS *voice.LocalTTS) {
 	if agentDef.TTS.Backend == "" {
 		http.Error(w, `{"error":"TTS not configured for this agent"}`, http.StatusServiceUnavailable)
 		return
 	}
 
 	backend, ok := dataStore.GetBackend(agentDef.TTS.Backend)
+	if ok && backend.Type == config.BackendTypeLocal {
+		serveLocalSpeech(w, r, agentDef, localTTS)
+		return
+	}
 	if !ok || backend.URL == "" {
 		http.Error(w, `{"error":"TTS backend not found"}`, http.StatusServiceUnavailable)
 		return
@@ -448,17 +565,55 @@ func serveSpeechProxy(w http.ResponseWriter, r *http.Request, agentDef store.Age
 	io.Copy(w, resp.Body)
 }
 
+// serveLocalSpeech synthesizes speech with the agent's local voice and
+// answers like /v1/audio/speech does: "input" is spoken in the
+// "response_format" requested (mp3 by default).
+func serveLocalSpeech(w http.ResponseWriter, r *http.Request, agentDef store.AgentDefinition, localTTS *voice.LocalTTS) {
+	var req struct {
+		Input          string `json:"input"`
+		ResponseFormat string `json:"response_format"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if req.ResponseFormat == "" {
+		req.ResponseFormat = "mp3"
+	}
+	contentType := voice.SpeechContentType(req.ResponseFormat)
+	if contentType == "" {
+		http.Error(w, `{"error":"unsupported response_format"}`, http.StatusBadRequest)
+		return
+	}
+
+	audio, err := localTTS.Synthesize(r.Context(), agentDef.TTS.Voice, req.Input, agentDef.TTS.Speed, req.ResponseFormat)
+	if err != nil {
+		slog.Error("Local TTS error", "agent", agentDef.ID, "error", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(audio)
+}
+
 // serveTranscriptionProxy forwards a speech-to-text request to the backend
 // configured for the agent. It injects the transcription model from the agent's
 // store config into the multipart form before proxying to the backend's
-// /v1/audio/transcriptions endpoint.
-func serveTranscriptionProxy(w http.ResponseWriter, r *http.Request, agentDef store.AgentDefinition, dataStore *store.Store) {
+// /v1/audio/transcriptions endpoint. Local backends are served in-process.
+func serveTranscriptionProxy(w http.ResponseWriter, r *http.Request, agentDef store.AgentDefinition, dataStore *store.Store, localSTT *voice.LocalSTT) {
 	if agentDef.Transcription.Backend == "" {
 		http.Error(w, `{"error":"transcription not configured for this agent"}`, http.StatusServiceUnavailable)
 		return
 	}
 
 	backend, ok := dataStore.GetBackend(agentDef.Transcription.Backend)
+	if ok && backend.Type == config.BackendTypeLocal {
+		serveLocalTranscription(w, r, agentDef, localSTT)
+		return
+	}
 	if !ok || backend.URL == "" {
 		http.Error(w, `{"error":"transcription backend not found"}`, http.StatusServiceUnavailable)
 		return
@@ -537,6 +692,39 @@ func serveTranscriptionProxy(w http.ResponseWriter, r *http.Request, agentDef st
 	io.Copy(w, resp.Body)
 }
 
+// serveLocalTranscription transcribes a WAV upload with the agent's local
+// model and answers like /v1/audio/transcriptions does. The optional
+// "language" form field skips language detection.
+func serveLocalTranscription(w http.ResponseWriter, r *http.Request, agentDef store.AgentDefinition, localSTT *voice.LocalSTT) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, `{"error":"invalid multipart form"}`, http.StatusBadRequest)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, `{"error":"file is required"}`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	audio, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read audio", http.StatusBadRequest)
+		return
+	}
+
+	text, err := localSTT.TranscribeWAV(agentDef.Transcription.Model, r.FormValue("language"), audio)
+	if err != nil {
+		slog.Error("Local transcription error", "agent", agentDef.ID, "error", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"text": text})
+}
+
 // agentRouterHandler is an HTTP handler that can be atomically swapped at
 // runtime. It wraps the ADK agent handler and is rebuilt every time the store
 // changes (agents added, removed, or modified).
@@ -545,6 +733,8 @@ type agentRouterHandler struct {
 	agentHandler http.Handler
 	adminHandler *admin.Handler
 	a2aHandler   *mageca2a.Handler
+	// voicePipeline records interrupted voice replies in the ADK sessions
+	voicePipeline *voice.Pipeline
 	// cwRegistry is passed through to agent.New so the ContextGuard plugin
 	// can look up each model's context window at runtime.
 	cwRegistry *contextguard.CrushRegistry
@@ -578,6 +768,10 @@ func (h *agentRouterHandler) rebuild(ctx context.Context, dataStore *store.Store
 			agentHandler = http.StripPrefix("/api/v1/agent", svc.Handler())
 			if h.adminHandler != nil {
 				h.adminHandler.SetSessionService(svc.SessionService())
+				h.adminHandler.SetMemoryService(svc.MemoryService())
+			}
+			if h.voicePipeline != nil {
+				h.voicePipeline.SetSessionService(svc.SessionService())
 			}
 			if h.a2aHandler != nil {
 				h.a2aHandler.Rebuild(storeData.Agents, storeData.Flows, svc.ADKAgents(), svc.SessionService(), svc.MemoryService())
@@ -597,9 +791,9 @@ func (h *agentRouterHandler) rebuild(ctx context.Context, dataStore *store.Store
 func checkDependencies(cfg *config.Config) {
 	var missing []string
 
-	// ffmpeg — required for Telegram/Discord voice messages (audio→WAV conversion)
+	// ffmpeg — required for Telegram/Discord/Matrix voice messages (audio→WAV conversion)
 	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		missing = append(missing, "ffmpeg (required for Telegram/Discord voice messages)")
+		missing = append(missing, "ffmpeg (required for Telegram/Discord/Matrix voice messages)")
 	}
 
 	// ONNX Runtime — required for voice UI (wake word + VAD detection)
@@ -618,7 +812,7 @@ func checkDependencies(cfg *config.Config) {
 	}
 }
 
-// clientManager manages the lifecycle of long-running clients (Telegram, Slack).
+// clientManager manages the lifecycle of long-running chat bots (Telegram, Slack, Discord).
 // It subscribes to store changes and reconciles running clients: stopping
 // removed/disabled ones and starting new/re-enabled ones automatically.
 type clientManager struct {
@@ -631,6 +825,7 @@ type clientManager struct {
 }
 
 type managedClient struct {
+	bot    chatBot
 	stop   func()
 	cancel context.CancelFunc
 	hash   string
@@ -678,7 +873,7 @@ func (m *clientManager) reconcile(ctx context.Context) {
 
 	desired := make(map[string]store.ClientDefinition)
 	for _, cl := range m.store.ListClients() {
-		if (cl.Type == "telegram" || cl.Type == "slack" || cl.Type == "discord") && cl.Enabled && len(cl.AllowedAgents) > 0 {
+		if _, ok := chatBots[cl.Type]; ok && cl.Enabled && len(cl.AllowedAgents) > 0 {
 			desired[cl.ID] = cl
 		}
 	}
@@ -704,14 +899,7 @@ func (m *clientManager) reconcile(ctx context.Context) {
 		if _, ok := m.running[id]; ok {
 			continue
 		}
-		switch cl.Type {
-		case "telegram":
-			m.startTelegram(ctx, cl)
-		case "slack":
-			m.startSlack(ctx, cl)
-		case "discord":
-			m.startDiscord(ctx, cl)
-		}
+		m.startBot(ctx, cl)
 	}
 }
 
@@ -720,137 +908,126 @@ func clientHash(cl store.ClientDefinition) string {
 	return string(b)
 }
 
-func (m *clientManager) startTelegram(ctx context.Context, cl store.ClientDefinition) {
-	if cl.Config.Telegram == nil {
+// chatBot is a long-running chat platform client built on the shared
+// chat-bot runtime.
+type chatBot interface {
+	Start(ctx context.Context) error
+	Stop()
+}
+
+// chatBots maps client types to the constructor of their chat bot.
+var chatBots = map[string]func(store.ClientDefinition, string, []chatbot.AgentInfo, chatbot.Store, *slog.Logger) (chatBot, error){
+	"telegram": func(cl store.ClientDefinition, url string, agents []chatbot.AgentInfo, s chatbot.Store, l *slog.Logger) (chatBot, error) {
+		return telegram.New(cl, url, agents, s, l)
+	},
+	"slack": func(cl store.ClientDefinition, url string, agents []chatbot.AgentInfo, s chatbot.Store, l *slog.Logger) (chatBot, error) {
+		return slackclient.New(cl, url, agents, s, l)
+	},
+	"discord": func(cl store.ClientDefinition, url string, agents []chatbot.AgentInfo, s chatbot.Store, l *slog.Logger) (chatBot, error) {
+		return discordclient.New(cl, url, agents, s, l)
+	},
+	"matrix": func(cl store.ClientDefinition, url string, agents []chatbot.AgentInfo, s chatbot.Store, l *slog.Logger) (chatBot, error) {
+		return matrixclient.New(cl, url, agents, s, l)
+	},
+	"mattermost": func(cl store.ClientDefinition, url string, agents []chatbot.AgentInfo, s chatbot.Store, l *slog.Logger) (chatBot, error) {
+		return mattermostclient.New(cl, url, agents, s, l)
+	},
+	"email": func(cl store.ClientDefinition, url string, agents []chatbot.AgentInfo, s chatbot.Store, l *slog.Logger) (chatBot, error) {
+		return emailclient.New(cl, url, agents, s, l)
+	},
+}
+
+func (m *clientManager) startBot(ctx context.Context, cl store.ClientDefinition) {
+	newBot, ok := chatBots[cl.Type]
+	if !ok {
 		return
 	}
+	name := cl.Type
+	if p := clients.Get(cl.Type); p != nil {
+		name = p.DisplayName()
+	}
 
-	var agents []telegram.AgentInfo
+	var agents []chatbot.AgentInfo
 	for _, agentID := range cl.AllowedAgents {
 		agentDef, ok := m.store.GetAgent(agentID)
 		if !ok {
 			if flowDef, ok := m.store.GetFlow(agentID); ok {
-				agents = append(agents, telegram.AgentInfo{ID: agentID, Name: flowDef.Name})
+				agents = append(agents, chatbot.AgentInfo{ID: agentID, Name: flowDef.Name})
 				continue
 			}
-			m.logger.Warn("Telegram client references unknown agent", "client", cl.Name, "agent", agentID)
+			m.logger.Warn(name+" client references unknown agent", "client", cl.Name, "agent", agentID)
 			continue
 		}
-		agents = append(agents, telegram.AgentInfo{ID: agentID, Name: agentDef.Name})
+		agents = append(agents, chatbot.AgentInfo{ID: agentID, Name: agentDef.Name})
 	}
 
 	if len(agents) == 0 {
-		m.logger.Warn("Telegram client has no valid agents", "client", cl.Name)
+		m.logger.Warn(name+" client has no valid agents", "client", cl.Name)
 		return
 	}
 
-	tgClient, err := telegram.New(cl, m.agentURL, agents, m.store, m.logger)
+	bot, err := newBot(cl, m.agentURL, agents, m.store, m.logger)
 	if err != nil {
-		m.logger.Error("Failed to create Telegram client", "client", cl.Name, "error", err)
+		m.logger.Error("Failed to create "+name+" client", "client", cl.Name, "error", err)
 		return
 	}
 
 	clientCtx, cancel := context.WithCancel(ctx)
-	m.running[cl.ID] = &managedClient{stop: tgClient.Stop, cancel: cancel, hash: clientHash(cl)}
+	m.running[cl.ID] = &managedClient{bot: bot, stop: bot.Stop, cancel: cancel, hash: clientHash(cl)}
 
-	go func(name string) {
+	go func(clientName string) {
 		time.Sleep(500 * time.Millisecond)
-		if err := tgClient.Start(clientCtx); err != nil {
+		if err := bot.Start(clientCtx); err != nil {
 			if clientCtx.Err() == nil {
-				m.logger.Error("Telegram client error", "client", name, "error", err)
+				m.logger.Error(name+" client error", "client", clientName, "error", err)
 			}
 		}
 	}(cl.Name)
 
-	m.logger.Info("Started Telegram client", "client", cl.Name)
+	m.logger.Info("Started "+name+" client", "client", cl.Name)
 }
 
-func (m *clientManager) startSlack(ctx context.Context, cl store.ClientDefinition) {
-	if cl.Config.Slack == nil {
-		return
-	}
-
-	var agents []slackclient.AgentInfo
-	for _, agentID := range cl.AllowedAgents {
-		agentDef, ok := m.store.GetAgent(agentID)
-		if !ok {
-			if flowDef, ok := m.store.GetFlow(agentID); ok {
-				agents = append(agents, slackclient.AgentInfo{ID: agentID, Name: flowDef.Name})
-				continue
-			}
-			m.logger.Warn("Slack client references unknown agent", "client", cl.Name, "agent", agentID)
-			continue
-		}
-		agents = append(agents, slackclient.AgentInfo{ID: agentID, Name: agentDef.Name})
-	}
+// deliveryBot is implemented by chat bots that can post a message outside
+// of a conversation.
+type deliveryBot interface {
+	Deliver(ctx context.Context, target, title, text string) error
+}
 
-	if len(agents) == 0 {
-		m.logger.Warn("Slack client has no valid agents", "client", cl.Name)
-		return
+// deliver posts text through the running chat bot of a client.
+func (m *clientManager) deliver(ctx context.Context, clientID, target, title, text string) error {
+	m.mu.Lock()
+	mc, ok := m.running[clientID]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("client %q is not running", clientID)
 	}
-
-	skClient, err := slackclient.New(cl, m.agentURL, agents, m.store, m.logger)
-	if err != nil {
-		m.logger.Error("Failed to create Slack client", "client", cl.Name, "error", err)
-		return
+	bot, ok := mc.bot.(deliveryBot)
+	if !ok {
+		return fmt.Errorf("client %q cannot deliver messages", clientID)
 	}
-
-	clientCtx, cancel := context.WithCancel(ctx)
-	m.running[cl.ID] = &managedClient{stop: skClient.Stop, cancel: cancel, hash: clientHash(cl)}
-
-	go func(name string) {
-		time.Sleep(500 * time.Millisecond)
-		if err := skClient.Start(clientCtx); err != nil {
-			if clientCtx.Err() == nil {
-				m.logger.Error("Slack client error", "client", name, "error", err)
-			}
-		}
-	}(cl.Name)
-
-	m.logger.Info("Started Slack client", "client", cl.Name)
+	return bot.Deliver(ctx, target, title, text)
 }
 
-func (m *clientManager) startDiscord(ctx context.Context, cl store.ClientDefinition) {
-	if cl.Config.Discord == nil {
-		return
-	}
+// deliveryRouter delivers cron results through other clients: running chat
+// bots post to a chat or channel, Direct clients get a voice UI
+// notification.
+type deliveryRouter struct {
+	store    *store.Store
+	bots     *clientManager
+	notifier *user.Notifier
+}
 
-	var agents []discordclient.AgentInfo
-	for _, agentID := range cl.AllowedAgents {
-		agentDef, ok := m.store.GetAgent(agentID)
-		if !ok {
-			if flowDef, ok := m.store.GetFlow(agentID); ok {
-				agents = append(agents, discordclient.AgentInfo{ID: agentID, Name: flowDef.Name})
-				continue
-			}
-			m.logger.Warn("Discord client references unknown agent", "client", cl.Name, "agent", agentID)
-			continue
-		}
-		agents = append(agents, discordclient.AgentInfo{ID: agentID, Name: agentDef.Name})
+func (d *deliveryRouter) Deliver(ctx context.Context, clientID, target, title, text string) error {
+	cl, ok := d.store.GetClient(clientID)
+	if !ok {
+		return fmt.Errorf("client %q not found", clientID)
 	}
-
-	if len(agents) == 0 {
-		m.logger.Warn("Discord client has no valid agents", "client", cl.Name)
-		return
+	if cl.Type == "direct" {
+		d.notifier.Publish(cl.ID, title, text)
+		return nil
 	}
-
-	dcClient, err := discordclient.New(cl, m.agentURL, agents, m.store, m.logger)
-	if err != nil {
-		m.logger.Error("Failed to create Discord client", "client", cl.Name, "error", err)
-		return
+	if target == "" {
+		return fmt.Errorf("no delivery target set for %s client %q", cl.Type, cl.Name)
 	}
-
-	clientCtx, cancel := context.WithCancel(ctx)
-	m.running[cl.ID] = &managedClient{stop: dcClient.Stop, cancel: cancel, hash: clientHash(cl)}
-
-	go func(name string) {
-		time.Sleep(500 * time.Millisecond)
-		if err := dcClient.Start(clientCtx); err != nil {
-			if clientCtx.Err() == nil {
-				m.logger.Error("Discord client error", "client", name, "error", err)
-			}
-		}
-	}(cl.Name)
-
-	m.logger.Info("Started Discord client", "client", cl.Name)
+	return d.bots.deliver(ctx, cl.ID, target, title, text)
 }
@@ -35,8 +35,11 @@ func AccessLog(next http.Handler) http.Handler {
 	})
 }
 
-// ClientAuth protects API endpoints with client token authentication.
-// Static files, health checks, CORS preflight, and voice-events pass through.
+// ClientAuth protects API endpoints (/api/ and the OpenAI-compatible /v1/)
+// with client token authentication. Static files, health checks and CORS
+// preflight pass through. Browsers can't set headers on WebSocket
+// handshakes, so the voice events WebSocket may also send the token as a
+// "bearer.<token>" subprotocol or a token query parameter.
 // If no clients exist in the store, all requests pass through (open mode).
 func ClientAuth(next http.Handler, dataStore *store.Store) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -44,10 +47,9 @@ func ClientAuth(next http.Handler, dataStore *store.Store) http.Handler {
 
 		if r.Method == http.MethodOptions ||
 			path == "/api/v1/health" ||
-			path == "/api/v1/voice/events" ||
 			(strings.HasPrefix(path, "/api/v1/a2a/") && strings.HasSuffix(path, "/.well-known/agent-card.json")) ||
 			strings.HasPrefix(path, "/api/v1/webhooks/") ||
-			!strings.HasPrefix(path, "/api/") {
+			(!strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/v1/")) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -59,6 +61,12 @@ func ClientAuth(next http.Handler, dataStore *store.Store) http.Handler {
 		}
 
 		token := r.Header.Get("Authorization")
+		if path == "/api/v1/voice/events" && !strings.HasPrefix(token, "Bearer ") {
+			if wsToken := webSocketToken(r); wsToken != "" {
+				token = "Bearer " + wsToken
+				r.Header.Set("Authorization", token)
+			}
+		}
 		hasToken := strings.HasPrefix(token, "Bearer ")
 
 		if hasToken {
@@ -157,6 +165,19 @@ func extractBearerToken(r *http.Request) string {
 	return ""
 }
 
+// webSocketToken returns the token of a WebSocket handshake sent as a
+// "bearer.<token>" subprotocol or a token query parameter.
+func webSocketToken(r *http.Request) string {
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), "bearer."); ok {
+				return token
+			}
+		}
+	}
+	return r.URL.Query().Get("token")
+}
+
 func extractIP(r *http.Request) string {
 	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
 		parts := strings.SplitN(fwd, ",", 2)
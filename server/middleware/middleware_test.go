@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+func TestWebSocketToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		protocols []string
+		query     string
+		want      string
+	}{
+		{"none", nil, "", ""},
+		{"subprotocol", []string{"magec.voice, bearer.mgc_abc"}, "", "mgc_abc"},
+		{"subprotocol alone", []string{"bearer.mgc_abc"}, "", "mgc_abc"},
+		{"subprotocol in a second header", []string{"magec.voice", " bearer.mgc_abc "}, "", "mgc_abc"},
+		{"other subprotocols only", []string{"magec.voice, chat"}, "", ""},
+		{"query", nil, "token=mgc_q", "mgc_q"},
+		{"subprotocol wins over query", []string{"bearer.mgc_abc"}, "token=mgc_q", "mgc_abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/voice/events?"+tt.query, nil)
+			for _, p := range tt.protocols {
+				r.Header.Add("Sec-WebSocket-Protocol", p)
+			}
+			if got := webSocketToken(r); got != tt.want {
+				t.Errorf("webSocketToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientAuthVoiceEvents(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "store.json"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := s.CreateClient(store.ClientDefinition{Name: "ui", Type: "direct", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var clientID string
+	h := ClientAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID = r.Header.Get("X-Client-ID")
+	}), s)
+
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		protocol string
+		want     int
+	}{
+		{"header", "/api/v1/voice/events", "Bearer " + cl.Token, "", http.StatusOK},
+		{"subprotocol", "/api/v1/voice/events", "", "magec.voice, bearer." + cl.Token, http.StatusOK},
+		{"query", "/api/v1/voice/events?token=" + cl.Token, "", "", http.StatusOK},
+		{"header wins over subprotocol", "/api/v1/voice/events", "Bearer " + cl.Token, "bearer.wrong", http.StatusOK},
+		{"wrong subprotocol token", "/api/v1/voice/events", "", "magec.voice, bearer.wrong", http.StatusUnauthorized},
+		{"wrong query token", "/api/v1/voice/events?token=wrong", "", "", http.StatusUnauthorized},
+		{"no token", "/api/v1/voice/events", "", "magec.voice", http.StatusUnauthorized},
+		{"query token on another endpoint", "/api/v1/agents?token=" + cl.Token, "", "", http.StatusUnauthorized},
+		{"subprotocol on another endpoint", "/api/v1/agents", "", "bearer." + cl.Token, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientID = ""
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.protocol != "" {
+				r.Header.Set("Sec-WebSocket-Protocol", tt.protocol)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusOK && clientID != cl.ID {
+				t.Errorf("X-Client-ID = %q, want %q", clientID, cl.ID)
+			}
+		})
+	}
+}
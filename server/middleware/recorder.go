@@ -223,6 +223,10 @@ func parseSSEEvents(raw string) []map[string]interface{} {
 		if err := json.Unmarshal([]byte(data), &event); err != nil {
 			continue
 		}
+		// Partial chunks of a streamed run are repeated by the final event.
+		if partial, _ := event["partial"].(bool); partial {
+			continue
+		}
 		events = append(events, event)
 	}
 	return events
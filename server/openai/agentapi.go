@@ -0,0 +1,126 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/achetronic/magec/server/clients/msgutil"
+)
+
+// agentAPI calls the internal agent API (ADK sessions and /run_sse) on
+// behalf of the client that made the request.
+type agentAPI struct {
+	baseURL string
+}
+
+// sessionExists reports whether the ADK session is already known.
+func (a *agentAPI) sessionExists(ctx context.Context, auth, agentID, userID, sessionID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", a.sessionURL(agentID, userID, sessionID), nil)
+	if err != nil {
+		return false, err
+	}
+	setAuth(req, auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to get session: status %d", resp.StatusCode)
+	}
+}
+
+// ensureSession creates the ADK session. An existing session is left as is.
+func (a *agentAPI) ensureSession(ctx context.Context, auth, agentID, userID, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.sessionURL(agentID, userID, sessionID), bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuth(req, auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		return fmt.Errorf("failed to create session: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// run sends a message to /run_sse and calls handler for each event as it
+// arrives. With streaming set, the agent also emits partial text events.
+func (a *agentAPI) run(ctx context.Context, auth, agentID, userID, sessionID string, parts []map[string]any, streaming bool, handler func(msgutil.SSEEvent)) error {
+	reqBody := map[string]any{
+		"appName":   agentID,
+		"userId":    userID,
+		"sessionId": sessionID,
+		"streaming": streaming,
+		"newMessage": map[string]any{
+			"role":  "user",
+			"parts": parts,
+		},
+	}
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/run_sse", bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	setAuth(req, auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("agent returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return msgutil.ParseSSEStream(resp.Body, handler)
+}
+
+func (a *agentAPI) sessionURL(agentID, userID, sessionID string) string {
+	return fmt.Sprintf("%s/apps/%s/users/%s/sessions/%s", a.baseURL,
+		url.PathEscape(agentID), url.PathEscape(userID), url.PathEscape(sessionID))
+}
+
+// setAuth forwards the caller's Authorization header so the agent API sees
+// the same client.
+func setAuth(req *http.Request, auth string) {
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+}
@@ -0,0 +1,441 @@
+package openai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/achetronic/magec/server/clients/msgutil"
+	"github.com/achetronic/magec/server/store"
+)
+
+// sessionHeader lets clients pin a request to an ADK session. The session
+// used is always echoed back in the response.
+const sessionHeader = "X-Session-ID"
+
+type chatRequest struct {
+	Model         string        `json:"model"`
+	Messages      []chatMessage `json:"messages"`
+	Stream        bool          `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	// User identifies the end user of the calling tool.
+	User string `json:"user"`
+	// Metadata may carry a conversation_id that pins the session.
+	Metadata map[string]any `json:"metadata"`
+}
+
+type chatMessage struct {
+	Role string `json:"role"`
+	// Content is a string or an array of content parts.
+	Content json.RawMessage `json:"content"`
+}
+
+type contentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+type completion struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []choice `json:"choices"`
+	Usage   *usage   `json:"usage,omitempty"`
+}
+
+type choice struct {
+	Index        int      `json:"index"`
+	Message      *message `json:"message,omitempty"`
+	Delta        *message `json:"delta,omitempty"`
+	FinishReason *string  `json:"finish_reason"`
+}
+
+type message struct {
+	Role    string  `json:"role,omitempty"`
+	Content *string `json:"content,omitempty"`
+	// Annotations carry the agent's tool activity. Tools run server-side,
+	// so they are reported here instead of as client-side tool_calls.
+	Annotations []annotation `json:"annotations,omitempty"`
+}
+
+// annotation describes one tool call or tool result made by the agent.
+type annotation struct {
+	Type      string `json:"type"` // "tool_call" or "tool_result"
+	Agent     string `json:"agent,omitempty"`
+	Name      string `json:"name"`
+	Arguments any    `json:"arguments,omitempty"`
+	Result    any    `json:"result,omitempty"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (h *Handler) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON: "+err.Error())
+		return
+	}
+	if req.Model == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "model is required")
+		return
+	}
+	if !slices.ContainsFunc(h.models(r), func(m model) bool { return m.ID == req.Model }) {
+		writeError(w, http.StatusNotFound, "invalid_request_error", "model "+req.Model+" not found")
+		return
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != "user" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "the last message must have role user")
+		return
+	}
+
+	last := req.Messages[len(req.Messages)-1]
+	text, images := last.parse()
+	if strings.TrimSpace(text) == "" && len(images) == 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "the last message is empty")
+		return
+	}
+
+	userID := "openai"
+	clientID := ""
+	if cl, ok := h.client(r); ok {
+		clientID = cl.ID
+		id, err := h.store.ResolveUser(store.IdentityClient, cl.ID, cl.Name)
+		if err != nil {
+			h.logger.Warn("Failed to resolve user identity", "client", cl.Name, "error", err)
+		}
+		if id != "" {
+			userID = id
+		}
+	}
+
+	auth := r.Header.Get("Authorization")
+	sessionID := deriveSessionID(r.Header.Get(sessionHeader), clientID, req)
+	exists, err := h.api.sessionExists(r.Context(), auth, req.Model, userID, sessionID)
+	if err != nil {
+		h.logger.Warn("Failed to look up session", "session", sessionID, "error", err)
+	}
+	if !exists {
+		if err := h.api.ensureSession(r.Context(), auth, req.Model, userID, sessionID); err != nil {
+			h.logger.Warn("Failed to ensure session, continuing anyway", "error", err)
+		}
+		// A new session doesn't know the earlier turns the client sent, so
+		// they are passed along as context.
+		text = historyBlock(req.Messages[:len(req.Messages)-1]) + text
+	}
+
+	parts := []map[string]any{{"text": text}}
+	parts = append(parts, images...)
+
+	w.Header().Set(sessionHeader, sessionID)
+	id := "chatcmpl-" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	run := func(t *translator) error {
+		return h.api.run(r.Context(), auth, req.Model, userID, sessionID, parts, req.Stream, t.handle)
+	}
+	if req.Stream {
+		h.stream(w, id, req, run)
+		return
+	}
+	h.complete(w, id, req, run)
+}
+
+// complete runs the agent and answers with a single chat.completion.
+func (h *Handler) complete(w http.ResponseWriter, id string, req chatRequest, run func(*translator) error) {
+	var content strings.Builder
+	var annotations []annotation
+	t := newTranslator(
+		func(s string) { content.WriteString(s) },
+		func(a annotation) { annotations = append(annotations, a) },
+	)
+	err := run(t)
+	if err == nil && t.errMsg != "" && content.Len() == 0 {
+		err = errors.New(t.errMsg)
+	}
+	if err != nil && content.Len() == 0 {
+		h.logger.Error("Chat completion failed", "model", req.Model, "error", err)
+		writeError(w, http.StatusBadGateway, "agent_error", err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Warn("Chat completion ended with an error", "model", req.Model, "error", err)
+	}
+
+	text := content.String()
+	finish := t.finishReason()
+	writeJSON(w, http.StatusOK, completion{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: now(),
+		Model:   req.Model,
+		Choices: []choice{{
+			Message:      &message{Role: "assistant", Content: &text, Annotations: annotations},
+			FinishReason: &finish,
+		}},
+		Usage: &t.usage,
+	})
+}
+
+// stream runs the agent and forwards its output as chat.completion.chunk
+// server-sent events.
+func (h *Handler) stream(w http.ResponseWriter, id string, req chatRequest, run func(*translator) error) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	created := now()
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunk := func(delta message, finish *string) completion {
+		return completion{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   req.Model,
+			Choices: []choice{{Delta: &delta, FinishReason: finish}},
+		}
+	}
+
+	empty := ""
+	send(chunk(message{Role: "assistant", Content: &empty}, nil))
+
+	t := newTranslator(
+		func(s string) { send(chunk(message{Content: &s}, nil)) },
+		func(a annotation) { send(chunk(message{Annotations: []annotation{a}}, nil)) },
+	)
+	err := run(t)
+	if err == nil && t.errMsg != "" && !t.wroteText {
+		err = errors.New(t.errMsg)
+	}
+	if err != nil {
+		h.logger.Error("Chat completion stream failed", "model", req.Model, "error", err)
+		send(errorBody{Error: errorDetail{Message: err.Error(), Type: "agent_error"}})
+	} else {
+		finish := t.finishReason()
+		send(chunk(message{}, &finish))
+		if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+			send(completion{
+				ID:      id,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   req.Model,
+				Choices: []choice{},
+				Usage:   &t.usage,
+			})
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// translator turns ADK events into completion text and annotations.
+type translator struct {
+	onText       func(string)
+	onAnnotation func(annotation)
+
+	// streamed marks authors whose partial text was already forwarded; the
+	// final event that repeats it is skipped.
+	streamed   map[string]bool
+	lastAuthor string
+	wroteText  bool
+	counted    map[string]bool
+
+	usage  usage
+	finish string
+	errMsg string
+}
+
+func newTranslator(onText func(string), onAnnotation func(annotation)) *translator {
+	return &translator{
+		onText:       onText,
+		onAnnotation: onAnnotation,
+		streamed:     make(map[string]bool),
+		counted:      make(map[string]bool),
+	}
+}
+
+func (t *translator) handle(evt msgutil.SSEEvent) {
+	switch evt.Type {
+	case msgutil.SSEEventText:
+		if !evt.Partial && t.streamed[evt.Author] {
+			delete(t.streamed, evt.Author)
+			break
+		}
+		if evt.Partial {
+			t.streamed[evt.Author] = true
+		}
+		// Separate the answers of different agents in a flow.
+		if t.wroteText && evt.Author != t.lastAuthor {
+			t.onText("\n\n")
+		}
+		t.lastAuthor = evt.Author
+		t.wroteText = true
+		t.onText(evt.Text)
+	case msgutil.SSEEventToolCall:
+		t.onAnnotation(annotation{Type: "tool_call", Agent: evt.Author, Name: evt.ToolName, Arguments: evt.ToolArgs})
+	case msgutil.SSEEventToolResult:
+		t.onAnnotation(annotation{Type: "tool_result", Agent: evt.Author, Name: evt.ToolName, Result: evt.ToolResult})
+	case msgutil.SSEEventError:
+		t.errMsg = msgutil.ExplainNoResponse(evt.FinishReason, evt.ErrorMessage)
+	}
+
+	if evt.Partial {
+		return
+	}
+	if evt.FinishReason != "" {
+		t.finish = evt.FinishReason
+	}
+	// One ADK event can yield several parsed events; count its usage once.
+	if um := evt.UsageMetadata; um != nil {
+		if eventID, _ := evt.Raw["id"].(string); eventID != "" {
+			if t.counted[eventID] {
+				return
+			}
+			t.counted[eventID] = true
+		}
+		t.usage.PromptTokens += um.PromptTokens
+		t.usage.CompletionTokens += um.CandidateTokens
+		t.usage.TotalTokens += um.TotalTokens
+	}
+}
+
+// finishReason maps the last ADK finish reason to OpenAI's values.
+func (t *translator) finishReason() string {
+	switch t.finish {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// parse returns a message's text and its inline images as ADK parts. Images
+// must be data URLs; remote URLs are not fetched.
+func (m chatMessage) parse() (string, []map[string]any) {
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		return s, nil
+	}
+	var parts []contentPart
+	if json.Unmarshal(m.Content, &parts) != nil {
+		return "", nil
+	}
+	var texts []string
+	var images []map[string]any
+	for _, p := range parts {
+		switch p.Type {
+		case "text":
+			texts = append(texts, p.Text)
+		case "image_url":
+			if p.ImageURL == nil {
+				continue
+			}
+			mimeType, data, ok := parseDataURL(p.ImageURL.URL)
+			if !ok {
+				continue
+			}
+			images = append(images, map[string]any{
+				"inlineData": map[string]any{"mimeType": mimeType, "data": data},
+			})
+		}
+	}
+	return strings.Join(texts, "\n"), images
+}
+
+// parseDataURL splits a base64 data URL into its MIME type and payload.
+func parseDataURL(u string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(u, "data:")
+	if !ok {
+		return "", "", false
+	}
+	header, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mimeType, ok := strings.CutSuffix(header, ";base64")
+	if !ok || mimeType == "" {
+		return "", "", false
+	}
+	return mimeType, data, true
+}
+
+// deriveSessionID picks the ADK session for a request. An explicit session
+// header wins, then a conversation_id in the request metadata. Otherwise the
+// session is derived from the opening of the conversation (every message up
+// to the second user message), which stays the same as the client resends
+// the growing history. A conversation with a single user message gets a
+// fresh session.
+//
+// A derived session is keyed by client, user, model and the opening text
+// only, so two conversations of the same user that open with the very same
+// turns share a session. Tools that can send a conversation ID or the user
+// field should, to keep them apart.
+func deriveSessionID(header, clientID string, req chatRequest) string {
+	if header != "" {
+		return header
+	}
+	if conv, _ := req.Metadata["conversation_id"].(string); conv != "" {
+		h := sha256.Sum256([]byte(clientID + "\x00" + req.Model + "\x00" + conv))
+		return "openai_" + hex.EncodeToString(h[:12])
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", clientID, req.User, req.Model)
+	users := 0
+	for _, m := range req.Messages {
+		text, _ := m.parse()
+		fmt.Fprintf(h, "%s\x00%s\x00", m.Role, text)
+		if m.Role == "user" {
+			users++
+			if users == 2 {
+				return "openai_" + hex.EncodeToString(h.Sum(nil)[:12])
+			}
+		}
+	}
+	return "openai_" + uuid.NewString()
+}
+
+// historyBlock renders earlier user and assistant turns as context for the
+// agent, in the same format chat bots use for thread history.
+func historyBlock(msgs []chatMessage) string {
+	var sb strings.Builder
+	for _, m := range msgs {
+		if m.Role != "user" && m.Role != "assistant" {
+			continue
+		}
+		text, _ := m.parse()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "[%s]: %s\n", m.Role, text)
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "<!--MAGEC_THREAD_HISTORY:\n" + sb.String() + ":MAGEC_THREAD_HISTORY-->\n"
+}
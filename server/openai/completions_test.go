@@ -0,0 +1,225 @@
+package openai
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/achetronic/magec/server/clients/msgutil"
+)
+
+func msg(role, content string) chatMessage {
+	data, _ := json.Marshal(content)
+	return chatMessage{Role: role, Content: data}
+}
+
+func TestDeriveSessionID(t *testing.T) {
+	opening := []chatMessage{msg("system", "Be brief."), msg("user", "hi"), msg("assistant", "hello"), msg("user", "weather?")}
+	grown := append(append([]chatMessage{}, opening...), msg("assistant", "sunny"), msg("user", "tomorrow?"))
+	req := func(user string, metadata map[string]any, msgs []chatMessage) chatRequest {
+		return chatRequest{Model: "helper", User: user, Metadata: metadata, Messages: msgs}
+	}
+
+	tests := []struct {
+		name     string
+		a, b     chatRequest
+		clientA  string
+		clientB  string
+		wantSame bool
+	}{
+		{"history grows", req("", nil, opening), req("", nil, grown), "c1", "c1", true},
+		{"other client", req("", nil, opening), req("", nil, opening), "c1", "c2", false},
+		{"other model", req("", nil, opening), chatRequest{Model: "coder", Messages: opening}, "c1", "c1", false},
+		{"other user", req("alice", nil, opening), req("bob", nil, opening), "c1", "c1", false},
+		{"other opening", req("", nil, opening), req("", nil, []chatMessage{msg("user", "hey"), msg("assistant", "hello"), msg("user", "weather?")}), "c1", "c1", false},
+		{
+			"same conversation ID, different history",
+			req("", map[string]any{"conversation_id": "chat-1"}, opening[:2]),
+			req("", map[string]any{"conversation_id": "chat-1"}, grown),
+			"c1", "c1", true,
+		},
+		{
+			"same opening, different conversation IDs",
+			req("", map[string]any{"conversation_id": "chat-1"}, opening),
+			req("", map[string]any{"conversation_id": "chat-2"}, opening),
+			"c1", "c1", false,
+		},
+		{
+			"conversation ID of another client",
+			req("", map[string]any{"conversation_id": "chat-1"}, opening),
+			req("", map[string]any{"conversation_id": "chat-1"}, opening),
+			"c1", "c2", false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := deriveSessionID("", tt.clientA, tt.a)
+			b := deriveSessionID("", tt.clientB, tt.b)
+			if (a == b) != tt.wantSame {
+				t.Errorf("sessions %q and %q, want same = %v", a, b, tt.wantSame)
+			}
+			if !strings.HasPrefix(a, "openai_") {
+				t.Errorf("session %q lacks the openai_ prefix", a)
+			}
+		})
+	}
+
+	if got := deriveSessionID("mine", "c1", req("", map[string]any{"conversation_id": "chat-1"}, opening)); got != "mine" {
+		t.Errorf("header session = %q, want mine", got)
+	}
+	single := req("", nil, []chatMessage{msg("user", "hi")})
+	if deriveSessionID("", "c1", single) == deriveSessionID("", "c1", single) {
+		t.Error("single-turn requests share a session")
+	}
+	if a, b := deriveSessionID("", "c1", req("", map[string]any{"conversation_id": 7}, single.Messages)), deriveSessionID("", "c1", single); a == b {
+		t.Error("a non-string conversation_id pinned the session")
+	}
+}
+
+func TestHistoryBlock(t *testing.T) {
+	parts := chatMessage{Role: "user", Content: json.RawMessage(`[{"type":"text","text":"look"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}}]`)}
+	tests := []struct {
+		name string
+		msgs []chatMessage
+		want string
+	}{
+		{"empty", nil, ""},
+		{"only system", []chatMessage{msg("system", "Be brief.")}, ""},
+		{
+			"turns",
+			[]chatMessage{msg("system", "Be brief."), msg("user", "hi"), msg("assistant", "hello"), msg("tool", "{}"), msg("assistant", "  "), parts},
+			"<!--MAGEC_THREAD_HISTORY:\n[user]: hi\n[assistant]: hello\n[user]: look\n:MAGEC_THREAD_HISTORY-->\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := historyBlock(tt.msgs); got != tt.want {
+				t.Errorf("historyBlock() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDataURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		mimeType string
+		data     string
+		ok       bool
+	}{
+		{"data:image/png;base64,iVBORw0KGgo=", "image/png", "iVBORw0KGgo=", true},
+		{"data:image/jpeg;base64,", "image/jpeg", "", true},
+		{"https://example.com/cat.png", "", "", false},
+		{"data:image/png,rawbytes", "", "", false},
+		{"data:;base64,AAAA", "", "", false},
+		{"data:image/png;base64", "", "", false},
+	}
+	for _, tt := range tests {
+		mimeType, data, ok := parseDataURL(tt.url)
+		if mimeType != tt.mimeType || data != tt.data || ok != tt.ok {
+			t.Errorf("parseDataURL(%q) = %q, %q, %v, want %q, %q, %v", tt.url, mimeType, data, ok, tt.mimeType, tt.data, tt.ok)
+		}
+	}
+}
+
+func TestTranslator(t *testing.T) {
+	text := func(author, s string, partial bool) msgutil.SSEEvent {
+		return msgutil.SSEEvent{Type: msgutil.SSEEventText, Author: author, Text: s, Partial: partial}
+	}
+	withUsage := func(evt msgutil.SSEEvent, id string, prompt, completion int) msgutil.SSEEvent {
+		evt.Raw = map[string]interface{}{"id": id}
+		evt.UsageMetadata = &msgutil.UsageMetadata{PromptTokens: prompt, CandidateTokens: completion, TotalTokens: prompt + completion}
+		return evt
+	}
+
+	tests := []struct {
+		name        string
+		events      []msgutil.SSEEvent
+		text        string
+		annotations int
+		usage       usage
+		finish      string
+	}{
+		{
+			name:   "final only",
+			events: []msgutil.SSEEvent{withUsage(text("helper", "Hello.", false), "e1", 10, 2)},
+			text:   "Hello.",
+			usage:  usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+			finish: "stop",
+		},
+		{
+			name: "partials are not repeated by the final event",
+			events: []msgutil.SSEEvent{
+				text("helper", "Hel", true),
+				text("helper", "lo.", true),
+				withUsage(text("helper", "Hello.", false), "e1", 10, 2),
+			},
+			text:   "Hello.",
+			usage:  usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+			finish: "stop",
+		},
+		{
+			name: "flow agents are separated",
+			events: []msgutil.SSEEvent{
+				text("researcher", "Found it.", true),
+				text("researcher", "Found it.", false),
+				text("writer", "Here it is.", false),
+			},
+			text:   "Found it.\n\nHere it is.",
+			finish: "stop",
+		},
+		{
+			name: "usage counted once per ADK event",
+			events: []msgutil.SSEEvent{
+				withUsage(msgutil.SSEEvent{Type: msgutil.SSEEventToolCall, Author: "helper", ToolName: "get_forecast"}, "e1", 10, 3),
+				withUsage(msgutil.SSEEvent{Type: msgutil.SSEEventToolCall, Author: "helper", ToolName: "get_time"}, "e1", 10, 3),
+				withUsage(msgutil.SSEEvent{Type: msgutil.SSEEventToolResult, Author: "helper", ToolName: "get_forecast"}, "e2", 0, 0),
+				withUsage(text("helper", "Sunny.", false), "e3", 20, 2),
+			},
+			text:        "Sunny.",
+			annotations: 3,
+			usage:       usage{PromptTokens: 30, CompletionTokens: 5, TotalTokens: 35},
+			finish:      "stop",
+		},
+		{
+			name: "partial usage is ignored",
+			events: []msgutil.SSEEvent{
+				withUsage(text("helper", "Long", true), "e1", 10, 1),
+				func() msgutil.SSEEvent {
+					e := withUsage(text("helper", "Long", false), "e1", 10, 50)
+					e.FinishReason = "MAX_TOKENS"
+					return e
+				}(),
+			},
+			text:   "Long",
+			usage:  usage{PromptTokens: 10, CompletionTokens: 50, TotalTokens: 60},
+			finish: "length",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			var annotations []annotation
+			tr := newTranslator(
+				func(s string) { sb.WriteString(s) },
+				func(a annotation) { annotations = append(annotations, a) },
+			)
+			for _, evt := range tt.events {
+				tr.handle(evt)
+			}
+			if got := sb.String(); got != tt.text {
+				t.Errorf("text = %q, want %q", got, tt.text)
+			}
+			if len(annotations) != tt.annotations {
+				t.Errorf("got %d annotations, want %d", len(annotations), tt.annotations)
+			}
+			if !reflect.DeepEqual(tr.usage, tt.usage) {
+				t.Errorf("usage = %+v, want %+v", tr.usage, tt.usage)
+			}
+			if got := tr.finishReason(); got != tt.finish {
+				t.Errorf("finish reason = %q, want %q", got, tt.finish)
+			}
+		})
+	}
+}
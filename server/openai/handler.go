@@ -0,0 +1,139 @@
+// Package openai serves an OpenAI-compatible Chat Completions API in front
+// of Magec agents and flows, for tools that only speak /v1/chat/completions.
+package openai
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+// Handler serves /v1/models and /v1/chat/completions. Each agent or flow
+// the calling client is allowed to use is exposed as a model. Requests are
+// run through the internal agent API with the caller's token, so they are
+// recorded and filtered like any other client call.
+type Handler struct {
+	store  *store.Store
+	api    *agentAPI
+	logger *slog.Logger
+	router *mux.Router
+}
+
+// NewHandler creates the OpenAI-compatible handler. agentURL is the base URL
+// of the agent API (e.g. "http://127.0.0.1:8080/api/v1/agent").
+func NewHandler(s *store.Store, agentURL string, logger *slog.Logger) *Handler {
+	h := &Handler{
+		store:  s,
+		api:    &agentAPI{baseURL: agentURL},
+		logger: logger,
+	}
+	h.router = mux.NewRouter()
+	h.router.HandleFunc("/v1/models", h.listModels).Methods("GET")
+	h.router.HandleFunc("/v1/models/{id}", h.getModel).Methods("GET")
+	h.router.HandleFunc("/v1/chat/completions", h.chatCompletions).Methods("POST")
+	h.router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "invalid_request_error", "unknown endpoint "+r.URL.Path)
+	})
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.router.ServeHTTP(w, r)
+}
+
+type model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+	// Name is not part of the OpenAI schema but is shown by clients such as
+	// Open WebUI.
+	Name string `json:"name,omitempty"`
+}
+
+type modelList struct {
+	Object string  `json:"object"`
+	Data   []model `json:"data"`
+}
+
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+func (h *Handler) listModels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, modelList{Object: "list", Data: h.models(r)})
+}
+
+func (h *Handler) getModel(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	for _, m := range h.models(r) {
+		if m.ID == id {
+			writeJSON(w, http.StatusOK, m)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "invalid_request_error", "model "+id+" not found")
+}
+
+// models lists the agents and flows the calling client may use. Without a
+// client (no clients configured yet) every agent and flow is listed.
+func (h *Handler) models(r *http.Request) []model {
+	models := []model{}
+	add := func(id, name string) {
+		models = append(models, model{ID: id, Object: "model", OwnedBy: "magec", Name: name})
+	}
+
+	if cl, ok := h.client(r); ok {
+		for _, id := range cl.AllowedAgents {
+			if a, ok := h.store.GetAgent(id); ok {
+				add(a.ID, a.Name)
+			} else if f, ok := h.store.GetFlow(id); ok {
+				add(f.ID, f.Name)
+			}
+		}
+		return models
+	}
+	for _, a := range h.store.ListAgents() {
+		add(a.ID, a.Name)
+	}
+	for _, f := range h.store.ListFlows() {
+		add(f.ID, f.Name)
+	}
+	return models
+}
+
+// client returns the client authenticated by the ClientAuth middleware.
+func (h *Handler) client(r *http.Request) (store.ClientDefinition, bool) {
+	id := r.Header.Get("X-Client-ID")
+	if id == "" {
+		return store.ClientDefinition{}, false
+	}
+	return h.store.GetClient(id)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the OpenAI error format.
+func writeError(w http.ResponseWriter, status int, errType, msg string) {
+	writeJSON(w, status, errorBody{Error: errorDetail{Message: msg, Type: errType}})
+}
+
+func now() int64 {
+	return time.Now().Unix()
+}
@@ -1,15 +1,24 @@
 package store
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Conversation log backends.
+const (
+	ConversationBackendSQLite   = "sqlite"
+	ConversationBackendPostgres = "postgres"
 )
 
 // ConversationMessage represents a single message in a conversation.
@@ -49,90 +58,148 @@ type Conversation struct {
 	Preview     string                `json:"preview,omitempty"`
 	ParentID    string                `json:"parentId,omitempty"`
 	RawEvents   []interface{}         `json:"rawEvents,omitempty"`
+	Snippets    []SearchSnippet       `json:"snippets,omitempty"` // set by ListFiltered when searching
+}
+
+// ConversationFilter narrows down List results. Empty fields match everything.
+// AgentID matches either the conversation's agent or its flow.
+type ConversationFilter struct {
+	AgentID     string
+	Source      string
+	ClientID    string
+	Perspective string
+	From        time.Time // inclusive, zero = unbounded
+	To          time.Time // exclusive, zero = unbounded
+	Query       string    // full-text search over message content and tool calls
 }
 
-// ConversationStore manages conversation logs with JSON persistence.
+// ConversationStats holds aggregate counts over the conversation log.
+type ConversationStats struct {
+	Total     int            `json:"total"`
+	BySources map[string]int `json:"bySources"`
+	ByAgents  map[string]int `json:"byAgents"`
+}
+
+// ConversationStore manages conversation logs in a SQL database. Conversation
+// headers live in an indexed table; messages and raw events are stored as
+// append-only rows so neither listing nor appending touches the whole log.
 type ConversationStore struct {
-	mu            sync.RWMutex
-	conversations []Conversation
-	filePath      string
+	mu      sync.RWMutex
+	db      *sql.DB
+	backend string
+	dsn     string
 }
 
-// NewConversationStore creates a conversation store backed by a JSON file.
-func NewConversationStore(filePath string) (*ConversationStore, error) {
-	cs := &ConversationStore{
-		conversations: []Conversation{},
-		filePath:      filePath,
+// NewConversationStore opens the conversation log. backend is "sqlite"
+// (default) or "postgres". For SQLite, dsn is a file path (":memory:" keeps
+// the log in memory); for Postgres it is a connection string.
+func NewConversationStore(backend, dsn string) (*ConversationStore, error) {
+	if backend == "" {
+		backend = ConversationBackendSQLite
+	}
+	if backend != ConversationBackendSQLite && backend != ConversationBackendPostgres {
+		return nil, fmt.Errorf("unsupported conversation backend %q", backend)
+	}
+	cs := &ConversationStore{backend: backend, dsn: dsn}
+	if err := cs.open(); err != nil {
+		return nil, err
 	}
+	return cs, nil
+}
 
-	if filePath != "" {
-		if _, err := os.Stat(filePath); err == nil {
-			if err := cs.loadFromDisk(); err != nil {
-				return nil, fmt.Errorf("failed to load conversations from %s: %w", filePath, err)
-			}
-		}
+// Close releases the underlying database connection.
+func (cs *ConversationStore) Close() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.db.Close()
+}
+
+// File returns the database file of a SQLite log, or "" for Postgres and
+// in-memory logs.
+func (cs *ConversationStore) File() string {
+	if cs.backend != ConversationBackendSQLite || cs.dsn == ":memory:" {
+		return ""
 	}
+	return cs.dsn
+}
 
-	return cs, nil
+// Snapshot writes a consistent copy of a SQLite log to path using VACUUM
+// INTO, which is safe while the log is being written. path must not exist.
+// Postgres logs are backed up with pg_dump instead.
+func (cs *ConversationStore) Snapshot(path string) error {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if cs.backend != ConversationBackendSQLite {
+		return fmt.Errorf("snapshots are not supported for the %s backend, use its own backup tools", cs.backend)
+	}
+	if _, err := cs.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("failed to snapshot conversations: %w", err)
+	}
+	return nil
 }
 
 // Append adds a new conversation to the store.
 func (cs *ConversationStore) Append(c Conversation) (Conversation, error) {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 
 	if c.ID == "" {
 		c.ID = generateID()
 	}
-	cs.conversations = append(cs.conversations, c)
 
-	if err := cs.persist(); err != nil {
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return c, err
+	}
+	defer tx.Rollback()
+
+	if err := cs.insertConversation(tx, c); err != nil {
 		return c, err
 	}
+	if err := tx.Commit(); err != nil {
+		return c, fmt.Errorf("failed to save conversation: %w", err)
+	}
 	return c, nil
 }
 
 // AppendMessage adds a message to an existing conversation.
 func (cs *ConversationStore) AppendMessage(conversationID string, msg ConversationMessage) error {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 
-	for i := range cs.conversations {
-		if cs.conversations[i].ID == conversationID {
-			cs.conversations[i].Messages = append(cs.conversations[i].Messages, msg)
-			return cs.persist()
-		}
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("conversation %q not found", conversationID)
+	defer tx.Rollback()
+
+	if err := cs.appendRows(tx, conversationID, []ConversationMessage{msg}, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // EndConversation marks a conversation as ended.
 func (cs *ConversationStore) EndConversation(conversationID string) error {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
-
-	for i := range cs.conversations {
-		if cs.conversations[i].ID == conversationID {
-			now := time.Now()
-			cs.conversations[i].EndedAt = &now
-			return cs.persist()
-		}
-	}
-	return fmt.Errorf("conversation %q not found", conversationID)
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.execOne(conversationID, `UPDATE conversations SET ended_at = ? WHERE id = ?`, time.Now().UnixNano(), conversationID)
 }
 
 // SetSummary sets the summary for a conversation (used by future summarization feature).
 func (cs *ConversationStore) SetSummary(conversationID, summary string) error {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.execOne(conversationID, `UPDATE conversations SET summary = ? WHERE id = ?`, summary, conversationID)
+}
 
-	for i := range cs.conversations {
-		if cs.conversations[i].ID == conversationID {
-			cs.conversations[i].Summary = summary
-			return cs.persist()
-		}
-	}
-	return fmt.Errorf("conversation %q not found", conversationID)
+// ReassignUser moves every conversation owned by fromUserID to toUserID.
+// Used when two users are merged so the audit log follows the surviving user.
+func (cs *ConversationStore) ReassignUser(fromUserID, toUserID string) error {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	_, err := cs.db.Exec(cs.rebind(`UPDATE conversations SET user_id = ? WHERE user_id = ?`), toUserID, fromUserID)
+	return err
 }
 
 // PaginatedResult wraps a paginated response with total count.
@@ -143,235 +210,721 @@ type PaginatedResult[T any] struct {
 
 // List returns conversations sorted by start time (newest first) with pagination.
 // Optional filters: agentID, source, clientID. Use limit=0 for no limit.
-func (cs *ConversationStore) List(agentID, source, clientID, perspective string, limit, offset int) PaginatedResult[Conversation] {
+func (cs *ConversationStore) List(agentID, source, clientID, perspective string, limit, offset int) (PaginatedResult[Conversation], error) {
+	return cs.ListFiltered(ConversationFilter{
+		AgentID:     agentID,
+		Source:      source,
+		ClientID:    clientID,
+		Perspective: perspective,
+	}, limit, offset)
+}
+
+// ListFiltered is like List but also supports a time range on StartedAt and
+// full-text search. Items carry a preview instead of messages and raw events;
+// when searching they also carry highlighted snippets of the matches.
+func (cs *ConversationStore) ListFiltered(f ConversationFilter, limit, offset int) (PaginatedResult[Conversation], error) {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
-	var filtered []Conversation
-	for _, c := range cs.conversations {
-		if agentID != "" && c.AgentID != agentID && c.FlowID != agentID {
-			continue
+	result := PaginatedResult[Conversation]{Items: []Conversation{}}
+	where, args, match := cs.filterWhere(f)
+
+	if err := cs.db.QueryRow(cs.rebind(`SELECT COUNT(*) FROM conversations`+where), args...).Scan(&result.Total); err != nil {
+		return result, fmt.Errorf("failed to count conversations: %w", err)
+	}
+
+	query := `SELECT ` + conversationColumns + ` FROM conversations` + where + ` ORDER BY started_at DESC` + cs.limitClause(limit, offset)
+	rows, err := cs.db.Query(cs.rebind(query), args...)
+	if err != nil {
+		return result, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return result, fmt.Errorf("failed to read conversation: %w", err)
 		}
-		if source != "" && c.Source != source {
-			continue
+		result.Items = append(result.Items, c)
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	rows.Close() // free the connection for the snippet query
+
+	if match != "" {
+		if err := cs.attachSnippets(result.Items, f.Query, match); err != nil {
+			return result, fmt.Errorf("failed to read search snippets: %w", err)
 		}
-		if clientID != "" && c.ClientID != clientID {
-			continue
+	}
+	return result, nil
+}
+
+// exportBatchSize is how many conversation headers Each reads per query.
+const exportBatchSize = 100
+
+// Each calls fn for every conversation matching f, oldest first, with all of
+// its messages loaded (and raw events when withEvents is set). Conversations
+// are loaded one at a time so exports of any size run in constant memory.
+// Iteration stops at the first error returned by fn.
+func (cs *ConversationStore) Each(f ConversationFilter, withEvents bool, fn func(Conversation) error) error {
+	var lastStarted int64
+	var lastID string
+	first := true
+	for {
+		ids, err := cs.nextBatch(f, first, lastStarted, lastID)
+		if err != nil {
+			return err
 		}
-		if perspective != "" && c.Perspective != perspective {
-			continue
+		for _, h := range ids {
+			c, _, ok := cs.load(h.id, 0, 0, withEvents)
+			if !ok {
+				continue
+			}
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		if len(ids) < exportBatchSize {
+			return nil
 		}
-		cCopy := c
-		cCopy.Preview = conversationPreview(c.Messages)
-		cCopy.Messages = nil
-		cCopy.RawEvents = nil
-		filtered = append(filtered, cCopy)
+		first = false
+		lastStarted, lastID = ids[len(ids)-1].startedAt, ids[len(ids)-1].id
 	}
+}
 
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].StartedAt.After(filtered[j].StartedAt)
-	})
+type conversationKey struct {
+	id        string
+	startedAt int64
+}
+
+// nextBatch returns the next page of conversation keys after (lastStarted,
+// lastID) in (started_at, id) order. Keyset pagination keeps the walk stable
+// while new conversations are being appended.
+func (cs *ConversationStore) nextBatch(f ConversationFilter, first bool, lastStarted int64, lastID string) ([]conversationKey, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 
-	total := len(filtered)
+	where, args, _ := cs.filterWhere(f)
+	if !first {
+		cond := `(started_at > ? OR (started_at = ? AND id > ?))`
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		args = append(args, lastStarted, lastStarted, lastID)
+	}
+
+	rows, err := cs.db.Query(cs.rebind(`SELECT id, started_at FROM conversations`+where+` ORDER BY started_at, id`+cs.limitClause(exportBatchSize, 0)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	if offset > total {
-		offset = total
+	var keys []conversationKey
+	for rows.Next() {
+		var k conversationKey
+		if err := rows.Scan(&k.id, &k.startedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
 	}
-	filtered = filtered[offset:]
+	return keys, rows.Err()
+}
+
+// Stats returns the total number of conversations and breakdowns by source
+// and agent (keyed by agent name when known).
+func (cs *ConversationStore) Stats() (ConversationStats, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 
-	if limit > 0 && limit < len(filtered) {
-		filtered = filtered[:limit]
+	stats := ConversationStats{BySources: map[string]int{}, ByAgents: map[string]int{}}
+
+	err := cs.countBy(`SELECT source, COUNT(*) FROM conversations GROUP BY source`, func(source string, n int) {
+		stats.BySources[source] = n
+		stats.Total += n
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to count conversations by source: %w", err)
 	}
 
-	if filtered == nil {
-		filtered = []Conversation{}
+	err = cs.countBy(`SELECT CASE WHEN agent_name <> '' THEN agent_name ELSE agent_id END AS agent, COUNT(*) FROM conversations GROUP BY agent`, func(agent string, n int) {
+		stats.ByAgents[agent] = n
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to count conversations by agent: %w", err)
 	}
+	return stats, nil
+}
 
-	return PaginatedResult[Conversation]{Items: filtered, Total: total}
+// countBy runs a two-column "key, COUNT(*)" query and calls fn for each row.
+// Caller must hold cs.mu.
+func (cs *ConversationStore) countBy(query string, fn func(key string, n int)) error {
+	rows, err := cs.db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var n int
+		if err := rows.Scan(&key, &n); err != nil {
+			return err
+		}
+		fn(key, n)
+	}
+	return rows.Err()
 }
 
 // FindBySession returns the most recent conversation matching the given
 // sessionID, agentID, and perspective. This is used to append messages to an
 // existing conversation instead of creating a new one for every /run call.
+// The returned conversation does not include messages or raw events.
 func (cs *ConversationStore) FindBySession(sessionID, agentID, perspective string) (Conversation, bool) {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
-	for i := len(cs.conversations) - 1; i >= 0; i-- {
-		c := cs.conversations[i]
-		if c.SessionID == sessionID && c.AgentID == agentID && c.Perspective == perspective {
-			return c, true
-		}
+	row := cs.db.QueryRow(cs.rebind(`SELECT `+conversationColumns+` FROM conversations
+		WHERE session_id = ? AND agent_id = ? AND perspective = ?
+		ORDER BY started_at DESC LIMIT 1`), sessionID, agentID, perspective)
+	c, err := scanConversation(row)
+	if err != nil {
+		return Conversation{}, false
 	}
-	return Conversation{}, false
+	c.Preview = ""
+	return c, true
 }
 
 // AppendMessages adds multiple messages and raw events to an existing conversation.
 func (cs *ConversationStore) AppendMessages(conversationID string, msgs []ConversationMessage, rawEvents []interface{}) error {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 
-	for i := range cs.conversations {
-		if cs.conversations[i].ID == conversationID {
-			cs.conversations[i].Messages = append(cs.conversations[i].Messages, msgs...)
-			cs.conversations[i].RawEvents = append(cs.conversations[i].RawEvents, rawEvents...)
-			now := time.Now()
-			cs.conversations[i].EndedAt = &now
-			return cs.persist()
-		}
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := cs.appendRows(tx, conversationID, msgs, rawEvents); err != nil {
+		return err
 	}
-	return fmt.Errorf("conversation %q not found", conversationID)
+	if _, err := tx.Exec(cs.rebind(`UPDATE conversations SET ended_at = ? WHERE id = ?`), time.Now().UnixNano(), conversationID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Get returns a single conversation by ID. If msgLimit > 0, only the latest
 // msgLimit messages starting from msgOffset (counted from the end) are returned,
 // along with totalMessages so the client can paginate.
 func (cs *ConversationStore) Get(id string, msgLimit, msgOffset int) (Conversation, int, bool) {
+	return cs.load(id, msgLimit, msgOffset, true)
+}
+
+// load reads a conversation with a window of its messages and, optionally,
+// the matching window of raw events. Returns the total message count.
+func (cs *ConversationStore) load(id string, msgLimit, msgOffset int, withEvents bool) (Conversation, int, bool) {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
-	for _, c := range cs.conversations {
-		if c.ID == id {
-			totalMsgs := len(c.Messages)
-			totalEvents := len(c.RawEvents)
-
-			if msgLimit > 0 {
-				end := totalMsgs - msgOffset
-				if end < 0 {
-					end = 0
-				}
-				start := end - msgLimit
-				if start < 0 {
-					start = 0
-				}
-				c.Messages = c.Messages[start:end]
-
-				evEnd := totalEvents - msgOffset
-				if evEnd < 0 {
-					evEnd = 0
-				}
-				evStart := evEnd - msgLimit
-				if evStart < 0 {
-					evStart = 0
-				}
-				c.RawEvents = c.RawEvents[evStart:evEnd]
-			}
+	var msgCount, evCount int
+	row := cs.db.QueryRow(cs.rebind(`SELECT `+conversationColumns+`, message_count, event_count FROM conversations WHERE id = ?`), id)
+	c, err := scanConversation(row, &msgCount, &evCount)
+	if err != nil {
+		return Conversation{}, 0, false
+	}
+	c.Preview = ""
+
+	msgStart, msgEnd := 0, msgCount
+	evStart, evEnd := 0, evCount
+	if msgLimit > 0 {
+		msgStart, msgEnd = tailWindow(msgCount, msgLimit, msgOffset)
+		evStart, evEnd = tailWindow(evCount, msgLimit, msgOffset)
+	}
 
-			return c, totalMsgs, true
+	c.Messages = []ConversationMessage{}
+	if err := cs.loadRows("conversation_messages", id, msgStart, msgEnd, func(data []byte) error {
+		var m ConversationMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
 		}
+		c.Messages = append(c.Messages, m)
+		return nil
+	}); err != nil {
+		return Conversation{}, 0, false
+	}
+
+	if !withEvents {
+		return c, msgCount, true
 	}
-	return Conversation{}, 0, false
+	if err := cs.loadRows("conversation_events", id, evStart, evEnd, func(data []byte) error {
+		var ev interface{}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return err
+		}
+		c.RawEvents = append(c.RawEvents, ev)
+		return nil
+	}); err != nil {
+		return Conversation{}, 0, false
+	}
+
+	return c, msgCount, true
 }
 
 // Delete removes a conversation and its paired perspective (user↔admin).
 func (cs *ConversationStore) Delete(id string) error {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 
 	var sessionID, agentID string
-	found := false
-	for _, c := range cs.conversations {
-		if c.ID == id {
-			sessionID = c.SessionID
-			agentID = c.AgentID
-			found = true
-			break
-		}
-	}
-	if !found {
+	err := cs.db.QueryRow(cs.rebind(`SELECT session_id, agent_id FROM conversations WHERE id = ?`), id).Scan(&sessionID, &agentID)
+	if err == sql.ErrNoRows {
 		return fmt.Errorf("conversation %q not found", id)
 	}
+	if err != nil {
+		return err
+	}
 
-	filtered := cs.conversations[:0]
-	for _, c := range cs.conversations {
-		if c.ID == id || (c.SessionID == sessionID && c.AgentID == agentID) {
-			continue
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	match := `SELECT id FROM conversations WHERE id = ? OR (session_id = ? AND agent_id = ?)`
+	for _, table := range conversationRowTables {
+		if _, err := tx.Exec(cs.rebind(`DELETE FROM `+table+` WHERE conversation_id IN (`+match+`)`), id, sessionID, agentID); err != nil {
+			return err
 		}
-		filtered = append(filtered, c)
 	}
-	cs.conversations = filtered
-	return cs.persist()
+	if _, err := tx.Exec(cs.rebind(`DELETE FROM conversations WHERE id = ? OR (session_id = ? AND agent_id = ?)`), id, sessionID, agentID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Clear removes all conversations.
 func (cs *ConversationStore) Clear() error {
-	cs.mu.Lock()
-	defer cs.mu.Unlock()
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	cs.conversations = []Conversation{}
-	return cs.persist()
+	for _, table := range append(conversationRowTables, "conversations") {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 // Count returns the total number of conversations.
 func (cs *ConversationStore) Count() int {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
-	return len(cs.conversations)
+
+	var n int
+	if err := cs.db.QueryRow(`SELECT COUNT(*) FROM conversations`).Scan(&n); err != nil {
+		return 0
+	}
+	return n
 }
 
-// Reload re-reads conversations from disk, replacing all in-memory data.
+// Reload reopens the conversation database. After a backup restore has
+// replaced the SQLite file on disk, this makes the store pick up the new data.
+// For Postgres the connection is simply re-established.
 func (cs *ConversationStore) Reload() error {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
-	cs.conversations = []Conversation{}
-	if cs.filePath != "" {
-		if _, err := os.Stat(cs.filePath); err == nil {
-			return cs.loadFromDisk()
+
+	if cs.db != nil {
+		cs.db.Close()
+	}
+	return cs.open()
+}
+
+// ImportLegacyJSON imports conversations from the JSON file used by earlier
+// versions (data/conversations.json). Conversations whose ID already exists
+// are skipped. On success the file is renamed with a ".imported" suffix so it
+// is not imported again. Returns the number of conversations imported.
+func (cs *ConversationStore) ImportLegacyJSON(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var convos []Conversation
+	if err := json.Unmarshal(data, &convos); err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	cs.mu.RLock()
+	imported := 0
+	for _, c := range convos {
+		var exists int
+		if err := cs.db.QueryRow(cs.rebind(`SELECT COUNT(*) FROM conversations WHERE id = ?`), c.ID).Scan(&exists); err != nil {
+			cs.mu.RUnlock()
+			return imported, err
+		}
+		if exists > 0 {
+			continue
+		}
+		tx, err := cs.db.Begin()
+		if err != nil {
+			cs.mu.RUnlock()
+			return imported, err
+		}
+		if err := cs.insertConversation(tx, c); err != nil {
+			tx.Rollback()
+			cs.mu.RUnlock()
+			return imported, err
+		}
+		if err := tx.Commit(); err != nil {
+			cs.mu.RUnlock()
+			return imported, err
 		}
+		imported++
+	}
+	cs.mu.RUnlock()
+
+	if err := os.Rename(path, path+".imported"); err != nil {
+		return imported, fmt.Errorf("failed to rename %s: %w", path, err)
+	}
+	return imported, nil
+}
+
+// --- SQL (internal) ---
+
+const conversationColumns = `id, session_id, agent_id, agent_name, flow_id, flow_name, client_id, client_name,
+	source, perspective, user_id, summary, preview, parent_id, started_at, ended_at`
+
+var conversationSchema = []string{
+	`CREATE TABLE IF NOT EXISTS conversations (
+		id            TEXT PRIMARY KEY,
+		session_id    TEXT NOT NULL DEFAULT '',
+		agent_id      TEXT NOT NULL DEFAULT '',
+		agent_name    TEXT NOT NULL DEFAULT '',
+		flow_id       TEXT NOT NULL DEFAULT '',
+		flow_name     TEXT NOT NULL DEFAULT '',
+		client_id     TEXT NOT NULL DEFAULT '',
+		client_name   TEXT NOT NULL DEFAULT '',
+		source        TEXT NOT NULL DEFAULT '',
+		perspective   TEXT NOT NULL DEFAULT '',
+		user_id       TEXT NOT NULL DEFAULT '',
+		summary       TEXT NOT NULL DEFAULT '',
+		preview       TEXT NOT NULL DEFAULT '',
+		parent_id     TEXT NOT NULL DEFAULT '',
+		started_at    BIGINT NOT NULL,
+		ended_at      BIGINT,
+		message_count INTEGER NOT NULL DEFAULT 0,
+		event_count   INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_conversations_started ON conversations (started_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_conversations_agent ON conversations (agent_id, started_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_conversations_flow ON conversations (flow_id, started_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_conversations_client ON conversations (client_id, started_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_conversations_source ON conversations (source, started_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_conversations_session ON conversations (session_id, agent_id, perspective)`,
+	`CREATE INDEX IF NOT EXISTS idx_conversations_user ON conversations (user_id)`,
+	`CREATE TABLE IF NOT EXISTS conversation_messages (
+		conversation_id TEXT NOT NULL,
+		seq             INTEGER NOT NULL,
+		data            TEXT NOT NULL,
+		PRIMARY KEY (conversation_id, seq)
+	)`,
+	`CREATE TABLE IF NOT EXISTS conversation_events (
+		conversation_id TEXT NOT NULL,
+		seq             INTEGER NOT NULL,
+		data            TEXT NOT NULL,
+		PRIMARY KEY (conversation_id, seq)
+	)`,
+}
+
+// conversationRowTables hold per-conversation rows keyed by conversation_id.
+var conversationRowTables = []string{"conversation_messages", "conversation_events", "conversation_search"}
+
+// open connects to the configured backend and creates the schema.
+// Caller must hold cs.mu (or be the constructor).
+func (cs *ConversationStore) open() error {
+	var driver, dsn string
+	switch cs.backend {
+	case ConversationBackendPostgres:
+		driver, dsn = "postgres", cs.dsn
+	default:
+		driver, dsn = "sqlite", cs.dsn
+		if dsn != ":memory:" {
+			if err := os.MkdirAll(filepath.Dir(dsn), 0o755); err != nil {
+				return fmt.Errorf("failed to create conversations directory: %w", err)
+			}
+		}
+		dsn += "?_pragma=busy_timeout(5000)"
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open conversation database: %w", err)
+	}
+	if cs.backend == ConversationBackendSQLite {
+		// SQLite serializes writers anyway; a single connection also keeps
+		// ":memory:" databases from being split across connections.
+		db.SetMaxOpenConns(1)
+	}
+	schema := append(append(append(conversationSchema, searchSchema(cs.backend)...), runSchema...), jobSchema...)
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return fmt.Errorf("failed to initialize conversation schema: %w", err)
+		}
+	}
+	cs.db = db
+	if err := cs.backfillSearch(); err != nil {
+		return fmt.Errorf("failed to build conversation search index: %w", err)
 	}
 	return nil
 }
 
-// persist writes conversations to disk as formatted JSON.
-func (cs *ConversationStore) persist() error {
-	if cs.filePath == "" {
-		return nil
+// rebind rewrites "?" placeholders to "$n" for Postgres.
+func (cs *ConversationStore) rebind(query string) string {
+	if cs.backend != ConversationBackendPostgres {
+		return query
 	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&sb, "$%d", n)
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
 
-	dir := filepath.Dir(cs.filePath)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("failed to create conversations directory: %w", err)
+func (cs *ConversationStore) limitClause(limit, offset int) string {
+	switch {
+	case limit > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case offset > 0 && cs.backend == ConversationBackendPostgres:
+		return fmt.Sprintf(" OFFSET %d", offset)
+	case offset > 0:
+		return fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
 	}
+	return ""
+}
 
-	data, err := json.MarshalIndent(cs.conversations, "", "  ")
+// execOne runs an UPDATE that must affect the given conversation.
+func (cs *ConversationStore) execOne(conversationID, query string, args ...interface{}) error {
+	res, err := cs.db.Exec(cs.rebind(query), args...)
 	if err != nil {
-		return fmt.Errorf("failed to marshal conversations: %w", err)
+		return err
 	}
-
-	if err := os.WriteFile(cs.filePath, data, 0o644); err != nil {
-		return fmt.Errorf("failed to write conversations file: %w", err)
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("conversation %q not found", conversationID)
 	}
 	return nil
 }
 
-// loadFromDisk reads conversations from the JSON file.
-func (cs *ConversationStore) loadFromDisk() error {
-	data, err := os.ReadFile(cs.filePath)
+func (cs *ConversationStore) insertConversation(tx *sql.Tx, c Conversation) error {
+	var endedAt interface{}
+	if c.EndedAt != nil {
+		endedAt = c.EndedAt.UnixNano()
+	}
+	if c.StartedAt.IsZero() {
+		c.StartedAt = time.Now()
+	}
+	_, err := tx.Exec(cs.rebind(`INSERT INTO conversations (`+conversationColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		c.ID, c.SessionID, c.AgentID, c.AgentName, c.FlowID, c.FlowName, c.ClientID, c.ClientName,
+		c.Source, c.Perspective, c.UserID, c.Summary, conversationPreview(c.Messages), c.ParentID,
+		c.StartedAt.UnixNano(), endedAt)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to insert conversation: %w", err)
 	}
+	return cs.appendRows(tx, c.ID, c.Messages, c.RawEvents)
+}
 
-	var convos []Conversation
-	if err := json.Unmarshal(data, &convos); err != nil {
+// appendRows appends messages and raw events to a conversation, bumping its
+// counters atomically so concurrent appends get distinct sequence numbers.
+func (cs *ConversationStore) appendRows(tx *sql.Tx, conversationID string, msgs []ConversationMessage, rawEvents []interface{}) error {
+	var msgCount, evCount int
+	var preview string
+	err := tx.QueryRow(cs.rebind(`UPDATE conversations
+		SET message_count = message_count + ?, event_count = event_count + ?
+		WHERE id = ? RETURNING message_count, event_count, preview`),
+		len(msgs), len(rawEvents), conversationID).Scan(&msgCount, &evCount, &preview)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("conversation %q not found", conversationID)
+	}
+	if err != nil {
 		return err
 	}
-	if convos == nil {
-		convos = []Conversation{}
+
+	seq := msgCount - len(msgs)
+	for _, m := range msgs {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+		if _, err := tx.Exec(cs.rebind(`INSERT INTO conversation_messages (conversation_id, seq, data) VALUES (?, ?, ?)`), conversationID, seq, string(data)); err != nil {
+			return err
+		}
+		if err := cs.indexMessage(tx, conversationID, seq, m); err != nil {
+			return err
+		}
+		seq++
+	}
+
+	seq = evCount - len(rawEvents)
+	for _, ev := range rawEvents {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		if _, err := tx.Exec(cs.rebind(`INSERT INTO conversation_events (conversation_id, seq, data) VALUES (?, ?, ?)`), conversationID, seq, string(data)); err != nil {
+			return err
+		}
+		seq++
+	}
+
+	if preview == "" {
+		if p := conversationPreview(msgs); p != "" {
+			if _, err := tx.Exec(cs.rebind(`UPDATE conversations SET preview = ? WHERE id = ?`), p, conversationID); err != nil {
+				return err
+			}
+		}
 	}
-	cs.conversations = convos
 	return nil
 }
 
+// loadRows streams the data column of rows with seq in [start, end).
+func (cs *ConversationStore) loadRows(table, conversationID string, start, end int, fn func([]byte) error) error {
+	if start >= end {
+		return nil
+	}
+	rows, err := cs.db.Query(cs.rebind(`SELECT data FROM `+table+` WHERE conversation_id = ? AND seq >= ? AND seq < ? ORDER BY seq`), conversationID, start, end)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := fn([]byte(data)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanConversation(row rowScanner, extra ...interface{}) (Conversation, error) {
+	var c Conversation
+	var startedAt int64
+	var endedAt sql.NullInt64
+	dest := []interface{}{
+		&c.ID, &c.SessionID, &c.AgentID, &c.AgentName, &c.FlowID, &c.FlowName, &c.ClientID, &c.ClientName,
+		&c.Source, &c.Perspective, &c.UserID, &c.Summary, &c.Preview, &c.ParentID, &startedAt, &endedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return Conversation{}, err
+	}
+	c.StartedAt = time.Unix(0, startedAt)
+	if endedAt.Valid {
+		t := time.Unix(0, endedAt.Int64)
+		c.EndedAt = &t
+	}
+	return c, nil
+}
+
+// filterWhere builds the WHERE clause for f, including the full-text search
+// condition. match is the search argument, or "" when not searching.
+func (cs *ConversationStore) filterWhere(f ConversationFilter) (where string, args []interface{}, match string) {
+	where, args = f.where()
+	if match = cs.searchArg(f.Query); match != "" {
+		cond := `id IN (SELECT conversation_id FROM conversation_search WHERE ` + cs.searchCond() + `)`
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		args = append(args, match)
+	}
+	return where, args, match
+}
+
+func (f ConversationFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if f.AgentID != "" {
+		conds = append(conds, "(agent_id = ? OR flow_id = ?)")
+		args = append(args, f.AgentID, f.AgentID)
+	}
+	if f.Source != "" {
+		conds = append(conds, "source = ?")
+		args = append(args, f.Source)
+	}
+	if f.ClientID != "" {
+		conds = append(conds, "client_id = ?")
+		args = append(args, f.ClientID)
+	}
+	if f.Perspective != "" {
+		conds = append(conds, "perspective = ?")
+		args = append(args, f.Perspective)
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, "started_at >= ?")
+		args = append(args, f.From.UnixNano())
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "started_at < ?")
+		args = append(args, f.To.UnixNano())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// tailWindow returns the [start, end) range of the latest limit items of a
+// list of total items, skipping offset items from the end.
+func tailWindow(total, limit, offset int) (int, int) {
+	end := total - offset
+	if end < 0 {
+		end = 0
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return start, end
+}
+
 var magecCommentRegex = regexp.MustCompile(`<!--MAGEC_[A-Z_]+:.*?:MAGEC_[A-Z_]+-->\n?`)
 
-func stripMagecComments(s string) string {
+// StripMagecComments removes the metadata comments Magec embeds in prompts.
+func StripMagecComments(s string) string {
 	return strings.TrimSpace(magecCommentRegex.ReplaceAllString(s, ""))
 }
 
 func conversationPreview(msgs []ConversationMessage) string {
 	for _, m := range msgs {
 		if m.Role == "user" && m.Content != "" {
-			clean := stripMagecComments(m.Content)
+			clean := StripMagecComments(m.Content)
 			if clean == "" {
 				continue
 			}
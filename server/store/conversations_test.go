@@ -0,0 +1,218 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestConversations(t *testing.T) *ConversationStore {
+	t.Helper()
+	cs, err := NewConversationStore(ConversationBackendSQLite, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.Close() })
+	return cs
+}
+
+func appendConversation(t *testing.T, cs *ConversationStore, c Conversation) Conversation {
+	t.Helper()
+	c, err := cs.Append(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func listIDs(t *testing.T, cs *ConversationStore, f ConversationFilter) []string {
+	t.Helper()
+	res, err := cs.ListFiltered(f, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != len(res.Items) {
+		t.Errorf("ListFiltered(%+v) total = %d, but %d items", f, res.Total, len(res.Items))
+	}
+	var ids []string
+	for _, c := range res.Items {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestListFiltered(t *testing.T) {
+	cs := newTestConversations(t)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	appendConversation(t, cs, Conversation{ID: "a", AgentID: "helper", Source: "telegram", ClientID: "tg", Perspective: "user", StartedAt: base})
+	appendConversation(t, cs, Conversation{ID: "b", AgentID: "helper", Source: "voice-ui", ClientID: "ui", Perspective: "admin", StartedAt: base.Add(time.Hour)})
+	appendConversation(t, cs, Conversation{ID: "c", AgentID: "step", FlowID: "pipeline", Source: "telegram", ClientID: "tg", Perspective: "user", StartedAt: base.Add(2 * time.Hour)})
+	appendConversation(t, cs, Conversation{ID: "d", AgentID: "other", Source: "cron", Perspective: "user", StartedAt: base.Add(3 * time.Hour)})
+
+	tests := []struct {
+		name   string
+		filter ConversationFilter
+		want   []string
+	}{
+		{"no filter, newest first", ConversationFilter{}, []string{"d", "c", "b", "a"}},
+		{"agent", ConversationFilter{AgentID: "helper"}, []string{"b", "a"}},
+		{"agent matches flow", ConversationFilter{AgentID: "pipeline"}, []string{"c"}},
+		{"source", ConversationFilter{Source: "telegram"}, []string{"c", "a"}},
+		{"client", ConversationFilter{ClientID: "ui"}, []string{"b"}},
+		{"perspective", ConversationFilter{Perspective: "user"}, []string{"d", "c", "a"}},
+		{"from is inclusive", ConversationFilter{From: base.Add(time.Hour)}, []string{"d", "c", "b"}},
+		{"to is exclusive", ConversationFilter{To: base.Add(2 * time.Hour)}, []string{"b", "a"}},
+		{"combined", ConversationFilter{Source: "telegram", From: base.Add(time.Minute)}, []string{"c"}},
+		{"no match", ConversationFilter{AgentID: "missing"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listIDs(t, cs, tt.filter); !slices.Equal(got, tt.want) {
+				t.Errorf("ListFiltered(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+
+	page, err := cs.List("", "", "", "", 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 4 || len(page.Items) != 2 || page.Items[0].ID != "c" || page.Items[1].ID != "b" {
+		t.Errorf("List(limit 2, offset 1) = %d items from %d, want c, b of 4", len(page.Items), page.Total)
+	}
+}
+
+func TestEachPagesAcrossEqualTimestamps(t *testing.T) {
+	cs := newTestConversations(t)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Batches end in the middle of runs of conversations started at the
+	// same instant, so paging has to break ties by ID.
+	const total = exportBatchSize*2 + 50
+	var want []string
+	for i := range total {
+		id := fmt.Sprintf("conv-%03d", i)
+		appendConversation(t, cs, Conversation{
+			ID:        id,
+			AgentID:   "helper",
+			Source:    "telegram",
+			StartedAt: base.Add(time.Duration(i/40) * time.Minute),
+			Messages:  []ConversationMessage{{Role: "user", Content: "message " + id}},
+		})
+		want = append(want, id)
+	}
+	appendConversation(t, cs, Conversation{ID: "other", AgentID: "other", StartedAt: base})
+
+	var got []string
+	err := cs.Each(ConversationFilter{AgentID: "helper"}, false, func(c Conversation) error {
+		if len(c.Messages) != 1 || c.Messages[0].Content != "message "+c.ID {
+			t.Errorf("conversation %s loaded with messages %+v", c.ID, c.Messages)
+		}
+		got = append(got, c.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Each visited %d conversations, want %d in (started_at, id) order", len(got), len(want))
+	}
+
+	stop := fmt.Errorf("stop")
+	visited := 0
+	err = cs.Each(ConversationFilter{}, false, func(Conversation) error {
+		visited++
+		return stop
+	})
+	if err != stop || visited != 1 {
+		t.Errorf("Each returned %v after %d calls, want the callback error after 1", err, visited)
+	}
+}
+
+func TestReassignUser(t *testing.T) {
+	cs := newTestConversations(t)
+	appendConversation(t, cs, Conversation{ID: "a", UserID: "old"})
+	appendConversation(t, cs, Conversation{ID: "b", UserID: "old"})
+	appendConversation(t, cs, Conversation{ID: "c", UserID: "keep"})
+
+	if err := cs.ReassignUser("old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]string{"a": "new", "b": "new", "c": "keep"} {
+		c, _, ok := cs.Get(id, 0, 0)
+		if !ok {
+			t.Fatalf("conversation %s not found", id)
+		}
+		if c.UserID != want {
+			t.Errorf("conversation %s user = %q, want %q", id, c.UserID, want)
+		}
+	}
+}
+
+func TestImportLegacyJSON(t *testing.T) {
+	cs := newTestConversations(t)
+	appendConversation(t, cs, Conversation{ID: "existing", AgentID: "kept", Source: "telegram"})
+
+	started := time.Date(2025, 11, 2, 9, 30, 0, 0, time.UTC)
+	legacy := []Conversation{
+		{ID: "existing", AgentID: "overwritten", Source: "voice-ui"},
+		{
+			ID:        "old-1",
+			AgentID:   "helper",
+			Source:    "telegram",
+			UserID:    "default_user",
+			StartedAt: started,
+			Messages: []ConversationMessage{
+				{Role: "user", Content: "hi", Timestamp: started},
+				{Role: "assistant", Content: "hello", Timestamp: started.Add(time.Second)},
+			},
+			RawEvents: []interface{}{map[string]interface{}{"id": "e1"}},
+		},
+	}
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := cs.ImportLegacyJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("imported %d conversations, want 1", n)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be renamed, stat error = %v", path, err)
+	}
+	if _, err := os.Stat(path + ".imported"); err != nil {
+		t.Errorf("expected %s.imported: %v", path, err)
+	}
+
+	c, total, ok := cs.Get("old-1", 0, 0)
+	if !ok {
+		t.Fatal("imported conversation not found")
+	}
+	if total != 2 || c.Messages[1].Content != "hello" || len(c.RawEvents) != 1 {
+		t.Errorf("imported conversation has %d messages and %d events", total, len(c.RawEvents))
+	}
+	if !c.StartedAt.Equal(started) {
+		t.Errorf("imported startedAt = %v, want %v", c.StartedAt, started)
+	}
+	if kept, _, _ := cs.Get("existing", 0, 0); kept.AgentID != "kept" {
+		t.Errorf("existing conversation agent = %q, want it left alone", kept.AgentID)
+	}
+
+	// The renamed file is not imported again.
+	if n, err := cs.ImportLegacyJSON(path); n != 0 || err != nil {
+		t.Errorf("second import = %d, %v, want nothing to do", n, err)
+	}
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Job statuses.
+const (
+	JobStatusQueued  = "queued"
+	JobStatusRunning = "running"
+	JobStatusSuccess = "success"
+	JobStatusError   = "error"
+)
+
+// Callback outcomes.
+const (
+	CallbackDelivered = "delivered"
+	CallbackFailed    = "failed"
+)
+
+// maxJobsPerClient caps the jobs kept for each webhook client.
+const maxJobsPerClient = 500
+
+// WebhookJob is an asynchronous webhook request, persisted so it survives
+// restarts and can be polled for its result.
+type WebhookJob struct {
+	ID       string `json:"id"`
+	ClientID string `json:"clientId"`
+	// Status is "queued", "running", "success" or "error".
+	Status string `json:"status"`
+	// Prompt is the passthrough prompt, empty in command mode.
+	Prompt      string `json:"-"`
+	CallbackURL string `json:"callbackUrl,omitempty"`
+	Response    string `json:"response,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// CallbackStatus is "delivered" or "failed" once the callback was tried.
+	CallbackStatus string     `json:"callbackStatus,omitempty"`
+	CallbackError  string     `json:"callbackError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	StartedAt      *time.Time `json:"startedAt,omitempty"`
+	FinishedAt     *time.Time `json:"finishedAt,omitempty"`
+}
+
+var jobSchema = []string{
+	`CREATE TABLE IF NOT EXISTS webhook_jobs (
+		id              TEXT PRIMARY KEY,
+		client_id       TEXT NOT NULL,
+		status          TEXT NOT NULL DEFAULT '',
+		prompt          TEXT NOT NULL DEFAULT '',
+		callback_url    TEXT NOT NULL DEFAULT '',
+		response        TEXT NOT NULL DEFAULT '',
+		error           TEXT NOT NULL DEFAULT '',
+		callback_status TEXT NOT NULL DEFAULT '',
+		callback_error  TEXT NOT NULL DEFAULT '',
+		created_at      BIGINT NOT NULL,
+		started_at      BIGINT,
+		finished_at     BIGINT
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_webhook_jobs_client ON webhook_jobs (client_id, created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_webhook_jobs_status ON webhook_jobs (status)`,
+}
+
+const jobColumns = `id, client_id, status, prompt, callback_url, response, error, callback_status, callback_error, created_at, started_at, finished_at`
+
+// AddJob records a new job and prunes the client's oldest finished jobs
+// beyond the history limit.
+func (cs *ConversationStore) AddJob(j WebhookJob) (WebhookJob, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if j.ID == "" {
+		j.ID = generateID()
+	}
+	if j.CreatedAt.IsZero() {
+		j.CreatedAt = time.Now()
+	}
+	if j.Status == "" {
+		j.Status = JobStatusQueued
+	}
+	_, err := cs.db.Exec(cs.rebind(`INSERT INTO webhook_jobs (`+jobColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		j.ID, j.ClientID, j.Status, j.Prompt, j.CallbackURL, j.Response, j.Error, j.CallbackStatus, j.CallbackError,
+		j.CreatedAt.UnixNano(), nanosOrNil(j.StartedAt), nanosOrNil(j.FinishedAt))
+	if err != nil {
+		return j, fmt.Errorf("failed to insert job: %w", err)
+	}
+
+	_, err = cs.db.Exec(cs.rebind(`DELETE FROM webhook_jobs WHERE client_id = ? AND status IN (?, ?) AND id NOT IN (
+		SELECT id FROM webhook_jobs WHERE client_id = ? ORDER BY created_at DESC LIMIT ?)`),
+		j.ClientID, JobStatusSuccess, JobStatusError, j.ClientID, maxJobsPerClient)
+	return j, err
+}
+
+// UpdateJob saves the status, result and callback outcome of a job.
+func (cs *ConversationStore) UpdateJob(j WebhookJob) error {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	res, err := cs.db.Exec(cs.rebind(`UPDATE webhook_jobs SET status = ?, response = ?, error = ?,
+		callback_status = ?, callback_error = ?, started_at = ?, finished_at = ? WHERE id = ?`),
+		j.Status, j.Response, j.Error, j.CallbackStatus, j.CallbackError,
+		nanosOrNil(j.StartedAt), nanosOrNil(j.FinishedAt), j.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("job %q not found", j.ID)
+	}
+	return nil
+}
+
+// ClaimJob moves a queued job to running. It returns false when the job is
+// no longer queued, so a job is only ever run once.
+func (cs *ConversationStore) ClaimJob(id string, startedAt time.Time) (bool, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	res, err := cs.db.Exec(cs.rebind(`UPDATE webhook_jobs SET status = ?, started_at = ? WHERE id = ? AND status = ?`),
+		JobStatusRunning, startedAt.UnixNano(), id, JobStatusQueued)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// GetJob returns a job of a client.
+func (cs *ConversationStore) GetJob(clientID, id string) (WebhookJob, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	row := cs.db.QueryRow(cs.rebind(`SELECT `+jobColumns+` FROM webhook_jobs WHERE id = ? AND client_id = ?`), id, clientID)
+	j, err := scanJob(row)
+	if err != nil {
+		return WebhookJob{}, false
+	}
+	return j, true
+}
+
+// QueuedJobs returns the jobs waiting to run, oldest first.
+func (cs *ConversationStore) QueuedJobs() ([]WebhookJob, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	rows, err := cs.db.Query(cs.rebind(`SELECT `+jobColumns+` FROM webhook_jobs WHERE status = ? ORDER BY created_at`), JobStatusQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []WebhookJob
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// InterruptJobs marks jobs still "running" as failed. Called on startup,
+// when no job can be in progress. They are not retried, since the agent
+// may already have acted on them.
+func (cs *ConversationStore) InterruptJobs() error {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	_, err := cs.db.Exec(cs.rebind(`UPDATE webhook_jobs SET status = ?, error = ?, finished_at = ? WHERE status = ?`),
+		JobStatusError, "interrupted by server restart", time.Now().UnixNano(), JobStatusRunning)
+	return err
+}
+
+func scanJob(row rowScanner) (WebhookJob, error) {
+	var j WebhookJob
+	var createdAt int64
+	var startedAt, finishedAt sql.NullInt64
+	if err := row.Scan(&j.ID, &j.ClientID, &j.Status, &j.Prompt, &j.CallbackURL, &j.Response, &j.Error,
+		&j.CallbackStatus, &j.CallbackError, &createdAt, &startedAt, &finishedAt); err != nil {
+		return j, err
+	}
+	j.CreatedAt = time.Unix(0, createdAt)
+	if startedAt.Valid {
+		t := time.Unix(0, startedAt.Int64)
+		j.StartedAt = &t
+	}
+	if finishedAt.Valid {
+		t := time.Unix(0, finishedAt.Int64)
+		j.FinishedAt = &t
+	}
+	return j, nil
+}
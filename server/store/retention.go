@@ -0,0 +1,267 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RetentionRuleReport describes what a single retention rule matched.
+type RetentionRuleReport struct {
+	ClientID      string    `json:"clientId,omitempty"` // empty for the global policy
+	Source        string    `json:"source,omitempty"`   // empty when the rule covers every other source
+	Cutoff        time.Time `json:"cutoff"`
+	Conversations int       `json:"conversations"`
+}
+
+// RetentionReport summarizes a retention pass.
+type RetentionReport struct {
+	DryRun                 bool                  `json:"dryRun"`
+	Conversations          int                   `json:"conversations"`          // conversations deleted (or that would be)
+	RawEventsConversations int                   `json:"rawEventsConversations"` // conversations whose raw events were dropped
+	Rules                  []RetentionRuleReport `json:"rules"`
+}
+
+// retentionRule deletes conversations last active before Cutoff. A rule
+// either targets one client or, with ClientID empty, every conversation not
+// owned by ExcludeClients. Source works the same way with ExcludeSources.
+type retentionRule struct {
+	ClientID       string
+	ExcludeClients []string
+	Source         string
+	ExcludeSources []string
+	Cutoff         time.Time
+}
+
+// MergeRetention returns the effective policy for a client: fields set on the
+// client override the global ones, even when set to 0, and SourceDays are
+// merged by source.
+func MergeRetention(global, client *RetentionPolicy) *RetentionPolicy {
+	if global == nil && client == nil {
+		return nil
+	}
+	merged := RetentionPolicy{SourceDays: map[string]int{}}
+	for _, p := range []*RetentionPolicy{global, client} {
+		if p == nil {
+			continue
+		}
+		if p.Days != nil {
+			merged.Days = p.Days
+		}
+		if p.RawEventsHours != nil {
+			merged.RawEventsHours = p.RawEventsHours
+		}
+		for src, days := range p.SourceDays {
+			merged.SourceDays[src] = days
+		}
+	}
+	return &merged
+}
+
+// Validate rejects negative durations.
+func (p *RetentionPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if valueOf(p.Days) < 0 || valueOf(p.RawEventsHours) < 0 {
+		return fmt.Errorf("retention durations must not be negative")
+	}
+	for src, days := range p.SourceDays {
+		if days < 0 {
+			return fmt.Errorf("retention days for source %q must not be negative", src)
+		}
+	}
+	return nil
+}
+
+// buildRetentionRules expands a policy into deletion rules for one scope.
+// clientID is empty for the global scope, in which case excludeClients lists
+// the clients that have their own policy.
+func buildRetentionRules(p *RetentionPolicy, clientID string, excludeClients []string, now time.Time) []retentionRule {
+	if p == nil {
+		return nil
+	}
+	var rules []retentionRule
+	sources := make([]string, 0, len(p.SourceDays))
+	for src := range p.SourceDays {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+
+	// Sources kept forever get no rule but stay excluded from the default.
+	for _, src := range sources {
+		days := p.SourceDays[src]
+		if days <= 0 {
+			continue
+		}
+		rules = append(rules, retentionRule{
+			ClientID:       clientID,
+			ExcludeClients: excludeClients,
+			Source:         src,
+			Cutoff:         now.Add(-time.Duration(days) * 24 * time.Hour),
+		})
+	}
+	if days := valueOf(p.Days); days > 0 {
+		rules = append(rules, retentionRule{
+			ClientID:       clientID,
+			ExcludeClients: excludeClients,
+			ExcludeSources: sources,
+			Cutoff:         now.Add(-time.Duration(days) * 24 * time.Hour),
+		})
+	}
+	return rules
+}
+
+// valueOf returns *n, or 0 ("keep forever") when n is unset.
+func valueOf(n *int) int {
+	if n == nil {
+		return 0
+	}
+	return *n
+}
+
+// ApplyRetention deletes conversations and raw events that fall outside the
+// global policy and the per-client policies (keyed by client ID). With dryRun
+// set nothing is deleted and the report shows what would be.
+func (cs *ConversationStore) ApplyRetention(global *RetentionPolicy, clients map[string]*RetentionPolicy, now time.Time, dryRun bool) (RetentionReport, error) {
+	report := RetentionReport{DryRun: dryRun, Rules: []RetentionRuleReport{}}
+
+	clientIDs := make([]string, 0, len(clients))
+	for id := range clients {
+		clientIDs = append(clientIDs, id)
+	}
+	sort.Strings(clientIDs)
+
+	type scope struct {
+		clientID string
+		exclude  []string
+		policy   *RetentionPolicy
+	}
+	scopes := []scope{{exclude: clientIDs, policy: global}}
+	for _, id := range clientIDs {
+		scopes = append(scopes, scope{clientID: id, policy: MergeRetention(global, clients[id])})
+	}
+
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	for _, sc := range scopes {
+		for _, rule := range buildRetentionRules(sc.policy, sc.clientID, sc.exclude, now) {
+			n, err := cs.pruneConversations(rule, dryRun)
+			if err != nil {
+				return report, err
+			}
+			report.Conversations += n
+			report.Rules = append(report.Rules, RetentionRuleReport{
+				ClientID:      rule.ClientID,
+				Source:        rule.Source,
+				Cutoff:        rule.Cutoff,
+				Conversations: n,
+			})
+		}
+
+		if sc.policy != nil && valueOf(sc.policy.RawEventsHours) > 0 {
+			rule := retentionRule{
+				ClientID:       sc.clientID,
+				ExcludeClients: sc.exclude,
+				Cutoff:         now.Add(-time.Duration(*sc.policy.RawEventsHours) * time.Hour),
+			}
+			n, err := cs.pruneRawEvents(rule, dryRun)
+			if err != nil {
+				return report, err
+			}
+			report.RawEventsConversations += n
+		}
+	}
+	return report, nil
+}
+
+// where builds the conversation filter for a rule.
+func (r retentionRule) where() (string, []interface{}) {
+	conds := []string{"COALESCE(ended_at, started_at) < ?"}
+	args := []interface{}{r.Cutoff.UnixNano()}
+	if r.ClientID != "" {
+		conds = append(conds, "client_id = ?")
+		args = append(args, r.ClientID)
+	} else if len(r.ExcludeClients) > 0 {
+		conds = append(conds, "client_id NOT IN ("+placeholders(len(r.ExcludeClients))+")")
+		for _, id := range r.ExcludeClients {
+			args = append(args, id)
+		}
+	}
+	if r.Source != "" {
+		conds = append(conds, "source = ?")
+		args = append(args, r.Source)
+	} else if len(r.ExcludeSources) > 0 {
+		conds = append(conds, "source NOT IN ("+placeholders(len(r.ExcludeSources))+")")
+		for _, src := range r.ExcludeSources {
+			args = append(args, src)
+		}
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// pruneConversations deletes (or counts) conversations matched by rule.
+// Caller must hold cs.mu.
+func (cs *ConversationStore) pruneConversations(rule retentionRule, dryRun bool) (int, error) {
+	where, args := rule.where()
+	match := `SELECT id FROM conversations` + where
+
+	var n int
+	if err := cs.db.QueryRow(cs.rebind(`SELECT COUNT(*) FROM conversations`+where), args...).Scan(&n); err != nil {
+		return 0, err
+	}
+	if dryRun || n == 0 {
+		return n, nil
+	}
+
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range conversationRowTables {
+		if _, err := tx.Exec(cs.rebind(`DELETE FROM `+table+` WHERE conversation_id IN (`+match+`)`), args...); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(cs.rebind(`DELETE FROM conversations`+where), args...); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// pruneRawEvents drops the raw events of conversations matched by rule while
+// keeping their messages. Caller must hold cs.mu.
+func (cs *ConversationStore) pruneRawEvents(rule retentionRule, dryRun bool) (int, error) {
+	where, args := rule.where()
+	where += " AND event_count > 0"
+
+	var n int
+	if err := cs.db.QueryRow(cs.rebind(`SELECT COUNT(*) FROM conversations`+where), args...).Scan(&n); err != nil {
+		return 0, err
+	}
+	if dryRun || n == 0 {
+		return n, nil
+	}
+
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(cs.rebind(`DELETE FROM conversation_events WHERE conversation_id IN (SELECT id FROM conversations`+where+`)`), args...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(cs.rebind(`UPDATE conversations SET event_count = 0`+where), args...); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestMergeRetention(t *testing.T) {
+	global := &RetentionPolicy{Days: intPtr(90), SourceDays: map[string]int{"cron": 7, "webhook": 14}, RawEventsHours: intPtr(48)}
+
+	tests := []struct {
+		name   string
+		global *RetentionPolicy
+		client *RetentionPolicy
+		want   *RetentionPolicy
+	}{
+		{"neither", nil, nil, nil},
+		{"global only", global, nil, &RetentionPolicy{Days: intPtr(90), SourceDays: map[string]int{"cron": 7, "webhook": 14}, RawEventsHours: intPtr(48)}},
+		{"client only", nil, &RetentionPolicy{Days: intPtr(30)}, &RetentionPolicy{Days: intPtr(30), SourceDays: map[string]int{}}},
+		{
+			"unset fields are inherited",
+			global,
+			&RetentionPolicy{SourceDays: map[string]int{"cron": 1}},
+			&RetentionPolicy{Days: intPtr(90), SourceDays: map[string]int{"cron": 1, "webhook": 14}, RawEventsHours: intPtr(48)},
+		},
+		{
+			"zero keeps forever",
+			global,
+			&RetentionPolicy{Days: intPtr(0), SourceDays: map[string]int{"webhook": 0}, RawEventsHours: intPtr(0)},
+			&RetentionPolicy{Days: intPtr(0), SourceDays: map[string]int{"cron": 7, "webhook": 0}, RawEventsHours: intPtr(0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeRetention(tt.global, tt.client); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeRetention() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRetentionRules(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	ago := func(d int) time.Time { return now.AddDate(0, 0, -d) }
+
+	tests := []struct {
+		name   string
+		policy *RetentionPolicy
+		want   []retentionRule
+	}{
+		{"nil policy", nil, nil},
+		{"keep forever", &RetentionPolicy{Days: intPtr(0)}, nil},
+		{"days only", &RetentionPolicy{Days: intPtr(30)}, []retentionRule{
+			{ClientID: "c1", ExcludeClients: []string{"x"}, ExcludeSources: []string{}, Cutoff: ago(30)},
+		}},
+		{"per source", &RetentionPolicy{Days: intPtr(30), SourceDays: map[string]int{"webhook": 7, "cron": 1}}, []retentionRule{
+			{ClientID: "c1", ExcludeClients: []string{"x"}, Source: "cron", Cutoff: ago(1)},
+			{ClientID: "c1", ExcludeClients: []string{"x"}, Source: "webhook", Cutoff: ago(7)},
+			{ClientID: "c1", ExcludeClients: []string{"x"}, ExcludeSources: []string{"cron", "webhook"}, Cutoff: ago(30)},
+		}},
+		{"source kept forever", &RetentionPolicy{Days: intPtr(30), SourceDays: map[string]int{"telegram": 0}}, []retentionRule{
+			{ClientID: "c1", ExcludeClients: []string{"x"}, ExcludeSources: []string{"telegram"}, Cutoff: ago(30)},
+		}},
+		{"sources without default", &RetentionPolicy{SourceDays: map[string]int{"cron": 1}}, []retentionRule{
+			{ClientID: "c1", ExcludeClients: []string{"x"}, Source: "cron", Cutoff: ago(1)},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildRetentionRules(tt.policy, "c1", []string{"x"}, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildRetentionRules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	ago := func(d int) time.Time { return now.AddDate(0, 0, -d) }
+
+	seed := func(t *testing.T) *ConversationStore {
+		cs := newTestConversations(t)
+		event := []interface{}{map[string]interface{}{"id": "e"}}
+		for _, c := range []Conversation{
+			{ID: "old-ui", Source: "voice-ui", ClientID: "ui", StartedAt: ago(100)},
+			{ID: "new-ui", Source: "voice-ui", ClientID: "ui", StartedAt: ago(10), RawEvents: event},
+			{ID: "old-cron", Source: "cron", ClientID: "nightly", StartedAt: ago(10)},
+			{ID: "new-cron", Source: "cron", ClientID: "nightly", StartedAt: ago(1)},
+			{ID: "old-tg", Source: "telegram", ClientID: "tg", StartedAt: ago(400), RawEvents: event},
+			{ID: "ended-late", Source: "voice-ui", ClientID: "ui", StartedAt: ago(100), EndedAt: func() *time.Time { e := ago(5); return &e }()},
+		} {
+			appendConversation(t, cs, c)
+		}
+		return cs
+	}
+	global := &RetentionPolicy{Days: intPtr(90), SourceDays: map[string]int{"cron": 7}, RawEventsHours: intPtr(24 * 7)}
+	clients := map[string]*RetentionPolicy{"tg": {Days: intPtr(0), RawEventsHours: intPtr(0)}}
+
+	t.Run("dry run", func(t *testing.T) {
+		cs := seed(t)
+		report, err := cs.ApplyRetention(global, clients, now, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.DryRun || report.Conversations != 2 || report.RawEventsConversations != 1 {
+			t.Errorf("dry run report = %+v, want 2 conversations and 1 raw events", report)
+		}
+		if n := cs.Count(); n != 6 {
+			t.Errorf("dry run left %d conversations, want all 6", n)
+		}
+		if c, _, _ := cs.Get("new-ui", 0, 0); len(c.RawEvents) != 1 {
+			t.Error("dry run dropped raw events")
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		cs := seed(t)
+		report, err := cs.ApplyRetention(global, clients, now, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Conversations != 2 || report.RawEventsConversations != 1 {
+			t.Errorf("report = %+v, want 2 conversations and 1 raw events", report)
+		}
+		left := listIDs(t, cs, ConversationFilter{})
+		want := []string{"new-cron", "new-ui", "ended-late", "old-tg"}
+		if !reflect.DeepEqual(left, want) {
+			t.Errorf("left %v, want %v", left, want)
+		}
+		if c, _, _ := cs.Get("new-ui", 0, 0); len(c.RawEvents) != 0 {
+			t.Error("expected raw events older than a week to be dropped")
+		}
+		if c, _, _ := cs.Get("old-tg", 0, 0); len(c.RawEvents) != 1 {
+			t.Error("expected the client kept forever to keep its raw events")
+		}
+	})
+}
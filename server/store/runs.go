@@ -0,0 +1,180 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Run statuses.
+const (
+	RunStatusRunning = "running"
+	RunStatusSuccess = "success"
+	RunStatusError   = "error"
+	// RunStatusMissed marks scheduled runs that were skipped while the
+	// server was down.
+	RunStatusMissed = "missed"
+)
+
+// Run triggers.
+const (
+	RunTriggerSchedule = "schedule"
+	RunTriggerCatchUp  = "catchup"
+	RunTriggerManual   = "manual"
+)
+
+// maxRunsPerClient caps the run history kept for each client.
+const maxRunsPerClient = 200
+
+// ClientRun is one execution of a scheduled client, kept as run history
+// alongside the conversation log.
+type ClientRun struct {
+	ID       string `json:"id"`
+	ClientID string `json:"clientId"`
+	// Trigger is "schedule", "catchup" or "manual".
+	Trigger string `json:"trigger"`
+	// ScheduledAt is the slot the run belongs to. Manual runs have none.
+	ScheduledAt *time.Time `json:"scheduledAt,omitempty"`
+	StartedAt   time.Time  `json:"startedAt"`
+	EndedAt     *time.Time `json:"endedAt,omitempty"`
+	// Status is "running", "success", "error" or "missed".
+	Status string `json:"status"`
+	// Response is an excerpt of the agent response.
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+var runSchema = []string{
+	`CREATE TABLE IF NOT EXISTS client_runs (
+		id           TEXT PRIMARY KEY,
+		client_id    TEXT NOT NULL,
+		trigger_type TEXT NOT NULL DEFAULT '',
+		scheduled_at BIGINT,
+		started_at   BIGINT NOT NULL,
+		ended_at     BIGINT,
+		status       TEXT NOT NULL DEFAULT '',
+		response     TEXT NOT NULL DEFAULT '',
+		error        TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_client_runs_client ON client_runs (client_id, started_at)`,
+}
+
+const runColumns = `id, client_id, trigger_type, scheduled_at, started_at, ended_at, status, response, error`
+
+// AddRun records a run and prunes the client's oldest runs beyond the
+// history limit.
+func (cs *ConversationStore) AddRun(r ClientRun) (ClientRun, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if r.ID == "" {
+		r.ID = generateID()
+	}
+	if r.StartedAt.IsZero() {
+		r.StartedAt = time.Now()
+	}
+	_, err := cs.db.Exec(cs.rebind(`INSERT INTO client_runs (`+runColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		r.ID, r.ClientID, r.Trigger, nanosOrNil(r.ScheduledAt), r.StartedAt.UnixNano(), nanosOrNil(r.EndedAt),
+		r.Status, r.Response, r.Error)
+	if err != nil {
+		return r, fmt.Errorf("failed to insert run: %w", err)
+	}
+
+	_, err = cs.db.Exec(cs.rebind(`DELETE FROM client_runs WHERE client_id = ? AND id NOT IN (
+		SELECT id FROM client_runs WHERE client_id = ? ORDER BY started_at DESC LIMIT ?)`),
+		r.ClientID, r.ClientID, maxRunsPerClient)
+	return r, err
+}
+
+// FinishRun sets the final status of a running run.
+func (cs *ConversationStore) FinishRun(id, status, response, errMsg string) error {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	res, err := cs.db.Exec(cs.rebind(`UPDATE client_runs SET status = ?, response = ?, error = ?, ended_at = ? WHERE id = ?`),
+		status, response, errMsg, time.Now().UnixNano(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("run %q not found", id)
+	}
+	return nil
+}
+
+// ListRuns returns a client's runs, newest first. Use limit=0 for no limit.
+func (cs *ConversationStore) ListRuns(clientID string, limit, offset int) PaginatedResult[ClientRun] {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	result := PaginatedResult[ClientRun]{Items: []ClientRun{}}
+	if err := cs.db.QueryRow(cs.rebind(`SELECT COUNT(*) FROM client_runs WHERE client_id = ?`), clientID).Scan(&result.Total); err != nil {
+		return result
+	}
+
+	rows, err := cs.db.Query(cs.rebind(`SELECT `+runColumns+` FROM client_runs WHERE client_id = ?
+		ORDER BY started_at DESC`+cs.limitClause(limit, offset)), clientID)
+	if err != nil {
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return result
+		}
+		result.Items = append(result.Items, r)
+	}
+	return result
+}
+
+// LastScheduledRun returns the latest scheduled slot recorded for a client,
+// whether it ran or was missed.
+func (cs *ConversationStore) LastScheduledRun(clientID string) (time.Time, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	var last sql.NullInt64
+	err := cs.db.QueryRow(cs.rebind(`SELECT MAX(scheduled_at) FROM client_runs WHERE client_id = ?`), clientID).Scan(&last)
+	if err != nil || !last.Valid {
+		return time.Time{}, false
+	}
+	return time.Unix(0, last.Int64), true
+}
+
+// InterruptRuns marks runs still "running" as failed. Called on startup,
+// when no run can be in progress.
+func (cs *ConversationStore) InterruptRuns() error {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	_, err := cs.db.Exec(cs.rebind(`UPDATE client_runs SET status = ?, error = ?, ended_at = ? WHERE status = ?`),
+		RunStatusError, "interrupted by server restart", time.Now().UnixNano(), RunStatusRunning)
+	return err
+}
+
+func scanRun(row rowScanner) (ClientRun, error) {
+	var r ClientRun
+	var scheduledAt, endedAt sql.NullInt64
+	var startedAt int64
+	if err := row.Scan(&r.ID, &r.ClientID, &r.Trigger, &scheduledAt, &startedAt, &endedAt, &r.Status, &r.Response, &r.Error); err != nil {
+		return r, err
+	}
+	r.StartedAt = time.Unix(0, startedAt)
+	if scheduledAt.Valid {
+		t := time.Unix(0, scheduledAt.Int64)
+		r.ScheduledAt = &t
+	}
+	if endedAt.Valid {
+		t := time.Unix(0, endedAt.Int64)
+		r.EndedAt = &t
+	}
+	return r, nil
+}
+
+func nanosOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSnippetsPerConversation caps the snippets attached to each search hit.
+const maxSnippetsPerConversation = 3
+
+// SearchSnippet is an excerpt of a message that matched a search query.
+// Text is HTML-escaped with the matched terms wrapped in <mark> tags.
+type SearchSnippet struct {
+	Seq  int    `json:"seq"`
+	Role string `json:"role"`
+	Text string `json:"text"`
+}
+
+// searchSchema returns the statements that create the full-text index. SQLite
+// uses an FTS5 table; Postgres a plain table with a GIN index over tsvector.
+func searchSchema(backend string) []string {
+	if backend == ConversationBackendPostgres {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS conversation_search (
+				conversation_id TEXT NOT NULL,
+				seq             INTEGER NOT NULL,
+				role            TEXT NOT NULL DEFAULT '',
+				content         TEXT NOT NULL,
+				PRIMARY KEY (conversation_id, seq)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_conversation_search_content ON conversation_search USING GIN (to_tsvector('simple', content))`,
+		}
+	}
+	return []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS conversation_search USING fts5(
+			conversation_id UNINDEXED, seq UNINDEXED, role UNINDEXED, content
+		)`,
+	}
+}
+
+// searchCond returns the SQL condition (with one placeholder) that matches
+// conversation_search rows against a query built by searchArg.
+func (cs *ConversationStore) searchCond() string {
+	if cs.backend == ConversationBackendPostgres {
+		return `to_tsvector('simple', content) @@ websearch_to_tsquery('simple', ?)`
+	}
+	return `conversation_search MATCH ?`
+}
+
+// searchArg turns a user query into the backend's match argument. Words are
+// ANDed together and double-quoted text is matched as a phrase. Returns ""
+// when the query has nothing to search for.
+func (cs *ConversationStore) searchArg(q string) string {
+	terms := parseSearchQuery(q)
+	if len(terms) == 0 {
+		return ""
+	}
+	if cs.backend == ConversationBackendPostgres {
+		return strings.TrimSpace(q)
+	}
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// parseSearchQuery splits q into words and "quoted phrases".
+func parseSearchQuery(q string) []string {
+	var terms []string
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			if p := strings.Join(strings.Fields(part), " "); p != "" {
+				terms = append(terms, p)
+			}
+			continue
+		}
+		terms = append(terms, strings.Fields(part)...)
+	}
+	return terms
+}
+
+// searchText is the indexed text of a message: its content plus the name and
+// arguments of every tool it called.
+func searchText(m ConversationMessage) string {
+	parts := []string{StripMagecComments(m.Content)}
+	for _, tc := range m.ToolCalls {
+		parts = append(parts, tc.Name)
+		if tc.Args != nil {
+			if args, err := json.Marshal(tc.Args); err == nil {
+				parts = append(parts, string(args))
+			}
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
+
+// indexMessage adds a message to the full-text index.
+func (cs *ConversationStore) indexMessage(tx *sql.Tx, conversationID string, seq int, m ConversationMessage) error {
+	_, err := tx.Exec(cs.rebind(`INSERT INTO conversation_search (conversation_id, seq, role, content) VALUES (?, ?, ?, ?)`),
+		conversationID, seq, m.Role, searchText(m))
+	return err
+}
+
+// backfillBatchSize is how many stored messages backfillSearch reads per query.
+const backfillBatchSize = 500
+
+// backfillSearch indexes stored messages when the full-text index is empty,
+// which happens the first time a database created by an older version is
+// opened. Messages are read in batches inside one transaction, so memory use
+// stays flat and an interrupted backfill leaves the index empty to be
+// retried. Caller must hold cs.mu (or be opening the store).
+func (cs *ConversationStore) backfillSearch() error {
+	var indexed int
+	if err := cs.db.QueryRow(`SELECT COUNT(*) FROM conversation_search`).Scan(&indexed); err != nil {
+		return err
+	}
+	if indexed > 0 {
+		return nil
+	}
+
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lastID string
+	lastSeq := -1
+	for {
+		n, err := cs.backfillBatch(tx, &lastID, &lastSeq)
+		if err != nil {
+			return err
+		}
+		if n < backfillBatchSize {
+			break
+		}
+	}
+	return tx.Commit()
+}
+
+// backfillBatch indexes the next batch of messages after (lastID, lastSeq)
+// and advances them. Returns the number of messages read.
+func (cs *ConversationStore) backfillBatch(tx *sql.Tx, lastID *string, lastSeq *int) (int, error) {
+	type row struct {
+		conversationID string
+		seq            int
+		data           string
+	}
+	rows, err := tx.Query(cs.rebind(`SELECT conversation_id, seq, data FROM conversation_messages
+		WHERE conversation_id > ? OR (conversation_id = ? AND seq > ?)
+		ORDER BY conversation_id, seq LIMIT ?`), *lastID, *lastID, *lastSeq, backfillBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.conversationID, &r.seq, &r.data); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range batch {
+		var m ConversationMessage
+		if json.Unmarshal([]byte(r.data), &m) != nil {
+			continue
+		}
+		if err := cs.indexMessage(tx, r.conversationID, r.seq, m); err != nil {
+			return 0, err
+		}
+	}
+	if len(batch) > 0 {
+		*lastID, *lastSeq = batch[len(batch)-1].conversationID, batch[len(batch)-1].seq
+	}
+	return len(batch), nil
+}
+
+// attachSnippets fills in Snippets for each conversation with the first
+// messages matching the query, reading the whole page in one query. Caller
+// must hold cs.mu.
+func (cs *ConversationStore) attachSnippets(items []Conversation, q, match string) error {
+	if len(items) == 0 {
+		return nil
+	}
+	byID := make(map[string]*Conversation, len(items))
+	args := make([]interface{}, 0, len(items)+2)
+	for i := range items {
+		byID[items[i].ID] = &items[i]
+		args = append(args, items[i].ID)
+	}
+	args = append(args, match, maxSnippetsPerConversation)
+
+	rows, err := cs.db.Query(cs.rebind(`SELECT conversation_id, seq, role, content FROM (
+			SELECT conversation_id, seq, role, content,
+				ROW_NUMBER() OVER (PARTITION BY conversation_id ORDER BY seq) AS n
+			FROM conversation_search
+			WHERE conversation_id IN (`+placeholders(len(items))+`) AND `+cs.searchCond()+`
+		) hits WHERE n <= ? ORDER BY conversation_id, seq`), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	highlight := highlightRegex(parseSearchQuery(q))
+	for rows.Next() {
+		var id, content string
+		var s SearchSnippet
+		if err := rows.Scan(&id, &s.Seq, &s.Role, &content); err != nil {
+			return err
+		}
+		if c, ok := byID[id]; ok {
+			s.Text = snippet(content, highlight)
+			c.Snippets = append(c.Snippets, s)
+		}
+	}
+	return rows.Err()
+}
+
+// highlightRegex matches any word of the search terms, case-insensitively.
+func highlightRegex(terms []string) *regexp.Regexp {
+	var words []string
+	for _, t := range terms {
+		for _, w := range strings.Fields(t) {
+			words = append(words, regexp.QuoteMeta(w))
+		}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(words, "|"))
+}
+
+// snippet cuts a window of text around the first match and marks every
+// match inside it.
+func snippet(text string, highlight *regexp.Regexp) string {
+	const before, after = 60, 140
+
+	start, end := 0, len(text)
+	if highlight != nil {
+		if loc := highlight.FindStringIndex(text); loc != nil {
+			start = loc[0] - before
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	if end > start+before+after {
+		end = start + before + after
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end++
+		}
+	}
+
+	window := text[start:end]
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	last := 0
+	if highlight != nil {
+		for _, loc := range highlight.FindAllStringIndex(window, -1) {
+			b.WriteString(html.EscapeString(window[last:loc[0]]))
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(window[loc[0]:loc[1]]))
+			b.WriteString("</mark>")
+			last = loc[1]
+		}
+	}
+	b.WriteString(html.EscapeString(window[last:]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seedSearch(t *testing.T, cs *ConversationStore) {
+	t.Helper()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	appendConversation(t, cs, Conversation{ID: "plants", AgentID: "helper", StartedAt: base, Messages: []ConversationMessage{
+		{Role: "user", Content: "<!--MAGEC_META:{\"source\":\"telegram\"}:MAGEC_META-->\nMy fern is dying"},
+		{Role: "assistant", Content: "Water the fern less & give it <indirect> light."},
+		{Role: "user", Content: "Which fern food?"},
+		{Role: "assistant", Content: "Any fern fertilizer, diluted."},
+		{Role: "user", Content: "Thanks, the fern looks better."},
+	}})
+	appendConversation(t, cs, Conversation{ID: "weather", AgentID: "helper", StartedAt: base.Add(time.Hour), Messages: []ConversationMessage{
+		{Role: "user", Content: "Is it going to rain in Madrid?"},
+		{Role: "assistant", Content: "Checking.", ToolCalls: []ToolCallInfo{{Name: "get_forecast", Args: map[string]any{"city": "Madrid"}}}},
+	}})
+	appendConversation(t, cs, Conversation{ID: "other", AgentID: "coder", StartedAt: base.Add(2 * time.Hour), Messages: []ConversationMessage{
+		{Role: "user", Content: "Water under the bridge, the build is dying"},
+	}})
+}
+
+func TestSearchMatching(t *testing.T) {
+	cs := newTestConversations(t)
+	seedSearch(t, cs)
+
+	tests := []struct {
+		query string
+		agent string
+		want  []string
+	}{
+		{"fern", "", []string{"plants"}},
+		{"FERN", "", []string{"plants"}},
+		{"water dying", "", []string{"other"}}, // words must share a message
+		{"fern madrid", "", nil},
+		{`"fern is dying"`, "", []string{"plants"}},
+		{`"dying fern"`, "", nil},
+		{"get_forecast", "", []string{"weather"}},
+		{"madrid", "", []string{"weather"}},
+		{"dying", "helper", []string{"plants"}},
+		{"telegram", "", nil}, // metadata comments are not indexed
+		{`"unbalanced`, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := listIDs(t, cs, ConversationFilter{Query: tt.query, AgentID: tt.agent})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	// A query with nothing to search for does not filter.
+	if got := listIDs(t, cs, ConversationFilter{Query: `  "" `}); len(got) != 3 {
+		t.Errorf("empty query returned %v, want every conversation", got)
+	}
+}
+
+func TestSearchSnippets(t *testing.T) {
+	cs := newTestConversations(t)
+	seedSearch(t, cs)
+
+	res, err := cs.ListFiltered(ConversationFilter{Query: "fern"}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Items) != 1 {
+		t.Fatalf("got %d results, want 1", len(res.Items))
+	}
+	snippets := res.Items[0].Snippets
+	if len(snippets) != maxSnippetsPerConversation {
+		t.Fatalf("got %d snippets, want %d", len(snippets), maxSnippetsPerConversation)
+	}
+	for i, want := range []int{0, 1, 2} {
+		if snippets[i].Seq != want {
+			t.Errorf("snippet %d seq = %d, want %d", i, snippets[i].Seq, want)
+		}
+	}
+	if got := snippets[0].Text; got != "My <mark>fern</mark> is dying" {
+		t.Errorf("snippet text = %q", got)
+	}
+	if got := snippets[1].Text; got != "Water the <mark>fern</mark> less &amp; give it &lt;indirect&gt; light." {
+		t.Errorf("snippet is not escaped: %q", got)
+	}
+	if snippets[1].Role != "assistant" {
+		t.Errorf("snippet role = %q, want assistant", snippets[1].Role)
+	}
+
+	// Every result on a page gets its own snippets.
+	res, err = cs.ListFiltered(ConversationFilter{Query: "water"}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range res.Items {
+		if len(c.Snippets) != 1 || !strings.Contains(c.Snippets[0].Text, "<mark>Water</mark>") {
+			t.Errorf("conversation %s snippets = %+v", c.ID, c.Snippets)
+		}
+	}
+
+	// Without a query there are no snippets.
+	res, _ = cs.ListFiltered(ConversationFilter{}, 10, 0)
+	for _, c := range res.Items {
+		if c.Snippets != nil {
+			t.Errorf("conversation %s has snippets without a query", c.ID)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	hl := highlightRegex(parseSearchQuery(`rain "in madrid"`))
+	if got := snippet("Rain in Madrid, today", hl); got != "<mark>Rain</mark> <mark>in</mark> <mark>Madrid</mark>, today" {
+		t.Errorf("snippet = %q", got)
+	}
+
+	long := strings.Repeat("a ", 100) + "needle" + strings.Repeat(" b", 200)
+	got := snippet(long, highlightRegex([]string{"needle"}))
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") || !strings.Contains(got, "<mark>needle</mark>") {
+		t.Errorf("long snippet = %q, want a window around the match", got)
+	}
+
+	// Windows never split a multi-byte character.
+	multi := strings.Repeat("ñ", 100) + "needle"
+	if got := snippet(multi, highlightRegex([]string{"needle"})); !strings.HasPrefix(got, "…ñ") {
+		t.Errorf("snippet = %q, want it to start on a character boundary", got)
+	}
+}
+
+func TestBackfillSearch(t *testing.T) {
+	cs := newTestConversations(t)
+	const total = backfillBatchSize + 20
+	for i := range total {
+		appendConversation(t, cs, Conversation{ID: fmt.Sprintf("c%04d", i), Messages: []ConversationMessage{
+			{Role: "user", Content: fmt.Sprintf("word%d shared", i)},
+		}})
+	}
+	// Simulate a database created before the search index existed.
+	if _, err := cs.db.Exec(`DELETE FROM conversation_search`); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.backfillSearch(); err != nil {
+		t.Fatal(err)
+	}
+
+	var indexed int
+	if err := cs.db.QueryRow(`SELECT COUNT(*) FROM conversation_search`).Scan(&indexed); err != nil {
+		t.Fatal(err)
+	}
+	if indexed != total {
+		t.Errorf("indexed %d messages, want %d", indexed, total)
+	}
+	if got := listIDs(t, cs, ConversationFilter{Query: fmt.Sprintf("word%d", total-1)}); !slices.Equal(got, []string{fmt.Sprintf("c%04d", total-1)}) {
+		t.Errorf("search after backfill = %v", got)
+	}
+}
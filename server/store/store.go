@@ -4,11 +4,14 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
 	"sync"
+	"time"
 )
 
 // Store manages agent, backend, and MCP configurations with JSON persistence.
@@ -26,6 +29,10 @@ type Store struct {
 	filePath      string
 	encryptionKey string
 
+	// pendingWrite is a scheduled writeToDisk for users created by
+	// ResolveUser. Guarded by mu.
+	pendingWrite *time.Timer
+
 	changeMu   sync.Mutex
 	changeSubs []chan struct{}
 }
@@ -43,6 +50,10 @@ func New(filePath string, encryptionKey string) (*Store, error) {
 		Flows:           []FlowDefinition{},
 		Commands:        []Command{},
 		Secrets:         []Secret{},
+		Users:           []User{},
+		WakeWords:       []WakeWord{},
+		TTSVoices:       []TTSVoice{},
+		Voiceprints:     []Voiceprint{},
 	}
 	s := &Store{
 		filePath:      filePath,
@@ -689,6 +700,20 @@ func (s *Store) DeleteClient(id string) error {
 	return fmt.Errorf("client %q not found", id)
 }
 
+// RetentionPolicies returns the global conversation retention policy and the
+// policies of every client that defines its own.
+func (s *Store) RetentionPolicies() (*RetentionPolicy, map[string]*RetentionPolicy) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clients := map[string]*RetentionPolicy{}
+	for _, c := range s.data.Clients {
+		if c.Retention != nil {
+			clients[c.ID] = c.Retention
+		}
+	}
+	return s.data.Settings.Retention, clients
+}
+
 // RegenerateClientToken replaces a client's API token with a new random one.
 func (s *Store) RegenerateClientToken(id string) (ClientDefinition, error) {
 	s.mu.Lock()
@@ -1103,11 +1128,499 @@ func (s *Store) DeleteSecret(id string) error {
 	return fmt.Errorf("secret %q not found", id)
 }
 
+// --- Wake words ---
+
+func (s *Store) ListWakeWords() []WakeWord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]WakeWord, len(s.rawData.WakeWords))
+	copy(result, s.rawData.WakeWords)
+	return result
+}
+
+func (s *Store) GetWakeWord(id string) (WakeWord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, ww := range s.rawData.WakeWords {
+		if ww.ID == id {
+			return ww, true
+		}
+	}
+	return WakeWord{}, false
+}
+
+// CreateWakeWord stores a wake word and its ONNX model. The model is written
+// before subscribers are notified, so they can load it right away. It is
+// written to a temporary directory first so mu is only held for the rename.
+func (s *Store) CreateWakeWord(ww WakeWord, model []byte) (WakeWord, error) {
+	ww.ID = generateID()
+	ww.Size = int64(len(model))
+	path := s.WakeWordFile(ww.ID)
+	tmp, err := stageFiles(filepath.Dir(path), map[string][]byte{"model.onnx": model})
+	if err != nil {
+		return WakeWord{}, fmt.Errorf("failed to write wake word model: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Rename(filepath.Join(tmp, "model.onnx"), path); err != nil {
+		return WakeWord{}, fmt.Errorf("failed to write wake word model: %w", err)
+	}
+	s.data.WakeWords = append(s.data.WakeWords, ww)
+	s.rawData.WakeWords = append(s.rawData.WakeWords, ww)
+	return ww, s.persist()
+}
+
+// UpdateWakeWord replaces the name, phrase and threshold of a wake word. The
+// model is kept.
+func (s *Store) UpdateWakeWord(id string, ww WakeWord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.rawData.WakeWords {
+		if existing.ID == id {
+			ww.ID = id
+			ww.Size = existing.Size
+			s.data.WakeWords[i] = ww
+			s.rawData.WakeWords[i] = ww
+			return s.persist()
+		}
+	}
+	return fmt.Errorf("wake word %q not found", id)
+}
+
+// DeleteWakeWord removes a wake word and its model file.
+func (s *Store) DeleteWakeWord(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.rawData.WakeWords {
+		if existing.ID == id {
+			s.data.WakeWords = append(s.data.WakeWords[:i], s.data.WakeWords[i+1:]...)
+			s.rawData.WakeWords = append(s.rawData.WakeWords[:i], s.rawData.WakeWords[i+1:]...)
+			if err := s.persist(); err != nil {
+				return err
+			}
+			os.Remove(s.WakeWordFile(id))
+			return nil
+		}
+	}
+	return fmt.Errorf("wake word %q not found", id)
+}
+
+// stageFiles writes files into a new temporary directory under parent and
+// returns it. Uploads are staged this way without holding mu, then renamed
+// into place, which is cheap on the same filesystem.
+func stageFiles(parent string, files map[string][]byte) (string, error) {
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(parent, ".upload-")
+	if err != nil {
+		return "", err
+	}
+	// MkdirTemp creates 0700; staged directories may be renamed into place.
+	if err := os.Chmod(dir, 0o755); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// WakeWordFile returns the filesystem path of a wake word's ONNX model.
+func (s *Store) WakeWordFile(id string) string {
+	base := filepath.Dir(s.filePath)
+	return filepath.Join(base, "wakewords", id+".onnx")
+}
+
+// --- TTS voices ---
+
+func (s *Store) ListTTSVoices() []TTSVoice {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]TTSVoice, len(s.rawData.TTSVoices))
+	copy(result, s.rawData.TTSVoices)
+	return result
+}
+
+func (s *Store) GetTTSVoice(id string) (TTSVoice, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.rawData.TTSVoices {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return TTSVoice{}, false
+}
+
+// CreateTTSVoice stores a voice with its ONNX model and JSON config. The
+// files are written to a temporary directory first so mu is only held for
+// the rename.
+func (s *Store) CreateTTSVoice(v TTSVoice, model, config []byte) (TTSVoice, error) {
+	v.ID = generateID()
+	v.Size = int64(len(model))
+	dir := s.TTSVoiceDir(v.ID)
+	tmp, err := stageFiles(filepath.Dir(dir), map[string][]byte{
+		"model.onnx":      model,
+		"model.onnx.json": config,
+	})
+	if err != nil {
+		return TTSVoice{}, fmt.Errorf("failed to write voice files: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Rename(tmp, dir); err != nil {
+		return TTSVoice{}, fmt.Errorf("failed to write voice files: %w", err)
+	}
+	s.data.TTSVoices = append(s.data.TTSVoices, v)
+	s.rawData.TTSVoices = append(s.rawData.TTSVoices, v)
+	return v, s.persist()
+}
+
+// UpdateTTSVoice replaces the name and speaker of a voice. The model, its
+// config and what was read from it are kept.
+func (s *Store) UpdateTTSVoice(id string, v TTSVoice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.rawData.TTSVoices {
+		if existing.ID == id {
+			existing.Name = v.Name
+			existing.Speaker = v.Speaker
+			s.data.TTSVoices[i] = existing
+			s.rawData.TTSVoices[i] = existing
+			return s.persist()
+		}
+	}
+	return fmt.Errorf("voice %q not found", id)
+}
+
+// DeleteTTSVoice removes a voice and its files.
+func (s *Store) DeleteTTSVoice(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.rawData.TTSVoices {
+		if existing.ID == id {
+			s.data.TTSVoices = append(s.data.TTSVoices[:i], s.data.TTSVoices[i+1:]...)
+			s.rawData.TTSVoices = append(s.rawData.TTSVoices[:i], s.rawData.TTSVoices[i+1:]...)
+			if err := s.persist(); err != nil {
+				return err
+			}
+			os.RemoveAll(s.TTSVoiceDir(id))
+			return nil
+		}
+	}
+	return fmt.Errorf("voice %q not found", id)
+}
+
+// TTSVoiceDir returns the directory holding a voice's model.onnx and
+// model.onnx.json.
+func (s *Store) TTSVoiceDir(id string) string {
+	base := filepath.Dir(s.filePath)
+	return filepath.Join(base, "voices", id)
+}
+
+// --- Users ---
+//
+// The user directory does not affect the agent runtime or the running
+// clients, so its mutations use writeToDisk instead of persist: notifying
+// OnChange would rebuild every agent and reconcile every bot each time a new
+// sender writes for the first time.
+
+// Errors returned by the user directory, so callers can tell a bad request
+// from a missing user or a failed write.
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrIdentityInUse     = errors.New("identity is already linked to another user")
+	ErrIdentityNotLinked = errors.New("identity is not linked to this user")
+	ErrMergeIntoItself   = errors.New("cannot merge a user into itself")
+)
+
+// userWriteDelay batches the users created by ResolveUser into one write, so
+// a burst of new senders does not rewrite the store file once per sender.
+const userWriteDelay = 2 * time.Second
+
+func (s *Store) ListUsers() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]User, len(s.rawData.Users))
+	copy(result, s.rawData.Users)
+	return result
+}
+
+func (s *Store) GetUser(id string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.rawData.Users {
+		if u.ID == id {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *Store) CreateUser(u User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u.ID = generateID()
+	if u.Identities == nil {
+		u.Identities = []Identity{}
+	}
+	for _, ident := range u.Identities {
+		if owner := s.findIdentityOwner(ident); owner != "" {
+			return User{}, fmt.Errorf("%w: %s:%s belongs to user %q", ErrIdentityInUse, ident.Provider, ident.ExternalID, owner)
+		}
+	}
+	// Both copies get their own identities, so appending to one never
+	// writes into the other or into the caller's slice.
+	s.data.Users = append(s.data.Users, User{ID: u.ID, Name: u.Name, Identities: slices.Clone(u.Identities)})
+	s.rawData.Users = append(s.rawData.Users, User{ID: u.ID, Name: u.Name, Identities: slices.Clone(u.Identities)})
+	return u, s.writeToDisk()
+}
+
+// UpdateUser replaces a user's name. Identities are managed through
+// LinkIdentity, UnlinkIdentity and MergeUsers.
+func (s *Store) UpdateUser(id string, u User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.rawData.Users {
+		if existing.ID == id {
+			s.data.Users[i].Name = u.Name
+			s.rawData.Users[i].Name = u.Name
+			return s.writeToDisk()
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUserNotFound, id)
+}
+
+func (s *Store) DeleteUser(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.rawData.Users {
+		if existing.ID == id {
+			s.data.Users = append(s.data.Users[:i], s.data.Users[i+1:]...)
+			s.rawData.Users = append(s.rawData.Users[:i], s.rawData.Users[i+1:]...)
+			s.removeVoiceprint(id)
+			return s.writeToDisk()
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUserNotFound, id)
+}
+
+// ResolveUser returns the Magec user ID that owns the given external identity.
+// Unknown identities get a new user created on the fly, so every sender has a
+// stable ADK user ID from the first message. Admins can merge these users later.
+// New users are written to disk within userWriteDelay, together with any
+// other users created meanwhile.
+func (s *Store) ResolveUser(provider, externalID, name string) (string, error) {
+	ident := Identity{Provider: provider, ExternalID: externalID}
+
+	s.mu.RLock()
+	owner := s.findIdentityOwner(ident)
+	s.mu.RUnlock()
+	if owner != "" {
+		return owner, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if owner := s.findIdentityOwner(ident); owner != "" {
+		return owner, nil
+	}
+	if name == "" {
+		name = provider + ":" + externalID
+	}
+	id := generateID()
+	s.data.Users = append(s.data.Users, User{ID: id, Name: name, Identities: []Identity{ident}})
+	s.rawData.Users = append(s.rawData.Users, User{ID: id, Name: name, Identities: []Identity{ident}})
+	s.writeSoon()
+	return id, nil
+}
+
+// LinkIdentity attaches an external identity to a user. If the identity is
+// currently linked to another user it is moved.
+func (s *Store) LinkIdentity(userID string, ident Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := slices.IndexFunc(s.rawData.Users, func(u User) bool { return u.ID == userID })
+	if idx < 0 {
+		return fmt.Errorf("%w: %q", ErrUserNotFound, userID)
+	}
+	if slices.Contains(s.rawData.Users[idx].Identities, ident) {
+		return nil
+	}
+	s.removeIdentity(ident)
+	s.data.Users[idx].Identities = append(s.data.Users[idx].Identities, ident)
+	s.rawData.Users[idx].Identities = append(s.rawData.Users[idx].Identities, ident)
+	return s.writeToDisk()
+}
+
+// UnlinkIdentity detaches an external identity from a user. The next message
+// from that identity will resolve to a fresh user.
+func (s *Store) UnlinkIdentity(userID string, ident Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.ContainsFunc(s.rawData.Users, func(u User) bool { return u.ID == userID }) {
+		return fmt.Errorf("%w: %q", ErrUserNotFound, userID)
+	}
+	if owner := s.findIdentityOwner(ident); owner != userID {
+		return fmt.Errorf("%w: %s:%s", ErrIdentityNotLinked, ident.Provider, ident.ExternalID)
+	}
+	s.removeIdentity(ident)
+	return s.writeToDisk()
+}
+
+// MergeUsers moves every identity of sourceID into targetID and deletes the
+// source user. The source's voiceprint is kept when the target has none.
+// Sessions and memories live outside the store; the caller moves them.
+func (s *Store) MergeUsers(targetID, sourceID string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if targetID == sourceID {
+		return User{}, fmt.Errorf("%w: %q", ErrMergeIntoItself, targetID)
+	}
+	ti := slices.IndexFunc(s.rawData.Users, func(u User) bool { return u.ID == targetID })
+	if ti < 0 {
+		return User{}, fmt.Errorf("%w: %q", ErrUserNotFound, targetID)
+	}
+	si := slices.IndexFunc(s.rawData.Users, func(u User) bool { return u.ID == sourceID })
+	if si < 0 {
+		return User{}, fmt.Errorf("%w: %q", ErrUserNotFound, sourceID)
+	}
+
+	moved := s.rawData.Users[si].Identities
+	s.data.Users[ti].Identities = append(s.data.Users[ti].Identities, moved...)
+	s.rawData.Users[ti].Identities = append(s.rawData.Users[ti].Identities, moved...)
+	merged := s.rawData.Users[ti]
+
+	s.data.Users = append(s.data.Users[:si], s.data.Users[si+1:]...)
+	s.rawData.Users = append(s.rawData.Users[:si], s.rawData.Users[si+1:]...)
+
+	if !slices.ContainsFunc(s.rawData.Voiceprints, func(v Voiceprint) bool { return v.UserID == targetID }) {
+		for _, voiceprints := range []*[]Voiceprint{&s.data.Voiceprints, &s.rawData.Voiceprints} {
+			for i := range *voiceprints {
+				if (*voiceprints)[i].UserID == sourceID {
+					(*voiceprints)[i].UserID = targetID
+				}
+			}
+		}
+	}
+	s.removeVoiceprint(sourceID)
+	return merged, s.writeToDisk()
+}
+
+// findIdentityOwner returns the ID of the user owning ident, or "".
+// Caller must hold s.mu.
+func (s *Store) findIdentityOwner(ident Identity) string {
+	for _, u := range s.rawData.Users {
+		if slices.Contains(u.Identities, ident) {
+			return u.ID
+		}
+	}
+	return ""
+}
+
+// removeIdentity drops ident from whichever user owns it. Caller must hold s.mu.
+func (s *Store) removeIdentity(ident Identity) {
+	for _, users := range []*[]User{&s.data.Users, &s.rawData.Users} {
+		for i := range *users {
+			(*users)[i].Identities = slices.DeleteFunc((*users)[i].Identities, func(id Identity) bool { return id == ident })
+		}
+	}
+}
+
+// --- Voiceprints ---
+
+func (s *Store) ListVoiceprints() []Voiceprint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]Voiceprint, len(s.rawData.Voiceprints))
+	copy(result, s.rawData.Voiceprints)
+	return result
+}
+
+func (s *Store) GetVoiceprint(userID string) (Voiceprint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.rawData.Voiceprints {
+		if v.UserID == userID {
+			return v, true
+		}
+	}
+	return Voiceprint{}, false
+}
+
+// SaveVoiceprint creates or replaces the voiceprint of a user.
+func (s *Store) SaveVoiceprint(v Voiceprint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.ContainsFunc(s.rawData.Users, func(u User) bool { return u.ID == v.UserID }) {
+		return fmt.Errorf("user %q not found", v.UserID)
+	}
+	v.Embedding = slices.Clone(v.Embedding)
+	if i := slices.IndexFunc(s.rawData.Voiceprints, func(e Voiceprint) bool { return e.UserID == v.UserID }); i >= 0 {
+		s.data.Voiceprints[i] = v
+		s.rawData.Voiceprints[i] = v
+	} else {
+		s.data.Voiceprints = append(s.data.Voiceprints, v)
+		s.rawData.Voiceprints = append(s.rawData.Voiceprints, v)
+	}
+	return s.writeToDisk()
+}
+
+func (s *Store) DeleteVoiceprint(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.ContainsFunc(s.rawData.Voiceprints, func(v Voiceprint) bool { return v.UserID == userID }) {
+		return fmt.Errorf("user %q has no voiceprint", userID)
+	}
+	s.removeVoiceprint(userID)
+	return s.writeToDisk()
+}
+
+// removeVoiceprint drops the voiceprint of a user. Caller must hold s.mu.
+func (s *Store) removeVoiceprint(userID string) {
+	for _, voiceprints := range []*[]Voiceprint{&s.data.Voiceprints, &s.rawData.Voiceprints} {
+		*voiceprints = slices.DeleteFunc(*voiceprints, func(v Voiceprint) bool { return v.UserID == userID })
+	}
+}
+
 // --- Persistence (internal) ---
 
 // persist writes the current store data to disk as formatted JSON and
 // notifies all change subscribers.
 func (s *Store) persist() error {
+	if err := s.writeToDisk(); err != nil {
+		return err
+	}
+	s.notifyChange()
+	return nil
+}
+
+// writeToDisk writes the current store data to disk without notifying change
+// subscribers. Used for mutations that don't affect the agent runtime.
+func (s *Store) writeToDisk() error {
 	if s.filePath == "" {
 		return nil
 	}
@@ -1125,11 +1638,42 @@ func (s *Store) persist() error {
 	if err := os.WriteFile(s.filePath, data, 0o644); err != nil {
 		return fmt.Errorf("failed to write store file: %w", err)
 	}
-
-	s.notifyChange()
+	if s.pendingWrite != nil {
+		s.pendingWrite.Stop()
+		s.pendingWrite = nil
+	}
 	return nil
 }
 
+// writeSoon schedules a writeToDisk after userWriteDelay unless one is
+// already pending. Caller must hold s.mu.
+func (s *Store) writeSoon() {
+	if s.filePath == "" || s.pendingWrite != nil {
+		return
+	}
+	s.pendingWrite = time.AfterFunc(userWriteDelay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.pendingWrite == nil {
+			return
+		}
+		s.pendingWrite = nil
+		if err := s.writeToDisk(); err != nil {
+			slog.Error("Failed to save new users", "error", err)
+		}
+	})
+}
+
+// Flush writes any pending changes to disk. Call it before shutting down.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pendingWrite == nil {
+		return nil
+	}
+	return s.writeToDisk()
+}
+
 // notifyChange sends a non-blocking signal to all OnChange subscribers.
 func (s *Store) notifyChange() {
 	s.changeMu.Lock()
@@ -1205,6 +1749,18 @@ func (s *Store) loadFromDisk() error {
 		if sd.Secrets == nil {
 			sd.Secrets = []Secret{}
 		}
+		if sd.Users == nil {
+			sd.Users = []User{}
+		}
+		if sd.WakeWords == nil {
+			sd.WakeWords = []WakeWord{}
+		}
+		if sd.TTSVoices == nil {
+			sd.TTSVoices = []TTSVoice{}
+		}
+		if sd.Voiceprints == nil {
+			sd.Voiceprints = []Voiceprint{}
+		}
 	}
 
 	initSlices(&storeData)
@@ -94,23 +94,30 @@ type MCPServer struct {
 // ClientDefinition represents an access point (voice-ui, Telegram, Discord, webhook, etc.).
 // Type determines what platform-specific config is expected inside Config.
 type ClientDefinition struct {
-	ID            string       `json:"id" yaml:"id"`
-	Name          string       `json:"name" yaml:"name"`
-	Type          string       `json:"type" yaml:"type"`
-	Token         string       `json:"token" yaml:"token"`
-	AllowedAgents []string     `json:"allowedAgents" yaml:"allowedAgents"`
-	Enabled       bool         `json:"enabled" yaml:"enabled"`
-	Config        ClientConfig `json:"config" yaml:"config"`
+	ID            string           `json:"id" yaml:"id"`
+	Name          string           `json:"name" yaml:"name"`
+	Type          string           `json:"type" yaml:"type"`
+	Token         string           `json:"token" yaml:"token"`
+	AllowedAgents []string         `json:"allowedAgents" yaml:"allowedAgents"`
+	Enabled       bool             `json:"enabled" yaml:"enabled"`
+	Config        ClientConfig     `json:"config" yaml:"config"`
+	Retention     *RetentionPolicy `json:"retention,omitempty" yaml:"retention,omitempty"`
+	Voice         *VoiceSettings   `json:"voice,omitempty" yaml:"voice,omitempty"`
 }
 
 // ClientConfig holds platform-specific configuration. Only the field matching
 // the ClientDefinition.Type should be populated.
 type ClientConfig struct {
-	Telegram *TelegramClientConfig `json:"telegram,omitempty" yaml:"telegram,omitempty"`
-	Discord  *DiscordClientConfig  `json:"discord,omitempty" yaml:"discord,omitempty"`
-	Slack    *SlackClientConfig    `json:"slack,omitempty" yaml:"slack,omitempty"`
-	Cron     *CronClientConfig     `json:"cron,omitempty" yaml:"cron,omitempty"`
-	Webhook  *WebhookClientConfig  `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+	Telegram   *TelegramClientConfig   `json:"telegram,omitempty" yaml:"telegram,omitempty"`
+	Discord    *DiscordClientConfig    `json:"discord,omitempty" yaml:"discord,omitempty"`
+	Slack      *SlackClientConfig      `json:"slack,omitempty" yaml:"slack,omitempty"`
+	Matrix     *MatrixClientConfig     `json:"matrix,omitempty" yaml:"matrix,omitempty"`
+	Mattermost *MattermostClientConfig `json:"mattermost,omitempty" yaml:"mattermost,omitempty"`
+	Email      *EmailClientConfig      `json:"email,omitempty" yaml:"email,omitempty"`
+	MQTT       *MQTTClientConfig       `json:"mqtt,omitempty" yaml:"mqtt,omitempty"`
+	Cron       *CronClientConfig       `json:"cron,omitempty" yaml:"cron,omitempty"`
+	Webhook    *WebhookClientConfig    `json:"webhook,omitempty" yaml:"webhook,omitempty"`
+	Wyoming    *WyomingClientConfig    `json:"wyoming,omitempty" yaml:"wyoming,omitempty"`
 }
 
 // TelegramClientConfig holds Telegram bot settings for a client.
@@ -145,19 +152,124 @@ type SlackClientConfig struct {
 	ThreadHistoryLimit int      `json:"threadHistoryLimit,omitempty" yaml:"threadHistoryLimit,omitempty"`
 }
 
+// MatrixClientConfig holds Matrix bot settings for a client.
+// Uses the client-server API with /sync long-polling — no public URL needed.
+type MatrixClientConfig struct {
+	HomeserverURL      string   `json:"homeserverUrl,omitempty" yaml:"homeserverUrl,omitempty"`
+	AccessToken        string   `json:"accessToken,omitempty" yaml:"accessToken,omitempty"`
+	AllowedUsers       []string `json:"allowedUsers,omitempty" yaml:"allowedUsers,omitempty"`
+	AllowedRooms       []string `json:"allowedRooms,omitempty" yaml:"allowedRooms,omitempty"`
+	ResponseMode       string   `json:"responseMode,omitempty" yaml:"responseMode,omitempty"`
+	DefaultAgent       string   `json:"defaultAgent,omitempty" yaml:"defaultAgent,omitempty"`
+	ThreadHistoryLimit int      `json:"threadHistoryLimit,omitempty" yaml:"threadHistoryLimit,omitempty"`
+}
+
+// MattermostClientConfig holds Mattermost bot settings for a client.
+// Uses the WebSocket event API for incoming posts and REST for replies.
+type MattermostClientConfig struct {
+	ServerURL          string   `json:"serverUrl,omitempty" yaml:"serverUrl,omitempty"`
+	BotToken           string   `json:"botToken,omitempty" yaml:"botToken,omitempty"`
+	AllowedUsers       []string `json:"allowedUsers,omitempty" yaml:"allowedUsers,omitempty"`
+	AllowedChannels    []string `json:"allowedChannels,omitempty" yaml:"allowedChannels,omitempty"`
+	ResponseMode       string   `json:"responseMode,omitempty" yaml:"responseMode,omitempty"`
+	DefaultAgent       string   `json:"defaultAgent,omitempty" yaml:"defaultAgent,omitempty"`
+	ThreadHistoryLimit int      `json:"threadHistoryLimit,omitempty" yaml:"threadHistoryLimit,omitempty"`
+}
+
+// EmailClientConfig holds mailbox settings for an email client.
+// Incoming mail is polled over IMAP and replies are sent over SMTP.
+// AllowedSenders are only trusted when the receiving server authenticated
+// the sender; AuthServID names the server whose Authentication-Results
+// header is read.
+type EmailClientConfig struct {
+	Address        string   `json:"address,omitempty" yaml:"address,omitempty"`
+	Username       string   `json:"username,omitempty" yaml:"username,omitempty"`
+	Password       string   `json:"password,omitempty" yaml:"password,omitempty"`
+	IMAPHost       string   `json:"imapHost,omitempty" yaml:"imapHost,omitempty"`
+	IMAPPort       int      `json:"imapPort,omitempty" yaml:"imapPort,omitempty"`
+	IMAPSecurity   string   `json:"imapSecurity,omitempty" yaml:"imapSecurity,omitempty"`
+	Mailbox        string   `json:"mailbox,omitempty" yaml:"mailbox,omitempty"`
+	PollInterval   int      `json:"pollInterval,omitempty" yaml:"pollInterval,omitempty"`
+	SMTPHost       string   `json:"smtpHost,omitempty" yaml:"smtpHost,omitempty"`
+	SMTPPort       int      `json:"smtpPort,omitempty" yaml:"smtpPort,omitempty"`
+	SMTPSecurity   string   `json:"smtpSecurity,omitempty" yaml:"smtpSecurity,omitempty"`
+	AllowedSenders []string `json:"allowedSenders,omitempty" yaml:"allowedSenders,omitempty"`
+	AuthServID     string   `json:"authServId,omitempty" yaml:"authServId,omitempty"`
+	DefaultAgent   string   `json:"defaultAgent,omitempty" yaml:"defaultAgent,omitempty"`
+}
+
+// MQTTClientConfig holds broker settings for an MQTT client. Each message
+// on Topics runs the client (payload as prompt, or CommandID templated with
+// the payload) and the response is published to ReplyTopic.
+type MQTTClientConfig struct {
+	BrokerURL  string   `json:"brokerUrl,omitempty" yaml:"brokerUrl,omitempty"`
+	ClientID   string   `json:"clientId,omitempty" yaml:"clientId,omitempty"`
+	Username   string   `json:"username,omitempty" yaml:"username,omitempty"`
+	Password   string   `json:"password,omitempty" yaml:"password,omitempty"`
+	Topics     []string `json:"topics,omitempty" yaml:"topics,omitempty"`
+	QoS        int      `json:"qos,omitempty" yaml:"qos,omitempty"`
+	CommandID  string   `json:"commandId,omitempty" yaml:"commandId,omitempty"`
+	ReplyTopic string   `json:"replyTopic,omitempty" yaml:"replyTopic,omitempty"`
+}
+
+// WyomingClientConfig holds settings for a Wyoming protocol server, used by
+// Home Assistant voice satellites. Listen is the TCP address to serve on
+// (e.g. "0.0.0.0:10700"); without a host it binds to loopback, as the
+// protocol has no authentication. Languages are advertised to Home Assistant ("en" when
+// empty).
+type WyomingClientConfig struct {
+	Listen    string   `json:"listen,omitempty" yaml:"listen,omitempty"`
+	Languages []string `json:"languages,omitempty" yaml:"languages,omitempty"`
+}
+
 // CronClientConfig holds settings for a cron-type client.
+// Timezone is an IANA name (server local time when empty). CatchUp decides
+// what happens to runs missed while the server was down: "skip" (default),
+// "once" or "all".
+// The result of each run can be delivered through another client
+// (a chat bot, or a Direct client for voice UI notifications) and/or
+// POSTed to an outbound URL. A failed delivery is retried DeliveryRetries
+// times, 3 when unset; it is a pointer because 0 turns retries off.
 type CronClientConfig struct {
-	Schedule  string `json:"schedule" yaml:"schedule"`
-	CommandID string `json:"commandId" yaml:"commandId"`
+	Schedule         string `json:"schedule" yaml:"schedule"`
+	CommandID        string `json:"commandId" yaml:"commandId"`
+	Timezone         string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+	CatchUp          string `json:"catchUp,omitempty" yaml:"catchUp,omitempty"`
+	DeliveryClientID string `json:"deliveryClientId,omitempty" yaml:"deliveryClientId,omitempty"`
+	DeliveryTarget   string `json:"deliveryTarget,omitempty" yaml:"deliveryTarget,omitempty"`
+	DeliveryURL      string `json:"deliveryUrl,omitempty" yaml:"deliveryUrl,omitempty"`
+	DeliveryRetries  *int   `json:"deliveryRetries,omitempty" yaml:"deliveryRetries,omitempty"`
 }
 
 // WebhookClientConfig holds settings for a webhook-type client.
 // Exactly one of Passthrough or CommandID must be set.
 // When Passthrough is true, the prompt comes from the request body.
 // When Passthrough is false, CommandID is required.
+// When Async is true, requests are queued as jobs and answered right away
+// with a job ID; results are polled or POSTed to CallbackURL. A request
+// may name its own callback only if it is CallbackURL or starts with one of
+// AllowedCallbackURLs.
+// In passthrough mode, PromptTemplate renders the prompt from an arbitrary
+// JSON body, so third-party services can call the webhook directly. Auth
+// selects how requests are authenticated: "token" (default, bearer client
+// token), "github" (X-Hub-Signature-256) or "hmac" (HMAC-SHA256 of the body
+// in SignatureHeader), the last two keyed with Secret. Requests whose
+// EventHeader is not in Events, or whose FilterPath value is not in
+// FilterValues, are acknowledged without running.
 type WebhookClientConfig struct {
-	Passthrough bool   `json:"passthrough" yaml:"passthrough"`
-	CommandID   string `json:"commandId,omitempty" yaml:"commandId,omitempty"`
+	Passthrough         bool     `json:"passthrough" yaml:"passthrough"`
+	CommandID           string   `json:"commandId,omitempty" yaml:"commandId,omitempty"`
+	Async               bool     `json:"async,omitempty" yaml:"async,omitempty"`
+	CallbackURL         string   `json:"callbackUrl,omitempty" yaml:"callbackUrl,omitempty"`
+	AllowedCallbackURLs []string `json:"allowedCallbackUrls,omitempty" yaml:"allowedCallbackUrls,omitempty"`
+	PromptTemplate      string   `json:"promptTemplate,omitempty" yaml:"promptTemplate,omitempty"`
+	Auth                string   `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Secret              string   `json:"secret,omitempty" yaml:"secret,omitempty"`
+	SignatureHeader     string   `json:"signatureHeader,omitempty" yaml:"signatureHeader,omitempty"`
+	EventHeader         string   `json:"eventHeader,omitempty" yaml:"eventHeader,omitempty"`
+	Events              []string `json:"events,omitempty" yaml:"events,omitempty"`
+	FilterPath          string   `json:"filterPath,omitempty" yaml:"filterPath,omitempty"`
+	FilterValues        []string `json:"filterValues,omitempty" yaml:"filterValues,omitempty"`
 }
 
 // SkillReference holds metadata for a file uploaded as a skill resource.
@@ -276,8 +388,73 @@ type FlowDefinition struct {
 // Settings holds global configuration that applies to the launcher/runtime
 // rather than to individual entities.
 type Settings struct {
-	SessionProvider  string `json:"sessionProvider,omitempty" yaml:"sessionProvider,omitempty"`
-	LongTermProvider string `json:"longTermProvider,omitempty" yaml:"longTermProvider,omitempty"`
+	SessionProvider  string           `json:"sessionProvider,omitempty" yaml:"sessionProvider,omitempty"`
+	LongTermProvider string           `json:"longTermProvider,omitempty" yaml:"longTermProvider,omitempty"`
+	Retention        *RetentionPolicy `json:"retention,omitempty" yaml:"retention,omitempty"`
+}
+
+// RetentionPolicy controls how long conversation logs are kept. 0 means
+// "keep forever" and unset fields are inherited: a client's policy overrides
+// the global one field by field, so "days": 0 opts a client out of a global
+// limit. SourceDays entries are merged by source, and a source listed with 0
+// is never pruned.
+type RetentionPolicy struct {
+	Days           *int           `json:"days,omitempty" yaml:"days,omitempty"`                     // default for every source
+	SourceDays     map[string]int `json:"sourceDays,omitempty" yaml:"sourceDays,omitempty"`         // per-source override, e.g. {"webhook": 7}
+	RawEventsHours *int           `json:"rawEventsHours,omitempty" yaml:"rawEventsHours,omitempty"` // drop RawEvents after this many hours
+}
+
+// WakeWord is a custom openWakeWord model uploaded through the Admin API.
+// The model itself is stored in the data directory (see Store.WakeWordFile).
+type WakeWord struct {
+	ID        string  `json:"id" yaml:"id"`
+	Name      string  `json:"name" yaml:"name"`
+	Phrase    string  `json:"phrase" yaml:"phrase"`
+	Threshold float32 `json:"threshold" yaml:"threshold"`
+	Size      int64   `json:"size" yaml:"size"` // bytes of the model file
+}
+
+// TTSVoice is a Piper voice uploaded through the Admin API for backends of
+// type "local". The model and its config are stored in the data directory
+// (see Store.TTSVoiceDir).
+type TTSVoice struct {
+	ID         string   `json:"id" yaml:"id"`
+	Name       string   `json:"name" yaml:"name"`
+	Language   string   `json:"language,omitempty" yaml:"language,omitempty"`
+	SampleRate int      `json:"sampleRate" yaml:"sampleRate"`
+	Speakers   []string `json:"speakers,omitempty" yaml:"speakers,omitempty"` // multi-speaker voices only
+	Speaker    string   `json:"speaker,omitempty" yaml:"speaker,omitempty"`   // speaker to use, the first when empty
+	Size       int64    `json:"size" yaml:"size"`                             // bytes of the model file
+}
+
+// Voiceprint is the enrolled voice of a user: the mean of the speaker
+// embeddings of their samples. Embeddings of different models can't be
+// compared, so Model records the one it was computed with.
+type Voiceprint struct {
+	UserID    string    `json:"userId" yaml:"userId"`
+	Model     string    `json:"model" yaml:"model"`
+	Samples   int       `json:"samples" yaml:"samples"`
+	Embedding []float32 `json:"embedding" yaml:"embedding"`
+}
+
+// VoiceSettings tunes voice detection for a client that streams audio
+// (Voice UI, voice sessions, Wyoming satellites). Zero or nil values use the
+// server defaults; a connection can override some of them with its "config"
+// message (see Override). MinSpeech and SpeakerID are pointers because 0 and
+// false are settings of their own.
+type VoiceSettings struct {
+	VADThreshold      float32 `json:"vadThreshold,omitempty" yaml:"vadThreshold,omitempty"`           // speech probability
+	SilenceTimeout    int     `json:"silenceTimeout,omitempty" yaml:"silenceTimeout,omitempty"`       // ms of silence that end speech
+	MinSpeech         *int    `json:"minSpeech,omitempty" yaml:"minSpeech,omitempty"`                 // ms of speech before it starts
+	WakewordThreshold float32 `json:"wakewordThreshold,omitempty" yaml:"wakewordThreshold,omitempty"` // wake word score, overrides the model's
+	// Wakewords restricts the client to these wake word IDs, the first one
+	// active by default. Empty allows them all.
+	Wakewords []string `json:"wakewords,omitempty" yaml:"wakewords,omitempty"`
+	// SpeakerID identifies the enrolled user speaking each utterance, who
+	// the turn then runs as. SpeakerThreshold is the similarity a voice
+	// must reach to be recognized.
+	SpeakerID        *bool   `json:"speakerId,omitempty" yaml:"speakerId,omitempty"`
+	SpeakerThreshold float32 `json:"speakerThreshold,omitempty" yaml:"speakerThreshold,omitempty"`
 }
 
 // Secret represents an encrypted key-value pair used for environment variable injection.
@@ -291,6 +468,32 @@ type Secret struct {
 	Description string `json:"description,omitempty" yaml:"description,omitempty"`
 }
 
+// Identity providers that can be linked to a User.
+const (
+	IdentityTelegram   = "telegram"
+	IdentitySlack      = "slack"
+	IdentityDiscord    = "discord"
+	IdentityMatrix     = "matrix"
+	IdentityEmail      = "email"
+	IdentityMattermost = "mattermost"
+	IdentityClient     = "client" // Magec client (e.g. voice UI), keyed by client ID
+)
+
+// Identity is an external account that belongs to a Magec user, such as a
+// Telegram user ID or the ID of a paired voice-UI client.
+type Identity struct {
+	Provider   string `json:"provider" yaml:"provider"`
+	ExternalID string `json:"externalId" yaml:"externalId"`
+}
+
+// User is a person known to Magec. All linked identities share the same ADK
+// user ID, so sessions and long-term memory follow the person across clients.
+type User struct {
+	ID         string     `json:"id" yaml:"id"`
+	Name       string     `json:"name" yaml:"name"`
+	Identities []Identity `json:"identities" yaml:"identities"`
+}
+
 // StoreData is the top-level structure persisted to disk.
 type StoreData struct {
 	Settings        Settings            `json:"settings"`
@@ -303,4 +506,8 @@ type StoreData struct {
 	Flows           []FlowDefinition    `json:"flows"`
 	Commands        []Command           `json:"commands"`
 	Secrets         []Secret            `json:"secrets"`
+	Users           []User              `json:"users"`
+	WakeWords       []WakeWord          `json:"wakeWords"`
+	TTSVoices       []TTSVoice          `json:"ttsVoices"`
+	Voiceprints     []Voiceprint        `json:"voiceprints"`
 }
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "store.json"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// savedUsers reads the users back from the store file.
+func savedUsers(t *testing.T, s *Store) []User {
+	t.Helper()
+	raw, err := os.ReadFile(s.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data StoreData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.Users
+}
+
+func TestResolveUser(t *testing.T) {
+	s := newTestStore(t)
+
+	id, err := s.ResolveUser(IdentityTelegram, "42", "Ana")
+	if err != nil || id == "" {
+		t.Fatalf("ResolveUser() = %q, %v", id, err)
+	}
+	again, err := s.ResolveUser(IdentityTelegram, "42", "Ana López")
+	if err != nil || again != id {
+		t.Errorf("second ResolveUser() = %q, %v, want %q", again, err, id)
+	}
+	other, _ := s.ResolveUser(IdentitySlack, "42", "")
+	if other == id {
+		t.Error("expected the same external ID on another provider to be another user")
+	}
+
+	u, ok := s.GetUser(other)
+	if !ok || u.Name != "slack:42" {
+		t.Errorf("GetUser(%q) = %+v, want a user named after the identity", other, u)
+	}
+	if n := len(s.ListUsers()); n != 2 {
+		t.Errorf("got %d users, want 2", n)
+	}
+
+	// New users are written in one batch, at the latest on Flush.
+	if _, err := os.Stat(s.filePath); !os.IsNotExist(err) {
+		t.Errorf("expected no write per new sender, stat error = %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(savedUsers(t, s)); n != 2 {
+		t.Errorf("saved %d users, want 2", n)
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	s := newTestStore(t)
+	ana, _ := s.CreateUser(User{Name: "Ana"})
+	tg, _ := s.ResolveUser(IdentityTelegram, "42", "")
+
+	ident := Identity{Provider: IdentityTelegram, ExternalID: "42"}
+	if err := s.LinkIdentity(ana.ID, ident); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.ResolveUser(IdentityTelegram, "42", ""); got != ana.ID {
+		t.Errorf("identity resolves to %q, want %q", got, ana.ID)
+	}
+	if u, _ := s.GetUser(tg); len(u.Identities) != 0 {
+		t.Errorf("expected the identity to leave its previous user, got %v", u.Identities)
+	}
+
+	if err := s.LinkIdentity(ana.ID, ident); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := s.GetUser(ana.ID); len(u.Identities) != 1 {
+		t.Errorf("linking twice should not duplicate the identity, got %v", u.Identities)
+	}
+
+	if err := s.LinkIdentity("missing", ident); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("LinkIdentity(missing) error = %v, want ErrUserNotFound", err)
+	}
+	if saved := savedUsers(t, s); !slices.ContainsFunc(saved, func(u User) bool {
+		return u.ID == ana.ID && slices.Contains(u.Identities, ident)
+	}) {
+		t.Error("expected the link to be saved")
+	}
+}
+
+func TestUnlinkIdentity(t *testing.T) {
+	s := newTestStore(t)
+	ident := Identity{Provider: IdentityDiscord, ExternalID: "7"}
+	ana, _ := s.CreateUser(User{Name: "Ana", Identities: []Identity{ident}})
+	bob, _ := s.CreateUser(User{Name: "Bob"})
+
+	if err := s.UnlinkIdentity(bob.ID, ident); !errors.Is(err, ErrIdentityNotLinked) {
+		t.Errorf("unlinking another user's identity: error = %v, want ErrIdentityNotLinked", err)
+	}
+	missing := Identity{Provider: IdentityDiscord, ExternalID: "8"}
+	if err := s.UnlinkIdentity(ana.ID, missing); !errors.Is(err, ErrIdentityNotLinked) {
+		t.Errorf("unlinking a missing identity: error = %v, want ErrIdentityNotLinked", err)
+	}
+	if err := s.UnlinkIdentity("missing", ident); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unlinking from a missing user: error = %v, want ErrUserNotFound", err)
+	}
+
+	if err := s.UnlinkIdentity(ana.ID, ident); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.ResolveUser(IdentityDiscord, "7", ""); got == ana.ID {
+		t.Error("expected an unlinked identity to resolve to a new user")
+	}
+}
+
+func TestMergeUsers(t *testing.T) {
+	s := newTestStore(t)
+	ana, _ := s.CreateUser(User{Name: "Ana", Identities: []Identity{{Provider: IdentityTelegram, ExternalID: "1"}}})
+	src, _ := s.CreateUser(User{Name: "slack:U1", Identities: []Identity{{Provider: IdentitySlack, ExternalID: "U1"}}})
+
+	if err := s.SaveVoiceprint(Voiceprint{UserID: src.ID, Embedding: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := s.MergeUsers(ana.ID, src.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Identities) != 2 {
+		t.Errorf("merged identities = %v, want both", merged.Identities)
+	}
+	if _, ok := s.GetUser(src.ID); ok {
+		t.Error("expected the source user to be deleted")
+	}
+	if got, _ := s.ResolveUser(IdentitySlack, "U1", ""); got != ana.ID {
+		t.Errorf("source identity resolves to %q, want %q", got, ana.ID)
+	}
+	if v, ok := s.GetVoiceprint(ana.ID); !ok || v.Embedding[0] != 1 {
+		t.Errorf("expected the source voiceprint to move to the target, got %+v", v)
+	}
+	if n := len(savedUsers(t, s)); n != 1 {
+		t.Errorf("saved %d users, want 1", n)
+	}
+}
+
+func TestMergeUsers_TargetKeepsVoiceprint(t *testing.T) {
+	s := newTestStore(t)
+	ana, _ := s.CreateUser(User{Name: "Ana"})
+	src, _ := s.CreateUser(User{Name: "Other"})
+	_ = s.SaveVoiceprint(Voiceprint{UserID: ana.ID, Embedding: []float32{1, 0}})
+	_ = s.SaveVoiceprint(Voiceprint{UserID: src.ID, Embedding: []float32{0, 1}})
+
+	if _, err := s.MergeUsers(ana.ID, src.ID); err != nil {
+		t.Fatal(err)
+	}
+	voiceprints := s.ListVoiceprints()
+	if len(voiceprints) != 1 || voiceprints[0].UserID != ana.ID || voiceprints[0].Embedding[0] != 1 {
+		t.Errorf("voiceprints = %+v, want only the target's own", voiceprints)
+	}
+}
+
+func TestMergeUsers_Errors(t *testing.T) {
+	s := newTestStore(t)
+	ana, _ := s.CreateUser(User{Name: "Ana"})
+
+	tests := []struct {
+		name           string
+		target, source string
+		want           error
+	}{
+		{"into itself", ana.ID, ana.ID, ErrMergeIntoItself},
+		{"missing source", ana.ID, "missing", ErrUserNotFound},
+		{"missing target", "missing", ana.ID, ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.MergeUsers(tt.target, tt.source); !errors.Is(err, tt.want) {
+				t.Errorf("MergeUsers() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateUser_IdentityInUse(t *testing.T) {
+	s := newTestStore(t)
+	ident := Identity{Provider: IdentityEmail, ExternalID: "ana@example.com"}
+	if _, err := s.CreateUser(User{Name: "Ana", Identities: []Identity{ident}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser(User{Name: "Copy", Identities: []Identity{ident}}); !errors.Is(err, ErrIdentityInUse) {
+		t.Errorf("CreateUser() error = %v, want ErrIdentityInUse", err)
+	}
+}
+
+func TestCreateUser_CopiesIdentities(t *testing.T) {
+	s := newTestStore(t)
+	idents := make([]Identity, 1, 4)
+	idents[0] = Identity{Provider: IdentityEmail, ExternalID: "ana@example.com"}
+	u, err := s.CreateUser(User{Name: "Ana", Identities: idents})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LinkIdentity(u.ID, Identity{Provider: IdentityTelegram, ExternalID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	idents[0].ExternalID = "changed@example.com"
+	if extra := idents[:2]; extra[1].Provider != "" {
+		t.Errorf("LinkIdentity wrote %+v into the caller's slice", extra[1])
+	}
+	got, _ := s.GetUser(u.ID)
+	if len(got.Identities) != 2 || got.Identities[0].ExternalID != "ana@example.com" {
+		t.Errorf("stored identities = %+v, want the original email and the linked telegram", got.Identities)
+	}
+}
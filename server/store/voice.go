@@ -0,0 +1,126 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Accepted ranges of VoiceSettings. Zero means "server default" except
+// for MinSpeech, where nil does.
+const (
+	MinVADThreshold      = 0.05
+	MaxVADThreshold      = 0.95
+	MinSilenceTimeoutMs  = 200
+	MaxSilenceTimeoutMs  = 10000
+	MaxMinSpeechMs       = 2000
+	MinWakewordThreshold = 0.05
+	MaxWakewordThreshold = 0.99
+	MinSpeakerThreshold  = 0.1
+	MaxSpeakerThreshold  = 0.95
+)
+
+// Merge returns the settings with the set fields of o applied on top.
+func (v VoiceSettings) Merge(o *VoiceSettings) VoiceSettings {
+	if o == nil {
+		return v
+	}
+	if o.VADThreshold != 0 {
+		v.VADThreshold = o.VADThreshold
+	}
+	if o.SilenceTimeout != 0 {
+		v.SilenceTimeout = o.SilenceTimeout
+	}
+	if o.MinSpeech != nil {
+		v.MinSpeech = o.MinSpeech
+	}
+	if o.WakewordThreshold != 0 {
+		v.WakewordThreshold = o.WakewordThreshold
+	}
+	if o.Wakewords != nil {
+		v.Wakewords = o.Wakewords
+	}
+	if o.SpeakerID != nil {
+		v.SpeakerID = o.SpeakerID
+	}
+	if o.SpeakerThreshold != 0 {
+		v.SpeakerThreshold = o.SpeakerThreshold
+	}
+	return v
+}
+
+// Override returns the client settings with the overrides of a connection
+// applied. A connection can tune detection for itself but only narrow what
+// the admin allows: it may pick a subset of the client's wake words, not
+// add others, and it never changes speaker identification, which decides
+// who turns run as. Fields it may not set are ignored; CheckOverride
+// reports them.
+func (v VoiceSettings) Override(o *VoiceSettings) VoiceSettings {
+	if o == nil {
+		return v
+	}
+	narrowed := *o
+	narrowed.SpeakerID = nil
+	narrowed.SpeakerThreshold = 0
+	if o.Wakewords != nil && len(v.Wakewords) > 0 {
+		narrowed.Wakewords = nil
+		for _, id := range o.Wakewords {
+			if slices.Contains(v.Wakewords, id) {
+				narrowed.Wakewords = append(narrowed.Wakewords, id)
+			}
+		}
+	}
+	return v.Merge(&narrowed)
+}
+
+// CheckOverride returns an error when o sets something a connection may not
+// change on top of the client settings v (see Override).
+func (v VoiceSettings) CheckOverride(o *VoiceSettings) error {
+	if o == nil {
+		return nil
+	}
+	if o.SpeakerID != nil || o.SpeakerThreshold != 0 {
+		return fmt.Errorf("speakerId and speakerThreshold can only be set on the client")
+	}
+	if len(v.Wakewords) > 0 {
+		for _, id := range o.Wakewords {
+			if !slices.Contains(v.Wakewords, id) {
+				return fmt.Errorf("wake word %q is not allowed for this client", id)
+			}
+		}
+	}
+	return nil
+}
+
+// SpeakerIDEnabled reports whether speaker identification is on.
+func (v VoiceSettings) SpeakerIDEnabled() bool {
+	return v.SpeakerID != nil && *v.SpeakerID
+}
+
+// IsZero reports whether no setting is set.
+func (v VoiceSettings) IsZero() bool {
+	return v.VADThreshold == 0 && v.SilenceTimeout == 0 && v.MinSpeech == nil &&
+		v.WakewordThreshold == 0 && v.Wakewords == nil && v.SpeakerID == nil && v.SpeakerThreshold == 0
+}
+
+// Validate rejects values outside the accepted ranges.
+func (v *VoiceSettings) Validate() error {
+	if v == nil {
+		return nil
+	}
+	if v.VADThreshold != 0 && (v.VADThreshold < MinVADThreshold || v.VADThreshold > MaxVADThreshold) {
+		return fmt.Errorf("vadThreshold must be between %.2f and %.2f", MinVADThreshold, MaxVADThreshold)
+	}
+	if v.SilenceTimeout != 0 && (v.SilenceTimeout < MinSilenceTimeoutMs || v.SilenceTimeout > MaxSilenceTimeoutMs) {
+		return fmt.Errorf("silenceTimeout must be between %d and %d ms", MinSilenceTimeoutMs, MaxSilenceTimeoutMs)
+	}
+	if v.MinSpeech != nil && (*v.MinSpeech < 0 || *v.MinSpeech > MaxMinSpeechMs) {
+		return fmt.Errorf("minSpeech must be between 0 and %d ms", MaxMinSpeechMs)
+	}
+	if v.WakewordThreshold != 0 && (v.WakewordThreshold < MinWakewordThreshold || v.WakewordThreshold > MaxWakewordThreshold) {
+		return fmt.Errorf("wakewordThreshold must be between %.2f and %.2f", MinWakewordThreshold, MaxWakewordThreshold)
+	}
+	if v.SpeakerThreshold != 0 && (v.SpeakerThreshold < MinSpeakerThreshold || v.SpeakerThreshold > MaxSpeakerThreshold) {
+		return fmt.Errorf("speakerThreshold must be between %.2f and %.2f", MinSpeakerThreshold, MaxSpeakerThreshold)
+	}
+	return nil
+}
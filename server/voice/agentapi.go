@@ -0,0 +1,198 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/achetronic/magec/server/clients/msgutil"
+)
+
+// agentAPI calls the internal agent API and the voice proxies next to it
+// on behalf of a voice session. baseURL ends in /agent.
+type agentAPI struct {
+	baseURL string
+}
+
+// ensureSession creates the ADK session. An existing session is left as is.
+func (a *agentAPI) ensureSession(ctx context.Context, auth, agentID, userID, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.sessionURL(agentID, userID, sessionID), bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuth(req, auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		return fmt.Errorf("failed to create session: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// run sends a message to /run_sse with streaming enabled and calls handler
+// for each event as it arrives.
+func (a *agentAPI) run(ctx context.Context, auth, agentID, userID, sessionID, text string, handler func(msgutil.SSEEvent)) error {
+	jsonBody, err := json.Marshal(map[string]any{
+		"appName":   agentID,
+		"userId":    userID,
+		"sessionId": sessionID,
+		"streaming": true,
+		"newMessage": map[string]any{
+			"role":  "user",
+			"parts": []map[string]any{{"text": text}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/run_sse", bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	setAuth(req, auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call agent: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("agent returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return msgutil.ParseSSEStream(resp.Body, handler)
+}
+
+// transcribe sends WAV audio to the transcription proxy of the agent.
+func (a *agentAPI) transcribe(ctx context.Context, auth, agentID string, wav []byte) (string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(wav); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.voiceURL(agentID, "transcription"), &buf)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	setAuth(req, auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("transcription failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// speech synthesizes text with the agent's TTS in the given format.
+func (a *agentAPI) speech(ctx context.Context, auth, agentID, text, format string) ([]byte, error) {
+	jsonBody, err := json.Marshal(map[string]any{
+		"input":           text,
+		"response_format": format,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.voiceURL(agentID, "speech"), bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuth(req, auth)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("TTS failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (a *agentAPI) sessionURL(agentID, userID, sessionID string) string {
+	return fmt.Sprintf("%s/apps/%s/users/%s/sessions/%s", a.baseURL,
+		url.PathEscape(agentID), url.PathEscape(userID), url.PathEscape(sessionID))
+}
+
+func (a *agentAPI) voiceURL(agentID, endpoint string) string {
+	return strings.TrimSuffix(a.baseURL, "/agent") + "/voice/" + url.PathEscape(agentID) + "/" + endpoint
+}
+
+// setAuth sends the session's client token so the agent API sees the same
+// client.
+func setAuth(req *http.Request, auth string) {
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+}
@@ -17,10 +17,12 @@
 package voice
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
 	"math"
+	"slices"
 	"sync"
 	"time"
 
@@ -37,6 +39,22 @@ var (
 	ortInitErr  error
 )
 
+// InitONNX initializes the ONNX Runtime environment shared by all voice
+// models. Only the first call loads the library; later calls return its
+// result.
+func InitONNX(libraryPath string) error {
+	ortInitOnce.Do(func() {
+		if libraryPath != "" {
+			ort.SetSharedLibraryPath(libraryPath)
+		}
+		ortInitErr = ort.InitializeEnvironment()
+	})
+	if ortInitErr != nil {
+		return fmt.Errorf("failed to initialize ONNX Runtime: %w", ortInitErr)
+	}
+	return nil
+}
+
 // newLightSessionOptions creates ONNX session options optimised for the small
 // models used in voice detection.  By default ONNX Runtime spawns as many
 // intra-op threads as there are CPU cores **for every session**.  With 4-5
@@ -97,6 +115,10 @@ type Detector struct {
 	// Wake word models (can have multiple loaded)
 	wakeWordSessions map[string]*wakeWordModel
 	activeModelID    string
+	// threshold overrides the threshold of the models when set
+	threshold float32
+	// allowed restricts the models a client can use, when set
+	allowed []string
 
 	audioBuffer       []int16
 	processedSamples  int
@@ -129,7 +151,124 @@ func (d *Detector) SetOnDetected(callback func(modelID string)) {
 
 // GetModels returns the list of available wake word models
 func (d *Detector) GetModels() []ModelConfig {
-	return d.config.Models
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	models := make([]ModelConfig, 0, len(d.config.Models))
+	for _, m := range d.config.Models {
+		if d.isAllowed(m.ID) {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// SetModels replaces the wake word models without a restart: new and
+// changed models are loaded and removed ones unloaded. It reports whether
+// the models changed.
+func (d *Detector) SetModels(models []ModelConfig) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if sameModels(d.config.Models, models) {
+		return false
+	}
+	wanted := make(map[string]ModelConfig, len(models))
+	for _, m := range models {
+		wanted[m.ID] = m
+	}
+	for id, m := range d.wakeWordSessions {
+		if w, ok := wanted[id]; ok && bytes.Equal(w.Data, m.config.Data) {
+			m.config = w
+			continue
+		}
+		m.session.Destroy()
+		delete(d.wakeWordSessions, id)
+	}
+	d.config.Models = models
+
+	// Models are loaded with the detector; before that there is nothing to do
+	if d.melspecSession != nil {
+		opts, err := newLightSessionOptions()
+		if err != nil {
+			d.logger.Warn("Failed to create session options", "error", err)
+			return true
+		}
+		defer opts.Destroy()
+		for _, m := range models {
+			if _, ok := d.wakeWordSessions[m.ID]; !ok {
+				d.loadModel(m, opts)
+			}
+		}
+	}
+	if _, ok := d.wakeWordSessions[d.activeModelID]; !ok || !d.isAllowed(d.activeModelID) {
+		d.activeModelID = d.defaultModel()
+	}
+	return true
+}
+
+// sameModels reports whether two model lists are identical.
+func sameModels(a, b []ModelConfig) bool {
+	return slices.EqualFunc(a, b, func(x, y ModelConfig) bool {
+		return x.ID == y.ID && x.Name == y.Name && x.Phrase == y.Phrase &&
+			x.Threshold == y.Threshold && bytes.Equal(x.Data, y.Data)
+	})
+}
+
+// loadModel creates the ONNX session of a wake word model. Must hold mu.
+func (d *Detector) loadModel(modelCfg ModelConfig, opts *ort.SessionOptions) {
+	session, err := newWakeWordSession(modelCfg.Data, opts)
+	if err != nil {
+		d.logger.Warn("Failed to load wake word model", "model", modelCfg.ID, "error", err)
+		return
+	}
+	d.wakeWordSessions[modelCfg.ID] = &wakeWordModel{
+		config:  modelCfg,
+		session: session,
+	}
+	d.logger.Info("Loaded wake word model", "model", modelCfg.ID, "phrase", modelCfg.Phrase)
+}
+
+// newWakeWordSession creates an ONNX session for an openWakeWord model.
+func newWakeWordSession(data []byte, opts *ort.SessionOptions) (*ort.DynamicAdvancedSession, error) {
+	return ort.NewDynamicAdvancedSessionWithONNXData(
+		data,
+		[]string{"onnx::Flatten_0"},
+		[]string{"39"},
+		opts,
+	)
+}
+
+// ValidateWakeWordModel checks that data loads as an openWakeWord model
+// with the input and output the detector uses. ONNX Runtime must already
+// be initialized with InitONNX.
+func ValidateWakeWordModel(data []byte) error {
+	opts, err := newLightSessionOptions()
+	if err != nil {
+		return fmt.Errorf("failed to create session options: %w", err)
+	}
+	defer opts.Destroy()
+
+	session, err := newWakeWordSession(data, opts)
+	if err != nil {
+		return err
+	}
+	return session.Destroy()
+}
+
+// defaultModel returns the first loaded model the client may use. Must
+// hold mu.
+func (d *Detector) defaultModel() string {
+	for _, m := range d.config.Models {
+		if _, ok := d.wakeWordSessions[m.ID]; ok && d.isAllowed(m.ID) {
+			return m.ID
+		}
+	}
+	return ""
+}
+
+// isAllowed reports whether the client may use a model. Must hold mu.
+func (d *Detector) isAllowed(modelID string) bool {
+	return len(d.allowed) == 0 || slices.Contains(d.allowed, modelID)
 }
 
 // SetActiveModel sets which wake word model to use for detection
@@ -137,7 +276,7 @@ func (d *Detector) SetActiveModel(modelID string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	
-	if _, ok := d.wakeWordSessions[modelID]; !ok {
+	if _, ok := d.wakeWordSessions[modelID]; !ok || !d.isAllowed(modelID) {
 		return fmt.Errorf("model %q not loaded", modelID)
 	}
 	d.activeModelID = modelID
@@ -150,6 +289,14 @@ func (d *Detector) GetActiveModel() string {
 	return d.activeModelID
 }
 
+// Config returns the configuration the detector was created with, so more
+// detectors can be created from it
+func (d *Detector) Config() DetectorConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.config
+}
+
 // Load initializes the ONNX models
 func (d *Detector) Load() error {
 	d.logger.Info("Loading wake word models",
@@ -157,14 +304,8 @@ func (d *Detector) Load() error {
 	)
 
 	// Initialize ONNX Runtime environment (once globally)
-	ortInitOnce.Do(func() {
-		if d.config.OnnxLibraryPath != "" {
-			ort.SetSharedLibraryPath(d.config.OnnxLibraryPath)
-		}
-		ortInitErr = ort.InitializeEnvironment()
-	})
-	if ortInitErr != nil {
-		return fmt.Errorf("failed to initialize ONNX Runtime: %w", ortInitErr)
+	if err := InitONNX(d.config.OnnxLibraryPath); err != nil {
+		return err
 	}
 
 	// Create lightweight session options (1 thread per session)
@@ -196,24 +337,12 @@ func (d *Detector) Load() error {
 		return fmt.Errorf("failed to load embedding model: %w", err)
 	}
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	// Load all wake word models
 	for _, modelCfg := range d.config.Models {
-		session, err := ort.NewDynamicAdvancedSessionWithONNXData(
-			modelCfg.Data,
-			[]string{"onnx::Flatten_0"},
-			[]string{"39"},
-			opts,
-		)
-		if err != nil {
-			d.logger.Warn("Failed to load wake word model", "model", modelCfg.ID, "error", err)
-			continue
-		}
-		
-		d.wakeWordSessions[modelCfg.ID] = &wakeWordModel{
-			config:  modelCfg,
-			session: session,
-		}
-		d.logger.Info("Loaded wake word model", "model", modelCfg.ID, "phrase", modelCfg.Phrase)
+		d.loadModel(modelCfg, opts)
 	}
 
 	if len(d.wakeWordSessions) == 0 {
@@ -221,10 +350,7 @@ func (d *Detector) Load() error {
 	}
 
 	// Set first model as active by default
-	for id := range d.wakeWordSessions {
-		d.activeModelID = id
-		break
-	}
+	d.activeModelID = d.defaultModel()
 
 	d.logger.Info("Wake word models loaded successfully", "active", d.activeModelID)
 	return nil
@@ -286,7 +412,8 @@ func (d *Detector) processBuffer() error {
 	// Get active model
 	activeModel, ok := d.wakeWordSessions[d.activeModelID]
 	if !ok {
-		return fmt.Errorf("no active model")
+		// None of the wake words the client may use is loaded
+		return nil
 	}
 
 	if d.logger.Enabled(context.Background(), slog.LevelDebug) {
@@ -351,7 +478,7 @@ func (d *Detector) processBuffer() error {
 	d.logger.Debug("Wake word inference",
 		"model", d.activeModelID,
 		"score", fmt.Sprintf("%.3f", score),
-		"threshold", activeModel.config.Threshold,
+		"threshold", d.thresholdFor(activeModel),
 		"mel_ms", melTime.Milliseconds(),
 		"emb_ms", embTime.Milliseconds(),
 		"ww_ms", wwTime.Milliseconds(),
@@ -359,7 +486,7 @@ func (d *Detector) processBuffer() error {
 	)
 
 	// Check for detection
-	if score >= activeModel.config.Threshold {
+	if score >= d.thresholdFor(activeModel) {
 		now := time.Now()
 		cooldown := time.Duration(DefaultCooldownMs) * time.Millisecond
 		if now.Sub(d.lastDetectionTime) >= cooldown {
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// maxEventsMessageSize bounds the messages of a voice events connection.
+	// Audio frames are a few kilobytes.
+	maxEventsMessageSize = 1 << 20
+	// EventsSubprotocol is the WebSocket subprotocol offered along with
+	// "bearer.<token>" by browsers, which can't send an Authorization header.
+	// It is required with the token, as it is the protocol the server
+	// answers with.
+	EventsSubprotocol = "magec.voice"
+	// idleCloseReason is the close reason of connections closed for idling.
+	idleCloseReason = "idle timeout"
+)
+
+// EventsPolicy guards the voice events WebSocket, where every connection
+// runs its own wake word and VAD models.
+type EventsPolicy struct {
+	// AllowedOrigins are the browser origins allowed besides the server's
+	// own, e.g. "https://kiosk.example.com"; "*" allows any. Connections
+	// without an Origin header don't come from a browser and are allowed.
+	AllowedOrigins []string
+	// MaxConnectionsPerClient bounds the open connections of a client, or
+	// of a remote address for connections without a client token. Zero
+	// means no limit.
+	MaxConnectionsPerClient int
+	// IdleTimeout closes connections that send nothing for this long. Zero
+	// means never.
+	IdleTimeout time.Duration
+}
+
+// ConnectionStats reports the voice events connections: those open now,
+// and totals since the server started.
+type ConnectionStats struct {
+	Active int `json:"active"`
+	// Sessions counts the open connections running a voice session
+	Sessions int `json:"sessions"`
+	// Clients counts the open connections of each client, by ID
+	Clients map[string]int `json:"clients"`
+	// Anonymous counts the open connections without a client token
+	Anonymous int `json:"anonymous"`
+
+	Accepted       uint64 `json:"accepted"`
+	RejectedOrigin uint64 `json:"rejectedOrigin"`
+	RejectedLimit  uint64 `json:"rejectedLimit"`
+	IdleClosed     uint64 `json:"idleClosed"`
+}
+
+// SetPolicy sets the origins, limits and timeouts of new connections.
+func (h *Handler) SetPolicy(p EventsPolicy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.policy = p
+}
+
+// Stats returns the current connection counts.
+func (h *Handler) Stats() ConnectionStats {
+	h.mu.Lock()
+	stats := h.totals
+	stats.Active = len(h.connections)
+	stats.Clients = make(map[string]int)
+	for key, n := range h.open {
+		if strings.HasPrefix(key, anonymousKeyPrefix) {
+			stats.Anonymous += n
+		} else {
+			stats.Clients[key] = n
+		}
+	}
+	states := make([]*clientState, 0, len(h.connections))
+	for _, state := range h.connections {
+		states = append(states, state)
+	}
+	h.mu.Unlock()
+
+	for _, state := range states {
+		if state.currentSession() != nil {
+			stats.Sessions++
+		}
+	}
+	return stats
+}
+
+// checkOrigin allows handshakes without an Origin header, from the
+// server's own origin and from the allowed origins.
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, allowed := range h.policy.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	h.totals.RejectedOrigin++
+	h.logger.Warn("Voice events connection from a disallowed origin", "origin", origin, "remote", r.RemoteAddr)
+	return false
+}
+
+// anonymousKeyPrefix marks the connection keys of remote addresses, used
+// for connections without a client token.
+const anonymousKeyPrefix = "addr:"
+
+// connectionKey returns what the connection limit of a handshake counts
+// against: the client its token belongs to, or its remote address.
+func (h *Handler) connectionKey(r *http.Request, token string) string {
+	if token != "" && h.store != nil {
+		if cl, ok := h.store.GetClientByToken(token); ok {
+			return cl.ID
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return anonymousKeyPrefix + host
+}
+
+// acquire counts a new connection for key, unless it would go over the
+// limit.
+func (h *Handler) acquire(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if limit := h.policy.MaxConnectionsPerClient; limit > 0 && h.open[key] >= limit {
+		h.totals.RejectedLimit++
+		return false
+	}
+	h.open[key]++
+	return true
+}
+
+// release uncounts a connection acquired for key.
+func (h *Handler) release(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.open[key]--; h.open[key] <= 0 {
+		delete(h.open, key)
+	}
+}
+
+// idleTimeout returns how long a connection may go without messages.
+func (h *Handler) idleTimeout() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.policy.IdleTimeout
+}
+
+// countIdleClose records a connection closed for idling.
+func (h *Handler) countIdleClose() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.totals.IdleClosed++
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Kaldi filterbank parameters at 16 kHz: 25 ms frames every 10 ms, padded
+// to a power of two for the FFT.
+const (
+	fbankFrameLength = 400
+	fbankFrameShift  = 160
+	fbankFFTSize     = 512
+	fbankPreemphasis = 0.97
+	fbankLowFreq     = 20
+)
+
+// fbank computes log mel filterbank features the way Kaldi does (and the
+// kaldi-native-fbank library speaker embedding models are trained with):
+// DC removal, pre-emphasis, Povey window, power spectrum, triangular mel
+// filters and natural log. Dither is off so features are deterministic.
+type fbank struct {
+	window  []float64
+	filters []melFilter
+}
+
+// newFbank builds the window and nBins mel filters for 16 kHz audio.
+func newFbank(nBins int) *fbank {
+	f := &fbank{window: make([]float64, fbankFrameLength)}
+	for i := range f.window {
+		f.window[i] = math.Pow(0.5-0.5*math.Cos(2*math.Pi*float64(i)/float64(fbankFrameLength-1)), 0.85)
+	}
+
+	kaldiMel := func(hz float64) float64 { return 1127 * math.Log(1+hz/700) }
+	binWidth := float64(TargetSampleRate) / fbankFFTSize
+	melLow := kaldiMel(fbankLowFreq)
+	melHigh := kaldiMel(TargetSampleRate / 2)
+	delta := (melHigh - melLow) / float64(nBins+1)
+
+	f.filters = make([]melFilter, nBins)
+	for b := range f.filters {
+		left := melLow + float64(b)*delta
+		center := left + delta
+		right := center + delta
+		filter := melFilter{start: -1}
+		for i := 0; i < fbankFFTSize/2; i++ {
+			mel := kaldiMel(binWidth * float64(i))
+			if mel <= left || mel >= right {
+				continue
+			}
+			weight := (right - mel) / (right - center)
+			if mel <= center {
+				weight = (mel - left) / (center - left)
+			}
+			if filter.start < 0 {
+				filter.start = i
+			}
+			filter.weights = append(filter.weights, weight)
+		}
+		if filter.start < 0 {
+			filter.start = 0
+		}
+		f.filters[b] = filter
+	}
+	return f
+}
+
+// compute returns one feature vector per frame of 16 kHz samples. Frames
+// that don't fit whole at the end are dropped, as with Kaldi's snip_edges.
+func (f *fbank) compute(samples []float32) [][]float32 {
+	if len(samples) < fbankFrameLength {
+		return nil
+	}
+	frames := 1 + (len(samples)-fbankFrameLength)/fbankFrameShift
+	features := make([][]float32, frames)
+
+	frame := make([]float64, fbankFrameLength)
+	spectrum := make([]complex128, fbankFFTSize)
+	power := make([]float64, fbankFFTSize/2+1)
+	for t := range features {
+		offset := t * fbankFrameShift
+		var mean float64
+		for i := range frame {
+			frame[i] = float64(samples[offset+i])
+			mean += frame[i]
+		}
+		mean /= fbankFrameLength
+		for i := range frame {
+			frame[i] -= mean
+		}
+		for i := fbankFrameLength - 1; i > 0; i-- {
+			frame[i] -= fbankPreemphasis * frame[i-1]
+		}
+		frame[0] -= fbankPreemphasis * frame[0]
+
+		for i := range spectrum {
+			spectrum[i] = 0
+			if i < fbankFrameLength {
+				spectrum[i] = complex(frame[i]*f.window[i], 0)
+			}
+		}
+		fft(spectrum)
+		for i := range power {
+			a := cmplx.Abs(spectrum[i])
+			power[i] = a * a
+		}
+
+		features[t] = make([]float32, len(f.filters))
+		for b, filter := range f.filters {
+			var energy float64
+			for i, w := range filter.weights {
+				energy += w * power[filter.start+i]
+			}
+			features[t][b] = float32(math.Log(math.Max(energy, 1.1920929e-07)))
+		}
+	}
+	return features
+}
+
+// fft is an in-place radix-2 FFT. len(x) must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
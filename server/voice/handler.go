@@ -19,22 +19,19 @@ package voice
 import (
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"math"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
-)
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now
-	},
-}
+	"github.com/achetronic/magec/server/store"
+)
 
 // Message types for WebSocket communication
 const (
@@ -45,6 +42,8 @@ const (
 	MsgTypeSpeechStart   = "speech_start"
 	MsgTypeSpeechEnd     = "speech_end"
 	MsgTypeError         = "error"
+	MsgTypePlaying       = "playing"
+	MsgTypeInterrupt     = "interrupt"
 )
 
 // WSMessage represents a WebSocket message
@@ -53,10 +52,12 @@ type WSMessage struct {
 	Data interface{} `json:"data,omitempty"`
 }
 
-// AudioConfig is sent by the client to configure audio processing
+// AudioConfig is sent by the client to configure audio processing. Voice
+// settings override those of the client for this connection.
 type AudioConfig struct {
 	SampleRate int    `json:"sampleRate"`
 	Model      string `json:"model"`
+	store.VoiceSettings
 }
 
 // WakewordModelInfo represents a wake word model for client
@@ -68,14 +69,17 @@ type WakewordModelInfo struct {
 
 // WakewordsCapabilities represents wake word detection capabilities
 type WakewordsCapabilities struct {
-	Models []WakewordModelInfo `json:"models"`
-	Active string              `json:"active"`
+	Models    []WakewordModelInfo `json:"models"`
+	Active    string              `json:"active"`
+	Threshold float32             `json:"threshold"`
 }
 
 // VADCapabilities represents voice activity detection capabilities
 type VADCapabilities struct {
-	Enabled        bool `json:"enabled"`
-	SilenceTimeout int  `json:"silenceTimeout"` // milliseconds
+	Enabled        bool    `json:"enabled"`
+	Threshold      float32 `json:"threshold"`
+	SilenceTimeout int     `json:"silenceTimeout"` // milliseconds
+	MinSpeech      int     `json:"minSpeech"`      // milliseconds
 }
 
 // Capabilities represents the full capabilities of the voice-events endpoint
@@ -87,42 +91,213 @@ type Capabilities struct {
 // Handler manages WebSocket connections for voice event detection
 type Handler struct {
 	logger         *slog.Logger
+	store          *store.Store
 	detectorConfig DetectorConfig
+	pipeline       *Pipeline
+	upgrader       websocket.Upgrader
+	policy         EventsPolicy
 
 	// Track active connections
 	connections map[*websocket.Conn]*clientState
 	mu          sync.Mutex
+
+	// open counts the connections of each client ID, or of each remote
+	// address for connections without a token (see connectionKey)
+	open   map[string]int
+	totals ConnectionStats
 }
 
 type clientState struct {
+	conn       *websocket.Conn
 	detector   *Detector
 	vad        *VAD
 	resampler  *Resampler
 	sampleRate int
 	vadEnabled bool
 	connMu     sync.Mutex // Mutex for writing to this connection
+
+	// token is the client token sent in the handshake, if any
+	token     string
+	session   *session
+	sessionMu sync.Mutex
+
+	// voice holds the settings of the client identified by its token, and
+	// overrides those set by the connection with "config" messages
+	voice     *store.VoiceSettings
+	overrides store.VoiceSettings
+
+	// playing is set while the client plays speech, so speech detected
+	// meanwhile is a barge-in
+	playing   bool
+	playingMu sync.Mutex
+}
+
+// writeJSON sends a message, serialized with other writers of the connection
+func (c *clientState) writeJSON(msg WSMessage) error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.conn.WriteJSON(msg)
+}
+
+// writeBinary sends a binary frame, serialized with other writers of the connection
+func (c *clientState) writeBinary(data []byte) error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (c *clientState) writeError(message string) error {
+	return c.writeJSON(WSMessage{
+		Type: MsgTypeError,
+		Data: map[string]string{"message": message},
+	})
+}
+
+// setPlaying tells the VAD whether the client is playing speech
+func (c *clientState) setPlaying(playing bool) {
+	c.playingMu.Lock()
+	defer c.playingMu.Unlock()
+	c.playing = playing
+	if c.vad != nil {
+		c.vad.SetPlaying(playing)
+	}
+}
+
+// interrupt tells the client to stop playback when the user barges in.
+// It reports whether the client was playing.
+func (c *clientState) interrupt() bool {
+	c.playingMu.Lock()
+	playing := c.playing
+	c.playing = false
+	c.playingMu.Unlock()
+	if !playing {
+		return false
+	}
+	if c.vad != nil {
+		c.vad.SetPlaying(false)
+	}
+	c.writeJSON(WSMessage{Type: MsgTypeInterrupt})
+	return true
+}
+
+// tune applies the voice settings of the connection to its detectors
+func (c *clientState) tune() {
+	settings := store.VoiceSettings{}.Merge(c.voice).Override(&c.overrides)
+	c.detector.Tune(settings)
+	if c.vad != nil {
+		c.vad.Tune(settings)
+	}
+}
+
+// currentSession returns the voice session of the connection, if any
+func (c *clientState) currentSession() *session {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	return c.session
+}
+
+// setSession replaces the voice session of the connection, closing the previous one
+func (c *clientState) setSession(s *session) {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	if c.session != nil {
+		c.session.close()
+	}
+	c.session = s
 }
 
-// NewHandler creates a new WebSocket handler for voice event detection
-func NewHandler(detector *Detector, logger *slog.Logger) *Handler {
-	return &Handler{
+// NewHandler creates a new WebSocket handler for voice event detection. The
+// store provides the voice settings of the clients that connect.
+func NewHandler(detector *Detector, s *store.Store, logger *slog.Logger) *Handler {
+	h := &Handler{
 		logger:         logger,
+		store:          s,
 		detectorConfig: detector.config,
 		connections:    make(map[*websocket.Conn]*clientState),
+		open:           make(map[string]int),
+	}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{EventsSubprotocol},
+		CheckOrigin:     h.checkOrigin,
+	}
+	return h
+}
+
+// offersBearerOnly reports whether a handshake offers a "bearer.<token>"
+// subprotocol without EventsSubprotocol.
+func offersBearerOnly(r *http.Request) bool {
+	bearer := false
+	for _, protocol := range websocket.Subprotocols(r) {
+		if protocol == EventsSubprotocol {
+			return false
+		}
+		if strings.HasPrefix(protocol, "bearer.") {
+			bearer = true
+		}
+	}
+	return bearer
+}
+
+// SetPipeline enables voice sessions, where the server runs the whole turn
+// (transcription, agent and speech) for clients that only stream audio
+func (h *Handler) SetPipeline(p *Pipeline) {
+	h.pipeline = p
+}
+
+// SetModels replaces the wake word models of new and open connections.
+// Open connections whose models changed get new capabilities.
+func (h *Handler) SetModels(models []ModelConfig) {
+	h.mu.Lock()
+	h.detectorConfig.Models = models
+	states := make([]*clientState, 0, len(h.connections))
+	for _, state := range h.connections {
+		states = append(states, state)
+	}
+	h.mu.Unlock()
+
+	for _, state := range states {
+		if state.detector.SetModels(models) {
+			h.sendCapabilities(state)
+		}
 	}
 }
 
 // ServeHTTP handles WebSocket upgrade and message processing
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// The handshake must answer with a subprotocol the client offered, and
+	// echoing the token back is not one the server will pick.
+	if offersBearerOnly(r) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error":"the bearer subprotocol must be offered along with `+EventsSubprotocol+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Every connection loads its own models: limit how many a client opens
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	key := h.connectionKey(r, token)
+	if !h.acquire(key) {
+		h.logger.Warn("Too many voice events connections", "remote", r.RemoteAddr)
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error":"too many voice connections for this client"}`, http.StatusTooManyRequests)
+		return
+	}
+	defer h.release(key)
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		h.logger.Error("WebSocket upgrade failed", "error", err)
 		return
 	}
 	defer conn.Close()
+	conn.SetReadLimit(maxEventsMessageSize)
 
 	// Create a new detector for this connection
-	detector := NewDetector(h.detectorConfig, h.logger)
+	h.mu.Lock()
+	detectorConfig := h.detectorConfig
+	h.mu.Unlock()
+	detector := NewDetector(detectorConfig, h.logger)
 	if err := detector.Load(); err != nil {
 		h.logger.Error("Failed to create detector for connection", "error", err, "remote", r.RemoteAddr)
 		conn.WriteJSON(WSMessage{
@@ -134,10 +309,10 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Create VAD if model data is configured
 	var vad *VAD
-	vadEnabled := len(h.detectorConfig.VADModelData) > 0
+	vadEnabled := len(detectorConfig.VADModelData) > 0
 	if vadEnabled {
 		vad = NewVAD(VADConfig{
-			ModelData:      h.detectorConfig.VADModelData,
+			ModelData:      detectorConfig.VADModelData,
 			Threshold:      VADThreshold,
 			SilenceTimeout: VADSilenceTimeout,
 		}, h.logger)
@@ -151,19 +326,25 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Register connection
 	h.mu.Lock()
 	state := &clientState{
+		conn:       conn,
 		detector:   detector,
 		vad:        vad,
 		vadEnabled: vadEnabled,
+		token:      token,
 	}
 	h.connections[conn] = state
+	h.totals.Accepted++
+	active := len(h.connections)
 	h.mu.Unlock()
+	h.identify(state, state.token)
 
-	h.logger.Info("Voice events WebSocket connected", "remote", r.RemoteAddr, "activeConnections", len(h.connections), "vadEnabled", vadEnabled)
+	h.logger.Info("Voice events WebSocket connected", "remote", r.RemoteAddr, "activeConnections", active, "vadEnabled", vadEnabled)
 
 	defer func() {
 		h.mu.Lock()
 		delete(h.connections, conn)
 		h.mu.Unlock()
+		state.setSession(nil)
 		detector.Close()
 		if vad != nil {
 			vad.Close()
@@ -173,49 +354,65 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Set up wake word detection callback
 	detector.SetOnDetected(func(modelID string) {
-		state.connMu.Lock()
-		defer state.connMu.Unlock()
 		msg := WSMessage{
 			Type: MsgTypeWakeword,
 			Data: map[string]string{"model": modelID},
 		}
-		if err := conn.WriteJSON(msg); err != nil {
+		if err := state.writeJSON(msg); err != nil {
 			h.logger.Error("Failed to send wakeword message", "error", err)
 		}
+		if sess := state.currentSession(); sess != nil {
+			sess.onWakeword()
+		}
 	})
 
 	// Set up VAD callbacks
 	if vad != nil {
 		vad.SetOnSpeechStart(func() {
-			state.connMu.Lock()
-			defer state.connMu.Unlock()
 			msg := WSMessage{
 				Type: MsgTypeSpeechStart,
 			}
-			if err := conn.WriteJSON(msg); err != nil {
+			if err := state.writeJSON(msg); err != nil {
 				h.logger.Error("Failed to send speech_start message", "error", err)
 			}
+			if sess := state.currentSession(); sess != nil {
+				sess.onSpeechStart()
+			} else {
+				state.interrupt()
+			}
 		})
 		vad.SetOnSpeechEnd(func() {
-			state.connMu.Lock()
-			defer state.connMu.Unlock()
 			msg := WSMessage{
 				Type: MsgTypeSpeechEnd,
 			}
-			if err := conn.WriteJSON(msg); err != nil {
+			if err := state.writeJSON(msg); err != nil {
 				h.logger.Error("Failed to send speech_end message", "error", err)
 			}
+			if sess := state.currentSession(); sess != nil {
+				sess.onSpeechEnd()
+			}
 		})
 	}
 
 	// Send capabilities on connect
-	h.sendCapabilities(conn, detector, vad)
+	h.sendCapabilities(state)
 
 	// Message processing loop
+	idleTimeout := h.idleTimeout()
 	for {
+		if idleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		}
 		messageType, data, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				h.countIdleClose()
+				h.logger.Info("Closing idle voice events WebSocket", "remote", r.RemoteAddr, "idleTimeout", idleTimeout)
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, idleCloseReason),
+					time.Now().Add(time.Second))
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				h.logger.Error("WebSocket read error", "error", err)
 			}
 			break
@@ -230,7 +427,8 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) sendCapabilities(conn *websocket.Conn, detector *Detector, vad *VAD) {
+func (h *Handler) sendCapabilities(state *clientState) {
+	detector, vad := state.detector, state.vad
 	models := detector.GetModels()
 	modelInfos := make([]WakewordModelInfo, len(models))
 	for i, m := range models {
@@ -243,21 +441,29 @@ func (h *Handler) sendCapabilities(conn *websocket.Conn, detector *Detector, vad
 
 	vadCaps := VADCapabilities{
 		Enabled:        vad != nil,
+		Threshold:      VADThreshold,
 		SilenceTimeout: int(VADSilenceTimeout / time.Millisecond),
 	}
+	if vad != nil {
+		vadConfig := vad.GetConfig()
+		vadCaps.Threshold = vadConfig.Threshold
+		vadCaps.SilenceTimeout = int(vadConfig.SilenceTimeout / time.Millisecond)
+		vadCaps.MinSpeech = int(vadConfig.MinSpeech / time.Millisecond)
+	}
 
 	msg := WSMessage{
 		Type: MsgTypeCapabilities,
 		Data: Capabilities{
 			Wakewords: WakewordsCapabilities{
-				Models: modelInfos,
-				Active: detector.GetActiveModel(),
+				Models:    modelInfos,
+				Active:    detector.GetActiveModel(),
+				Threshold: detector.Threshold(),
 			},
 			VAD: vadCaps,
 		},
 	}
 
-	if err := conn.WriteJSON(msg); err != nil {
+	if err := state.writeJSON(msg); err != nil {
 		h.logger.Error("Failed to send capabilities", "error", err)
 	}
 }
@@ -274,7 +480,98 @@ func (h *Handler) handleTextMessage(conn *websocket.Conn, data []byte) {
 		h.handleConfig(conn, msg.Data)
 	case MsgTypeSetModel:
 		h.handleSetModel(conn, msg.Data)
+	case MsgTypeSession:
+		h.handleSession(conn, msg.Data)
+	case MsgTypeSessionEnd:
+		if state := h.state(conn); state != nil {
+			state.setSession(nil)
+		}
+	case MsgTypePlaying:
+		h.handlePlaying(conn, msg.Data)
+	case MsgTypeListen:
+		if state := h.state(conn); state != nil {
+			if sess := state.currentSession(); sess != nil {
+				sess.onListen()
+			}
+		}
+	}
+}
+
+func (h *Handler) state(conn *websocket.Conn) *clientState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.connections[conn]
+}
+
+// identify applies the voice settings of the client a token belongs to
+func (h *Handler) identify(state *clientState, token string) {
+	state.voice = nil
+	if token != "" && h.store != nil {
+		if cl, ok := h.store.GetClientByToken(token); ok {
+			state.voice = cl.Voice
+		}
+	}
+	state.tune()
+}
+
+func (h *Handler) handleSession(conn *websocket.Conn, data interface{}) {
+	state := h.state(conn)
+	if state == nil {
+		return
+	}
+	if h.pipeline == nil {
+		state.writeError("Voice sessions are not available")
+		return
+	}
+	if state.vad == nil {
+		state.writeError("Voice sessions require voice activity detection")
+		return
+	}
+
+	configBytes, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	var config SessionConfig
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		state.writeError("Invalid session config")
+		return
+	}
+
+	sess, err := h.pipeline.startSession(state, config, state.token)
+	if err != nil {
+		state.writeError(err.Error())
+		return
+	}
+	if config.Token != "" {
+		h.identify(state, config.Token)
+		h.sendCapabilities(state)
 	}
+	state.setSession(sess)
+	state.writeJSON(WSMessage{Type: MsgTypeSession, Data: sess.info})
+	sess.setState(StateIdle)
+
+	h.logger.Info("Voice session started", "agent", sess.info.AgentID, "session", sess.info.SessionID, "wakeword", sess.info.Wakeword)
+}
+
+// handlePlaying tracks the playback of clients that speak the agent replies
+// themselves. Sessions know when they speak, so they only need to hear
+// when playback ends.
+func (h *Handler) handlePlaying(conn *websocket.Conn, data interface{}) {
+	state := h.state(conn)
+	if state == nil {
+		return
+	}
+	dataMap, _ := data.(map[string]interface{})
+	playing, _ := dataMap["playing"].(bool)
+
+	if sess := state.currentSession(); sess != nil {
+		if !playing {
+			sess.onPlaybackEnd()
+		}
+		return
+	}
+	state.setPlaying(playing)
 }
 
 func (h *Handler) handleConfig(conn *websocket.Conn, data interface{}) {
@@ -293,7 +590,7 @@ func (h *Handler) handleConfig(conn *websocket.Conn, data interface{}) {
 
 	h.mu.Lock()
 	state := h.connections[conn]
-	if state != nil {
+	if state != nil && config.SampleRate > 0 {
 		state.sampleRate = config.SampleRate
 		// Create resampler if needed
 		if config.SampleRate != TargetSampleRate {
@@ -305,7 +602,8 @@ func (h *Handler) handleConfig(conn *websocket.Conn, data interface{}) {
 		} else {
 			state.resampler = nil
 		}
-
+	}
+	if state != nil {
 		// Set active model if specified
 		if config.Model != "" {
 			if err := state.detector.SetActiveModel(config.Model); err != nil {
@@ -315,6 +613,21 @@ func (h *Handler) handleConfig(conn *websocket.Conn, data interface{}) {
 	}
 	h.mu.Unlock()
 
+	if state != nil && !config.VoiceSettings.IsZero() {
+		if err := config.VoiceSettings.Validate(); err != nil {
+			state.writeError(err.Error())
+			return
+		}
+		if err := (store.VoiceSettings{}).Merge(state.voice).CheckOverride(&config.VoiceSettings); err != nil {
+			state.writeError(err.Error())
+			return
+		}
+		state.overrides = state.overrides.Merge(&config.VoiceSettings)
+		state.tune()
+		// Confirm the settings in effect
+		h.sendCapabilities(state)
+	}
+
 	h.logger.Debug("Audio config received",
 		"sampleRate", config.SampleRate,
 		"model", config.Model,
@@ -341,20 +654,12 @@ func (h *Handler) handleSetModel(conn *websocket.Conn, data interface{}) {
 	}
 
 	if err := state.detector.SetActiveModel(modelID); err != nil {
-		h.sendError(conn, err.Error())
+		state.writeError(err.Error())
 		return
 	}
 
 	// Confirm model change by sending updated capabilities
-	h.sendCapabilities(conn, state.detector, state.vad)
-}
-
-func (h *Handler) sendError(conn *websocket.Conn, message string) {
-	msg := WSMessage{
-		Type: MsgTypeError,
-		Data: map[string]string{"message": message},
-	}
-	conn.WriteJSON(msg)
+	h.sendCapabilities(state)
 }
 
 func (h *Handler) handleBinaryMessage(conn *websocket.Conn, data []byte) {
@@ -374,10 +679,16 @@ func (h *Handler) handleBinaryMessage(conn *websocket.Conn, data []byte) {
 		samples[i] = math.Float32frombits(bits)
 	}
 
+	sess := state.currentSession()
+
 	// Process audio (resample if needed)
 	if state.resampler != nil {
 		frames := state.resampler.Process(samples)
 		for _, frame := range frames {
+			if sess != nil {
+				sess.feed(frame)
+			}
+
 			// Process wake word detection
 			int16Samples := floatToInt16(frame)
 			if err := state.detector.ProcessAudio(int16Samples); err != nil {
@@ -393,6 +704,9 @@ func (h *Handler) handleBinaryMessage(conn *websocket.Conn, data []byte) {
 		}
 	} else {
 		// Already at target sample rate
+		if sess != nil {
+			sess.feed(samples)
+		}
 		if err := state.detector.ProcessAudioFloat32(samples); err != nil {
 			h.logger.Error("Wake word processing error", "error", err)
 		}
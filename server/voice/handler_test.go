@@ -0,0 +1,54 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOffersBearerOnly(t *testing.T) {
+	tests := []struct {
+		protocols string
+		want      bool
+	}{
+		{"", false},
+		{EventsSubprotocol, false},
+		{EventsSubprotocol + ", bearer.mgc_abc", false},
+		{"bearer.mgc_abc, " + EventsSubprotocol, false},
+		{"bearer.mgc_abc", true},
+		{"chat, bearer.mgc_abc", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/voice/events", nil)
+		if tt.protocols != "" {
+			r.Header.Set("Sec-WebSocket-Protocol", tt.protocols)
+		}
+		if got := offersBearerOnly(r); got != tt.want {
+			t.Errorf("offersBearerOnly(%q) = %v, want %v", tt.protocols, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/voice/events", nil)
+	r.Header.Set("Sec-WebSocket-Protocol", "bearer.mgc_abc")
+	rec := httptest.NewRecorder()
+	(&Handler{}).ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for a token without %s", rec.Code, EventsSubprotocol)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import "math"
+
+const (
+	// whisperFFTSize and whisperHopLength are the STFT parameters Whisper
+	// was trained with: 25 ms windows every 10 ms at 16 kHz.
+	whisperFFTSize   = 400
+	whisperHopLength = 160
+	// whisperChunkSamples is the audio Whisper sees at once: 30 seconds.
+	whisperChunkSamples = 30 * TargetSampleRate
+	// whisperFrames is the number of mel frames in one chunk.
+	whisperFrames = whisperChunkSamples / whisperHopLength
+)
+
+// melBank computes Whisper log-mel spectrograms. The DFT tables and the
+// filters are built once per model.
+type melBank struct {
+	nMels   int
+	window  []float64
+	cos     []float64 // bins x whisperFFTSize
+	sin     []float64 // bins x whisperFFTSize
+	filters []melFilter
+}
+
+// melFilter is one triangular mel filter over the DFT bins [start, start+len(weights)).
+type melFilter struct {
+	start   int
+	weights []float64
+}
+
+// newMelBank builds the tables for nMels mel bands, the same Slaney-style
+// filters librosa creates for Whisper.
+func newMelBank(nMels int) *melBank {
+	bins := whisperFFTSize/2 + 1
+	b := &melBank{
+		nMels:  nMels,
+		window: make([]float64, whisperFFTSize),
+		cos:    make([]float64, bins*whisperFFTSize),
+		sin:    make([]float64, bins*whisperFFTSize),
+	}
+	for n := range b.window {
+		// Periodic Hann window, as torch.hann_window
+		b.window[n] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(n)/whisperFFTSize)
+	}
+	for k := 0; k < bins; k++ {
+		for n := 0; n < whisperFFTSize; n++ {
+			angle := 2 * math.Pi * float64(k*n%whisperFFTSize) / whisperFFTSize
+			b.cos[k*whisperFFTSize+n] = math.Cos(angle)
+			b.sin[k*whisperFFTSize+n] = math.Sin(angle)
+		}
+	}
+
+	// Band edges evenly spaced on the mel scale between 0 and Nyquist
+	maxMel := hzToMel(TargetSampleRate / 2)
+	edges := make([]float64, nMels+2)
+	for i := range edges {
+		edges[i] = melToHz(maxMel * float64(i) / float64(nMels+1))
+	}
+	for m := 0; m < nMels; m++ {
+		lo, center, hi := edges[m], edges[m+1], edges[m+2]
+		norm := 2 / (hi - lo)
+		f := melFilter{start: -1}
+		for k := 0; k < bins; k++ {
+			freq := float64(k) * TargetSampleRate / whisperFFTSize
+			w := math.Min((freq-lo)/(center-lo), (hi-freq)/(hi-center))
+			if w <= 0 {
+				if f.start >= 0 {
+					break
+				}
+				continue
+			}
+			if f.start < 0 {
+				f.start = k
+			}
+			f.weights = append(f.weights, w*norm)
+		}
+		if f.start < 0 {
+			f.start = 0
+		}
+		b.filters = append(b.filters, f)
+	}
+	return b
+}
+
+// logMel returns the normalized log-mel spectrogram of up to 30 seconds of
+// 16 kHz audio as nMels rows of whisperFrames values. Shorter audio is
+// padded with silence, like Whisper does.
+func (b *melBank) logMel(samples []float32) []float32 {
+	pad := whisperFFTSize / 2
+	if len(samples) > whisperChunkSamples {
+		samples = samples[:whisperChunkSamples]
+	}
+
+	// Centered frames: the chunk is reflect-padded by half a window
+	padded := make([]float64, whisperChunkSamples+2*pad)
+	for i, s := range samples {
+		padded[pad+i] = float64(s)
+	}
+	for i := 0; i < pad; i++ {
+		padded[pad-1-i] = padded[pad+1+i]
+		padded[pad+whisperChunkSamples+i] = padded[pad+whisperChunkSamples-2-i]
+	}
+
+	bins := whisperFFTSize/2 + 1
+	mel := make([]float64, b.nMels*whisperFrames)
+	frame := make([]float64, whisperFFTSize)
+	power := make([]float64, bins)
+	for t := 0; t < whisperFrames; t++ {
+		silent := true
+		for n := range frame {
+			frame[n] = padded[t*whisperHopLength+n] * b.window[n]
+			if frame[n] != 0 {
+				silent = false
+			}
+		}
+		if silent {
+			continue
+		}
+		for k := 0; k < bins; k++ {
+			var re, im float64
+			row := k * whisperFFTSize
+			for n, v := range frame {
+				re += v * b.cos[row+n]
+				im -= v * b.sin[row+n]
+			}
+			power[k] = re*re + im*im
+		}
+		for m, f := range b.filters {
+			var sum float64
+			for i, w := range f.weights {
+				sum += w * power[f.start+i]
+			}
+			mel[m*whisperFrames+t] = sum
+		}
+	}
+
+	maxLog := math.Inf(-1)
+	for i, v := range mel {
+		mel[i] = math.Log10(math.Max(v, 1e-10))
+		maxLog = math.Max(maxLog, mel[i])
+	}
+	out := make([]float32, len(mel))
+	for i, v := range mel {
+		out[i] = float32((math.Max(v, maxLog-8) + 4) / 4)
+	}
+	return out
+}
+
+// hzToMel converts a frequency to the Slaney mel scale: linear below
+// 1 kHz and logarithmic above.
+func hzToMel(hz float64) float64 {
+	if hz < 1000 {
+		return hz * 3 / 200
+	}
+	return 15 + math.Log(hz/1000)*27/math.Log(6.4)
+}
+
+// melToHz is the inverse of hzToMel.
+func melToHz(mel float64) float64 {
+	if mel < 15 {
+		return mel * 200 / 3
+	}
+	return 1000 * math.Exp((mel-15)*math.Log(6.4)/27)
+}
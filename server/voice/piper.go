@@ -0,0 +1,301 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// Piper phoneme IDs that frame every sentence.
+const (
+	piperPad = "_"
+	piperBOS = "^"
+	piperEOS = "$"
+)
+
+// PiperConfig is the part of a Piper voice's .onnx.json file Magec uses.
+type PiperConfig struct {
+	Audio struct {
+		SampleRate int `json:"sample_rate"`
+	} `json:"audio"`
+	Espeak struct {
+		Voice string `json:"voice"`
+	} `json:"espeak"`
+	Language struct {
+		Code string `json:"code"`
+	} `json:"language"`
+	Inference struct {
+		NoiseScale  float32 `json:"noise_scale"`
+		LengthScale float32 `json:"length_scale"`
+		NoiseW      float32 `json:"noise_w"`
+	} `json:"inference"`
+	// PhonemeType is "espeak" (the default) or "text" for voices trained
+	// on characters.
+	PhonemeType  string             `json:"phoneme_type"`
+	NumSpeakers  int                `json:"num_speakers"`
+	SpeakerIDMap map[string]int64   `json:"speaker_id_map"`
+	PhonemeIDMap map[string][]int64 `json:"phoneme_id_map"`
+}
+
+// ParsePiperConfig parses and checks a Piper voice config, filling in the
+// inference defaults.
+func ParsePiperConfig(data []byte) (PiperConfig, error) {
+	var c PiperConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid voice config: %w", err)
+	}
+	if c.Audio.SampleRate <= 0 {
+		return c, fmt.Errorf("voice config has no audio.sample_rate")
+	}
+	for _, id := range []string{piperPad, piperBOS, piperEOS} {
+		if len(c.PhonemeIDMap[id]) == 0 {
+			return c, fmt.Errorf("voice config phoneme_id_map has no %q", id)
+		}
+	}
+	if c.PhonemeType == "" {
+		c.PhonemeType = "espeak"
+	}
+	if c.PhonemeType != "espeak" && c.PhonemeType != "text" {
+		return c, fmt.Errorf("unsupported phoneme_type %q", c.PhonemeType)
+	}
+	if c.PhonemeType == "espeak" && c.Espeak.Voice == "" {
+		return c, fmt.Errorf("voice config has no espeak.voice")
+	}
+	if c.Inference.NoiseScale == 0 {
+		c.Inference.NoiseScale = 0.667
+	}
+	if c.Inference.LengthScale == 0 {
+		c.Inference.LengthScale = 1
+	}
+	if c.Inference.NoiseW == 0 {
+		c.Inference.NoiseW = 0.8
+	}
+	return c, nil
+}
+
+// Speakers returns the speaker names of a multi-speaker voice in ID order.
+func (c PiperConfig) Speakers() []string {
+	if c.NumSpeakers <= 1 {
+		return nil
+	}
+	names := make([]string, 0, len(c.SpeakerIDMap))
+	for name := range c.SpeakerIDMap {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return int(c.SpeakerIDMap[a] - c.SpeakerIDMap[b])
+	})
+	return names
+}
+
+// piperVoice runs a Piper (VITS) voice exported to ONNX.
+type piperVoice struct {
+	config  PiperConfig
+	session *ort.DynamicAdvancedSession
+	// mu keeps the session alive while it is in use
+	mu sync.RWMutex
+}
+
+// loadPiperVoice loads model.onnx and model.onnx.json from dir.
+func loadPiperVoice(dir string) (*piperVoice, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "model.onnx.json"))
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParsePiperConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, err
+	}
+	defer opts.Destroy()
+	if err := opts.SetIntraOpNumThreads(min(runtime.NumCPU(), 4)); err != nil {
+		return nil, err
+	}
+
+	inputs := []string{"input", "input_lengths", "scales"}
+	if config.NumSpeakers > 1 {
+		inputs = append(inputs, "sid")
+	}
+	session, err := ort.NewDynamicAdvancedSession(filepath.Join(dir, "model.onnx"), inputs, []string{"output"}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load voice model: %w", err)
+	}
+	return &piperVoice{config: config, session: session}, nil
+}
+
+// Destroy releases the ONNX session.
+func (v *piperVoice) Destroy() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.session.Destroy()
+	v.session = nil
+}
+
+// synthesize speaks text and returns mono samples at the voice's sample
+// rate. speed scales the speaking rate (1 is normal) and speaker picks a
+// speaker of multi-speaker voices, the first when empty.
+func (v *piperVoice) synthesize(ctx context.Context, text, speaker string, speed float64) ([]float32, error) {
+	sentences, err := v.phonemize(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	lengthScale := v.config.Inference.LengthScale
+	if speed > 0 {
+		lengthScale /= float32(speed)
+	}
+	var sid int64
+	if speaker != "" {
+		id, ok := v.config.SpeakerIDMap[speaker]
+		if !ok {
+			return nil, fmt.Errorf("voice has no speaker %q", speaker)
+		}
+		sid = id
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.session == nil {
+		return nil, fmt.Errorf("voice was deleted")
+	}
+	var audio []float32
+	for _, phonemes := range sentences {
+		ids := v.phonemeIDs(phonemes)
+		if len(ids) <= 3 {
+			continue
+		}
+		samples, err := v.infer(ids, lengthScale, sid)
+		if err != nil {
+			return nil, err
+		}
+		audio = append(audio, samples...)
+	}
+	normalize(audio)
+	return audio, nil
+}
+
+// phonemize converts text to one phoneme sequence per sentence. espeak
+// voices use the espeak-ng command; text voices use the characters.
+func (v *piperVoice) phonemize(ctx context.Context, text string) ([][]rune, error) {
+	var lines []string
+	if v.config.PhonemeType == "text" {
+		lines = strings.Split(strings.ToLower(text), "\n")
+	} else {
+		cmd := exec.CommandContext(ctx, "espeak-ng", "-q", "--ipa", "-v", v.config.Espeak.Voice, "--stdin")
+		cmd.Stdin = strings.NewReader(text)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("espeak-ng failed: %w, stderr: %s", err, stderr.String())
+		}
+		lines = strings.Split(string(out), "\n")
+	}
+
+	var sentences [][]rune
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			sentences = append(sentences, []rune(line))
+		}
+	}
+	return sentences, nil
+}
+
+// phonemeIDs maps phonemes to model IDs the way Piper does: the sentence
+// starts with BOS, every phoneme is followed by padding and EOS ends it.
+// Phonemes the voice doesn't know are skipped.
+func (v *piperVoice) phonemeIDs(phonemes []rune) []int64 {
+	m := v.config.PhonemeIDMap
+	ids := append(slices.Clone(m[piperBOS]), m[piperPad]...)
+	for _, p := range phonemes {
+		if id, ok := m[string(p)]; ok {
+			ids = append(ids, id...)
+			ids = append(ids, m[piperPad]...)
+		}
+	}
+	return append(ids, m[piperEOS]...)
+}
+
+// infer runs the model on one sentence.
+func (v *piperVoice) infer(ids []int64, lengthScale float32, sid int64) ([]float32, error) {
+	input, err := ort.NewTensor(ort.NewShape(1, int64(len(ids))), ids)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Destroy()
+	lengths, err := ort.NewTensor(ort.NewShape(1), []int64{int64(len(ids))})
+	if err != nil {
+		return nil, err
+	}
+	defer lengths.Destroy()
+	scales, err := ort.NewTensor(ort.NewShape(3), []float32{v.config.Inference.NoiseScale, lengthScale, v.config.Inference.NoiseW})
+	if err != nil {
+		return nil, err
+	}
+	defer scales.Destroy()
+
+	inputs := []ort.Value{input, lengths, scales}
+	if v.config.NumSpeakers > 1 {
+		speaker, err := ort.NewTensor(ort.NewShape(1), []int64{sid})
+		if err != nil {
+			return nil, err
+		}
+		defer speaker.Destroy()
+		inputs = append(inputs, speaker)
+	}
+
+	outputs := []ort.Value{nil}
+	if err := v.session.Run(inputs, outputs); err != nil {
+		return nil, fmt.Errorf("voice model failed: %w", err)
+	}
+	defer outputs[0].Destroy()
+	audio, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("unexpected voice model output type")
+	}
+	return slices.Clone(audio.GetData()), nil
+}
+
+// normalize scales audio so its peak is at full scale, like Piper does.
+// Near silence is left quiet.
+func normalize(audio []float32) {
+	var peak float64
+	for _, s := range audio {
+		peak = math.Max(peak, math.Abs(float64(s)))
+	}
+	scale := float32(1 / math.Max(peak, 0.01))
+	for i := range audio {
+		audio[i] = max(-1, min(1, audio[i]*scale))
+	}
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minSentenceRunes merges very short sentences ("Sure.", "1.") into the
+	// next one, so they are not spoken as separate, choppy clips.
+	minSentenceRunes = 12
+	// maxSentenceRunes cuts text that never reaches a sentence end at a
+	// clause break, so long unpunctuated replies still start playing.
+	maxSentenceRunes = 300
+)
+
+// sentenceAbbreviations are the words that end in a period without ending
+// the sentence, by language. Single letters (initials) never end one.
+var sentenceAbbreviations = map[string][]string{
+	"en": {"mr", "mrs", "ms", "dr", "prof", "sr", "jr", "st", "vs", "etc", "e.g", "i.e", "approx", "dept", "est", "inc", "ltd", "co", "corp", "no", "fig", "jan", "feb", "mar", "apr", "jun", "jul", "aug", "sep", "sept", "oct", "nov", "dec", "a.m", "p.m", "u.s", "u.k"},
+	"es": {"sr", "sra", "srta", "sres", "dr", "dra", "d", "dña", "ud", "uds", "vd", "vds", "etc", "p.ej", "pág", "págs", "núm", "nº", "tel", "av", "avda", "c", "cía", "aprox", "ej", "admón", "dpto", "ene", "feb", "mar", "abr", "jun", "jul", "ago", "sept", "oct", "nov", "dic", "a.m", "p.m", "ee.uu"},
+	"fr": {"m", "mm", "mme", "mlle", "dr", "pr", "etc", "p.ex", "c.-à-d", "cf", "env", "av", "bd", "st", "ste", "janv", "févr", "avr", "juil", "sept", "oct", "nov", "déc"},
+	"de": {"hr", "fr", "dr", "prof", "bzw", "ca", "usw", "z.b", "d.h", "u.a", "vgl", "nr", "str", "evtl", "ggf", "inkl", "jan", "feb", "mär", "apr", "jun", "jul", "aug", "sep", "okt", "nov", "dez"},
+	"it": {"sig", "sigra", "dott", "dr", "prof", "ing", "avv", "ecc", "es", "pag", "n", "gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+	"pt": {"sr", "sra", "srta", "dr", "dra", "prof", "etc", "ex", "pág", "nº", "av", "jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+}
+
+// Sentence terminators. Full-width ones, used by Chinese and Japanese,
+// end a sentence without a following space.
+const (
+	sentenceTerminators = ".!?…؟।։"
+	wideTerminators     = "。！？"
+	sentenceClosers     = "\"'”’»)]」』）"
+	clauseBreaks        = ",;:、，；："
+	markdownMarks       = "*`"
+)
+
+var (
+	markdownLinkRe    = regexp.MustCompile(`\[([^\]]+)\]\([^)]+\)`)
+	markdownHeadingRe = regexp.MustCompile(`(?m)^\s*#{1,6}\s+`)
+	markdownBulletRe  = regexp.MustCompile(`(?m)^\s*(?:[-*+•]|>)\s+`)
+	spacesRe          = regexp.MustCompile(`\s+`)
+)
+
+// SentenceSplitter cuts text that arrives in pieces, like the deltas of a
+// streamed agent reply, into sentences as soon as each one is complete, so
+// it can be spoken while the rest is generated. Language (an ISO 639-1
+// code, optionally with a region) picks the abbreviations that don't end
+// a sentence; other rules apply to every language:
+//
+//   - ".", "!", "?" and "…" end a sentence when followed by a space, and
+//     full-width "。", "！" and "？" end it right away
+//   - a period after an abbreviation, an initial, a list number at the
+//     start of a line or before a lowercase word doesn't end it
+//   - decimals ("3.5") and URLs are never cut, as no space follows the period
+//   - line breaks end a sentence
+type SentenceSplitter struct {
+	abbreviations map[string]bool
+	buf           []rune
+}
+
+// NewSentenceSplitter creates a splitter for language. Unknown or empty
+// languages get the language-independent rules only.
+func NewSentenceSplitter(language string) *SentenceSplitter {
+	base, _, _ := strings.Cut(strings.ToLower(language), "-")
+	base, _, _ = strings.Cut(base, "_")
+	abbreviations := make(map[string]bool)
+	for _, a := range sentenceAbbreviations[base] {
+		abbreviations[a] = true
+	}
+	return &SentenceSplitter{abbreviations: abbreviations}
+}
+
+// Push adds text and returns the sentences it completed, if any.
+func (s *SentenceSplitter) Push(text string) []string {
+	s.buf = append(s.buf, []rune(text)...)
+
+	var sentences []string
+	from := 0
+	for {
+		end := s.boundary(from)
+		if end < 0 {
+			break
+		}
+		sentence := strings.TrimSpace(string(s.buf[:end]))
+		if len([]rune(sentence)) >= minSentenceRunes && hasWords(sentence) {
+			sentences = append(sentences, sentence)
+			s.buf = s.buf[end:]
+			from = 0
+			continue
+		}
+		// Too short: keep it for the next sentence
+		from = end
+	}
+
+	if len(s.buf) > maxSentenceRunes {
+		if cut := s.clauseBreak(); cut > 0 {
+			sentences = append(sentences, strings.TrimSpace(string(s.buf[:cut])))
+			s.buf = s.buf[cut:]
+		}
+	}
+	return sentences
+}
+
+// Flush returns the text left after the last sentence and resets the
+// splitter. Call it when the text is complete.
+func (s *SentenceSplitter) Flush() string {
+	rest := strings.TrimSpace(string(s.buf))
+	s.buf = nil
+	return rest
+}
+
+// boundary returns the end of the first sentence in buf[from:], or -1 when
+// none is complete yet. A sentence end that needs the following text to be
+// told apart waits for it.
+func (s *SentenceSplitter) boundary(from int) int {
+	buf := s.buf
+	for i := from; i < len(buf); i++ {
+		r := buf[i]
+		switch {
+		case r == '\n':
+			return i + 1
+		case strings.ContainsRune(wideTerminators, r):
+			return s.skipClosers(i + 1)
+		case strings.ContainsRune(sentenceTerminators, r):
+			end := s.skipClosers(i + 1)
+			if end >= len(buf) {
+				return -1
+			}
+			if !unicode.IsSpace(buf[end]) {
+				i = end - 1
+				continue
+			}
+			if r != '.' {
+				return end
+			}
+			next := end
+			for next < len(buf) && buf[next] == ' ' {
+				next++
+			}
+			if next >= len(buf) {
+				return -1
+			}
+			if s.continues(i, buf[next]) {
+				i = end - 1
+				continue
+			}
+			return end
+		}
+	}
+	return -1
+}
+
+// skipClosers moves past further terminators and closing quotes or
+// brackets after a sentence end ("?!", "...", `."`).
+func (s *SentenceSplitter) skipClosers(i int) int {
+	for i < len(s.buf) && strings.ContainsRune(sentenceTerminators+wideTerminators+sentenceClosers, s.buf[i]) {
+		i++
+	}
+	return i
+}
+
+// continues reports whether the period at buf[dot] is not a sentence end:
+// it follows an abbreviation, an initial or a list number, or the text
+// goes on in lowercase.
+func (s *SentenceSplitter) continues(dot int, next rune) bool {
+	if unicode.IsLower(next) {
+		return true
+	}
+	start := dot
+	for start > 0 && !unicode.IsSpace(s.buf[start-1]) && !strings.ContainsRune("(\"'¿¡«“", s.buf[start-1]) {
+		start--
+	}
+	word := string(s.buf[start:dot])
+	if word == "" {
+		return false
+	}
+	if w := []rune(word); len(w) == 1 && unicode.IsUpper(w[0]) {
+		return true
+	}
+	if s.abbreviations[strings.ToLower(word)] {
+		return true
+	}
+	// "1." at the start of a line is a numbered list item
+	if isDigits(word) && (start == 0 || s.buf[start-1] == '\n') {
+		return true
+	}
+	return false
+}
+
+// clauseBreak returns where to cut an overlong sentence: after the last
+// clause break, or the last space, past half the maximum length.
+func (s *SentenceSplitter) clauseBreak() int {
+	limit := min(len(s.buf), maxSentenceRunes)
+	for i := limit - 1; i > maxSentenceRunes/2; i-- {
+		if strings.ContainsRune(clauseBreaks, s.buf[i]) {
+			return i + 1
+		}
+	}
+	for i := limit - 1; i > maxSentenceRunes/2; i-- {
+		if unicode.IsSpace(s.buf[i]) {
+			return i + 1
+		}
+	}
+	return limit
+}
+
+// speakable strips the markdown agents tend to reply with, so it is not
+// read aloud, and collapses whitespace.
+func speakable(text string) string {
+	text = markdownLinkRe.ReplaceAllString(text, "$1")
+	text = markdownHeadingRe.ReplaceAllString(text, "")
+	text = markdownBulletRe.ReplaceAllString(text, "")
+	text = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(markdownMarks, r) {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.TrimSpace(spacesRe.ReplaceAllString(text, " "))
+}
+
+func hasWords(text string) bool {
+	return strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) >= 0
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
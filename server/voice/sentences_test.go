@@ -0,0 +1,203 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"strings"
+	"testing"
+)
+
+// splitAll pushes chunks through a splitter and returns every sentence,
+// including what Flush leaves.
+func splitAll(language string, chunks []string) []string {
+	s := NewSentenceSplitter(language)
+	var out []string
+	for _, c := range chunks {
+		out = append(out, s.Push(c)...)
+	}
+	if rest := s.Flush(); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+func TestSentenceSplitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		text     string
+		want     []string
+	}{
+		{
+			name: "basic sentences",
+			text: "The weather is nice today. Do you want to go out? Let's do it!",
+			want: []string{"The weather is nice today.", "Do you want to go out?", "Let's do it!"},
+		},
+		{
+			name: "short sentences merge",
+			text: "Sure. The meeting is at ten tomorrow. Ok.",
+			want: []string{"Sure. The meeting is at ten tomorrow.", "Ok."},
+		},
+		{
+			name:     "english abbreviations",
+			language: "en",
+			text:     "I spoke with Dr. Smith this morning. He says hello to Mrs. Jones too.",
+			want:     []string{"I spoke with Dr. Smith this morning.", "He says hello to Mrs. Jones too."},
+		},
+		{
+			name:     "language with region",
+			language: "en-US",
+			text:     "Bring fruit, bread, etc. Then we can have lunch.",
+			want:     []string{"Bring fruit, bread, etc. Then we can have lunch."},
+		},
+		{
+			name:     "spanish abbreviations",
+			language: "es",
+			text:     "Hablé con la Sra. García esta mañana. Mañana llamará al Dr. Pérez.",
+			want:     []string{"Hablé con la Sra. García esta mañana.", "Mañana llamará al Dr. Pérez."},
+		},
+		{
+			name: "abbreviations depend on language",
+			text: "I spoke with Dr. Smith this morning. He says hello.",
+			want: []string{"I spoke with Dr.", "Smith this morning.", "He says hello."},
+		},
+		{
+			name: "initials",
+			text: "The book by J. R. R. Tolkien is long. I liked it a lot.",
+			want: []string{"The book by J. R. R. Tolkien is long.", "I liked it a lot."},
+		},
+		{
+			name: "decimals",
+			text: "The temperature is 21.5 degrees now. It will rise to 25.",
+			want: []string{"The temperature is 21.5 degrees now.", "It will rise to 25."},
+		},
+		{
+			name: "urls",
+			text: "The docs are at https://example.com/docs.html for you. Read them first.",
+			want: []string{"The docs are at https://example.com/docs.html for you.", "Read them first."},
+		},
+		{
+			name: "lowercase continuation",
+			text: "It costs approx. twenty euros in total. That is fine.",
+			want: []string{"It costs approx. twenty euros in total.", "That is fine."},
+		},
+		{
+			name: "numbered list",
+			text: "1. Open the settings page. 2. Pick a new voice.\n3. Save it",
+			want: []string{"1. Open the settings page.", "2. Pick a new voice.", "3. Save it"},
+		},
+		{
+			name: "line breaks end sentences",
+			text: "First line without a period\nSecond line without one either",
+			want: []string{"First line without a period", "Second line without one either"},
+		},
+		{
+			name: "closing quotes and repeated marks",
+			text: "She said \"this is great.\" Really?! I can't believe it...",
+			want: []string{"She said \"this is great.\"", "Really?! I can't believe it..."},
+		},
+		{
+			name: "chinese punctuation",
+			text: "今天天气很好，我们去公园散步吧。你觉得怎么样？我很想去！",
+			want: []string{"今天天气很好，我们去公园散步吧。", "你觉得怎么样？我很想去！"},
+		},
+		{
+			name: "japanese punctuation",
+			text: "こんにちは、今日はいい天気ですね。散歩に行きましょうか？",
+			want: []string{"こんにちは、今日はいい天気ですね。", "散歩に行きましょうか？"},
+		},
+		{
+			name: "no terminator",
+			text: "Nothing ends here",
+			want: []string{"Nothing ends here"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := func(mode string, got []string) {
+				t.Helper()
+				if len(got) != len(tt.want) {
+					t.Fatalf("%s: got %d sentences %q, want %q", mode, len(got), got, tt.want)
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Errorf("%s: sentence %d = %q, want %q", mode, i, got[i], tt.want[i])
+					}
+				}
+			}
+			check("whole", splitAll(tt.language, []string{tt.text}))
+
+			// Streamed one rune at a time, as agent deltas may arrive.
+			var chunks []string
+			for _, r := range tt.text {
+				chunks = append(chunks, string(r))
+			}
+			check("streamed", splitAll(tt.language, chunks))
+		})
+	}
+}
+
+func TestSentenceSplitter_WaitsForNextText(t *testing.T) {
+	s := NewSentenceSplitter("en")
+	if got := s.Push("This could be the end."); len(got) != 0 {
+		t.Fatalf("expected no sentence before the next text, got %q", got)
+	}
+	if got := s.Push(" And more"); len(got) != 1 || got[0] != "This could be the end." {
+		t.Errorf("got %q, want the first sentence", got)
+	}
+	if rest := s.Flush(); rest != "And more" {
+		t.Errorf("Flush = %q, want %q", rest, "And more")
+	}
+	if rest := s.Flush(); rest != "" {
+		t.Errorf("second Flush = %q, want empty", rest)
+	}
+}
+
+func TestSentenceSplitter_LongText(t *testing.T) {
+	clause := "this goes on and on without ending, "
+	text := strings.Repeat(clause, 20)
+
+	s := NewSentenceSplitter("en")
+	got := s.Push(text)
+	if len(got) == 0 {
+		t.Fatal("expected overlong text to be cut")
+	}
+	for _, sentence := range got {
+		if n := len([]rune(sentence)); n > maxSentenceRunes {
+			t.Errorf("sentence of %d runes exceeds %d", n, maxSentenceRunes)
+		}
+		if !strings.HasSuffix(sentence, ",") {
+			t.Errorf("expected a cut at a clause break, got %q", sentence)
+		}
+	}
+}
+
+func TestSpeakable(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"**Bold** and `code`", "Bold and code"},
+		{"See [the docs](https://example.com) now", "See the docs now"},
+		{"## Title\n- one\n- two", "Title one two"},
+		{"> quoted  text", "quoted text"},
+	}
+	for _, tt := range tests {
+		if got := speakable(tt.in); got != tt.want {
+			t.Errorf("speakable(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
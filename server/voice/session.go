@@ -0,0 +1,779 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	adksession "google.golang.org/adk/session"
+	"google.golang.org/genai"
+
+	"github.com/achetronic/magec/server/clients/msgutil"
+	"github.com/achetronic/magec/server/store"
+)
+
+// Message types of voice sessions. A client that sends "session" gets the
+// whole turn done server-side: the utterance is transcribed, the agent
+// reply is streamed back as text and its speech is sent as binary frames
+// between "audio_start" and "audio_end". In wav, mp3 and pcm the speech
+// starts with the first sentence of the reply, while the rest is still
+// being generated. Speaking while the reply is being generated or played
+// interrupts it. Clients with speaker identification on run each turn as
+// the enrolled user recognized by their voice, announced with "speaker".
+const (
+	MsgTypeSession       = "session"
+	MsgTypeSessionEnd    = "session_end"
+	MsgTypeListen        = "listen"
+	MsgTypeState         = "state"
+	MsgTypeTranscript    = "transcript"
+	MsgTypeSpeaker       = "speaker"
+	MsgTypeResponseDelta = "response_delta"
+	MsgTypeResponse      = "response"
+	MsgTypeAudioStart    = "audio_start"
+	MsgTypeAudioEnd      = "audio_end"
+)
+
+// Session states, reported with "state" messages.
+const (
+	StateIdle      = "idle"
+	StateListening = "listening"
+	StateThinking  = "thinking"
+	StateSpeaking  = "speaking"
+	// StatePlaying lasts until the client reports the end of playback with
+	// a "playing" message, or the speech should have finished.
+	StatePlaying = "playing"
+)
+
+const (
+	// prerollSamples is the audio kept from before speech starts, so the
+	// first syllable is not lost to VAD latency.
+	prerollSamples = TargetSampleRate / 2
+	// maxUtteranceSamples ends an utterance that never goes silent.
+	maxUtteranceSamples = TargetSampleRate * 30
+	// listenTimeout returns to idle when nothing is said after the wake word.
+	listenTimeout = 8 * time.Second
+	// audioChunkSize is the size of the binary frames carrying speech.
+	audioChunkSize = 16 * 1024
+
+	// playbackTimeout bounds the playing state when the length of the
+	// speech cannot be told from its format.
+	playbackTimeout = 60 * time.Second
+	// playbackGrace is added to the length of the speech for client buffering.
+	playbackGrace = 2 * time.Second
+	// pcmBytesPerSecond is the rate of "pcm" speech: 24 kHz 16-bit mono.
+	pcmBytesPerSecond = 24000 * 2
+
+	// interruptionNote is recorded in the conversation after an interrupted
+	// reply, so the model knows the user did not hear all of it.
+	interruptionNote = "[The user interrupted your previous reply before it finished. They may not have heard the rest of it.]"
+
+	defaultAudioFormat = "wav"
+	defaultUserID      = "default_user"
+)
+
+// audioFormats are the speech formats a session can ask for.
+var audioFormats = []string{"wav", "mp3", "opus", "aac", "flac", "pcm"}
+
+// SessionConfig is sent by the client to start a voice session.
+type SessionConfig struct {
+	AgentID string `json:"agentId"`
+	// SessionID continues an existing conversation. A new one is created
+	// when empty.
+	SessionID string `json:"sessionId,omitempty"`
+	// Token is the client token. The Authorization header of the WebSocket
+	// handshake is used when empty.
+	Token string `json:"token,omitempty"`
+	// Wakeword makes the session wait for the wake word (or a "listen"
+	// message) before each turn. Defaults to true.
+	Wakeword *bool `json:"wakeword,omitempty"`
+	// Format is the speech format: wav (default), mp3, opus, aac, flac or pcm.
+	Format string `json:"format,omitempty"`
+	// Language of the replies (e.g. "en"), used to split them into
+	// sentences that are spoken as soon as they are generated.
+	Language string `json:"language,omitempty"`
+}
+
+// SessionInfo confirms a started session.
+type SessionInfo struct {
+	AgentID   string `json:"agentId"`
+	SessionID string `json:"sessionId"`
+	UserID    string `json:"userId"`
+	Wakeword  bool   `json:"wakeword"`
+	Format    string `json:"format"`
+	Language  string `json:"language,omitempty"`
+}
+
+// Pipeline runs voice turns for clients that only stream audio, such as
+// ESP32 satellites or kiosks. Transcription, the agent run and speech go
+// through the internal API with the client's token, so they are recorded
+// and authorized like any other client call.
+type Pipeline struct {
+	store  *store.Store
+	api    *agentAPI
+	logger *slog.Logger
+
+	mu       sync.RWMutex
+	sessions adksession.Service
+	speakers *SpeakerID
+}
+
+// NewPipeline creates a voice pipeline. agentURL is the base URL of the
+// agent API (e.g. "http://127.0.0.1:8080/api/v1/agent").
+func NewPipeline(s *store.Store, agentURL string, logger *slog.Logger) *Pipeline {
+	return &Pipeline{
+		store:  s,
+		api:    &agentAPI{baseURL: agentURL},
+		logger: logger,
+	}
+}
+
+// SetSessionService injects the ADK session service, used to record replies
+// cut off by the user. It is swapped every time the agents are rebuilt.
+func (p *Pipeline) SetSessionService(svc adksession.Service) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sessions = svc
+}
+
+func (p *Pipeline) sessionService() adksession.Service {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.sessions
+}
+
+// SetSpeakerID enables speaker identification for the clients that have
+// it turned on.
+func (p *Pipeline) SetSpeakerID(sid *SpeakerID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.speakers = sid
+}
+
+// IdentifySpeaker returns the enrolled user speaking in an utterance of
+// 16 kHz samples, or "" when identification is off for the client (see
+// store.VoiceSettings) or nobody is recognized.
+func (p *Pipeline) IdentifySpeaker(samples []float32, settings store.VoiceSettings) string {
+	p.mu.RLock()
+	sid := p.speakers
+	p.mu.RUnlock()
+	if sid == nil || !settings.SpeakerIDEnabled() {
+		return ""
+	}
+	userID, score, err := sid.Identify(samples, settings.SpeakerThreshold)
+	switch {
+	case errors.Is(err, ErrSpeakerAudioTooShort):
+		return ""
+	case err != nil:
+		p.logger.Warn("Speaker identification failed", "error", err)
+		return ""
+	case userID != "":
+		p.logger.Info("Speaker identified", "user", userID, "score", score)
+	}
+	return userID
+}
+
+// recordInterruption adds the part of a reply generated before the user
+// interrupted it to the conversation, followed by a note saying the reply
+// was cut off. A reply that finished generating is already recorded.
+func (p *Pipeline) recordInterruption(ctx context.Context, info SessionInfo, author, partial string) error {
+	svc := p.sessionService()
+	if svc == nil {
+		return errors.New("session service is not available")
+	}
+	resp, err := svc.Get(ctx, &adksession.GetRequest{
+		AppName:   info.AgentID,
+		UserID:    info.UserID,
+		SessionID: info.SessionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	invocationID := "voice-interrupt-" + uuid.NewString()
+	if partial = strings.TrimSpace(partial); partial != "" && author != "" {
+		evt := adksession.NewEvent(invocationID)
+		evt.Author = author
+		evt.Content = genai.NewContentFromText(partial, genai.RoleModel)
+		if err := svc.AppendEvent(ctx, resp.Session, evt); err != nil {
+			return err
+		}
+	}
+	note := adksession.NewEvent(invocationID)
+	note.Author = "user"
+	note.Content = genai.NewContentFromText(interruptionNote, genai.RoleUser)
+	return svc.AppendEvent(ctx, resp.Session, note)
+}
+
+// Transcribe converts WAV audio to text with the STT backend of the agent.
+// token is the client token the request is made with.
+func (p *Pipeline) Transcribe(ctx context.Context, token, agentID string, wav []byte) (string, error) {
+	return p.api.transcribe(ctx, bearer(token), agentID, wav)
+}
+
+// Speak synthesizes text with the TTS backend of the agent in the given
+// format (wav, mp3, opus, aac, flac or pcm).
+func (p *Pipeline) Speak(ctx context.Context, token, agentID, text, format string) ([]byte, error) {
+	return p.api.speech(ctx, bearer(token), agentID, text, format)
+}
+
+// Ask runs one agent turn in a session and returns the last text reply.
+func (p *Pipeline) Ask(ctx context.Context, token, agentID, userID, sessionID, text string) (string, error) {
+	auth := bearer(token)
+	if err := p.api.ensureSession(ctx, auth, agentID, userID, sessionID); err != nil {
+		p.logger.Warn("Failed to ensure session, continuing anyway", "session", sessionID, "error", err)
+	}
+
+	var reply, finishReason, errMsg string
+	err := p.api.run(ctx, auth, agentID, userID, sessionID, text, func(evt msgutil.SSEEvent) {
+		if evt.FinishReason != "" {
+			finishReason = evt.FinishReason
+		}
+		switch {
+		case evt.Type == msgutil.SSEEventText && !evt.Partial:
+			reply = evt.Text
+		case evt.Type == msgutil.SSEEventError:
+			errMsg = evt.ErrorMessage
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if reply == "" {
+		return "", errors.New(msgutil.ExplainNoResponse(finishReason, errMsg))
+	}
+	return reply, nil
+}
+
+// authorize checks the session token against the clients in the store and
+// returns the user the session runs as. Without any client (open mode)
+// every agent is allowed.
+func (p *Pipeline) authorize(token, agentID string) (string, error) {
+	_, isAgent := p.store.GetAgent(agentID)
+	_, isFlow := p.store.GetFlow(agentID)
+	if !isAgent && !isFlow {
+		return "", fmt.Errorf("agent %q not found", agentID)
+	}
+
+	if len(p.store.ListClients()) == 0 {
+		return defaultUserID, nil
+	}
+	if token == "" {
+		return "", errors.New("a client token is required")
+	}
+	cl, ok := p.store.GetClientByToken(token)
+	if !ok || !cl.Enabled {
+		return "", errors.New("invalid or disabled client token")
+	}
+	if !slices.Contains(cl.AllowedAgents, agentID) {
+		return "", fmt.Errorf("client is not allowed to use agent %q", agentID)
+	}
+
+	userID, err := p.store.ResolveUser(store.IdentityClient, cl.ID, cl.Name)
+	if err != nil {
+		p.logger.Warn("Failed to resolve user identity", "client", cl.Name, "error", err)
+	}
+	if userID == "" {
+		userID = defaultUserID
+	}
+	return userID, nil
+}
+
+// session is the server-side voice session of one connection.
+type session struct {
+	pipeline *Pipeline
+	client   *clientState
+	info     SessionInfo
+	auth     string
+	logger   *slog.Logger
+	// voice holds the client's stored voice settings, which decide whether
+	// speakers are identified
+	voice store.VoiceSettings
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	state     string
+	preroll   []float32
+	utterance []float32
+	capturing bool
+	deadline  time.Time
+
+	// The turn in progress, cancelled when the user interrupts it
+	turnID     int
+	turnCancel context.CancelFunc
+	// reply is the text streamed so far by the agent, final once done
+	reply     string
+	author    string
+	replyDone bool
+	// turnUser is the user the turn runs as: the recognized speaker, or
+	// the session's user
+	turnUser string
+}
+
+func newSession(p *Pipeline, client *clientState, info SessionInfo, token string, logger *slog.Logger) *session {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &session{
+		pipeline: p,
+		client:   client,
+		info:     info,
+		logger:   logger,
+		ctx:      ctx,
+		cancel:   cancel,
+		state:    StateIdle,
+	}
+	s.auth = bearer(token)
+	return s
+}
+
+// bearer turns a client token into an Authorization header value.
+func bearer(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "Bearer " + token
+}
+
+// startSession validates a session request and returns the new session.
+func (p *Pipeline) startSession(client *clientState, cfg SessionConfig, handshakeToken string) (*session, error) {
+	if cfg.AgentID == "" {
+		return nil, errors.New("agentId is required")
+	}
+	format := cfg.Format
+	if format == "" {
+		format = defaultAudioFormat
+	}
+	if !slices.Contains(audioFormats, format) {
+		return nil, fmt.Errorf("unsupported audio format %q", format)
+	}
+
+	token := cfg.Token
+	if token == "" {
+		token = handshakeToken
+	}
+	userID, err := p.authorize(token, cfg.AgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := SessionInfo{
+		AgentID:   cfg.AgentID,
+		SessionID: cfg.SessionID,
+		UserID:    userID,
+		Wakeword:  cfg.Wakeword == nil || *cfg.Wakeword,
+		Format:    format,
+		Language:  cfg.Language,
+	}
+	if info.SessionID == "" {
+		info.SessionID = "voice-" + uuid.NewString()
+	}
+
+	s := newSession(p, client, info, token, p.logger.With("agent", info.AgentID, "session", info.SessionID))
+	if cl, ok := p.store.GetClientByToken(token); ok {
+		s.voice = store.VoiceSettings{}.Merge(cl.Voice)
+	}
+	if err := p.api.ensureSession(s.ctx, s.auth, info.AgentID, info.UserID, info.SessionID); err != nil {
+		s.logger.Warn("Failed to ensure session, continuing anyway", "error", err)
+	}
+	return s, nil
+}
+
+// close stops the session and any turn in progress.
+func (s *session) close() {
+	s.cancel()
+	s.client.setPlaying(false)
+}
+
+// feed takes a 16 kHz frame of the client's audio.
+func (s *session) feed(frame []float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preroll = append(s.preroll, frame...)
+	if over := len(s.preroll) - prerollSamples; over > 0 {
+		s.preroll = s.preroll[over:]
+	}
+
+	if s.capturing {
+		s.utterance = append(s.utterance, frame...)
+		if len(s.utterance) >= maxUtteranceSamples {
+			s.finish()
+		}
+		return
+	}
+	if (s.state == StateListening || s.state == StatePlaying) && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.enter(StateIdle)
+	}
+}
+
+// onWakeword starts listening when the session waits for the wake word.
+func (s *session) onWakeword() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == StateIdle && s.info.Wakeword {
+		s.listen()
+	}
+}
+
+// onListen starts listening on the client's request, e.g. a button press.
+func (s *session) onListen() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == StateIdle {
+		s.listen()
+	}
+}
+
+// onPlaybackEnd is called when the client finished playing the speech.
+func (s *session) onPlaybackEnd() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == StatePlaying {
+		s.enter(StateIdle)
+	}
+}
+
+func (s *session) onSpeechStart() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.capturing {
+		return
+	}
+	switch {
+	case s.interruptible():
+		s.interrupt()
+	case !s.listening():
+		return
+	}
+	s.capturing = true
+	s.utterance = append(s.utterance[:0], s.preroll...)
+}
+
+func (s *session) onSpeechEnd() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.capturing {
+		s.finish()
+	}
+}
+
+// listening reports whether speech now would be a turn. Must hold mu.
+func (s *session) listening() bool {
+	return s.state == StateListening || (s.state == StateIdle && !s.info.Wakeword)
+}
+
+// interruptible reports whether a reply is being generated or played. Must
+// hold mu.
+func (s *session) interruptible() bool {
+	return s.state == StateThinking || s.state == StateSpeaking || s.state == StatePlaying
+}
+
+// interrupt cancels the turn in progress when the user barges in, tells
+// the client to stop playback and starts listening to what the user says.
+// Must hold mu.
+func (s *session) interrupt() {
+	interrupted := s.state
+	if s.turnCancel != nil {
+		s.turnCancel()
+		s.turnCancel = nil
+	}
+	s.turnID++
+
+	// A reply cut off before any text was generated leaves nothing to record
+	partial := ""
+	if !s.replyDone {
+		partial = s.reply
+	}
+	if s.replyDone || partial != "" {
+		info := s.info
+		info.UserID = s.turnUser
+		go func(author string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := s.pipeline.recordInterruption(ctx, info, author, partial); err != nil {
+				s.logger.Warn("Failed to record interrupted reply", "error", err)
+			}
+		}(s.author)
+	}
+
+	s.logger.Info("Voice turn interrupted", "state", interrupted)
+	s.client.writeJSON(WSMessage{Type: MsgTypeInterrupt, Data: map[string]string{"state": interrupted}})
+	s.enter(StateListening)
+}
+
+// listen waits for speech until the listen timeout. Must hold mu.
+func (s *session) listen() {
+	s.enter(StateListening)
+	s.deadline = time.Now().Add(listenTimeout)
+}
+
+// finish hands the captured utterance to a new turn. Must hold mu.
+func (s *session) finish() {
+	samples := s.utterance
+	s.utterance = nil
+	s.capturing = false
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.turnID++
+	s.turnCancel = cancel
+	s.reply, s.author, s.replyDone = "", "", false
+	s.turnUser = s.info.UserID
+	s.enter(StateThinking)
+	go s.turn(ctx, s.turnID, samples)
+}
+
+// enter switches state and tells the client. The VAD turns echo-tolerant
+// while the client plays speech. Must hold mu.
+func (s *session) enter(state string) {
+	s.state = state
+	s.deadline = time.Time{}
+	s.client.setPlaying(state == StateSpeaking || state == StatePlaying)
+	s.client.writeJSON(WSMessage{Type: MsgTypeState, Data: map[string]string{"state": state}})
+}
+
+func (s *session) setState(state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enter(state)
+}
+
+// advance moves turn id to the given state. It reports false when the turn
+// was interrupted or the session closed, so the turn must stop.
+func (s *session) advance(id int, state string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != s.turnID || s.ctx.Err() != nil {
+		return false
+	}
+	s.enter(state)
+	return true
+}
+
+// streamed keeps the reply of turn id as it is generated.
+func (s *session) streamed(id int, evt msgutil.SSEEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != s.turnID {
+		return
+	}
+	if evt.Author != "" {
+		s.author = evt.Author
+	}
+	if evt.Partial {
+		s.reply += evt.Text
+	} else {
+		s.reply, s.replyDone = evt.Text, true
+	}
+}
+
+// identified makes the recognized speaker the user of turn id.
+func (s *session) identified(id int, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id == s.turnID {
+		s.turnUser = userID
+	}
+}
+
+// playbackDuration is the length of speech audio, or playbackTimeout when
+// the format does not tell.
+func playbackDuration(audio []byte, format string) time.Duration {
+	switch format {
+	case "wav":
+		pcm, f, err := DecodeWAV(audio)
+		if err == nil && f.Rate > 0 && f.Width > 0 && f.Channels > 0 {
+			return time.Duration(len(pcm)) * time.Second / time.Duration(f.Rate*f.Width*f.Channels)
+		}
+	case "pcm":
+		return time.Duration(len(audio)) * time.Second / pcmBytesPerSecond
+	}
+	return playbackTimeout
+}
+
+// turn runs turn id and waits for the client to play the speech, if any.
+// ctx is cancelled when the user interrupts the turn.
+func (s *session) turn(ctx context.Context, id int, samples []float32) {
+	audio := s.respond(ctx, id, samples)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != s.turnID || s.ctx.Err() != nil {
+		return
+	}
+	s.turnCancel()
+	s.turnCancel = nil
+	if audio == nil {
+		s.enter(StateIdle)
+		return
+	}
+	// Playing ends when the client says so, or after the length of the speech
+	s.enter(StatePlaying)
+	s.deadline = time.Now().Add(playbackDuration(audio, s.info.Format) + playbackGrace)
+}
+
+// respond transcribes an utterance, runs the agent and speaks its reply.
+// It returns the speech sent to the client, or nil when there was none.
+func (s *session) respond(ctx context.Context, id int, samples []float32) []byte {
+	api := s.pipeline.api
+
+	// The speaker is identified while the utterance is transcribed
+	speaker := make(chan string, 1)
+	go func() { speaker <- s.pipeline.IdentifySpeaker(samples, s.voice) }()
+
+	text, err := api.transcribe(ctx, s.auth, s.info.AgentID, EncodeWAV(samples, TargetSampleRate))
+	if err != nil {
+		s.fail(ctx, "Transcription failed", err)
+		return nil
+	}
+	text = strings.TrimSpace(text)
+	s.client.writeJSON(WSMessage{Type: MsgTypeTranscript, Data: map[string]string{"text": text}})
+	if text == "" {
+		return nil
+	}
+	s.logger.Info("Voice turn", "text", text)
+
+	userID := s.info.UserID
+	if speakerID := <-speaker; speakerID != "" && ctx.Err() == nil {
+		userID = speakerID
+		s.identified(id, userID)
+		name := ""
+		if u, ok := s.pipeline.store.GetUser(userID); ok {
+			name = u.Name
+		}
+		s.client.writeJSON(WSMessage{Type: MsgTypeSpeaker, Data: map[string]string{"userId": userID, "name": name}})
+		if err := api.ensureSession(ctx, s.auth, s.info.AgentID, userID, s.info.SessionID); err != nil {
+			s.logger.Warn("Failed to ensure session, continuing anyway", "user", userID, "error", err)
+		}
+	}
+
+	// Streamable formats are spoken sentence by sentence as the reply is
+	// generated; the others once it is complete
+	var sentences *sentenceSpeaker
+	var audio []byte
+	if slices.Contains(streamFormats, s.info.Format) {
+		sentences = s.pipeline.newSentenceSpeaker(ctx, s.auth, s.info.AgentID, s.info.Format, s.info.Language, func(chunk []byte) error {
+			if audio == nil && !s.startSpeaking(id) {
+				return context.Canceled
+			}
+			audio = append(audio, chunk...)
+			return s.sendAudio(ctx, chunk)
+		})
+	}
+
+	var reply, finishReason, errMsg string
+	err = api.run(ctx, s.auth, s.info.AgentID, userID, s.info.SessionID, text, func(evt msgutil.SSEEvent) {
+		if evt.FinishReason != "" {
+			finishReason = evt.FinishReason
+		}
+		switch evt.Type {
+		case msgutil.SSEEventText:
+			if ctx.Err() != nil {
+				return
+			}
+			s.streamed(id, evt)
+			msgType := MsgTypeResponse
+			if evt.Partial {
+				msgType = MsgTypeResponseDelta
+			} else {
+				reply = evt.Text
+			}
+			s.client.writeJSON(WSMessage{Type: msgType, Data: map[string]string{"text": evt.Text, "agent": evt.Author}})
+			if sentences != nil {
+				sentences.event(evt)
+			}
+		case msgutil.SSEEventError:
+			errMsg = evt.ErrorMessage
+		}
+	})
+	if sentences != nil {
+		speakErr := sentences.close()
+		if audio != nil && ctx.Err() == nil {
+			s.client.writeJSON(WSMessage{Type: MsgTypeAudioEnd})
+		}
+		if err == nil && speakErr != nil {
+			s.fail(ctx, "Speech synthesis failed", speakErr)
+		}
+	}
+	if err != nil {
+		s.fail(ctx, "Agent run failed", err)
+		return audio
+	}
+	if reply == "" {
+		if ctx.Err() == nil {
+			s.client.writeError(msgutil.ExplainNoResponse(finishReason, errMsg))
+		}
+		return audio
+	}
+	if sentences != nil {
+		return audio
+	}
+
+	if !s.startSpeaking(id) {
+		return nil
+	}
+	audio, err = api.speech(ctx, s.auth, s.info.AgentID, speakable(reply), s.info.Format)
+	if err != nil {
+		s.fail(ctx, "Speech synthesis failed", err)
+		return nil
+	}
+	if err := s.sendAudio(ctx, audio); err != nil {
+		return nil
+	}
+	s.client.writeJSON(WSMessage{Type: MsgTypeAudioEnd})
+	return audio
+}
+
+// startSpeaking moves turn id to speaking and tells the client speech
+// follows. It reports false when the turn is over.
+func (s *session) startSpeaking(id int) bool {
+	if !s.advance(id, StateSpeaking) {
+		return false
+	}
+	s.client.writeJSON(WSMessage{Type: MsgTypeAudioStart, Data: map[string]string{"format": s.info.Format}})
+	return true
+}
+
+// sendAudio sends speech to the client in binary frames.
+func (s *session) sendAudio(ctx context.Context, audio []byte) error {
+	for chunk := range slices.Chunk(audio, audioChunkSize) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.client.writeBinary(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fail reports a failed step of a turn unless the turn was interrupted or
+// the session closed.
+func (s *session) fail(ctx context.Context, msg string, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	s.logger.Error(msg, "error", err)
+	s.client.writeError(msg)
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"time"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+// Tune applies the voice settings of a client. Unset fields restore the
+// defaults.
+func (v *VAD) Tune(s store.VoiceSettings) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.config.Threshold = VADThreshold
+	if s.VADThreshold != 0 {
+		v.config.Threshold = s.VADThreshold
+	}
+	v.config.SilenceTimeout = VADSilenceTimeout
+	if s.SilenceTimeout != 0 {
+		v.config.SilenceTimeout = time.Duration(s.SilenceTimeout) * time.Millisecond
+	}
+	v.config.MinSpeech = 0
+	if s.MinSpeech != nil {
+		v.config.MinSpeech = time.Duration(*s.MinSpeech) * time.Millisecond
+	}
+	v.speechWindows = 0
+}
+
+// Tune applies the wake word settings of a client: its threshold, which
+// overrides that of every model (zero restores them), and the wake words it
+// may use. The active model moves to the first allowed one when needed.
+func (d *Detector) Tune(s store.VoiceSettings) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.threshold = s.WakewordThreshold
+	d.allowed = s.Wakewords
+	if !d.isAllowed(d.activeModelID) {
+		d.activeModelID = d.defaultModel()
+	}
+}
+
+// Threshold returns the wake word threshold of the active model.
+func (d *Detector) Threshold() float32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if m, ok := d.wakeWordSessions[d.activeModelID]; ok {
+		return d.thresholdFor(m)
+	}
+	return d.threshold
+}
+
+// thresholdFor returns the threshold a model detects with. Must hold mu.
+func (d *Detector) thresholdFor(m *wakeWordModel) float32 {
+	if d.threshold > 0 {
+		return d.threshold
+	}
+	return m.config.Threshold
+}
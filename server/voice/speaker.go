@@ -0,0 +1,317 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	ort "github.com/yalue/onnxruntime_go"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+const (
+	// SpeakerThreshold is the default cosine similarity between an
+	// utterance and a voiceprint for the speaker to be recognized.
+	SpeakerThreshold = 0.5
+	// minSpeakerSamples is the shortest audio a speaker can be told from.
+	minSpeakerSamples = TargetSampleRate
+	// MaxEnrollmentSamples bounds the samples of one enrollment request.
+	MaxEnrollmentSamples = 10
+)
+
+var (
+	// ErrSpeakerAudioTooShort is returned for audio shorter than a second.
+	ErrSpeakerAudioTooShort = errors.New("audio is too short to identify a speaker (at least 1 second is needed)")
+	// ErrNoSpeakerModel is returned when no embedding model is installed.
+	ErrNoSpeakerModel = errors.New("no speaker embedding model")
+)
+
+// speakerModel computes speaker embeddings with a WeSpeaker or 3D-Speaker
+// model exported by sherpa-onnx: fbank features in, one embedding out.
+type speakerModel struct {
+	name    string
+	session *ort.DynamicAdvancedSession
+	fbank   *fbank
+	nBins   int
+	// scaleSamples feeds samples in the 16-bit range, for models trained
+	// without normalized samples (normalize_samples = 0)
+	scaleSamples bool
+	// subtractMean removes the mean of each feature over the utterance
+	subtractMean bool
+
+	mu sync.Mutex
+}
+
+// loadSpeakerModel loads a speaker embedding model and reads its feature
+// settings from the sherpa-onnx metadata.
+func loadSpeakerModel(path string) (*speakerModel, error) {
+	inputs, outputs, err := ort.GetInputOutputInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read speaker model: %w", err)
+	}
+	if len(inputs) != 1 || len(outputs) != 1 || len(inputs[0].Dimensions) != 3 {
+		return nil, fmt.Errorf("speaker model must take one [batch, frames, features] input and give one embedding")
+	}
+	m := &speakerModel{name: filepath.Base(path), nBins: int(inputs[0].Dimensions[2])}
+	if m.nBins <= 0 {
+		m.nBins = 80
+	}
+	m.fbank = newFbank(m.nBins)
+
+	md, err := ort.GetModelMetadata(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model metadata: %w", err)
+	}
+	defer md.Destroy()
+	lookup := func(key string) string {
+		v, _, _ := md.LookupCustomMetadataMap(key)
+		return v
+	}
+	if framework := lookup("framework"); framework == "nemo" {
+		return nil, fmt.Errorf("NeMo speaker models are not supported; use a WeSpeaker or 3D-Speaker model")
+	}
+	if rate := lookup("sample_rate"); rate != "" && rate != fmt.Sprint(TargetSampleRate) {
+		return nil, fmt.Errorf("speaker model expects %s Hz audio, only %d Hz is supported", rate, TargetSampleRate)
+	}
+	m.scaleSamples = lookup("normalize_samples") == "0"
+	m.subtractMean = lookup("feature_normalize_type") == "global-mean"
+
+	opts, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, err
+	}
+	defer opts.Destroy()
+	if err := opts.SetIntraOpNumThreads(min(runtime.NumCPU(), 2)); err != nil {
+		return nil, err
+	}
+	m.session, err = ort.NewDynamicAdvancedSession(path, []string{inputs[0].Name}, []string{outputs[0].Name}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load speaker model: %w", err)
+	}
+	return m, nil
+}
+
+// embed returns the unit-length speaker embedding of 16 kHz samples.
+func (m *speakerModel) embed(samples []float32) ([]float32, error) {
+	if len(samples) < minSpeakerSamples {
+		return nil, ErrSpeakerAudioTooShort
+	}
+	if m.scaleSamples {
+		scaled := make([]float32, len(samples))
+		for i, s := range samples {
+			scaled[i] = s * 32768
+		}
+		samples = scaled
+	}
+
+	features := m.fbank.compute(samples)
+	if m.subtractMean {
+		mean := make([]float32, m.nBins)
+		for _, f := range features {
+			for b, v := range f {
+				mean[b] += v / float32(len(features))
+			}
+		}
+		for _, f := range features {
+			for b := range f {
+				f[b] -= mean[b]
+			}
+		}
+	}
+	flat := make([]float32, 0, len(features)*m.nBins)
+	for _, f := range features {
+		flat = append(flat, f...)
+	}
+
+	input, err := ort.NewTensor(ort.NewShape(1, int64(len(features)), int64(m.nBins)), flat)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Destroy()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	outputs := []ort.Value{nil}
+	if err := m.session.Run([]ort.Value{input}, outputs); err != nil {
+		return nil, fmt.Errorf("speaker model failed: %w", err)
+	}
+	defer outputs[0].Destroy()
+	out, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("unexpected speaker model output type")
+	}
+	embedding := slices.Clone(out.GetData())
+	normalizeEmbedding(embedding)
+	return embedding, nil
+}
+
+// SpeakerID recognizes enrolled users by their voice. The embedding model
+// is the first .onnx file in dir (int8 preferred); it is loaded on first
+// use. Voiceprints are kept in the store, one per user.
+type SpeakerID struct {
+	store           *store.Store
+	dir             string
+	onnxLibraryPath string
+	logger          *slog.Logger
+
+	mu    sync.Mutex
+	model *speakerModel
+}
+
+// NewSpeakerID creates a speaker identifier with the model in dir.
+func NewSpeakerID(s *store.Store, dir, onnxLibraryPath string, logger *slog.Logger) *SpeakerID {
+	return &SpeakerID{store: s, dir: dir, onnxLibraryPath: onnxLibraryPath, logger: logger}
+}
+
+// loadModel returns the embedding model, loading it on first use.
+func (sid *SpeakerID) loadModel() (*speakerModel, error) {
+	sid.mu.Lock()
+	defer sid.mu.Unlock()
+	if sid.model != nil {
+		return sid.model, nil
+	}
+	path, err := findModelFile(sid.dir, "*.onnx")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoSpeakerModel, err)
+	}
+	if err := InitONNX(sid.onnxLibraryPath); err != nil {
+		return nil, err
+	}
+	m, err := loadSpeakerModel(path)
+	if err != nil {
+		return nil, err
+	}
+	sid.model = m
+	sid.logger.Info("Loaded speaker embedding model", "model", m.name)
+	return m, nil
+}
+
+// Enroll adds WAV samples of a user's voice to their voiceprint. With
+// reset, or when the voiceprint was made with another model, it is
+// replaced instead. Each sample should hold a few seconds of speech.
+func (sid *SpeakerID) Enroll(userID string, wavs [][]byte, reset bool) (store.Voiceprint, error) {
+	if len(wavs) == 0 || len(wavs) > MaxEnrollmentSamples {
+		return store.Voiceprint{}, fmt.Errorf("between 1 and %d samples are needed", MaxEnrollmentSamples)
+	}
+	m, err := sid.loadModel()
+	if err != nil {
+		return store.Voiceprint{}, err
+	}
+
+	v, ok := sid.store.GetVoiceprint(userID)
+	if !ok || reset || v.Model != m.name {
+		v = store.Voiceprint{UserID: userID, Model: m.name}
+	}
+	// The stored embedding is shared with concurrent identifications
+	v.Embedding = slices.Clone(v.Embedding)
+	for i, wav := range wavs {
+		samples, err := WAVSamples(wav)
+		if err != nil {
+			return store.Voiceprint{}, fmt.Errorf("sample %d: %w", i+1, err)
+		}
+		embedding, err := m.embed(samples)
+		if err != nil {
+			return store.Voiceprint{}, fmt.Errorf("sample %d: %w", i+1, err)
+		}
+		// Running mean of the samples' embeddings
+		if v.Embedding == nil {
+			v.Embedding = make([]float32, len(embedding))
+		}
+		if len(v.Embedding) != len(embedding) {
+			return store.Voiceprint{}, fmt.Errorf("speaker model changed embedding size")
+		}
+		v.Samples++
+		for j, e := range embedding {
+			v.Embedding[j] += (e - v.Embedding[j]) / float32(v.Samples)
+		}
+	}
+	if err := sid.store.SaveVoiceprint(v); err != nil {
+		return store.Voiceprint{}, err
+	}
+	return v, nil
+}
+
+// Identify returns the enrolled user whose voiceprint is most similar to
+// 16 kHz samples, and the similarity, or "" when no voiceprint reaches
+// threshold (SpeakerThreshold when zero).
+func (sid *SpeakerID) Identify(samples []float32, threshold float32) (string, float32, error) {
+	voiceprints := sid.store.ListVoiceprints()
+	if len(voiceprints) == 0 {
+		return "", 0, nil
+	}
+	if threshold == 0 {
+		threshold = SpeakerThreshold
+	}
+	m, err := sid.loadModel()
+	if err != nil {
+		return "", 0, err
+	}
+
+	start := time.Now()
+	embedding, err := m.embed(samples)
+	if err != nil {
+		return "", 0, err
+	}
+	best, bestScore := "", float32(-1)
+	for _, v := range voiceprints {
+		if v.Model != m.name || len(v.Embedding) != len(embedding) {
+			continue
+		}
+		if score := cosineSimilarity(embedding, v.Embedding); score > bestScore {
+			best, bestScore = v.UserID, score
+		}
+	}
+	sid.logger.Debug("Speaker identification done", "user", best, "score", bestScore, "took", time.Since(start))
+	if bestScore < threshold {
+		return "", bestScore, nil
+	}
+	return best, bestScore, nil
+}
+
+func normalizeEmbedding(v []float32) {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range v {
+			v[i] = float32(float64(v[i]) / norm)
+		}
+	}
+}
+
+func cosineSimilarity(a, b []float32) float32 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(na*nb))
+}
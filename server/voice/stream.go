@@ -0,0 +1,281 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/achetronic/magec/server/clients/msgutil"
+)
+
+const (
+	// defaultStreamFormat is the format of streamed speech when none is asked.
+	defaultStreamFormat = "mp3"
+	// maxStreamRequestSize bounds JSON requests to the speech stream.
+	maxStreamRequestSize = 1 << 20
+	// sentenceQueueSize is how many sentences can wait for synthesis before
+	// the text source is held back.
+	sentenceQueueSize = 64
+	// maxStreamDuration bounds how long an SSE body is read, like agent runs.
+	maxStreamDuration = 15 * time.Minute
+)
+
+// streamFormats are the speech formats whose per-sentence files can be
+// joined into one stream: MP3 frames and raw PCM concatenate, and WAV keeps
+// the header of the first sentence only.
+var streamFormats = []string{"mp3", "wav", "pcm"}
+
+// SpeechStreamRequest is the JSON body of the speech stream. It carries
+// either the text to speak (Input) or a message to run the agent with,
+// whose reply is spoken as it is generated.
+type SpeechStreamRequest struct {
+	Input string `json:"input,omitempty"`
+
+	Message   string `json:"message,omitempty"`
+	UserID    string `json:"userId,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+
+	// ResponseFormat is mp3 (default), wav or pcm.
+	ResponseFormat string `json:"response_format,omitempty"`
+	// Language picks the sentence rules, e.g. "en" or "es-ES".
+	Language string `json:"language,omitempty"`
+}
+
+// ServeSpeechStream speaks text as it arrives and streams the audio back
+// in a chunked response, one sentence at a time, so playback starts as
+// soon as the first sentence is synthesized. The text comes from:
+//
+//   - a text/event-stream body: the SSE stream of /run_sse, relayed as it
+//     is received
+//   - a JSON body with "input": text already at hand
+//   - a JSON body with "message" and "sessionId": the agent is run and its
+//     reply is spoken while it is generated
+//
+// response_format and language may also be given as query parameters.
+// Every sentence goes through the agent's speech endpoint with the
+// caller's credentials, so it is synthesized by the agent's TTS backend.
+func (p *Pipeline) ServeSpeechStream(w http.ResponseWriter, r *http.Request, agentID string) {
+	req := SpeechStreamRequest{
+		ResponseFormat: r.URL.Query().Get("response_format"),
+		Language:       r.URL.Query().Get("language"),
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		body := SpeechStreamRequest{}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxStreamRequestSize)).Decode(&body); err != nil {
+			writeStreamError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if body.ResponseFormat == "" {
+			body.ResponseFormat = req.ResponseFormat
+		}
+		if body.Language == "" {
+			body.Language = req.Language
+		}
+		req = body
+		if req.Input == "" && req.Message == "" {
+			writeStreamError(w, http.StatusBadRequest, "input or message is required")
+			return
+		}
+		if req.Message != "" && req.SessionID == "" {
+			writeStreamError(w, http.StatusBadRequest, "sessionId is required with message")
+			return
+		}
+	}
+	if req.ResponseFormat == "" {
+		req.ResponseFormat = defaultStreamFormat
+	}
+	if !slices.Contains(streamFormats, req.ResponseFormat) {
+		writeStreamError(w, http.StatusBadRequest, fmt.Sprintf("unsupported stream format %q (use mp3, wav or pcm)", req.ResponseFormat))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeStreamError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	ctx := r.Context()
+	auth := r.Header.Get("Authorization")
+	started := false
+	speaker := p.newSentenceSpeaker(ctx, auth, agentID, req.ResponseFormat, req.Language, func(audio []byte) error {
+		if !started {
+			w.Header().Set("Content-Type", SpeechContentType(req.ResponseFormat))
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if _, err := w.Write(audio); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+
+	var err error
+	switch {
+	case mediaType == "text/event-stream":
+		// The body is read while audio is written, for as long as the
+		// agent runs
+		rc := http.NewResponseController(w)
+		rc.EnableFullDuplex()
+		rc.SetReadDeadline(time.Now().Add(maxStreamDuration))
+		err = msgutil.ParseSSEStream(r.Body, speaker.event)
+	case req.Input != "":
+		speaker.push(req.Input)
+	default:
+		userID := req.UserID
+		if userID == "" {
+			userID = defaultUserID
+		}
+		if err := p.api.ensureSession(ctx, auth, agentID, userID, req.SessionID); err != nil {
+			p.logger.Warn("Failed to ensure session, continuing anyway", "session", req.SessionID, "error", err)
+		}
+		err = p.api.run(ctx, auth, agentID, userID, req.SessionID, req.Message, speaker.event)
+	}
+	if speakErr := speaker.close(); err == nil {
+		err = speakErr
+	}
+
+	switch {
+	case err != nil && ctx.Err() == nil:
+		p.logger.Error("Speech stream failed", "agent", agentID, "error", err)
+		if !started {
+			writeStreamError(w, http.StatusBadGateway, err.Error())
+		}
+	case !started && ctx.Err() == nil:
+		// Nothing to say: an empty stream is still a valid answer
+		w.Header().Set("Content-Type", SpeechContentType(req.ResponseFormat))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func writeStreamError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// sentenceSpeaker splits text into sentences as it is pushed and
+// synthesizes them in order in the background, handing their audio to
+// write joined into one stream. Synthesis of a sentence overlaps with the
+// generation of the next ones.
+type sentenceSpeaker struct {
+	splitter *SentenceSplitter
+	queue    chan string
+	done     chan struct{}
+	err      error
+
+	// partial is set while an agent reply is streamed in partial events
+	partial bool
+}
+
+// newSentenceSpeaker starts a speaker for the TTS of agentID. write is
+// called from the speaker's goroutine; an error from it stops the speech.
+func (p *Pipeline) newSentenceSpeaker(ctx context.Context, auth, agentID, format, language string, write func([]byte) error) *sentenceSpeaker {
+	sp := &sentenceSpeaker{
+		splitter: NewSentenceSplitter(language),
+		queue:    make(chan string, sentenceQueueSize),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(sp.done)
+		var joined []byte
+		var wav *WAVFormat
+		for sentence := range sp.queue {
+			text := speakable(sentence)
+			if sp.err != nil || ctx.Err() != nil || text == "" {
+				continue
+			}
+			audio, err := p.api.speech(ctx, auth, agentID, text, format)
+			if err == nil {
+				joined, wav, err = joinSpeech(audio, format, wav)
+			}
+			if err == nil {
+				err = write(joined)
+			}
+			sp.err = err
+		}
+	}()
+	return sp
+}
+
+// push adds text and queues the sentences it completes.
+func (sp *sentenceSpeaker) push(text string) {
+	for _, sentence := range sp.splitter.Push(text) {
+		sp.queue <- sentence
+	}
+}
+
+// event pushes the text of an agent SSE event. A streamed reply comes as
+// partial events followed by one with the whole text, which is skipped.
+func (sp *sentenceSpeaker) event(evt msgutil.SSEEvent) {
+	if evt.Type != msgutil.SSEEventText {
+		return
+	}
+	if evt.Partial {
+		sp.partial = true
+		sp.push(evt.Text)
+		return
+	}
+	if !sp.partial {
+		sp.push(evt.Text)
+	}
+	sp.partial = false
+	// A reply always ends a sentence, even without a period
+	sp.push("\n")
+}
+
+// close speaks what is left, waits for the speech to finish and returns
+// the first error.
+func (sp *sentenceSpeaker) close() error {
+	if rest := sp.splitter.Flush(); rest != "" {
+		sp.queue <- rest
+	}
+	close(sp.queue)
+	<-sp.done
+	return sp.err
+}
+
+// joinSpeech prepares the audio of one sentence to follow the previous
+// ones in a stream of format. For WAV, the first sentence sets the format
+// of the stream and later ones are sent as bare samples.
+func joinSpeech(audio []byte, format string, stream *WAVFormat) ([]byte, *WAVFormat, error) {
+	if format != "wav" {
+		return audio, stream, nil
+	}
+	pcm, f, err := DecodeWAV(audio)
+	if err != nil {
+		return nil, stream, err
+	}
+	if stream == nil {
+		return append(wavStreamHeader(f), pcm...), &f, nil
+	}
+	if f != *stream {
+		return nil, stream, errors.New("speech changed format mid-stream")
+	}
+	return pcm, stream, nil
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LocalSTT transcribes speech in-process for backends of type "local".
+// Each model is a directory under dir holding a Whisper ONNX export; the
+// agent's transcription model names the directory. Models are loaded on
+// first use and kept loaded.
+type LocalSTT struct {
+	dir             string
+	onnxLibraryPath string
+	logger          *slog.Logger
+
+	mu     sync.Mutex
+	models map[string]*whisperModel
+}
+
+// NewLocalSTT creates a local transcriber for the models under dir.
+func NewLocalSTT(dir, onnxLibraryPath string, logger *slog.Logger) *LocalSTT {
+	return &LocalSTT{
+		dir:             dir,
+		onnxLibraryPath: onnxLibraryPath,
+		logger:          logger,
+		models:          make(map[string]*whisperModel),
+	}
+}
+
+// TranscribeWAV converts a 16-bit PCM WAV file to text with the named
+// model. An empty language lets multilingual models detect it.
+func (l *LocalSTT) TranscribeWAV(model, language string, wav []byte) (string, error) {
+	samples, err := WAVSamples(wav)
+	if err != nil {
+		return "", err
+	}
+	m, err := l.model(model)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	text, err := m.Transcribe(samples, language)
+	if err != nil {
+		return "", err
+	}
+	l.logger.Debug("Local transcription done", "model", model,
+		"audio", time.Duration(len(samples))*time.Second/TargetSampleRate,
+		"took", time.Since(start))
+	return text, nil
+}
+
+// model returns a loaded model, loading it on first use.
+func (l *LocalSTT) model(name string) (*whisperModel, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no transcription model configured")
+	}
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid transcription model %q", name)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if m, ok := l.models[name]; ok {
+		return m, nil
+	}
+
+	dir := filepath.Join(l.dir, name)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("transcription model %q not found in %s", name, l.dir)
+	}
+	if err := InitONNX(l.onnxLibraryPath); err != nil {
+		return nil, err
+	}
+	m, err := loadWhisper(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transcription model %q: %w", name, err)
+	}
+	l.models[name] = m
+	l.logger.Info("Loaded local transcription model", "model", name)
+	return m, nil
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+// LocalTTS synthesizes speech in-process for backends of type "local",
+// with the Piper voices uploaded through the Admin API. Voices are loaded
+// on first use and unloaded when they are deleted.
+type LocalTTS struct {
+	store           *store.Store
+	onnxLibraryPath string
+	logger          *slog.Logger
+
+	mu     sync.Mutex
+	voices map[string]*piperVoice
+}
+
+// NewLocalTTS creates a local synthesizer for the voices in the store.
+func NewLocalTTS(s *store.Store, onnxLibraryPath string, logger *slog.Logger) *LocalTTS {
+	return &LocalTTS{
+		store:           s,
+		onnxLibraryPath: onnxLibraryPath,
+		logger:          logger,
+		voices:          make(map[string]*piperVoice),
+	}
+}
+
+// Synthesize speaks text with a voice, found by ID or name, and returns
+// the audio encoded in format (see EncodeSpeech). An empty voice uses the
+// first one uploaded.
+func (l *LocalTTS) Synthesize(ctx context.Context, voice, text string, speed float64, format string) ([]byte, error) {
+	def, err := l.find(voice)
+	if err != nil {
+		return nil, err
+	}
+	v, err := l.voice(def.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	samples, err := v.synthesize(ctx, text, def.Speaker, speed)
+	if err != nil {
+		return nil, err
+	}
+	l.logger.Debug("Local speech done", "voice", def.Name,
+		"audio", time.Duration(len(samples))*time.Second/time.Duration(v.config.Audio.SampleRate),
+		"took", time.Since(start))
+	return EncodeSpeech(ctx, samples, v.config.Audio.SampleRate, format)
+}
+
+// find resolves a voice reference against the uploaded voices.
+func (l *LocalTTS) find(ref string) (store.TTSVoice, error) {
+	voices := l.store.ListTTSVoices()
+	if len(voices) == 0 {
+		return store.TTSVoice{}, fmt.Errorf("no voices uploaded")
+	}
+	if ref == "" {
+		return voices[0], nil
+	}
+	for _, v := range voices {
+		if v.ID == ref || strings.EqualFold(v.Name, ref) {
+			return v, nil
+		}
+	}
+	return store.TTSVoice{}, fmt.Errorf("voice %q not found", ref)
+}
+
+// voice returns a loaded voice, loading it on first use. Voices deleted
+// from the store are unloaded on the way.
+func (l *LocalTTS) voice(id string) (*piperVoice, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for cached, v := range l.voices {
+		if _, ok := l.store.GetTTSVoice(cached); !ok {
+			v.Destroy()
+			delete(l.voices, cached)
+		}
+	}
+	if v, ok := l.voices[id]; ok {
+		return v, nil
+	}
+
+	if err := InitONNX(l.onnxLibraryPath); err != nil {
+		return nil, err
+	}
+	v, err := loadPiperVoice(l.store.TTSVoiceDir(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load voice: %w", err)
+	}
+	l.voices[id] = v
+	l.logger.Info("Loaded local voice", "voice", id)
+	return v, nil
+}
+
+// speechFormats maps the response_format values of /v1/audio/speech to
+// their content type and the ffmpeg arguments that encode them. PCM is
+// 24 kHz 16-bit mono, as in the OpenAI API.
+var speechFormats = map[string]struct {
+	contentType string
+	ffmpegArgs  []string
+}{
+	"wav":  {"audio/wav", nil},
+	"mp3":  {"audio/mpeg", []string{"-c:a", "libmp3lame", "-b:a", "64k", "-f", "mp3"}},
+	"opus": {"audio/ogg", []string{"-c:a", "libopus", "-b:a", "32k", "-f", "ogg"}},
+	"aac":  {"audio/aac", []string{"-c:a", "aac", "-b:a", "64k", "-f", "adts"}},
+	"flac": {"audio/flac", []string{"-f", "flac"}},
+	"pcm":  {"audio/pcm", []string{"-ar", "24000", "-f", "s16le"}},
+}
+
+// SpeechContentType returns the content type of a speech format, or ""
+// when the format is not supported.
+func SpeechContentType(format string) string {
+	return speechFormats[format].contentType
+}
+
+// EncodeSpeech encodes mono samples in a response_format of
+// /v1/audio/speech. WAV is written directly; the other formats are
+// encoded with ffmpeg.
+func EncodeSpeech(ctx context.Context, samples []float32, sampleRate int, format string) ([]byte, error) {
+	f, ok := speechFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	wav := EncodeWAV(samples, sampleRate)
+	if f.ffmpegArgs == nil {
+		return wav, nil
+	}
+
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-f", "wav", "-i", "pipe:0", "-ac", "1"}, f.ffmpegArgs...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", append(args, "pipe:1")...)
+	cmd.Stdin = bytes.NewReader(wav)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg %s encoding failed: %w, stderr: %s", format, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
@@ -31,6 +31,13 @@ const (
 	VADWindowSamples  = 512 // ~32ms at 16kHz (Silero VAD uses 512 samples)
 	VADThreshold      = 0.5 // Speech probability threshold
 	VADSilenceTimeout = 2000 * time.Millisecond
+
+	// Barge-in: while the client plays speech, the microphone also picks up
+	// the playback, so speech must be louder and longer to count
+	VADBargeInThreshold = 0.85
+	VADBargeInMinSpeech = 300 * time.Millisecond
+
+	vadWindowDuration = VADWindowSamples * time.Second / VADSampleRate
 )
 
 // VADConfig holds configuration for voice activity detection
@@ -38,6 +45,12 @@ type VADConfig struct {
 	ModelData      []byte
 	Threshold      float32
 	SilenceTimeout time.Duration
+	// MinSpeech is how long speech must last before it starts
+	MinSpeech time.Duration
+
+	// BargeInThreshold and BargeInMinSpeech replace Threshold while playing
+	BargeInThreshold float32
+	BargeInMinSpeech time.Duration
 }
 
 // VAD implements voice activity detection using Silero VAD ONNX model
@@ -56,6 +69,11 @@ type VAD struct {
 	audioBuffer      []float32
 	mu               sync.Mutex
 
+	// Windows in a row above the threshold, until speech starts. While the
+	// client plays speech, barge-in thresholds apply
+	speechWindows int
+	playing       bool
+
 	// Callbacks
 	onSpeechStart func()
 	onSpeechEnd   func()
@@ -69,6 +87,12 @@ func NewVAD(config VADConfig, logger *slog.Logger) *VAD {
 	if config.SilenceTimeout == 0 {
 		config.SilenceTimeout = VADSilenceTimeout
 	}
+	if config.BargeInThreshold == 0 {
+		config.BargeInThreshold = VADBargeInThreshold
+	}
+	if config.BargeInMinSpeech == 0 {
+		config.BargeInMinSpeech = VADBargeInMinSpeech
+	}
 
 	return &VAD{
 		config:      config,
@@ -90,6 +114,15 @@ func (v *VAD) SetOnSpeechEnd(callback func()) {
 	v.onSpeechEnd = callback
 }
 
+// SetPlaying switches echo-tolerant detection on while the client plays
+// speech, so its own playback is not taken as the user barging in
+func (v *VAD) SetPlaying(playing bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.playing = playing
+	v.speechWindows = 0
+}
+
 // Load initializes the ONNX model
 func (v *VAD) Load() error {
 	opts, err := newLightSessionOptions()
@@ -215,6 +248,25 @@ func (v *VAD) updateState(prob float32) {
 	// Log every probability for debugging
 	v.logger.Debug("VAD inference", "prob", fmt.Sprintf("%.4f", prob), "threshold", v.config.Threshold, "speaking", v.isSpeaking)
 
+	if !v.isSpeaking {
+		// Speech must stay above the threshold for the minimum duration in a
+		// row before it starts
+		threshold, minSpeech := v.config.Threshold, v.config.MinSpeech
+		if v.playing {
+			threshold = max(threshold, v.config.BargeInThreshold)
+			minSpeech = max(minSpeech, v.config.BargeInMinSpeech)
+		}
+		if prob < threshold {
+			v.speechWindows = 0
+			return
+		}
+		v.speechWindows++
+		if time.Duration(v.speechWindows)*vadWindowDuration < minSpeech {
+			return
+		}
+		v.speechWindows = 0
+	}
+
 	if prob >= v.config.Threshold {
 		v.lastSpeechTime = time.Now()
 		if !v.isSpeaking {
@@ -244,6 +296,7 @@ func (v *VAD) Reset() {
 
 	v.audioBuffer = v.audioBuffer[:0]
 	v.isSpeaking = false
+	v.speechWindows = 0
 	// Reset LSTM states
 	for i := range v.h {
 		v.h[i] = 0
@@ -269,5 +322,7 @@ func (v *VAD) Close() {
 
 // GetConfig returns the current VAD configuration
 func (v *VAD) GetConfig() VADConfig {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	return v.config
 }
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/achetronic/magec/server/store"
+)
+
+// CustomModels reads the wake word models uploaded through the Admin API.
+// Models whose file cannot be read are skipped.
+func CustomModels(s *store.Store, logger *slog.Logger) []ModelConfig {
+	var models []ModelConfig
+	for _, ww := range s.ListWakeWords() {
+		data, err := os.ReadFile(s.WakeWordFile(ww.ID))
+		if err != nil {
+			logger.Warn("Failed to read wake word model", "model", ww.ID, "error", err)
+			continue
+		}
+		models = append(models, ModelConfig{
+			ID:        ww.ID,
+			Name:      ww.Name,
+			Data:      data,
+			Phrase:    ww.Phrase,
+			Threshold: ww.Threshold,
+		})
+	}
+	return models
+}
+
+// WatchWakeWords hot-loads uploaded wake words: every time the store changes,
+// the built-in models plus the uploaded ones are applied to the detector
+// and the handler, until the context is cancelled.
+func WatchWakeWords(ctx context.Context, s *store.Store, builtin []ModelConfig, detector *Detector, handler *Handler, logger *slog.Logger) {
+	changeCh := s.OnChange()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changeCh:
+			models := append(builtin[:len(builtin):len(builtin)], CustomModels(s, logger)...)
+			if detector.SetModels(models) {
+				logger.Info("Wake word models reloaded", "models", len(models))
+			}
+			handler.SetModels(models)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// EncodeWAV wraps mono float32 samples in a 16-bit PCM WAV file.
+func EncodeWAV(samples []float32, sampleRate int) []byte {
+	pcm := floatToInt16(samples)
+	dataSize := len(pcm) * 2
+
+	var buf bytes.Buffer
+	buf.Grow(44 + dataSize)
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))           // fmt chunk size
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // mono
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))   // sample rate
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2)) // byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(2))            // block align
+	binary.Write(&buf, binary.LittleEndian, uint16(16))           // bits per sample
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	binary.Write(&buf, binary.LittleEndian, pcm)
+	return buf.Bytes()
+}
+
+// wavStreamHeader is the header of a WAV stream of unknown length. Sizes
+// are set to the maximum, which players read as "until the end".
+func wavStreamHeader(f WAVFormat) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xFFFFFFFF))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1))
+	binary.Write(&buf, binary.LittleEndian, uint16(f.Channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(f.Rate))
+	binary.Write(&buf, binary.LittleEndian, uint32(f.Rate*f.Width*f.Channels))
+	binary.Write(&buf, binary.LittleEndian, uint16(f.Width*f.Channels))
+	binary.Write(&buf, binary.LittleEndian, uint16(f.Width*8))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xFFFFFFFF))
+	return buf.Bytes()
+}
+
+// WAVFormat describes the PCM samples of a WAV file.
+type WAVFormat struct {
+	Rate     int // samples per second
+	Width    int // bytes per sample
+	Channels int
+}
+
+// DecodeWAV returns the PCM data of a WAV file and its format. Streaming
+// encoders write a placeholder data size, so the data chunk is allowed to
+// run to the end of the file.
+func DecodeWAV(data []byte) ([]byte, WAVFormat, error) {
+	var format WAVFormat
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, format, errors.New("not a WAV file")
+	}
+
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, format, errors.New("truncated fmt chunk")
+			}
+			if binary.LittleEndian.Uint16(body[0:2]) != 1 {
+				return nil, format, errors.New("WAV is not PCM")
+			}
+			format.Channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			format.Rate = int(binary.LittleEndian.Uint32(body[4:8]))
+			format.Width = int(binary.LittleEndian.Uint16(body[14:16])) / 8
+		case "data":
+			if format.Rate == 0 {
+				return nil, format, errors.New("data chunk before fmt chunk")
+			}
+			if size > len(body) {
+				size = len(body)
+			}
+			return body[:size], format, nil
+		}
+		if size > len(body) {
+			break
+		}
+		pos += 8 + size + size%2
+	}
+	return nil, format, errors.New("WAV has no data chunk")
+}
+
+// WAVSamples decodes a 16-bit PCM WAV file to mono float32 samples at
+// TargetSampleRate, keeping the first channel.
+func WAVSamples(data []byte) ([]float32, error) {
+	pcm, format, err := DecodeWAV(data)
+	if err != nil {
+		return nil, err
+	}
+	if format.Width != 2 {
+		return nil, errors.New("only 16-bit WAV is supported")
+	}
+	if format.Channels < 1 {
+		format.Channels = 1
+	}
+	frame := 2 * format.Channels
+	samples := make([]float32, len(pcm)/frame)
+	for i := range samples {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(pcm[i*frame:]))) / 32768
+	}
+	if format.Rate == TargetSampleRate {
+		return samples, nil
+	}
+	var out []float32
+	for _, f := range NewResampler(format.Rate, TargetSampleRate, melStepSamples).Process(samples) {
+		out = append(out, f...)
+	}
+	return out, nil
+}
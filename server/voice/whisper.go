@@ -0,0 +1,424 @@
+/*
+ * Copyright 2025 Alby Hernández
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package voice
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// whisperModel runs a Whisper model exported to ONNX in the sherpa-onnx
+// layout: an encoder, a decoder with a self-attention cache and a tokens
+// file, with the model dimensions in the encoder's metadata.
+type whisperModel struct {
+	encoder *ort.DynamicAdvancedSession
+	decoder *ort.DynamicAdvancedSession
+	mel     *melBank
+	tokens  map[int64][]byte
+
+	textLayers   int64
+	textCtx      int64
+	textState    int64
+	sot          int64
+	eot          int64
+	transcribe   int64
+	noTimestamps int64
+	multilingual bool
+	// languages maps language codes ("en", "es"...) to their tokens
+	languages map[string]int64
+
+	// mu runs one transcription at a time; each already uses several cores
+	mu sync.Mutex
+}
+
+// loadWhisper loads the Whisper model in dir. The first *encoder*.onnx,
+// *decoder*.onnx and *tokens.txt files are used, preferring int8
+// quantized models, which are faster on CPU.
+func loadWhisper(dir string) (*whisperModel, error) {
+	encoderPath, err := findModelFile(dir, "*encoder*.onnx")
+	if err != nil {
+		return nil, err
+	}
+	decoderPath, err := findModelFile(dir, "*decoder*.onnx")
+	if err != nil {
+		return nil, err
+	}
+	tokensPath, err := findModelFile(dir, "*tokens.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	w := &whisperModel{languages: make(map[string]int64)}
+	if err := w.readMetadata(encoderPath); err != nil {
+		return nil, err
+	}
+	if w.tokens, err = readWhisperTokens(tokensPath); err != nil {
+		return nil, err
+	}
+
+	opts, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, err
+	}
+	defer opts.Destroy()
+	if err := opts.SetIntraOpNumThreads(min(runtime.NumCPU(), 4)); err != nil {
+		return nil, err
+	}
+
+	w.encoder, err = ort.NewDynamicAdvancedSession(encoderPath,
+		[]string{"mel"},
+		[]string{"n_layer_cross_k", "n_layer_cross_v"},
+		opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encoder: %w", err)
+	}
+	w.decoder, err = ort.NewDynamicAdvancedSession(decoderPath,
+		[]string{"tokens", "in_n_layer_self_k_cache", "in_n_layer_self_v_cache", "n_layer_cross_k", "n_layer_cross_v", "offset"},
+		[]string{"logits", "out_n_layer_self_k_cache", "out_n_layer_self_v_cache"},
+		opts)
+	if err != nil {
+		w.encoder.Destroy()
+		return nil, fmt.Errorf("failed to load decoder: %w", err)
+	}
+	return w, nil
+}
+
+// findModelFile returns the file in dir matching pattern, preferring int8
+// models when there are several.
+func findModelFile(dir, pattern string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no %s file in %s", pattern, dir)
+	}
+	slices.Sort(matches)
+	for _, m := range matches {
+		if strings.Contains(filepath.Base(m), ".int8.") {
+			return m, nil
+		}
+	}
+	return matches[0], nil
+}
+
+// readMetadata reads the model dimensions and special tokens.
+func (w *whisperModel) readMetadata(encoderPath string) error {
+	md, err := ort.GetModelMetadata(encoderPath)
+	if err != nil {
+		return fmt.Errorf("failed to read model metadata: %w", err)
+	}
+	defer md.Destroy()
+
+	lookup := func(key string) (string, error) {
+		v, ok, err := md.LookupCustomMetadataMap(key)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("model metadata has no %q; is it a sherpa-onnx Whisper export?", key)
+		}
+		return v, nil
+	}
+	ints := map[string]*int64{
+		"n_text_layer":  &w.textLayers,
+		"n_text_ctx":    &w.textCtx,
+		"n_text_state":  &w.textState,
+		"sot":           &w.sot,
+		"eot":           &w.eot,
+		"transcribe":    &w.transcribe,
+		"no_timestamps": &w.noTimestamps,
+	}
+	for key, dst := range ints {
+		v, err := lookup(key)
+		if err != nil {
+			return err
+		}
+		if *dst, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("invalid %s in model metadata: %w", key, err)
+		}
+	}
+
+	nMels := int64(80)
+	if v, err := lookup("n_mels"); err == nil {
+		if nMels, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("invalid n_mels in model metadata: %w", err)
+		}
+	}
+	w.mel = newMelBank(int(nMels))
+
+	if v, err := lookup("is_multilingual"); err == nil && v == "1" {
+		w.multilingual = true
+		codes, err1 := lookup("all_language_codes")
+		tokens, err2 := lookup("all_language_tokens")
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("multilingual model without language tokens")
+		}
+		codeList, tokenList := strings.Split(codes, ","), strings.Split(tokens, ",")
+		if len(codeList) != len(tokenList) {
+			return fmt.Errorf("model has %d language codes and %d language tokens", len(codeList), len(tokenList))
+		}
+		for i, code := range codeList {
+			token, err := strconv.ParseInt(strings.TrimSpace(tokenList[i]), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid language token in model metadata: %w", err)
+			}
+			w.languages[strings.TrimSpace(code)] = token
+		}
+	}
+	return nil
+}
+
+// readWhisperTokens reads a tokens file: one base64-encoded token and its
+// ID per line.
+func readWhisperTokens(path string) (map[int64][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := make(map[int64][]byte)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		id, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		text, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			continue
+		}
+		tokens[id] = text
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens in %s", path)
+	}
+	return tokens, nil
+}
+
+// Destroy releases the ONNX sessions.
+func (w *whisperModel) Destroy() {
+	w.encoder.Destroy()
+	w.decoder.Destroy()
+}
+
+// Transcribe converts 16 kHz audio to text. Audio longer than 30 seconds
+// is transcribed in consecutive 30 second chunks. With an empty language,
+// multilingual models detect it from the first chunk.
+func (w *whisperModel) Transcribe(samples []float32, language string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var parts []string
+	for start := 0; start < len(samples); start += whisperChunkSamples {
+		end := min(start+whisperChunkSamples, len(samples))
+		text, lang, err := w.transcribeChunk(samples[start:end], language)
+		if err != nil {
+			return "", err
+		}
+		language = lang
+		if text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// transcribeChunk transcribes up to 30 seconds of audio with greedy
+// decoding and returns the text and the language used.
+func (w *whisperModel) transcribeChunk(samples []float32, language string) (string, string, error) {
+	mel, err := ort.NewTensor(ort.NewShape(1, int64(w.mel.nMels), whisperFrames), w.mel.logMel(samples))
+	if err != nil {
+		return "", "", err
+	}
+	defer mel.Destroy()
+
+	cross := []ort.Value{nil, nil}
+	if err := w.encoder.Run([]ort.Value{mel}, cross); err != nil {
+		return "", "", fmt.Errorf("encoder failed: %w", err)
+	}
+	defer destroyValues(cross)
+
+	prompt := []int64{w.sot}
+	if w.multilingual {
+		token, ok := w.languages[language]
+		if !ok {
+			if token, err = w.detectLanguage(cross); err != nil {
+				return "", "", err
+			}
+			for code, t := range w.languages {
+				if t == token {
+					language = code
+				}
+			}
+		}
+		prompt = append(prompt, token, w.transcribe)
+	}
+	prompt = append(prompt, w.noTimestamps)
+
+	dec, err := w.newDecoding(cross)
+	if err != nil {
+		return "", "", err
+	}
+	defer dec.destroy()
+
+	logits, err := dec.step(prompt)
+	if err != nil {
+		return "", "", err
+	}
+	var text []byte
+	// Half the context is Whisper's own limit for one chunk
+	for n := int64(0); n < w.textCtx/2; n++ {
+		next := argmax(logits)
+		if next == w.eot {
+			break
+		}
+		// Special and timestamp tokens come after the end of text token
+		if next < w.eot {
+			text = append(text, w.tokens[next]...)
+		}
+		if logits, err = dec.step([]int64{next}); err != nil {
+			return "", "", err
+		}
+	}
+	return strings.TrimSpace(string(text)), language, nil
+}
+
+// detectLanguage returns the most likely language token after the start
+// of transcript token.
+func (w *whisperModel) detectLanguage(cross []ort.Value) (int64, error) {
+	dec, err := w.newDecoding(cross)
+	if err != nil {
+		return 0, err
+	}
+	defer dec.destroy()
+
+	logits, err := dec.step([]int64{w.sot})
+	if err != nil {
+		return 0, err
+	}
+	best, bestScore := int64(-1), float32(0)
+	for _, token := range w.languages {
+		if int(token) < len(logits) && (best < 0 || logits[token] > bestScore) {
+			best, bestScore = token, logits[token]
+		}
+	}
+	if best < 0 {
+		return 0, fmt.Errorf("could not detect the language")
+	}
+	return best, nil
+}
+
+// whisperDecoding is one run of the decoder with its self-attention cache.
+type whisperDecoding struct {
+	model  *whisperModel
+	cross  []ort.Value
+	cache  []ort.Value // self k, self v
+	offset int64
+}
+
+func (w *whisperModel) newDecoding(cross []ort.Value) (*whisperDecoding, error) {
+	shape := ort.NewShape(w.textLayers, 1, w.textCtx, w.textState)
+	k, err := ort.NewEmptyTensor[float32](shape)
+	if err != nil {
+		return nil, err
+	}
+	v, err := ort.NewEmptyTensor[float32](shape)
+	if err != nil {
+		k.Destroy()
+		return nil, err
+	}
+	return &whisperDecoding{model: w, cross: cross, cache: []ort.Value{k, v}}, nil
+}
+
+// step feeds tokens to the decoder and returns the logits after the last one.
+func (d *whisperDecoding) step(tokens []int64) ([]float32, error) {
+	if d.offset+int64(len(tokens)) > d.model.textCtx {
+		return nil, fmt.Errorf("transcript is longer than the model context")
+	}
+	tokenTensor, err := ort.NewTensor(ort.NewShape(1, int64(len(tokens))), tokens)
+	if err != nil {
+		return nil, err
+	}
+	defer tokenTensor.Destroy()
+	offset, err := ort.NewTensor(ort.NewShape(1), []int64{d.offset})
+	if err != nil {
+		return nil, err
+	}
+	defer offset.Destroy()
+
+	outputs := []ort.Value{nil, nil, nil}
+	inputs := []ort.Value{tokenTensor, d.cache[0], d.cache[1], d.cross[0], d.cross[1], offset}
+	if err := d.model.decoder.Run(inputs, outputs); err != nil {
+		return nil, fmt.Errorf("decoder failed: %w", err)
+	}
+	defer outputs[0].Destroy()
+
+	destroyValues(d.cache)
+	d.cache = outputs[1:]
+	d.offset += int64(len(tokens))
+
+	logits, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("unexpected decoder output type")
+	}
+	data := logits.GetData()
+	vocab := len(data) / len(tokens)
+	return slices.Clone(data[len(data)-vocab:]), nil
+}
+
+func (d *whisperDecoding) destroy() {
+	destroyValues(d.cache)
+}
+
+// destroyValues releases ONNX values, skipping unset ones.
+func destroyValues(values []ort.Value) {
+	for _, v := range values {
+		if v != nil {
+			v.Destroy()
+		}
+	}
+}
+
+// argmax returns the index of the largest value.
+func argmax(values []float32) int64 {
+	best := 0
+	for i, v := range values {
+		if v > values[best] {
+			best = i
+		}
+	}
+	return int64(best)
+}